@@ -0,0 +1,188 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Action statuses reported in ActionResult.Status.
+const (
+	ActionPending    = "pending"    // accepted, still running
+	ActionDone       = "done"       // finished without error
+	ActionFailed     = "error"      // finished with an error, see ActionResult.Error
+	ActionDispatched = "dispatched" // handed to a TUI or handler that does not report results
+)
+
+// ActionReporter is implemented by handlers whose actions finish after the
+// call returns, e.g. an Execute that starts a background run. RunAction
+// replaces Execute/Change for remote actions and must call done exactly once,
+// when the work has finished; a non-nil error marks the action failed.
+type ActionReporter interface {
+	RunAction(value string, done func(error))
+}
+
+// ActionRedactor is implemented by handlers whose action values may hold
+// secrets. The action result, served to any client that asks for it,
+// records RedactActionValue(value) instead of the value.
+type ActionRedactor interface {
+	RedactActionValue(value string) string
+}
+
+// actionHistory bounds how many finished actions ActionTracker remembers.
+const actionHistory = 100
+
+// ActionResult is the JSON form of one dispatched action.
+type ActionResult struct {
+	ID       string   `json:"id"`
+	Key      string   `json:"key"`
+	Value    string   `json:"value"`
+	Handler  string   `json:"handler"`
+	Status   string   `json:"status"`
+	Error    string   `json:"error,omitempty"`
+	NewValue string   `json:"new_value"`          // handler Value() after the action
+	Logs     []string `json:"logs,omitempty"`     // lines the handler logged while running
+	Started  string   `json:"started"`            // RFC3339
+	Duration string   `json:"duration,omitempty"` // set once finished
+}
+
+// JSON encodes r; ActionResult only holds strings so encoding cannot fail.
+func (r ActionResult) JSON() []byte {
+	b, _ := json.Marshal(r)
+	return b
+}
+
+// Action tracks a single dispatched action until it finishes.
+type Action struct {
+	mu       sync.Mutex
+	result   ActionResult
+	started  time.Time
+	done     chan struct{}
+	finished bool
+}
+
+// ID returns the identifier used by GET /tinywasm/action/{id}.
+func (a *Action) ID() string { return a.result.ID }
+
+// Done is closed once the action has finished.
+func (a *Action) Done() <-chan struct{} { return a.done }
+
+// Result returns a snapshot of the action state.
+func (a *Action) Result() ActionResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r := a.result
+	r.Logs = append([]string(nil), a.result.Logs...)
+	return r
+}
+
+// Wait blocks until the action finishes or timeout elapses and returns its state.
+func (a *Action) Wait(timeout time.Duration) ActionResult {
+	select {
+	case <-a.done:
+	case <-time.After(timeout):
+	}
+	return a.Result()
+}
+
+// log records a line the handler emitted while the action was running.
+func (a *Action) log(msg string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.finished {
+		return
+	}
+	a.result.Logs = append(a.result.Logs, msg)
+}
+
+// finish records the outcome; a non-nil err turns ActionDone into ActionFailed.
+func (a *Action) finish(status string, err error, newValue string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.finished {
+		return
+	}
+	a.finished = true
+	if err != nil {
+		a.result.Error = err.Error()
+		if status == ActionDone {
+			status = ActionFailed
+		}
+	}
+	a.result.Status = status
+	a.result.NewValue = newValue
+	a.result.Duration = time.Since(a.started).Round(time.Millisecond).String()
+	close(a.done)
+}
+
+// unknownActionMessage returns the JSON string reporting an unregistered key.
+func unknownActionMessage(key string) string {
+	b, _ := json.Marshal("unknown action key: " + key)
+	return string(b)
+}
+
+// ActionTracker assigns ids to dispatched actions and keeps the latest
+// results so they can be queried after the fact. One tracker is shared by
+// every project the daemon runs, so ids stay unique across restarts.
+type ActionTracker struct {
+	mu      sync.Mutex
+	seq     uint64
+	actions map[string]*Action
+	order   []string
+}
+
+// NewActionTracker creates an empty ActionTracker.
+func NewActionTracker() *ActionTracker {
+	return &ActionTracker{actions: map[string]*Action{}}
+}
+
+// begin registers a pending action for key handled by handler.
+func (t *ActionTracker) begin(key, value, handler string) *Action {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	now := time.Now()
+	a := &Action{
+		started: now,
+		done:    make(chan struct{}),
+		result: ActionResult{
+			ID:      fmt.Sprintf("act-%d", t.seq),
+			Key:     key,
+			Value:   value,
+			Handler: handler,
+			Status:  ActionPending,
+			Started: now.Format(time.RFC3339),
+		},
+	}
+	t.actions[a.result.ID] = a
+	t.order = append(t.order, a.result.ID)
+	if len(t.order) > actionHistory {
+		delete(t.actions, t.order[0])
+		t.order = t.order[1:]
+	}
+	return a
+}
+
+// Run tracks fn as an action executed synchronously by the caller's goroutine.
+// Used for daemon-level keys (start, stop, restart, quit).
+func (t *ActionTracker) Run(key, value, handler string, fn func() error) *Action {
+	a := t.begin(key, value, handler)
+	a.finish(ActionDone, fn(), "")
+	return a
+}
+
+// Dispatched records an action handed to a TUI that cannot report its outcome.
+func (t *ActionTracker) Dispatched(key, value string) *Action {
+	a := t.begin(key, value, "")
+	a.finish(ActionDispatched, nil, "")
+	return a
+}
+
+// Get returns the action with the given id, if it is still in the history.
+func (t *ActionTracker) Get(id string) (*Action, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a, ok := t.actions[id]
+	return a, ok
+}
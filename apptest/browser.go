@@ -0,0 +1,80 @@
+package apptest
+
+import (
+	"sync"
+
+	"github.com/tinywasm/mcp"
+)
+
+// Browser implements app.BrowserInterface without launching a real browser.
+// It records every Reload and OpenBrowser call so tests can assert on them.
+type Browser struct {
+	ReloadErr error // returned by Reload when set
+
+	mu            sync.Mutex
+	reloads       int
+	opens         int
+	lastOpenPort  string
+	lastOpenHttps bool
+	logFunc       func(message ...any)
+}
+
+// NewBrowser creates a Browser with no recorded calls.
+func NewBrowser() *Browser {
+	return &Browser{}
+}
+
+// Reloads returns how many times Reload was called.
+func (b *Browser) Reloads() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reloads
+}
+
+// Opens returns how many times OpenBrowser was called.
+func (b *Browser) Opens() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.opens
+}
+
+// LastOpen returns the arguments of the latest OpenBrowser call.
+func (b *Browser) LastOpen() (port string, https bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastOpenPort, b.lastOpenHttps
+}
+
+func (b *Browser) Reload() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reloads++
+	return b.ReloadErr
+}
+
+func (b *Browser) OpenBrowser(port string, https bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.opens++
+	b.lastOpenPort = port
+	b.lastOpenHttps = https
+	if b.logFunc != nil {
+		b.logFunc("apptest: OpenBrowser called with port", port, "https", https)
+	}
+}
+
+func (b *Browser) SetLog(f func(message ...any)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.logFunc = f
+}
+
+func (b *Browser) GetLog() func(message ...any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.logFunc
+}
+
+func (b *Browser) GetMCPTools() []mcp.Tool {
+	return []mcp.Tool{}
+}
@@ -0,0 +1,252 @@
+// Package apptest runs the tinywasm build pipeline in-process for end-to-end
+// tests of downstream modules. It provides a recording Browser, a port-less
+// MemoryServer, a MemoryStore-backed DB and a temporary project scaffolder,
+// plus helpers to edit files and await compile and reload events.
+//
+//	p := apptest.NewProject(t, "example.com/demo", nil)
+//	env := apptest.Start(t, p, nil)
+//	env.Edit("web/client.go", newSource)
+//	if err := env.WaitCompile(30 * time.Second); err != nil {
+//		t.Fatal(err)
+//	}
+package apptest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/app"
+	"github.com/tinywasm/devflow"
+)
+
+// ErrTimeout is returned by the Wait helpers when the event did not happen in time.
+var ErrTimeout = errors.New("apptest: timeout")
+
+// Config customizes Start. Every field is optional.
+type Config struct {
+	Browser       app.BrowserInterface   // default: NewBrowser()
+	ServerFactory app.ServerFactory      // default: returns a NewMemoryServer()
+	DB            app.DB                 // default: NewDB(project dir)
+	GitClient     devflow.GitClient      // default: GitClient{}
+	GoModHandler  devflow.GoModInterface // default: devflow.NewGoModHandler()
+	Options       *app.Options           // default: app.TestOptions(project dir)
+	Logger        func(messages ...any)  // receives every log line in addition to Env.Logs
+	ReadyTimeout  time.Duration          // how long Start waits for the watcher (default 30s)
+}
+
+// Env is a running project started by Start.
+type Env struct {
+	t       testing.TB
+	Project *Project
+	Handler *app.Handler
+	Browser *Browser      // nil when Config.Browser is not an *apptest.Browser
+	Server  *MemoryServer // nil when Config.ServerFactory is set
+	DB      app.DB
+	Logs    *Logs
+
+	exit     chan bool
+	done     chan struct{}
+	stopOnce sync.Once
+	compiles chan error
+	mark     int // Browser.Reloads() at the last Edit
+}
+
+// Start runs the project headlessly (no MCP listener, no TUI) and waits until
+// the file watcher is listening. The project is stopped on t.Cleanup.
+func Start(t testing.TB, p *Project, cfg *Config) *Env {
+	t.Helper()
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	env := &Env{
+		t:        t,
+		Project:  p,
+		Logs:     &Logs{},
+		exit:     make(chan bool),
+		done:     make(chan struct{}),
+		compiles: make(chan error, 16),
+	}
+
+	logger := env.Logs.Add
+	if cfg.Logger != nil {
+		logger = func(messages ...any) {
+			env.Logs.Add(messages...)
+			cfg.Logger(messages...)
+		}
+	}
+
+	browser := cfg.Browser
+	if browser == nil {
+		browser = NewBrowser()
+	}
+	env.Browser, _ = browser.(*Browser)
+
+	factory := cfg.ServerFactory
+	if factory == nil {
+		env.Server = NewMemoryServer()
+		factory = func(chan bool, app.TuiInterface, app.BrowserInterface) app.ServerInterface {
+			return env.Server
+		}
+	}
+
+	env.DB = cfg.DB
+	if env.DB == nil {
+		env.DB = NewDB(p.Dir, logger)
+	}
+	var git devflow.GitClient = GitClient{}
+	if cfg.GitClient != nil {
+		git = cfg.GitClient
+	}
+	goMod := cfg.GoModHandler
+	if goMod == nil {
+		goMod = devflow.NewGoModHandler()
+	}
+	opts := app.TestOptions(p.Dir)
+	if cfg.Options != nil {
+		opts = *cfg.Options
+		if opts.ID == "" {
+			opts.ID = p.Dir
+		}
+	}
+	timeout := cfg.ReadyTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	go func() {
+		defer close(env.done)
+		app.Start(p.Dir, logger, app.NewHeadlessTUI(logger), browser, env.DB, env.exit, factory,
+			devflow.NewMockGitHubAuth(), git, goMod, true, false, opts, nil)
+	}()
+	t.Cleanup(env.Stop)
+
+	env.Handler = app.WaitForHandler(opts.ID, timeout)
+	if env.Handler == nil {
+		t.Fatalf("apptest: project %s did not start within %s\n%s", p.Dir, timeout, env.Logs)
+	}
+	env.Handler.WasmClient.SetOnCompile(func(err error) {
+		select {
+		case env.compiles <- err:
+		default: // nobody is waiting; drop rather than block the watcher
+		}
+	})
+	if err := env.WaitLog("Listening for File Changes", timeout); err != nil {
+		t.Fatalf("apptest: watcher not ready: %v\n%s", err, env.Logs)
+	}
+	return env
+}
+
+// Stop shuts the project down and waits for Start to return. Safe to call twice.
+func (e *Env) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.exit)
+		select {
+		case <-e.done:
+		case <-time.After(10 * time.Second):
+			e.t.Logf("apptest: project %s did not stop within 10s", e.Project.Dir)
+		}
+	})
+}
+
+// Edit writes rel inside the project and marks the current reload count,
+// so the next WaitReload only returns for reloads caused after this edit.
+func (e *Env) Edit(rel, content string) {
+	e.t.Helper()
+	if e.Browser != nil {
+		e.mark = e.Browser.Reloads()
+	}
+	e.drainCompiles()
+	e.Project.WriteFile(rel, content)
+}
+
+// WaitCompile waits for the next wasm compilation triggered by a file event
+// and returns its error, or ErrTimeout.
+func (e *Env) WaitCompile(timeout time.Duration) error {
+	select {
+	case err := <-e.compiles:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("%w waiting for wasm compile after %s", ErrTimeout, timeout)
+	}
+}
+
+// WaitReload waits until the browser was reloaded after the last Edit.
+// It requires the default apptest Browser.
+func (e *Env) WaitReload(timeout time.Duration) error {
+	if e.Browser == nil {
+		return errors.New("apptest: WaitReload needs an *apptest.Browser")
+	}
+	return poll(timeout, "browser reload", func() bool { return e.Browser.Reloads() > e.mark })
+}
+
+// WaitLog waits until a log line containing substr was produced.
+func (e *Env) WaitLog(substr string, timeout time.Duration) error {
+	return poll(timeout, fmt.Sprintf("log %q", substr), func() bool { return e.Logs.Contains(substr) })
+}
+
+func (e *Env) drainCompiles() {
+	for {
+		select {
+		case <-e.compiles:
+		default:
+			return
+		}
+	}
+}
+
+func poll(timeout time.Duration, what string, cond func() bool) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return nil
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return fmt.Errorf("%w waiting for %s after %s", ErrTimeout, what, timeout)
+}
+
+// Logs is a thread-safe log sink shared by every component of the project.
+type Logs struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+// Add records one log line; it matches the func(...any) logger signature.
+func (l *Logs) Add(messages ...any) {
+	parts := make([]string, len(messages))
+	for i, m := range messages {
+		parts[i] = fmt.Sprint(m)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, strings.Join(parts, " "))
+}
+
+// Lines returns a copy of the recorded lines.
+func (l *Logs) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+// Contains reports whether any recorded line contains substr.
+func (l *Logs) Contains(substr string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns all lines joined by newlines.
+func (l *Logs) String() string {
+	return strings.Join(l.Lines(), "\n")
+}
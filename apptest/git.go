@@ -0,0 +1,26 @@
+package apptest
+
+import "github.com/tinywasm/devflow"
+
+// GitClient implements devflow.GitClient as a no-op so tests never touch
+// a real repository or remote.
+type GitClient struct{}
+
+func (GitClient) CheckRemoteAccess() error { return nil }
+func (GitClient) Push(message, tag string) (devflow.PushResult, error) {
+	return devflow.PushResult{}, nil
+}
+func (GitClient) GetLatestTag() (string, error)         { return "v0.0.0", nil }
+func (GitClient) SetLog(fn func(...any))                {}
+func (GitClient) SetShouldWrite(fn func() bool)         {}
+func (GitClient) SetRootDir(path string)                {}
+func (GitClient) GitIgnoreAdd(entry string) error       { return nil }
+func (GitClient) GetConfigUserName() (string, error)    { return "apptest", nil }
+func (GitClient) GetConfigUserEmail() (string, error)   { return "apptest@example.com", nil }
+func (GitClient) InitRepo(dir string) error             { return nil }
+func (GitClient) Add() error                            { return nil }
+func (GitClient) Commit(message string) (bool, error)   { return true, nil }
+func (GitClient) CreateTag(tag string) (bool, error)    { return true, nil }
+func (GitClient) PushWithTags(tag string) (bool, error) { return true, nil }
+func (GitClient) PushWithoutTags() (bool, error)        { return true, nil }
+func (GitClient) HasPendingChanges() (bool, error)      { return false, nil }
@@ -0,0 +1,94 @@
+package apptest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tinywasm/app"
+	"github.com/tinywasm/kvdb"
+)
+
+// DefaultClient is the web/client.go written by NewProject.
+const DefaultClient = `//go:build wasm
+
+package main
+
+func main() {
+	select {}
+}
+`
+
+// Project is a temporary tinywasm project on disk.
+type Project struct {
+	t      testing.TB
+	Dir    string      // absolute project root (contains go.mod)
+	Module string      // module path declared in go.mod
+	Config *app.Config // conventional paths resolved against Dir
+}
+
+// NewProject scaffolds a project in a fresh t.TempDir(): go.mod, the default
+// web/client.go and web/public/index.html. files overrides or adds entries,
+// keyed by slash-separated paths relative to the project root.
+func NewProject(t testing.TB, module string, files map[string]string) *Project {
+	t.Helper()
+	dir := t.TempDir()
+	p := &Project{
+		t:      t,
+		Dir:    dir,
+		Module: module,
+		Config: app.NewConfig(dir, func(...any) {}),
+	}
+
+	defaults := map[string]string{
+		"go.mod": "module " + module + "\n\ngo 1.25\n",
+		filepath.ToSlash(filepath.Join(p.Config.WebDir(), p.Config.ClientFileName())): DefaultClient,
+		filepath.ToSlash(filepath.Join(p.Config.WebPublicDir(), "index.html")):        "<html><body></body></html>",
+	}
+	for name, content := range defaults {
+		if _, ok := files[name]; !ok {
+			p.WriteFile(name, content)
+		}
+	}
+	for name, content := range files {
+		p.WriteFile(name, content)
+	}
+	return p
+}
+
+// Path returns the absolute path of rel inside the project.
+func (p *Project) Path(rel string) string {
+	return filepath.Join(p.Dir, filepath.FromSlash(rel))
+}
+
+// WriteFile creates or overwrites rel, creating parent directories as needed.
+func (p *Project) WriteFile(rel, content string) {
+	p.t.Helper()
+	path := p.Path(rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		p.t.Fatalf("apptest: mkdir for %s: %v", rel, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		p.t.Fatalf("apptest: write %s: %v", rel, err)
+	}
+}
+
+// ReadFile returns the content of rel, failing the test if it can't be read.
+func (p *Project) ReadFile(rel string) string {
+	p.t.Helper()
+	data, err := os.ReadFile(p.Path(rel))
+	if err != nil {
+		p.t.Fatalf("apptest: read %s: %v", rel, err)
+	}
+	return string(data)
+}
+
+// NewDB returns a kvdb backed by app.MemoryStore, keyed under dir/.env
+// so nothing is written to disk.
+func NewDB(dir string, logger func(...any)) app.DB {
+	if logger == nil {
+		logger = func(...any) {}
+	}
+	db, _ := kvdb.New(filepath.Join(dir, ".env"), logger, app.NewMemoryStore())
+	return db
+}
@@ -0,0 +1,119 @@
+package apptest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// MemoryServer implements app.ServerInterface without binding a port.
+// Routes registered by the build pipeline (assets, wasm) land on an internal
+// mux that tests reach through ServeHTTP or Get.
+type MemoryServer struct {
+	mu       sync.Mutex
+	mux      *http.ServeMux
+	starts   int
+	restarts int
+	running  bool
+	log      func(message ...any)
+}
+
+// NewMemoryServer creates a MemoryServer with an empty mux.
+func NewMemoryServer() *MemoryServer {
+	return &MemoryServer{mux: http.NewServeMux()}
+}
+
+// StartServer marks the server as running. It does not block.
+func (s *MemoryServer) StartServer(wg *sync.WaitGroup) {
+	s.mu.Lock()
+	s.starts++
+	s.running = true
+	s.mu.Unlock()
+	if wg != nil {
+		wg.Done()
+	}
+}
+
+func (s *MemoryServer) StopServer() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = false
+	return nil
+}
+
+func (s *MemoryServer) RestartServer() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restarts++
+	s.running = true
+	return nil
+}
+
+// NewFileEvent is a no-op: there is no server binary to rebuild.
+func (s *MemoryServer) NewFileEvent(fileName, extension, filePath, event string) error {
+	return nil
+}
+
+func (s *MemoryServer) UnobservedFiles() []string     { return []string{} }
+func (s *MemoryServer) SupportedExtensions() []string { return []string{} }
+func (s *MemoryServer) MainInputFileRelativePath() string {
+	return "server.go"
+}
+
+func (s *MemoryServer) Name() string  { return "MemoryServer" }
+func (s *MemoryServer) Label() string { return "Server" }
+
+func (s *MemoryServer) Value() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return "running"
+	}
+	return "stopped"
+}
+
+func (s *MemoryServer) Change(v string) {}
+func (s *MemoryServer) RefreshUI()      {}
+
+func (s *MemoryServer) SetLog(f func(message ...any)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = f
+}
+
+// RegisterRoutes applies fn to the internal mux immediately.
+func (s *MemoryServer) RegisterRoutes(fn func(*http.ServeMux)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.mux)
+}
+
+// ServeHTTP serves a request against the registered routes.
+func (s *MemoryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Get performs an in-process GET and returns the status code and body.
+func (s *MemoryServer) Get(path string) (int, []byte) {
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	res := rec.Result()
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	return res.StatusCode, body
+}
+
+// Starts returns how many times StartServer was called.
+func (s *MemoryServer) Starts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.starts
+}
+
+// Restarts returns how many times RestartServer was called.
+func (s *MemoryServer) Restarts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restarts
+}
@@ -0,0 +1,405 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoreKeyArtifactsKeep sets how many artifacts are kept per target (default 5).
+const StoreKeyArtifactsKeep = "TINYWASM_ARTIFACTS_KEEP"
+
+// ArtifactsIndexFile lists the kept artifacts, oldest first.
+const ArtifactsIndexFile = "index.json"
+
+const defaultArtifactsKeep = 5
+
+// Artifact targets.
+const (
+	ArtifactWasm   = "wasm"
+	ArtifactServer = "server"
+)
+
+// Artifact is one successful build output kept on disk.
+type Artifact struct {
+	ID      string    `json:"id"`     // e.g. "wasm-12"
+	Target  string    `json:"target"` // ArtifactWasm or ArtifactServer
+	Time    time.Time `json:"time"`
+	File    string    `json:"file"` // absolute path of the kept copy
+	Size    int       `json:"size"`
+	Hash    string    `json:"hash"`           // sha256 prefix of the content
+	Mode    string    `json:"mode,omitempty"` // WasmClient size mode (wasm only)
+	Commit  string    `json:"commit,omitempty"`
+	Dirty   bool      `json:"dirty,omitempty"`   // uncommitted changes at build time
+	Trigger string    `json:"trigger,omitempty"` // edited file that caused the build
+}
+
+// ArtifactStore keeps the last N successful builds per target with their git
+// state, and can pin a previous wasm build so the dev server serves it instead
+// of the latest one until unpinned.
+type ArtifactStore struct {
+	mu         sync.Mutex
+	dir        string
+	gitDir     string
+	keep       int
+	seq        int
+	list       []Artifact // oldest first
+	triggers   map[string]string
+	pinned     *Artifact
+	pinnedData []byte
+	mode       func() string
+	fromDisk   func() bool // wasm is served by the external server from disk
+	onPin      func()      // e.g. reload the browser
+	log        func(message ...any)
+}
+
+type artifactsIndex struct {
+	Seq       int        `json:"seq"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// NewArtifactStore keeps artifacts under dir, reading the index left by a
+// previous session. gitDir is where the git state of each build is read from.
+// A relative dir is made absolute, so Artifact.File always is.
+func NewArtifactStore(db DB, dir, gitDir string) *ArtifactStore {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	s := &ArtifactStore{dir: dir, gitDir: gitDir, keep: defaultArtifactsKeep, triggers: map[string]string{}}
+	if db != nil {
+		if v, err := db.Get(StoreKeyArtifactsKeep); err == nil && v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				s.keep = n
+			}
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, ArtifactsIndexFile)); err == nil {
+		var idx artifactsIndex
+		if json.Unmarshal(data, &idx) == nil {
+			s.seq = idx.Seq
+			for _, a := range idx.Artifacts {
+				if _, err := os.Stat(a.File); err == nil {
+					s.list = append(s.list, a)
+				}
+			}
+		}
+	}
+	return s
+}
+
+// SetMode sets the function reporting the current wasm size mode. A wasm
+// build only runs with the wasm_exec.js of its own mode.
+func (s *ArtifactStore) SetMode(f func() string) { s.mode = f }
+
+// SetServedFromDisk sets the function reporting whether the wasm is served by
+// the external server from disk, where a pin cannot take effect.
+func (s *ArtifactStore) SetServedFromDisk(f func() bool) { s.fromDisk = f }
+
+// SetOnPin sets a hook run after the served wasm changes through Pin or Unpin.
+func (s *ArtifactStore) SetOnPin(f func()) { s.onPin = f }
+
+func (s *ArtifactStore) Name() string  { return "Artifacts" }
+func (s *ArtifactStore) Label() string { return "Serve Build" }
+
+// Value implements HandlerEdit.Value: the pinned artifact ID or "latest".
+func (s *ArtifactStore) Value() string {
+	if a := s.Pinned(); a != nil {
+		return a.ID
+	}
+	return "latest"
+}
+
+// Change implements HandlerEdit.Change: an artifact ID pins it, "latest" or
+// an empty value unpins.
+func (s *ArtifactStore) Change(newValue string) {
+	id := strings.TrimSpace(newValue)
+	if id == "" || id == "latest" {
+		s.Unpin()
+		return
+	}
+	if _, err := s.Pin(id); err != nil {
+		s.logf("Pin failed:", err)
+	}
+}
+
+func (s *ArtifactStore) SetLog(f func(message ...any)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = f
+}
+
+// NoteEdit records the file whose edit triggers the next build of target.
+func (s *ArtifactStore) NoteEdit(target, file string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.triggers[target] = file
+}
+
+// List returns the kept artifacts of target ("" for all), oldest first.
+func (s *ArtifactStore) List(target string) []Artifact {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Artifact
+	for _, a := range s.list {
+		if target == "" || a.Target == target {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// Pinned returns the pinned artifact, or nil while the latest build is served.
+func (s *ArtifactStore) Pinned() *Artifact {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pinned == nil {
+		return nil
+	}
+	a := *s.pinned
+	return &a
+}
+
+// Record keeps data as the newest artifact of target. Identical consecutive
+// builds are recorded once; the oldest artifacts beyond the limit are removed,
+// except a pinned one.
+func (s *ArtifactStore) Record(target, name string, data []byte, mode string) (*Artifact, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:6])
+
+	s.mu.Lock()
+	trigger := s.triggers[target]
+	delete(s.triggers, target)
+	for i := len(s.list) - 1; i >= 0; i-- {
+		if s.list[i].Target == target {
+			if s.list[i].Hash == hash && s.list[i].Mode == mode {
+				s.mu.Unlock()
+				return nil, nil
+			}
+			break
+		}
+	}
+	s.seq++
+	id := target + "-" + strconv.Itoa(s.seq)
+	s.mu.Unlock()
+
+	commit, dirty := gitState(s.gitDir)
+	a := Artifact{
+		ID: id, Target: target, Time: time.Now(), Size: len(data), Hash: hash,
+		Mode: mode, Commit: commit, Dirty: dirty, Trigger: trigger,
+		File: filepath.Join(s.dir, target, id+"-"+name),
+	}
+	if err := os.MkdirAll(filepath.Dir(a.File), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(a.File, data, 0644); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.list = append(s.list, a)
+	s.prune(target)
+	err := s.saveIndex()
+	unpin := s.pinned != nil && target == ArtifactWasm && s.pinned.Mode != mode
+	s.mu.Unlock()
+
+	s.logf("Saved", a.ID, describeArtifact(a))
+	if unpin {
+		s.logf("Size mode changed: unpinning, the pinned build needs a different wasm_exec.js")
+		s.Unpin()
+	}
+	return &a, err
+}
+
+// RecordFile keeps a copy of the file at path, see Record.
+func (s *ArtifactStore) RecordFile(target, path string) (*Artifact, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.Record(target, filepath.Base(path), data, "")
+}
+
+// Pin serves the wasm artifact id in place of the latest build until Unpin.
+func (s *ArtifactStore) Pin(id string) (*Artifact, error) {
+	s.mu.Lock()
+	var a *Artifact
+	for i := range s.list {
+		if s.list[i].ID == id {
+			found := s.list[i]
+			a = &found
+		}
+	}
+	s.mu.Unlock()
+
+	switch {
+	case a == nil:
+		return nil, fmt.Errorf("no artifact %q", id)
+	case a.Target != ArtifactWasm:
+		return nil, fmt.Errorf("%s is a %s binary: only wasm builds can be served, the binary is kept at %s", id, a.Target, a.File)
+	case s.fromDisk != nil && s.fromDisk():
+		return nil, errors.New("the external server serves the wasm from disk: pinning needs the built-in server")
+	case s.mode != nil && s.mode() != a.Mode:
+		return nil, fmt.Errorf("%s was built in mode %s, the current mode is %s", id, a.Mode, s.mode())
+	}
+	data, err := os.ReadFile(a.File)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.pinned, s.pinnedData = a, data
+	s.mu.Unlock()
+	s.logf("Pinned", a.ID, describeArtifact(*a))
+	if s.onPin != nil {
+		s.onPin()
+	}
+	return a, nil
+}
+
+// Unpin serves the latest build again.
+func (s *ArtifactStore) Unpin() {
+	s.mu.Lock()
+	was := s.pinned
+	s.pinned, s.pinnedData = nil, nil
+	s.mu.Unlock()
+	if was == nil {
+		return
+	}
+	s.logf("Unpinned", was.ID+": serving the latest build")
+	if s.onPin != nil {
+		s.onPin()
+	}
+}
+
+// Routes registers fns on a private mux and mounts it at "/", answering
+// wasmPath() with the pinned build while one is pinned.
+func (s *ArtifactStore) Routes(wasmPath func() string, fns ...func(*http.ServeMux)) func(*http.ServeMux) {
+	return func(mux *http.ServeMux) {
+		inner := http.NewServeMux()
+		for _, fn := range fns {
+			fn(inner)
+		}
+		mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.mu.Lock()
+			a, data := s.pinned, s.pinnedData
+			s.mu.Unlock()
+			if a == nil || r.URL.Path != wasmPath() {
+				inner.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/wasm")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Tinywasm-Artifact", a.ID)
+			w.Write(data)
+		}))
+	}
+}
+
+// prune removes the oldest unpinned artifacts of target beyond the limit.
+// Callers hold s.mu.
+func (s *ArtifactStore) prune(target string) {
+	n := 0
+	for _, a := range s.list {
+		if a.Target == target {
+			n++
+		}
+	}
+	kept := s.list[:0]
+	for _, a := range s.list {
+		if n > s.keep && a.Target == target && (s.pinned == nil || s.pinned.ID != a.ID) {
+			os.Remove(a.File)
+			n--
+			continue
+		}
+		kept = append(kept, a)
+	}
+	s.list = kept
+}
+
+// saveIndex writes the index next to the artifacts. Callers hold s.mu.
+func (s *ArtifactStore) saveIndex() error {
+	data, err := json.MarshalIndent(artifactsIndex{Seq: s.seq, Artifacts: s.list}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, ArtifactsIndexFile), data, 0644)
+}
+
+func (s *ArtifactStore) logf(message ...any) {
+	s.mu.Lock()
+	log := s.log
+	s.mu.Unlock()
+	if log != nil {
+		log(message...)
+	}
+}
+
+// describeArtifact summarizes a for the log, e.g. "(1.2 MB, a1b2c3d*, web/client.go)".
+func describeArtifact(a Artifact) string {
+	parts := []string{formatBytes(a.Size)}
+	if a.Commit != "" {
+		commit := a.Commit
+		if a.Dirty {
+			commit += "*"
+		}
+		parts = append(parts, commit)
+	}
+	if a.Trigger != "" {
+		parts = append(parts, a.Trigger)
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// gitState returns the short HEAD commit of dir and whether it has
+// uncommitted changes; "" when dir is not in a git repository.
+func gitState(dir string) (commit string, dirty bool) {
+	if dir == "" {
+		return "", false
+	}
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return "", false
+	}
+	status, _ := exec.Command("git", "-C", dir, "status", "--porcelain").Output()
+	return strings.TrimSpace(string(out)), len(strings.TrimSpace(string(status))) > 0
+}
+
+// recordWasmArtifact keeps the build that just compiled successfully.
+func (h *Handler) recordWasmArtifact() {
+	if h.Artifacts == nil {
+		return
+	}
+	data, mode, err := h.wasmOutput()
+	if err == nil {
+		_, err = h.Artifacts.Record(ArtifactWasm, filepath.Base(h.WasmClient.MainOutputFileAbsolutePath()), data, mode)
+	}
+	if err != nil {
+		h.WasmClient.Logger("Saving build artifact failed:", err)
+	}
+}
+
+// recordServerArtifact keeps the server binary an edit rebuilt. The binary
+// only exists in external mode, where UnobservedFiles lists it.
+func (h *Handler) recordServerArtifact(string) error {
+	binDir := filepath.Join(h.RootDir, h.Config.DeployAppServerDir())
+	for _, name := range h.Server.UnobservedFiles() {
+		bin := filepath.Join(binDir, name)
+		if info, err := os.Stat(bin); err == nil && !info.IsDir() {
+			if _, err := h.Artifacts.RecordFile(ArtifactServer, bin); err != nil {
+				h.Artifacts.logf("Saving server artifact failed:", err)
+			}
+			return nil
+		}
+	}
+	return nil
+}
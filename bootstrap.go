@@ -31,6 +31,7 @@ type BootstrapConfig struct {
 	BrowserFactory  func(ui TuiInterface, exitChan chan bool) BrowserInterface
 	GitHubAuth      any
 	McpToolHandlers []mcp.ToolProvider
+	Options         Options // side effect toggles passed to Start; ID is suffixed per project
 }
 
 // Bootstrap is the main entry point for the application logic
@@ -154,7 +155,8 @@ func runClient(cfg BootstrapConfig) {
 		cfg.GoModHandler,
 		false, // headless (we want UI)
 		true,  // clientMode true! skips backend loop and connects SSE
-		nil,   // no onProjectReady callback in client mode
+		cfg.Options,
+		nil, // no onProjectReady callback in client mode
 	)
 	// Start() returns here only after devtui has fully restored the terminal.
 	// NOW it is safe to close exitChan — no goroutine will write to stdout after this.
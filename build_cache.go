@@ -0,0 +1,721 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/build"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tinywasm/client"
+)
+
+// StoreKeyBuildCache disables the build cache when set to "false" (toggled
+// from the BUILD tab).
+const StoreKeyBuildCache = "TINYWASM_BUILD_CACHE"
+
+// buildCacheMaxBytes bounds the cache directory; the least recently used
+// entries are evicted first.
+const buildCacheMaxBytes = 1 << 30
+
+// buildCacheEnv are the environment variables that change compiler output.
+var buildCacheEnv = []string{
+	"GOOS", "GOARCH", "GOFLAGS", "GOEXPERIMENT", "CGO_ENABLED", "GOWASM",
+	"GOAMD64", "GOARM64", "GOWORK", "TINYGOROOT",
+}
+
+// BuildSpec describes one compile for BuildCache.Key.
+type BuildSpec struct {
+	Dir      string   // main package directory
+	Compiler string   // "go" or "tinygo"
+	Tags     string   // build tags the sources are listed with
+	Env      []string // extra environment, e.g. "GOOS=js"
+	Flags    []string // mode and compiler arguments
+}
+
+// BuildCache stores compiled artifacts in the user cache dir, keyed by a hash
+// of everything the output depends on: the source files of every module
+// package in the build, go.mod/go.sum, locally replaced modules, the compiler
+// version, flags and environment. An identical source state is then restored instead
+// of recompiled, e.g. when switching size modes back and forth or reverting
+// an edit.
+//
+// Only the wasm client is cached; server builds are out of scope and always
+// compile. tinywasm/server builds and restarts the server in one step, with
+// no way to hand it a binary, so a cached one could not be installed.
+type BuildCache struct {
+	mu       sync.Mutex
+	db       DB
+	enabled  bool
+	dir      string
+	hits     int
+	misses   int
+	versions map[string]string        // compiler version by compiler+dir
+	graphs   map[string]*PackageGraph // by module root
+	log      func(message ...any)
+}
+
+// NewBuildCache stores entries under dir, which defaults to
+// <user cache dir>/tinywasm/build. The toggle is restored from db.
+func NewBuildCache(db DB, dir string) *BuildCache {
+	if dir == "" {
+		if base, err := os.UserCacheDir(); err == nil {
+			dir = filepath.Join(base, "tinywasm", "build")
+		}
+	}
+	c := &BuildCache{db: db, enabled: dir != "", dir: dir, versions: map[string]string{}, graphs: map[string]*PackageGraph{}}
+	if db != nil {
+		if v, err := db.Get(StoreKeyBuildCache); err == nil && v == "false" {
+			c.enabled = false
+		}
+	}
+	return c
+}
+
+func (c *BuildCache) Name() string  { return "BuildCache" }
+func (c *BuildCache) Label() string { return "Build Cache" }
+
+// Value implements HandlerEdit.Value, e.g. "BuildCache:T".
+func (c *BuildCache) Value() string {
+	if c.Enabled() {
+		return "BuildCache:T"
+	}
+	return "BuildCache:F"
+}
+
+// Change implements HandlerEdit.Change, accepting "BuildCache:T" or "BuildCache:F".
+func (c *BuildCache) Change(newValue string) {
+	key, val, ok := strings.Cut(newValue, ":")
+	if !ok || strings.TrimSpace(key) != "BuildCache" {
+		return
+	}
+	val = strings.ToLower(strings.TrimSpace(val))
+	c.SetEnabled(val == "t" || val == "true")
+}
+
+func (c *BuildCache) SetLog(f func(message ...any)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.log = f
+}
+
+// Enabled reports whether compiles are looked up in and stored to the cache.
+func (c *BuildCache) Enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enabled && c.dir != ""
+}
+
+// SetEnabled toggles the cache and persists the choice.
+func (c *BuildCache) SetEnabled(on bool) {
+	c.mu.Lock()
+	c.enabled = on
+	db := c.db
+	c.mu.Unlock()
+	if db != nil {
+		db.Set(StoreKeyBuildCache, strconv.FormatBool(on))
+	}
+	if on {
+		c.logf("Build cache enabled:", c.dir)
+	} else {
+		c.logf("Build cache disabled: every change recompiles")
+	}
+}
+
+// Stats returns the hits and misses since start.
+func (c *BuildCache) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// Key hashes everything the output of spec depends on. It fails when the
+// sources can't be listed (e.g. a syntax error); callers then just compile.
+func (c *BuildCache) Key(spec BuildSpec) (string, error) {
+	k, err := c.sources(spec)
+	if err != nil {
+		return "", err
+	}
+	return k.key, nil
+}
+
+// sourceKey is a Key together with the local files it hashed, so a compile
+// can tell whether they changed meanwhile without listing the packages again.
+type sourceKey struct {
+	key   string
+	files map[string]string // path -> sha256 or "missing"
+}
+
+// unchanged reports whether every hashed file still has its recorded sum.
+func (k *sourceKey) unchanged() bool {
+	for path, sum := range k.files {
+		if fileSum(path) != sum {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *BuildCache) sources(spec BuildSpec) (*sourceKey, error) {
+	version, err := c.compilerVersion(spec)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "compiler %s %s\n", spec.Compiler, version)
+	fmt.Fprintf(h, "tags %s\nflags %q\n", spec.Tags, spec.Flags)
+	env := buildCacheEnvOf(spec.Env)
+	for _, name := range buildCacheEnv {
+		fmt.Fprintf(h, "env %s=%s\n", name, env[name])
+	}
+	files, err := c.hashSources(h, spec, env)
+	if err != nil {
+		return nil, err
+	}
+	return &sourceKey{key: hex.EncodeToString(h.Sum(nil)), files: files}, nil
+}
+
+// Get returns the cached artifact for key and marks it recently used.
+func (c *BuildCache) Get(key, ext string) ([]byte, bool) {
+	if !c.Enabled() || key == "" {
+		return nil, false
+	}
+	file := c.path(key, ext)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(file, now, now)
+	return data, true
+}
+
+// Put stores data under key, then evicts the least recently used entries
+// beyond buildCacheMaxBytes.
+func (c *BuildCache) Put(key, ext string, data []byte) error {
+	if !c.Enabled() || key == "" {
+		return nil
+	}
+	file := c.path(key, ext)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return err
+	}
+	return c.evict(buildCacheMaxBytes)
+}
+
+func (c *BuildCache) path(key, ext string) string {
+	return filepath.Join(c.dir, key[:2], key+ext)
+}
+
+// evict removes the oldest entries until the cache fits in max bytes.
+func (c *BuildCache) evict(max int64) error {
+	type entry struct {
+		path string
+		size int64
+		mod  time.Time
+	}
+	var entries []entry
+	var total int64
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, entry{path, info.Size(), info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil || total <= max {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].mod.Before(entries[j].mod) })
+	for _, e := range entries {
+		if total <= max {
+			break
+		}
+		if os.Remove(e.path) == nil {
+			total -= e.size
+		}
+	}
+	return nil
+}
+
+// record counts a lookup and reports hits in the BUILD tab.
+func (c *BuildCache) record(hit bool, what string) {
+	c.mu.Lock()
+	if hit {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	hits, misses := c.hits, c.misses
+	c.mu.Unlock()
+	if hit {
+		c.logf("Cache hit:", what, fmt.Sprintf("(%d hits, %d misses)", hits, misses))
+	}
+}
+
+func (c *BuildCache) logf(message ...any) {
+	c.mu.Lock()
+	log := c.log
+	c.mu.Unlock()
+	if log != nil {
+		log(message...)
+	}
+}
+
+// compilerVersion runs the compiler once per directory: a go.mod toolchain
+// line can select another Go version per module.
+func (c *BuildCache) compilerVersion(spec BuildSpec) (string, error) {
+	id := spec.Compiler + "\x00" + spec.Dir
+	c.mu.Lock()
+	v, ok := c.versions[id]
+	c.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+	cmd := exec.Command(spec.Compiler, "version")
+	if spec.Compiler == "go" {
+		cmd = exec.Command("go", "env", "GOVERSION")
+	}
+	cmd.Dir = spec.Dir
+	cmd.Env = append(os.Environ(), spec.Env...)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s version: %w", spec.Compiler, err)
+	}
+	v = strings.TrimSpace(string(out))
+	c.mu.Lock()
+	c.versions[id] = v
+	c.mu.Unlock()
+	return v, nil
+}
+
+// buildCacheEnvOf resolves buildCacheEnv from the process environment
+// overridden by extra.
+func buildCacheEnvOf(extra []string) map[string]string {
+	env := map[string]string{}
+	for _, name := range buildCacheEnv {
+		env[name] = os.Getenv(name)
+	}
+	for _, kv := range extra {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// hashSources writes the source state of spec's package and its module
+// dependencies to h, found in the package graph of the module. Every file of
+// those packages counts, the ones excluded by build constraints included, and
+// the packages only they import: another mode or tag may build them.
+// Required modules are pinned by go.mod and go.sum, which are hashed instead
+// of the module cache; modules replaced by a local directory are hashed file
+// by file. The hashed files are returned with their sums.
+func (c *BuildCache) hashSources(h io.Writer, spec BuildSpec, env map[string]string) (map[string]string, error) {
+	dir, err := filepath.Abs(spec.Dir)
+	if err != nil {
+		return nil, err
+	}
+	g, err := c.graphFor(dir)
+	if err != nil {
+		return nil, err
+	}
+	target := TestTargetServer
+	if env["GOOS"] == "js" {
+		target = TestTargetWasm
+	}
+	g.mu.Lock()
+	pkgs, err := g.walk(target, dir, true)
+	g.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]string{}
+	hashFile := func(path string) {
+		sum := fileSum(path)
+		files[path] = sum
+		fmt.Fprintf(h, "file %s %s\n", path, sum)
+	}
+	for _, name := range []string{"go.mod", "go.sum", "go.work", "go.work.sum"} {
+		hashFile(filepath.Join(g.rootDir, name))
+	}
+	for _, replaced := range localReplaces(g.rootDir) {
+		filepath.WalkDir(replaced, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && (strings.HasSuffix(p, ".go") || d.Name() == "go.mod" || d.Name() == "go.sum") {
+				hashFile(p)
+			}
+			return nil
+		})
+	}
+	dirs := make([]string, 0, len(pkgs))
+	for d := range pkgs {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+	for _, d := range dirs {
+		p := pkgs[d]
+		var names []string
+		for _, list := range [][]string{p.GoFiles, p.CgoFiles, p.IgnoredGoFiles, embedFiles(p)} {
+			names = append(names, list...)
+		}
+		sort.Strings(names)
+		for _, f := range names {
+			hashFile(filepath.Join(p.Dir, f))
+		}
+	}
+	return files, nil
+}
+
+// graphFor returns the package graph of the module holding dir: the shared
+// one when SetGraph registered it, a graph of the cache's own otherwise.
+func (c *BuildCache) graphFor(dir string) (*PackageGraph, error) {
+	root := dir
+	for {
+		if _, err := os.Stat(filepath.Join(root, "go.mod")); err == nil {
+			break
+		}
+		parent := filepath.Dir(root)
+		if parent == root {
+			return nil, fmt.Errorf("%s: no go.mod", dir)
+		}
+		root = parent
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	g, ok := c.graphs[root]
+	if !ok {
+		g = NewPackageGraph(root)
+		c.graphs[root] = g
+	}
+	return g, nil
+}
+
+// SetGraph shares g, kept up to date by the watcher, for the sources of its
+// module instead of a graph of the cache's own.
+func (c *BuildCache) SetGraph(g *PackageGraph) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.graphs[g.rootDir] = g
+}
+
+// embedFiles returns the files matched by the //go:embed patterns of p,
+// relative to its directory.
+func embedFiles(p *build.Package) []string {
+	var names []string
+	for _, pattern := range p.EmbedPatterns {
+		all := strings.HasPrefix(pattern, "all:")
+		matches, _ := filepath.Glob(filepath.Join(p.Dir, filepath.FromSlash(strings.TrimPrefix(pattern, "all:"))))
+		for _, m := range matches {
+			filepath.WalkDir(m, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return nil
+				}
+				if path != m && !all && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "_")) {
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if !d.IsDir() {
+					if rel, err := filepath.Rel(p.Dir, path); err == nil {
+						names = append(names, rel)
+					}
+				}
+				return nil
+			})
+		}
+	}
+	return names
+}
+
+// localReplaces returns the directories of the modules go.mod in rootDir
+// replaces with a local path.
+func localReplaces(rootDir string) []string {
+	data, err := os.ReadFile(filepath.Join(rootDir, "go.mod"))
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	block := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		switch {
+		case line == "replace (":
+			block = true
+			continue
+		case block && line == ")":
+			block = false
+			continue
+		case !block && !strings.HasPrefix(line, "replace "):
+			continue
+		}
+		_, target, ok := strings.Cut(line, "=>")
+		if !ok {
+			continue
+		}
+		path := strings.Fields(target)
+		if len(path) == 1 && (strings.HasPrefix(path[0], "./") || strings.HasPrefix(path[0], "../") || filepath.IsAbs(path[0])) {
+			if !filepath.IsAbs(path[0]) {
+				path[0] = filepath.Join(rootDir, path[0])
+			}
+			dirs = append(dirs, path[0])
+		}
+	}
+	return dirs
+}
+
+// fileSum returns the sha256 of path, or "missing".
+func fileSum(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "missing"
+	}
+	s := sha256.Sum256(data)
+	return hex.EncodeToString(s[:])
+}
+
+// compileWasm builds the client through the build cache: an identical
+// earlier build is installed instead of compiling. Headless builds over
+// budget are rolled back to the previous one before it returns, so the
+// caller neither serves them nor reloads the browser. Every compile of the
+// project goes through here rather than WasmClient.Storage.
+func (h *Handler) compileWasm() error {
+	if !h.headless {
+		return h.buildWasm()
+	}
+	return h.gateWasm(h.buildWasm, h.admitWasm)
+}
+
+// compileWasmFile is WasmClient.NewFileEvent for a saved file that
+// compiles, with the compile through compileWasm.
+func (h *Handler) compileWasmFile(fileName, extension, filePath, event string) error {
+	err := h.compileWasm()
+	if h.WasmClient.OnCompile != nil {
+		h.WasmClient.OnCompile(err)
+	}
+	if err != nil {
+		return fmt.Errorf("compiling to WebAssembly error: %w", err)
+	}
+	h.WasmClient.LogSuccessState()
+	h.wasmBuilt()
+	return nil
+}
+
+// RecompileWasm compiles the client in the current size mode, see compileWasm.
+func (h *Handler) RecompileWasm() error {
+	return h.compileWasm()
+}
+
+// gateWasm runs build and restores the previous output when admit rejects
+// the new one.
+func (h *Handler) gateWasm(build func() error, admit func(data []byte) error) error {
+	prev, _, _ := h.wasmOutput() // nil before the first build
+	if err := build(); err != nil {
+		return err
+	}
+	data, _, err := h.wasmOutput()
+	if err != nil {
+		return nil
+	}
+	if err := admit(data); err != nil {
+		if rerr := h.installWasm(prev); rerr != nil {
+			h.WasmClient.Logger("Restoring previous wasm build:", rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// buildWasm restores the build from the cache or compiles and stores it.
+func (h *Handler) buildWasm() error {
+	restored, key := h.restoreWasm(h.WasmClient.Value())
+	if restored {
+		return nil
+	}
+	if err := h.WasmClient.Compile(); err != nil {
+		return err
+	}
+	h.wasmRestored.clear()
+	h.storeWasm(key)
+	return nil
+}
+
+// restoreWasm installs the cached build of mode. The returned key, nil
+// while the cache is off, is where a compile of mode is stored.
+func (h *Handler) restoreWasm(mode string) (bool, *sourceKey) {
+	c := h.BuildCache
+	if c == nil || !c.Enabled() {
+		return false, nil
+	}
+	key, err := c.sources(wasmBuildSpec(h.WasmClient, mode))
+	if err != nil {
+		return false, nil
+	}
+	data, ok := c.Get(key.key, ".wasm")
+	if !ok || h.installWasm(data) != nil {
+		return false, key
+	}
+	c.record(true, filepath.Base(h.WasmClient.MainOutputFileAbsolutePath())+" mode "+mode+", "+formatBytes(len(data)))
+	return true, key
+}
+
+// storeWasm caches the build just compiled under key, unless its sources
+// changed while compiling.
+func (h *Handler) storeWasm(key *sourceKey) {
+	c := h.BuildCache
+	if c == nil || !c.Enabled() {
+		return
+	}
+	c.record(false, "")
+	if key == nil || !key.unchanged() {
+		return
+	}
+	data, _, err := h.wasmOutput()
+	if err == nil {
+		err = c.Put(key.key, ".wasm", data)
+	}
+	if err != nil {
+		c.logf("Build cache:", err)
+	}
+}
+
+// installWasm serves a build in place of the client's own; nil serves
+// none. In memory the route answers with it (see restoredWasm), on disk it
+// replaces the output file.
+func (h *Handler) installWasm(data []byte) error {
+	if !h.wasmOnDisk.Load() {
+		h.wasmRestored.put(data)
+		return nil
+	}
+	out := h.WasmClient.MainOutputFileAbsolutePath()
+	if data == nil {
+		if err := os.Remove(out); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(out, data, 0644)
+}
+
+// useWasmDisk switches the client to disk storage (external server mode).
+func (h *Handler) useWasmDisk() {
+	h.WasmClient.UseDiskStorage()
+	h.wasmOnDisk.Store(true)
+	h.wasmRestored.clear()
+}
+
+// wasmModeSwitch stands in for the WasmClient in the BUILD tab so a size
+// mode with a cached build is restored instead of compiled. Otherwise it
+// is WasmClient.Change, whose build is then cached and, headless, gated on
+// the size budgets like compileWasm.
+type wasmModeSwitch struct {
+	*client.WasmClient
+	h *Handler
+}
+
+func (m wasmModeSwitch) Change(newValue string) {
+	h := m.h
+	mode := strings.ToUpper(strings.TrimSpace(newValue))
+	prevMode := m.Value()
+	prev, _, _ := h.wasmOutput()
+
+	var key *sourceKey
+	if m.ValidateMode(mode) == nil && (!m.RequiresTinyGo(mode) || m.TinyGoInstalled) {
+		var restored bool
+		if restored, key = h.restoreWasm(mode); restored {
+			if err := h.admitHeadless(); err != nil {
+				h.installWasm(prev)
+				m.Logger("Error:", err)
+				return
+			}
+			m.SetMode(mode)
+			h.wasmBuilt()
+			m.LogSuccessState("Changed", "To", "Mode", mode)
+			return
+		}
+	}
+
+	// The client's callback leaves the reload to this switch, which
+	// decides first whether the new build is kept
+	compiles := h.wasmCompiles.Load()
+	h.wasmHold.Store(true)
+	m.WasmClient.Change(newValue)
+	h.wasmHold.Store(false)
+	if h.wasmCompiles.Load() == compiles {
+		return // rejected mode or failed compile: the old build stays
+	}
+	if err := h.admitHeadless(); err != nil {
+		m.SetMode(prevMode)
+		if rerr := h.installWasm(prev); rerr != nil {
+			m.Logger("Restoring previous wasm build:", rerr)
+		}
+		m.Logger("Error:", err)
+		return
+	}
+	h.storeWasm(key)
+	h.wasmBuilt()
+}
+
+// admitHeadless gates the served build on the size budgets when headless.
+func (h *Handler) admitHeadless() error {
+	if !h.headless {
+		return nil
+	}
+	data, _, err := h.wasmOutput()
+	if err != nil {
+		return nil
+	}
+	return h.admitWasm(data)
+}
+
+// wasmBuildSpec mirrors the WasmClient builder of size mode.
+func wasmBuildSpec(w *client.WasmClient, mode string) BuildSpec {
+	spec := BuildSpec{
+		Dir:      filepath.Join(w.AppRootDir, w.Config.SourceDir()),
+		Compiler: "go",
+		Tags:     "dev",
+		Env:      append([]string{"GOOS=js", "GOARCH=wasm"}, w.Config.Env...),
+		Flags:    []string{"mode=" + mode},
+	}
+	if w.RequiresTinyGo(mode) {
+		spec.Compiler, spec.Tags = "tinygo", "tinygo"
+	}
+	if w.CompilingArguments != nil {
+		args := withoutBuildTime(w.CompilingArguments())
+		spec.Flags = append(spec.Flags, args...)
+		for _, a := range args {
+			if tags, ok := strings.CutPrefix(a, "-tags="); ok {
+				spec.Tags += "," + tags // feature tags select source files too
+			}
+		}
+	}
+	return spec
+}
@@ -0,0 +1,523 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tinywasm/devwatch"
+)
+
+// Build phases a hook can run in. A failing before-* hook blocks that build.
+const (
+	PhaseBeforeWasm   = "before-wasm"
+	PhaseAfterWasm    = "after-wasm"
+	PhaseBeforeServer = "before-server"
+	PhaseAfterServer  = "after-server"
+	PhaseAfterAssets  = "after-assets" // after assetmin processed a change or flushed to disk
+)
+
+var hookPhases = []string{PhaseBeforeWasm, PhaseAfterWasm, PhaseBeforeServer, PhaseAfterServer, PhaseAfterAssets}
+
+// hookTimeout bounds a single hook command.
+const hookTimeout = 2 * time.Minute
+
+// StoreKeyBuildHooks holds the project's hooks, each written as
+// "<phase> <glob> <command>", query-escaped and separated by ';'.
+const StoreKeyBuildHooks = "TINYWASM_HOOKS"
+
+// errHooksDeferred tells the watcher a build was handed to the hooks
+// goroutine: it must not reload yet, BuildHooks reloads once it is done.
+var errHooksDeferred = errors.New("build deferred to the hooks queue")
+
+// BuildHook runs Command when a file matching Glob changes, in Phase.
+type BuildHook struct {
+	Phase   string
+	Glob    string // slash-separated, relative to the project root; "**" spans directories
+	Command string // run with sh -c (cmd /C on Windows) in the project root
+}
+
+// String returns the hook as "<phase> <glob> <command>".
+func (h BuildHook) String() string {
+	return h.Phase + " " + h.Glob + " " + h.Command
+}
+
+// BuildHooks runs the project's hooks, kept in the project config under
+// StoreKeyBuildHooks and edited from the BUILD tab:
+//
+//	before-wasm  models/*.go      go generate ./models
+//	after-assets web/ui/**/*.css  ./scripts/postcss.sh
+//
+// Builds whose file has hooks or generators run on the hooks goroutine, in
+// order, so the watcher never waits on a command. Each hook runs once per
+// file content, however many handlers see the change. Hook output is logged
+// to the BUILD tab.
+type BuildHooks struct {
+	mu        sync.Mutex
+	run       sync.Mutex // hooks run one at a time
+	db        DB
+	rootDir   string
+	raw       string // stored value the hooks were parsed from
+	hooks     []BuildHook
+	loadErr   error
+	failed    string // last failing hook, shown in Value until one succeeds
+	covered   map[string]bool
+	generated map[string]generation // by directive file, see Generate
+	ran       map[string]generation // by phase and file, see Run
+	queue     []func() error
+	busy      bool // the hooks goroutine is draining queue
+	reload    func() error
+	log       func(message ...any)
+}
+
+// NewBuildHooks reads the hooks from db; commands run in rootDir.
+func NewBuildHooks(db DB, rootDir string) *BuildHooks {
+	return &BuildHooks{db: db, rootDir: rootDir, covered: map[string]bool{},
+		generated: map[string]generation{}, ran: map[string]generation{}}
+}
+
+func (b *BuildHooks) Name() string  { return "Hooks" }
+func (b *BuildHooks) Label() string { return "Build Hooks" }
+
+// Value summarizes the hooks, e.g. "2 hooks" or "⚠ before-wasm: go generate".
+func (b *BuildHooks) Value() string {
+	hooks, err := b.Hooks()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case err != nil:
+		return "⚠ " + err.Error()
+	case b.failed != "":
+		return "⚠ " + b.failed
+	case len(hooks) == 0:
+		return "none"
+	case len(hooks) == 1:
+		return "1 hook"
+	}
+	return fmt.Sprintf("%d hooks", len(hooks))
+}
+
+// Change implements HandlerEdit.Change: "<phase> <glob> <command>" adds a
+// hook, "-N" removes the Nth one (see the list logged on each change).
+func (b *BuildHooks) Change(newValue string) {
+	in := strings.TrimSpace(newValue)
+	var err error
+	switch {
+	case in == "" || in == b.Value():
+		return
+	case strings.HasPrefix(in, "-"):
+		var n int
+		if _, err = fmt.Sscanf(in, "-%d", &n); err == nil {
+			err = b.RemoveHook(n)
+		}
+	default:
+		var hooks []BuildHook
+		if hooks, err = ParseBuildHooks(in); err == nil && len(hooks) == 1 {
+			err = b.AddHook(hooks[0])
+		}
+	}
+	if err != nil {
+		b.logf(err)
+		return
+	}
+	hooks, _ := b.Hooks()
+	for i, hook := range hooks {
+		b.logf(fmt.Sprintf("%d.", i+1), hook.String())
+	}
+}
+
+func (b *BuildHooks) SetLog(f func(message ...any)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.log = f
+}
+
+// SetReload sets what runs once the hooks goroutine finished a build.
+func (b *BuildHooks) SetReload(f func() error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reload = f
+}
+
+// Hooks returns the declared hooks, reparsed when the stored value changed.
+func (b *BuildHooks) Hooks() ([]BuildHook, error) {
+	raw := ""
+	if b.db != nil {
+		raw, _ = b.db.Get(StoreKeyBuildHooks)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if raw == b.raw {
+		return b.hooks, b.loadErr
+	}
+	var lines []string
+	for _, escaped := range strings.Split(raw, ";") {
+		if text, err := url.QueryUnescape(escaped); err == nil {
+			lines = append(lines, text)
+		}
+	}
+	b.raw, b.failed, b.ran = raw, "", map[string]generation{}
+	b.hooks, b.loadErr = ParseBuildHooks(strings.Join(lines, "\n"))
+	return b.hooks, b.loadErr
+}
+
+// AddHook appends hook and persists the list.
+func (b *BuildHooks) AddHook(hook BuildHook) error {
+	hooks, _ := b.Hooks()
+	return b.SetHooks(append(append([]BuildHook(nil), hooks...), hook))
+}
+
+// RemoveHook drops the nth hook, counting from 1.
+func (b *BuildHooks) RemoveHook(n int) error {
+	hooks, _ := b.Hooks()
+	if n < 1 || n > len(hooks) {
+		return fmt.Errorf("no hook %d (%d declared)", n, len(hooks))
+	}
+	return b.SetHooks(append(append([]BuildHook(nil), hooks[:n-1]...), hooks[n:]...))
+}
+
+// SetHooks replaces the hooks and persists them.
+func (b *BuildHooks) SetHooks(hooks []BuildHook) error {
+	escaped := make([]string, len(hooks))
+	for i, hook := range hooks {
+		if _, err := ParseBuildHooks(hook.String()); err != nil {
+			return err
+		}
+		escaped[i] = url.QueryEscape(hook.String())
+	}
+	if b.db == nil {
+		return errors.New("hooks: no project config")
+	}
+	return b.db.Set(StoreKeyBuildHooks, strings.Join(escaped, ";"))
+}
+
+// ParseBuildHooks parses hooks written one per line as
+// "<phase> <glob> <command>". Blank lines and lines starting with # are ignored.
+func ParseBuildHooks(src string) ([]BuildHook, error) {
+	var hooks []BuildHook
+	var errs []error
+	for i, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			errs = append(errs, fmt.Errorf("line %d: want <phase> <glob> <command>", i+1))
+			continue
+		}
+		phase, glob := fields[0], fields[1]
+		known := false
+		for _, p := range hookPhases {
+			known = known || p == phase
+		}
+		if !known {
+			errs = append(errs, fmt.Errorf("line %d: unknown phase %q (want one of %s)", i+1, phase, strings.Join(hookPhases, ", ")))
+			continue
+		}
+		if _, err := path.Match(strings.ReplaceAll(glob, "**", "*"), ""); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: bad glob %q", i+1, glob))
+			continue
+		}
+		rest := strings.TrimSpace(line[len(phase):])
+		command := strings.TrimSpace(rest[len(glob):])
+		hooks = append(hooks, BuildHook{Phase: phase, Glob: glob, Command: command})
+	}
+	return hooks, errors.Join(errs...)
+}
+
+// MatchGlob reports whether the slash-separated relative path name matches
+// pattern. "**" matches any number of directories; a pattern without a slash
+// matches the base name in any directory.
+func MatchGlob(pattern, name string) bool {
+	name = filepath.ToSlash(name)
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// Run runs, in declaration order, the hooks of phase whose glob matches file
+// (relative to the project root). An empty file runs every hook of phase.
+// It stops at the first failure and returns it. For a given file content a
+// phase runs once: repeated events and the other handlers of the change get
+// the first outcome.
+func (b *BuildHooks) Run(phase, file string) error {
+	hooks, err := b.Hooks()
+	if err != nil {
+		b.logf("Hooks:", err)
+	}
+	b.run.Lock()
+	defer b.run.Unlock()
+	var id string
+	var sum [sha256.Size]byte
+	if file != "" {
+		id = phase + "\x00" + file
+		if data, err := os.ReadFile(filepath.Join(b.rootDir, filepath.FromSlash(file))); err == nil {
+			sum = sha256.Sum256(data)
+		}
+		b.mu.Lock()
+		last, seen := b.ran[id]
+		b.mu.Unlock()
+		if seen && last.sum == sum {
+			return last.err
+		}
+	}
+	err = nil
+	for _, hook := range hooks {
+		if hook.Phase != phase || (file != "" && !MatchGlob(hook.Glob, file)) {
+			continue
+		}
+		if err = b.exec(hook, file); err != nil {
+			break
+		}
+	}
+	if id != "" {
+		b.mu.Lock()
+		b.ran[id] = generation{sum, err}
+		b.mu.Unlock()
+	}
+	return err
+}
+
+// Matches reports whether a hook of one of phases (all when none) or a
+// generator directive applies to file.
+func (b *BuildHooks) Matches(file string, phases ...string) bool {
+	hooks, _ := b.Hooks()
+	for _, hook := range hooks {
+		if (len(phases) == 0 || slices.Contains(phases, hook.Phase)) && MatchGlob(hook.Glob, file) {
+			return true
+		}
+	}
+	if filepath.Ext(file) != ".go" {
+		return false
+	}
+	src, err := os.ReadFile(filepath.Join(b.rootDir, filepath.FromSlash(file)))
+	return err == nil && len(Generators(src)) > 0
+}
+
+// Defer queues build, usually hooks and the compile they gate, on the hooks
+// goroutine when hooks apply to it or earlier builds are still queued, and
+// returns errHooksDeferred. Otherwise it runs build right away. Once the
+// queue drains after a build succeeded, the browser reloads.
+func (b *BuildHooks) Defer(applies bool, build func() error) error {
+	b.mu.Lock()
+	if !applies && !b.busy {
+		b.mu.Unlock()
+		return build()
+	}
+	b.queue = append(b.queue, build)
+	start := !b.busy
+	b.busy = true
+	b.mu.Unlock()
+	if start {
+		go b.drain()
+	}
+	return errHooksDeferred
+}
+
+func (b *BuildHooks) drain() {
+	succeeded := false
+	for {
+		b.mu.Lock()
+		if len(b.queue) == 0 {
+			b.busy = false
+			reload := b.reload
+			b.mu.Unlock()
+			if succeeded && reload != nil {
+				if err := reload(); err != nil {
+					b.logf("Error reloading Browser:", err)
+				}
+			}
+			return
+		}
+		build := b.queue[0]
+		b.queue = b.queue[1:]
+		b.mu.Unlock()
+		if err := build(); err == nil {
+			succeeded = true
+		}
+	}
+}
+
+// Idle reports whether no deferred build is queued or running.
+func (b *BuildHooks) Idle() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.busy
+}
+
+// exec runs one hook and logs its output line by line.
+func (b *BuildHooks) exec(hook BuildHook, file string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", hook.Command)
+	}
+	cmd.Dir = b.rootDir
+	cmd.Env = append(os.Environ(), "TINYWASM_HOOK_PHASE="+hook.Phase, "TINYWASM_HOOK_FILE="+file)
+
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			b.logf(line)
+		}
+	}
+	name := hook.Phase + ": " + hook.Command
+	b.mu.Lock()
+	if err != nil {
+		b.failed = name
+	} else if b.failed == name {
+		b.failed = ""
+	}
+	b.mu.Unlock()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("timed out after %s", hookTimeout)
+		}
+		err = fmt.Errorf("hook %s failed: %w", name, err)
+		b.logf(err)
+		return err
+	}
+	b.logf("Hook", name, "ok", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// SetCovered records the extensions the build handlers see; the hooks
+// watcher only handles the other ones (e.g. .templ, .proto).
+func (b *BuildHooks) SetCovered(exts ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ext := range exts {
+		b.covered[ext] = true
+	}
+}
+
+// Watcher returns the handler that runs hooks for files no build handler
+// watches. Their hooks run right away whatever their phase, since no build
+// follows the change directly.
+func (b *BuildHooks) Watcher() devwatch.FilesEventHandlers { return hooksWatcher{b} }
+
+type hooksWatcher struct{ hooks *BuildHooks }
+
+func (w hooksWatcher) MainInputFileRelativePath() string { return "" }
+func (w hooksWatcher) UnobservedFiles() []string         { return nil }
+
+// SupportedExtensions lists the extensions of the hook globs that no build
+// handler covers.
+func (w hooksWatcher) SupportedExtensions() []string {
+	hooks, _ := w.hooks.Hooks()
+	w.hooks.mu.Lock()
+	defer w.hooks.mu.Unlock()
+	var exts []string
+	for _, hook := range hooks {
+		ext := path.Ext(hook.Glob)
+		if ext != "" && !strings.ContainsAny(ext, "*?[") && !w.hooks.covered[ext] {
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
+
+func (w hooksWatcher) NewFileEvent(fileName, extension, filePath, event string) error {
+	if event != "write" && event != "create" {
+		return nil
+	}
+	file := w.hooks.rel(filePath)
+	if !w.hooks.Matches(file) {
+		return nil
+	}
+	return w.hooks.Defer(true, func() error {
+		for _, phase := range hookPhases {
+			if err := w.hooks.Run(phase, file); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// rel returns filePath relative to the project root, slash-separated.
+func (b *BuildHooks) rel(filePath string) string {
+	if rel, err := filepath.Rel(b.rootDir, filePath); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(filePath)
+}
+
+func (b *BuildHooks) logf(message ...any) {
+	b.mu.Lock()
+	log := b.log
+	b.mu.Unlock()
+	if log != nil {
+		log(message...)
+	}
+}
+
+// Phases runs the before and after hooks of a build around it; builds that
+// a hook or generator applies to queue on the hooks goroutine (see Defer).
+// Called after the other features register theirs, the before hooks run
+// right ahead of the compile and the after hooks last.
+func (b *BuildHooks) Phases(p *buildPhases, before, after string) {
+	p.Before(func(file string) error { return b.Run(before, file) })
+	p.After(func(file string) error { return b.Run(after, file) })
+	p.SetQueue(func(file string, build func() error) error {
+		return b.Defer(b.Matches(file, before, after), build)
+	})
+}
+
+// assetHooks stands in for assetmin in the watcher to run after-assets hooks
+// once a change has been processed.
+type assetHooks struct {
+	devwatch.FilesEventHandlers
+	hooks *BuildHooks
+}
+
+func (a assetHooks) NewFileEvent(fileName, extension, filePath, event string) error {
+	if err := a.FilesEventHandlers.NewFileEvent(fileName, extension, filePath, event); err != nil || event == "scan" {
+		return err
+	}
+	file := a.hooks.rel(filePath)
+	if !a.hooks.Matches(file, PhaseAfterAssets) {
+		return nil
+	}
+	return a.hooks.Defer(true, func() error { return a.hooks.Run(PhaseAfterAssets, file) })
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"path/filepath"
+	"slices"
+
+	"github.com/tinywasm/devwatch"
+)
+
+// buildPhases are the steps features add around the build a saved file
+// triggers, one hook each, so no feature wraps the build handler itself.
+// Files are relative to the project root and slash-separated.
+type buildPhases struct {
+	edit   []func(file string)
+	before []func(file string) error
+	after  []func(file string) error
+	queue  func(file string, build func() error) error
+}
+
+// OnEdit runs fn for every change of a file the build watches, whether or
+// not it compiles.
+func (p *buildPhases) OnEdit(fn func(file string)) {
+	p.edit = append(p.edit, fn)
+}
+
+// Before runs fn ahead of the compile, in registration order; an error
+// blocks the compile.
+func (p *buildPhases) Before(fn func(file string) error) {
+	p.before = append(p.before, fn)
+}
+
+// After runs fn once the compile succeeded, in registration order.
+func (p *buildPhases) After(fn func(file string) error) {
+	p.after = append(p.after, fn)
+}
+
+// SetQueue hands each build, phases included, to queue instead of running
+// it on the watcher (see BuildHooks.Defer).
+func (p *buildPhases) SetQueue(queue func(file string, build func() error) error) {
+	p.queue = queue
+}
+
+func (p *buildPhases) run(file string, compile func() error) error {
+	build := func() error {
+		for _, fn := range p.before {
+			if err := fn(file); err != nil {
+				return err
+			}
+		}
+		if err := compile(); err != nil {
+			return err
+		}
+		for _, fn := range p.after {
+			if err := fn(file); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if p.queue == nil {
+		return build()
+	}
+	return p.queue(file, build)
+}
+
+// phasedBuild stands in for a build handler in the watcher and runs the
+// compile of a saved .go file between the phases. compile is the handler's
+// NewFileEvent or stands in for it; events other than compiles, if listed,
+// go straight to the handler.
+type phasedBuild struct {
+	devwatch.FilesEventHandlers
+	phases   *buildPhases
+	compile  func(fileName, extension, filePath, event string) error
+	compiles []string // events that compile; nil for all
+	rootDir  string
+}
+
+func (b phasedBuild) NewFileEvent(fileName, extension, filePath, event string) error {
+	if filePath == "" || extension != ".go" || event == "scan" { // the initial scan is not an edit
+		return b.FilesEventHandlers.NewFileEvent(fileName, extension, filePath, event)
+	}
+	file := filePath
+	if rel, err := filepath.Rel(b.rootDir, filePath); err == nil {
+		file = rel
+	}
+	file = filepath.ToSlash(file)
+	for _, fn := range b.phases.edit {
+		fn(file)
+	}
+	if b.compiles != nil && !slices.Contains(b.compiles, event) {
+		return b.FilesEventHandlers.NewFileEvent(fileName, extension, filePath, event)
+	}
+	return b.phases.run(file, func() error {
+		return b.compile(fileName, extension, filePath, event)
+	})
+}
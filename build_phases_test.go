@@ -0,0 +1,58 @@
+package app
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type phaseTestHandler struct{ events *[]string }
+
+func (h phaseTestHandler) MainInputFileRelativePath() string { return "" }
+func (h phaseTestHandler) SupportedExtensions() []string     { return []string{".go"} }
+func (h phaseTestHandler) UnobservedFiles() []string         { return nil }
+func (h phaseTestHandler) NewFileEvent(fileName, extension, filePath, event string) error {
+	*h.events = append(*h.events, "handler "+event)
+	return nil
+}
+
+func TestPhasedBuild_RunsFeatureStepsAroundCompile(t *testing.T) {
+	root := t.TempDir()
+	var got []string
+	note := func(step string) func(string) error {
+		return func(file string) error {
+			got = append(got, step+" "+file)
+			return nil
+		}
+	}
+	p := &buildPhases{}
+	p.OnEdit(func(file string) { got = append(got, "edit "+file) })
+	p.Before(note("generate"))
+	p.Before(note("before"))
+	p.After(note("after"))
+	b := phasedBuild{phaseTestHandler{&got}, p, func(_, _, _, event string) error {
+		got = append(got, "compile "+event)
+		return nil
+	}, []string{"create", "write"}, root}
+
+	file := filepath.Join(root, "web", "client.go")
+	b.NewFileEvent("client.go", ".go", file, "scan")
+	b.NewFileEvent("client.go", ".go", file, "write")
+	b.NewFileEvent("client.go", ".go", file, "remove")
+	want := "handler scan|edit web/client.go|generate web/client.go|before web/client.go|compile write|after web/client.go|edit web/client.go|handler remove"
+	if s := strings.Join(got, "|"); s != want {
+		t.Errorf("steps:\n got %s\nwant %s", s, want)
+	}
+
+	// A failing before step blocks the compile and the after steps
+	got = nil
+	failed := errors.New("hook failed")
+	p.Before(func(string) error { return failed })
+	if err := b.NewFileEvent("client.go", ".go", file, "write"); !errors.Is(err, failed) {
+		t.Errorf("err = %v", err)
+	}
+	if s := strings.Join(got, "|"); strings.Contains(s, "compile") || strings.Contains(s, "after") {
+		t.Errorf("ran past a failed step: %s", s)
+	}
+}
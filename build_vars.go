@@ -0,0 +1,438 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Project store keys of the build-time configuration. Each has a shared
+// value and per env profile overrides under <key>_<profile>.
+const (
+	StoreKeyBuildVars = "TINYWASM_BUILD_VARS" // -X vars: pkg.Name:value;pkg.Name:value (values query-escaped)
+	StoreKeyBuildTags = "TINYWASM_BUILD_TAGS" // extra build tags, comma-separated
+	StoreKeyFeatures  = "TINYWASM_FEATURES"   // feature flags: name:on,name:off
+)
+
+// BuildInfoPackage receives the BuildInfo values with -ldflags -X.
+const BuildInfoPackage = "github.com/tinywasm/app/buildinfo"
+
+// FeatureTagPrefix makes a build tag of each enabled feature flag.
+const FeatureTagPrefix = "feature_"
+
+// Build targets of BuildVars.Args.
+const (
+	BuildTargetWasm   = "wasm"
+	BuildTargetServer = "server"
+)
+
+var (
+	buildVarSymbol = regexp.MustCompile(`^[\w./-]+\.\w+$`)
+	buildTagName   = regexp.MustCompile(`^[\w.]+$`)
+)
+
+// BuildInfo is what a build gets in the buildinfo package.
+type BuildInfo struct {
+	Commit   string   `json:"commit"`
+	Time     string   `json:"time"`
+	Mode     string   `json:"mode"`
+	Profile  string   `json:"profile"`
+	Target   string   `json:"target"`
+	Features []string `json:"features"`
+}
+
+// BuildVars injects project-configured -ldflags -X variables, build tags and
+// feature flags into the wasm client and server builds, along with BuildInfo.
+// Values set for the active env profile override the shared ones.
+type BuildVars struct {
+	mu       sync.Mutex
+	db       DB
+	rootDir  string
+	profile  func() string
+	onChange func()
+	log      func(message ...any)
+}
+
+// NewBuildVars reads the active env profile from profile (nil: shared values only).
+func NewBuildVars(db DB, rootDir string, profile func() string) *BuildVars {
+	return &BuildVars{db: db, rootDir: rootDir, profile: profile}
+}
+
+func (b *BuildVars) Name() string  { return "BuildVars" }
+func (b *BuildVars) Label() string { return "Build Flags" }
+
+// Value implements HandlerEdit.Value: the feature flags, e.g. "+checkout -beta".
+func (b *BuildVars) Value() string {
+	features := b.Features()
+	if len(features) == 0 {
+		return "-"
+	}
+	var parts []string
+	for _, name := range sortedKeys(features) {
+		sign := "-"
+		if features[name] {
+			sign = "+"
+		}
+		parts = append(parts, sign+name)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Change implements HandlerEdit.Change: "name" flips a feature flag, "+name"
+// and "-name" turn it on or off, "pkg.Var=value" sets a variable ("pkg.Var="
+// removes it). The wasm client and the server are rebuilt.
+func (b *BuildVars) Change(newValue string) {
+	in := strings.TrimSpace(newValue)
+	var err error
+	switch {
+	case in == "" || in == b.Value():
+		return
+	case strings.Contains(in, "="):
+		symbol, value, _ := strings.Cut(in, "=")
+		err = b.SetVar("", strings.TrimSpace(symbol), value)
+	case strings.HasPrefix(in, "+"), strings.HasPrefix(in, "-"):
+		err = b.SetFeature("", in[1:], in[0] == '+')
+	default:
+		_, err = b.Flip(in)
+	}
+	if err != nil {
+		b.logf(err)
+	}
+}
+
+func (b *BuildVars) SetLog(f func(message ...any)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.log = f
+}
+
+// SetOnChange registers the rebuild run after a change.
+func (b *BuildVars) SetOnChange(fn func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onChange = fn
+}
+
+func (b *BuildVars) activeProfile() string {
+	if b.profile == nil {
+		return ""
+	}
+	return b.profile()
+}
+
+// layerKey is the store key of key for profile, "" being the shared layer.
+func layerKey(key, profile string) string {
+	if profile == "" {
+		return key
+	}
+	return key + "_" + profile
+}
+
+func (b *BuildVars) get(key string) string {
+	if b.db == nil {
+		return ""
+	}
+	v, _ := b.db.Get(key)
+	return v
+}
+
+// layered reads the shared and the active profile values of key.
+func (b *BuildVars) layered(key string, parse func(string) map[string]string) map[string]string {
+	out := parse(b.get(key))
+	if p := b.activeProfile(); p != "" {
+		for k, v := range parse(b.get(layerKey(key, p))) {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func parseBuildVars(s string) map[string]string {
+	vars := map[string]string{}
+	for _, entry := range strings.Split(s, ";") {
+		symbol, escaped, ok := strings.Cut(entry, ":")
+		if !ok || symbol == "" {
+			continue
+		}
+		if v, err := url.QueryUnescape(escaped); err == nil {
+			vars[symbol] = v
+		}
+	}
+	return vars
+}
+
+func parseFeatures(s string) map[string]string {
+	out := map[string]string{}
+	for _, entry := range strings.Split(s, ",") {
+		if name, state, ok := strings.Cut(strings.TrimSpace(entry), ":"); ok && name != "" {
+			out[name] = state
+		}
+	}
+	return out
+}
+
+// Vars returns the effective -X variables, symbol to value.
+func (b *BuildVars) Vars() map[string]string {
+	return b.layered(StoreKeyBuildVars, parseBuildVars)
+}
+
+// Features returns the effective feature flags.
+func (b *BuildVars) Features() map[string]bool {
+	out := map[string]bool{}
+	for name, state := range b.layered(StoreKeyFeatures, parseFeatures) {
+		out[name] = state == "on"
+	}
+	return out
+}
+
+// Tags returns the extra build tags and one feature_<name> tag per enabled flag.
+func (b *BuildVars) Tags() []string {
+	var tags []string
+	for _, key := range []string{StoreKeyBuildTags, layerKey(StoreKeyBuildTags, b.activeProfile())} {
+		for _, t := range strings.Split(b.get(key), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tags = append(tags, t)
+			}
+		}
+	}
+	features := b.Features()
+	for _, name := range sortedKeys(features) {
+		if features[name] {
+			tags = append(tags, FeatureTagPrefix+name)
+		}
+	}
+	return dedupe(tags)
+}
+
+// SetVar sets the -X variable symbol ("main.apiBase",
+// "example.com/app/config.APIBase") for profile ("" for every profile); an
+// empty value removes it.
+func (b *BuildVars) SetVar(profile, symbol, value string) error {
+	if !buildVarSymbol.MatchString(symbol) {
+		return fmt.Errorf("invalid variable %q: use package.Name, e.g. main.apiBase", symbol)
+	}
+	key := layerKey(StoreKeyBuildVars, profile)
+	vars := parseBuildVars(b.get(key))
+	if value == "" {
+		delete(vars, symbol)
+	} else {
+		vars[symbol] = value
+	}
+	var parts []string
+	for _, s := range sortedKeys(vars) {
+		parts = append(parts, s+":"+url.QueryEscape(vars[s]))
+	}
+	if err := b.set(key, strings.Join(parts, ";")); err != nil {
+		return err
+	}
+	b.logf("Build var", symbol, "=", strconv.Quote(value), layerName(profile))
+	b.changed()
+	return nil
+}
+
+// SetFeature turns the feature flag name on or off for profile ("" for every profile).
+func (b *BuildVars) SetFeature(profile, name string, on bool) error {
+	if !buildTagName.MatchString(name) {
+		return fmt.Errorf("invalid feature flag %q: use letters, digits, _ and .", name)
+	}
+	key := layerKey(StoreKeyFeatures, profile)
+	features := parseFeatures(b.get(key))
+	features[name] = "off"
+	if on {
+		features[name] = "on"
+	}
+	var parts []string
+	for _, n := range sortedKeys(features) {
+		parts = append(parts, n+":"+features[n])
+	}
+	if err := b.set(key, strings.Join(parts, ",")); err != nil {
+		return err
+	}
+	state := "off"
+	if on {
+		state = "on"
+	}
+	b.logf("Feature", name, state, layerName(profile))
+	b.changed()
+	return nil
+}
+
+// Flip toggles the effective value of a feature flag, in the active
+// profile when it overrides the flag and in the shared values otherwise.
+func (b *BuildVars) Flip(name string) (bool, error) {
+	profile := b.activeProfile()
+	if _, overridden := parseFeatures(b.get(layerKey(StoreKeyFeatures, profile)))[name]; profile == "" || !overridden {
+		profile = ""
+	}
+	on := !b.Features()[name]
+	return on, b.SetFeature(profile, name, on)
+}
+
+// SetTags replaces the extra build tags of profile ("" for every profile).
+func (b *BuildVars) SetTags(profile string, tags []string) error {
+	for _, t := range tags {
+		if !buildTagName.MatchString(t) {
+			return fmt.Errorf("invalid build tag %q", t)
+		}
+	}
+	if err := b.set(layerKey(StoreKeyBuildTags, profile), strings.Join(tags, ",")); err != nil {
+		return err
+	}
+	b.logf("Build tags", strings.Join(tags, ","), layerName(profile))
+	b.changed()
+	return nil
+}
+
+func (b *BuildVars) set(key, value string) error {
+	if b.db == nil {
+		return fmt.Errorf("no project store")
+	}
+	return b.db.Set(key, value)
+}
+
+func layerName(profile string) string {
+	if profile == "" {
+		return "(all profiles)"
+	}
+	return "(profile " + profile + ")"
+}
+
+// Info returns the BuildInfo of a build of target in mode.
+func (b *BuildVars) Info(target, mode string) BuildInfo {
+	info := BuildInfo{Commit: gitCommit(b.rootDir), Time: time.Now().UTC().Format(time.RFC3339), Mode: mode, Profile: b.activeProfile(), Target: target, Features: []string{}}
+	features := b.Features()
+	for _, name := range sortedKeys(features) {
+		if features[name] {
+			info.Features = append(info.Features, name)
+		}
+	}
+	return info
+}
+
+// gitCommit is the short HEAD commit, "+dirty" with uncommitted changes.
+func gitCommit(dir string) string {
+	cmd := exec.Command("git", "rev-parse", "--short", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	commit := strings.TrimSpace(string(out))
+	status := exec.Command("git", "status", "--porcelain", "--untracked-files=no")
+	status.Dir = dir
+	if out, err := status.Output(); err == nil && len(strings.TrimSpace(string(out))) > 0 {
+		commit += "+dirty"
+	}
+	return commit
+}
+
+// Args returns the go build/tinygo flags of a target build in mode: one
+// -tags with the extra and feature tags, and -ldflags setting the variables
+// and BuildInfo.
+func (b *BuildVars) Args(target, mode string) []string {
+	info := b.Info(target, mode)
+	vars := b.Vars()
+	for name, value := range map[string]string{
+		"Commit": info.Commit, "Time": info.Time, "Mode": info.Mode,
+		"Profile": info.Profile, "Target": info.Target, "Features": strings.Join(info.Features, ","),
+	} {
+		vars[BuildInfoPackage+"."+name] = value
+	}
+	var ldflags []string
+	for _, symbol := range sortedKeys(vars) {
+		ldflags = append(ldflags, "-X", ldflagQuote(symbol+"="+vars[symbol]))
+	}
+	args := []string{"-ldflags=" + strings.Join(ldflags, " ")}
+	if tags := b.Tags(); len(tags) > 0 {
+		args = append([]string{"-tags=" + strings.Join(tags, ",")}, args...)
+	}
+	return args
+}
+
+// ldflagQuote quotes s for the -ldflags parser when it has spaces or quotes.
+func ldflagQuote(s string) string {
+	if !strings.ContainsAny(s, " \t'\"") {
+		return s
+	}
+	if !strings.Contains(s, "'") {
+		return "'" + s + "'"
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// mergeBuildTags folds every -tags flag of args into one at the place of the
+// first: go build keeps only the last -tags.
+func mergeBuildTags(args []string) []string {
+	var out, tags []string
+	at := -1
+	for i := 0; i < len(args); i++ {
+		value, ok := strings.CutPrefix(args[i], "-tags=")
+		if !ok && args[i] == "-tags" && i+1 < len(args) {
+			i++
+			value, ok = args[i], true
+		}
+		if !ok {
+			out = append(out, args[i])
+			continue
+		}
+		if at < 0 {
+			at = len(out)
+			out = append(out, "")
+		}
+		for _, t := range strings.Split(value, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tags = append(tags, t)
+			}
+		}
+	}
+	if at >= 0 {
+		out[at] = "-tags=" + strings.Join(dedupe(tags), ",")
+	}
+	return out
+}
+
+// buildTimeFlag is the BuildInfo time in -ldflags, which changes every build.
+var buildTimeFlag = regexp.MustCompile(`-X ` + regexp.QuoteMeta(BuildInfoPackage) + `\.Time=\S*\s?`)
+
+// withoutBuildTime drops the BuildInfo time from args so build cache keys
+// stay stable across builds of the same sources.
+func withoutBuildTime(args []string) []string {
+	out := make([]string, len(args))
+	for i, a := range args {
+		out[i] = buildTimeFlag.ReplaceAllString(a, "")
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (b *BuildVars) changed() {
+	b.mu.Lock()
+	fn := b.onChange
+	b.mu.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+func (b *BuildVars) logf(message ...any) {
+	b.mu.Lock()
+	log := b.log
+	b.mu.Unlock()
+	if log != nil {
+		log(message...)
+	}
+}
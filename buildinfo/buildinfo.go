@@ -0,0 +1,32 @@
+// Package buildinfo holds the values tinywasm injects with -ldflags -X into
+// the wasm client and the server it builds: git commit, build time, mode,
+// env profile and the enabled feature flags. Outside tinywasm builds every
+// value is empty. It has no imports so TinyGo builds stay small.
+package buildinfo
+
+var (
+	Commit   string // short git commit, with "+dirty" for uncommitted changes
+	Time     string // RFC 3339, UTC
+	Mode     string // wasm size mode (L, M, S) or server build profile
+	Profile  string // tinywasm env profile: dev, staging-local, test...
+	Target   string // "wasm" or "server"
+	Features string // enabled feature flags, comma-separated
+)
+
+// Feature reports whether the feature flag name is on in this build.
+// Code behind a flag can also be excluded with //go:build feature_<name>.
+func Feature(name string) bool {
+	if name == "" {
+		return false
+	}
+	start := 0
+	for i := 0; i <= len(Features); i++ {
+		if i == len(Features) || Features[i] == ',' {
+			if Features[start:i] == name {
+				return true
+			}
+			start = i + 1
+		}
+	}
+	return false
+}
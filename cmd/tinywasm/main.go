@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"log"
 	"os"
@@ -21,13 +22,58 @@ var Version = "dev"
 func main() {
 	debugFlag := flag.Bool("debug", false, "Enable debug mode for unfiltered logs")
 	mcpFlag := flag.Bool("mcp", false, "Run as MCP Daemon")
+	wasmSizeFlag := flag.String("wasm-size", "", "Print a JSON size report for the given .wasm file and exit; exits 1 when over the project's size budget (for CI)")
 	flag.Parse()
 
+	if *wasmSizeFlag != "" {
+		if err := printWasmSize(*wasmSizeFlag); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := run(*debugFlag, *mcpFlag); err != nil {
 		os.Exit(1)
 	}
 }
 
+// printWasmSize writes the app.AnalyzeWasmFile report for path to stdout and
+// checks it against the budgets in the project's .env.
+func printWasmSize(path string) error {
+	report, err := app.AnalyzeWasmFile(path)
+	if err != nil {
+		return err
+	}
+
+	root, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if r, err := devflow.FindProjectRoot(root); err == nil {
+		root = r
+	}
+	db, err := kvdb.New(filepath.Join(root, ".env"), nil, &app.FileStore{})
+	if err != nil {
+		return err
+	}
+	budget, err := app.LoadWasmBudget(db)
+	if err != nil {
+		return err
+	}
+	report.Violations = budget.Check(report)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	if len(report.Violations) > 0 {
+		return &app.WasmBudgetError{Violations: report.Violations}
+	}
+	return nil
+}
+
 func run(debug, mcpMode bool) error {
 	// Initialize start directory
 	startDir, err := os.Getwd()
@@ -124,8 +170,13 @@ func run(debug, mcpMode bool) error {
 
 			switch serverType {
 			case "wasi":
-				// Not implemented yet or just return nil/log
-				return nil
+				// Server sources compiled to wasip1, run in-process by wazero
+				return app.NewWasiServer().
+					SetLogger(logger.Logger).
+					SetExitChan(exitChan).
+					SetUI(ui).
+					SetOpenBrowser(browser.OpenBrowser).
+					SetGitIgnoreAdd(gitHandler.GitIgnoreAdd)
 			default:
 				// Default Server implementation
 				return server.New().
@@ -0,0 +1,217 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tinywasm/devflow"
+)
+
+// Code generators the watcher re-runs on its own, before the wasm and server
+// rebuilds, when an edited file carries their directive.
+const (
+	GeneratorOrmc       = "ormc"        // "// ormc:" model directives, run from the module root
+	GeneratorGoGenerate = "go generate" // "//go:generate" directives, run on the edited file
+)
+
+// OrmcInstall is logged when a model file changes and ormc is not installed.
+const OrmcInstall = "go install github.com/tinywasm/orm/cmd/ormc@latest"
+
+// generation is the outcome of the last generator run for a directive file.
+type generation struct {
+	sum [sha256.Size]byte
+	err error
+}
+
+// Generators returns the generators whose directives appear in src, in the
+// order they run. Generated files (a "DO NOT EDIT" header) have none, so
+// regenerating never loops.
+func Generators(src []byte) []string {
+	var gens []string
+	orm, gen := false, false
+	for i, line := range bytes.Split(src, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if i < 5 && bytes.Contains(line, []byte("DO NOT EDIT")) {
+			return nil
+		}
+		orm = orm || bytes.HasPrefix(line, []byte("// ormc:"))
+		gen = gen || bytes.HasPrefix(line, []byte("//go:generate "))
+	}
+	if orm {
+		gens = append(gens, GeneratorOrmc)
+	}
+	if gen {
+		gens = append(gens, GeneratorGoGenerate)
+	}
+	return gens
+}
+
+// Generate re-runs the generators of file (relative to the project root)
+// when its content changed since they last ran, and logs which generated
+// files changed. The wasm and server recorders call it first, so whichever
+// sees the edit first generates and the other finds the work done. A failing
+// generator blocks the build like a failing before-* hook.
+func (b *BuildHooks) Generate(file string) error {
+	abs := filepath.FromSlash(file)
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(b.rootDir, abs)
+	}
+	src, err := os.ReadFile(abs)
+	if err != nil {
+		return nil // removed meanwhile
+	}
+	gens := Generators(src)
+	sum := sha256.Sum256(src)
+	b.run.Lock()
+	defer b.run.Unlock()
+	b.mu.Lock()
+	last, seen := b.generated[abs]
+	if len(gens) == 0 {
+		delete(b.generated, abs)
+	}
+	b.mu.Unlock()
+	if len(gens) == 0 {
+		return nil
+	}
+	if seen && last.sum == sum {
+		return last.err // same content: don't run (or fail) twice
+	}
+
+	dir := filepath.Dir(abs)
+	before := snapshotGoFiles(dir)
+	for _, gen := range gens {
+		if err = b.generate(gen, abs); err != nil {
+			break
+		}
+	}
+	b.mu.Lock()
+	b.generated[abs] = generation{sum, err}
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if changes := diffGoFiles(before, snapshotGoFiles(dir), abs); len(changes) > 0 {
+		b.logf("Regenerated", file+":", strings.Join(changes, ", "))
+	} else {
+		b.logf("Generated code up to date for", file)
+	}
+	return nil
+}
+
+// generate runs one generator for the directive file abs.
+func (b *BuildHooks) generate(gen, abs string) error {
+	var cmd *exec.Cmd
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	switch gen {
+	case GeneratorOrmc:
+		if _, err := exec.LookPath("ormc"); err != nil {
+			// Building anyway is the best we can do; say why the models are stale
+			b.logf("ormc not found, generated models not updated. Install it with:", OrmcInstall)
+			return nil
+		}
+		cmd = exec.CommandContext(ctx, "ormc")
+		cmd.Dir = b.rootDir
+		if root, err := devflow.FindProjectRoot(filepath.Dir(abs)); err == nil {
+			cmd.Dir = root
+		}
+	default:
+		cmd = exec.CommandContext(ctx, "go", "generate", filepath.Base(abs))
+		cmd.Dir = filepath.Dir(abs)
+	}
+
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			b.logf(line)
+		}
+	}
+	name := gen + ": " + b.rel(abs)
+	b.mu.Lock()
+	if err != nil {
+		b.failed = name
+	} else if b.failed == name {
+		b.failed = ""
+	}
+	b.mu.Unlock()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("timed out after %s", hookTimeout)
+		}
+		err = fmt.Errorf("generator %s failed: %w", name, err)
+		b.logf(err)
+		return err
+	}
+	b.logf("Generator", name, "ok", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// snapshotGoFiles maps the .go files of dir to their lines.
+func snapshotGoFiles(dir string) map[string][]string {
+	files := map[string][]string{}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".go" {
+			continue
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, e.Name())); err == nil {
+			files[e.Name()] = strings.Split(string(data), "\n")
+		}
+	}
+	return files
+}
+
+// diffGoFiles summarizes what changed between two snapshots, skipping the
+// directive file itself, e.g. "model_orm.go +12 -3" or "user_orm.go (new, 40 lines)".
+func diffGoFiles(before, after map[string][]string, skip string) []string {
+	var changes []string
+	for name, lines := range after {
+		if name == filepath.Base(skip) {
+			continue
+		}
+		old, existed := before[name]
+		if !existed {
+			changes = append(changes, fmt.Sprintf("%s (new, %d lines)", name, len(lines)))
+			continue
+		}
+		if added, removed := lineDiff(old, lines); added+removed > 0 {
+			changes = append(changes, fmt.Sprintf("%s +%d -%d", name, added, removed))
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok && name != filepath.Base(skip) {
+			changes = append(changes, name+" (removed)")
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// lineDiff counts the lines added and removed, ignoring moves.
+func lineDiff(old, new []string) (added, removed int) {
+	count := map[string]int{}
+	for _, l := range old {
+		count[l]++
+	}
+	for _, l := range new {
+		count[l]--
+	}
+	for _, n := range count {
+		if n > 0 {
+			removed += n
+		} else {
+			added -= n
+		}
+	}
+	return added, removed
+}
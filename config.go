@@ -145,6 +145,36 @@ func (c *Config) DeployEdgeWorkerDir() string {
 	return filepath.Join(c.DeployDir(), "edgeworker")
 }
 
+// DeployReleaseDir returns the relative release output directory path
+// Returns: "deploy/release" (content-hashed assets + asset-manifest.json)
+func (c *Config) DeployReleaseDir() string {
+	return filepath.Join(c.DeployDir(), "release")
+}
+
+// DeployArtifactsDir returns the relative directory of the kept build artifacts
+// Returns: "deploy/artifacts" (last N wasm/server builds + index.json)
+func (c *Config) DeployArtifactsDir() string {
+	return filepath.Join(c.DeployDir(), "artifacts")
+}
+
+// DeployCoverageFile returns the relative path of the merged test coverage profile
+// Returns: "deploy/coverage.out" (go test -coverprofile format)
+func (c *Config) DeployCoverageFile() string {
+	return filepath.Join(c.DeployDir(), "coverage.out")
+}
+
+// DeployServerCoverDir returns the relative GOCOVERDIR of the cover server profile
+// Returns: "deploy/servercover" (read with go tool covdata)
+func (c *Config) DeployServerCoverDir() string {
+	return filepath.Join(c.DeployDir(), "servercover")
+}
+
+// DeployProfilesDir returns the relative directory of captured pprof profiles
+// Returns: "deploy/profiles" (<target>-<kind>-<time>.pb.gz)
+func (c *Config) DeployProfilesDir() string {
+	return filepath.Join(c.DeployDir(), "profiles")
+}
+
 // === CONFIGURATION ===
 
 // ServerPort returns the default server port or overrides from PORT env var
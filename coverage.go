@@ -0,0 +1,436 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StoreKeyCoverage disables coverage collection when set to "false" (toggled
+// from the TESTS tab).
+const StoreKeyCoverage = "TINYWASM_COVERAGE"
+
+// StoreKeyCoverageSummary keeps the last known coverage per package as
+// "<package>:<percent>,..." so deltas survive restarts.
+const StoreKeyCoverageSummary = "TINYWASM_COVERAGE_SUMMARY"
+
+// CoverageBlock is one block of a go test -coverprofile.
+type CoverageBlock struct {
+	File      string // import path of the package + "/" + file name
+	StartLine int
+	StartCol  int
+	EndLine   int
+	EndCol    int
+	Stmts     int
+	Count     int
+}
+
+func (b CoverageBlock) key() string {
+	return fmt.Sprintf("%s:%d.%d,%d.%d", b.File, b.StartLine, b.StartCol, b.EndLine, b.EndCol)
+}
+
+// ParseCoverProfile parses the go test -coverprofile format.
+func ParseCoverProfile(data []byte) ([]CoverageBlock, error) {
+	var blocks []CoverageBlock
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		// example.com/m/a/a.go:3.24,3.38 1 1
+		colon := strings.LastIndex(line, ":")
+		fields := strings.Fields(line[colon+1:])
+		if colon < 0 || len(fields) != 3 {
+			return nil, fmt.Errorf("coverage profile line %d: %q", n, line)
+		}
+		b := CoverageBlock{File: line[:colon]}
+		_, err := fmt.Sscanf(fields[0], "%d.%d,%d.%d", &b.StartLine, &b.StartCol, &b.EndLine, &b.EndCol)
+		if err == nil {
+			b.Stmts, err = strconv.Atoi(fields[1])
+		}
+		if err == nil {
+			b.Count, err = strconv.Atoi(fields[2])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("coverage profile line %d: %w", n, err)
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, scanner.Err()
+}
+
+// FileCoverage is the coverage of one source file.
+type FileCoverage struct {
+	File      string      `json:"file"`
+	Percent   float64     `json:"percent"`
+	Stmts     int         `json:"statements"`
+	Covered   int         `json:"covered"`
+	Uncovered []LineRange `json:"uncovered,omitempty"`
+}
+
+// LineRange is an inclusive range of source lines.
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// PackageCoverage is the coverage of one package and its files.
+type PackageCoverage struct {
+	Package string         `json:"package"`
+	Percent float64        `json:"percent"`
+	Delta   float64        `json:"delta"` // vs the previous run of the package
+	Stmts   int            `json:"statements"`
+	Covered int            `json:"covered"`
+	Files   []FileCoverage `json:"files,omitempty"`
+}
+
+// Coverage merges the coverage profiles of every test round: each round
+// replaces the blocks of the packages it tested, per target, and a block
+// counts as covered when a test of either target ran it. The merged profile
+// is written to the coverage file (deploy/coverage.out), so it survives
+// restarts and works with go tool cover.
+type Coverage struct {
+	mu       sync.Mutex
+	db       DB
+	file     string
+	enabled  bool
+	profiles map[string]map[string][]CoverageBlock // target -> package -> blocks; "" holds the loaded file
+	previous map[string]float64                    // package percent before the last round
+	log      func(message ...any)
+}
+
+// NewCoverage reads the toggle from db (enabled by default) and loads the
+// merged profile kept in file.
+func NewCoverage(db DB, file string) *Coverage {
+	c := &Coverage{
+		db:       db,
+		file:     file,
+		enabled:  true,
+		profiles: map[string]map[string][]CoverageBlock{},
+		previous: map[string]float64{},
+	}
+	if db != nil {
+		if v, err := db.Get(StoreKeyCoverage); err == nil && v == "false" {
+			c.enabled = false
+		}
+		if v, err := db.Get(StoreKeyCoverageSummary); err == nil {
+			for _, entry := range strings.Split(v, ",") {
+				pkg, pct, ok := strings.Cut(entry, ":")
+				if f, err := strconv.ParseFloat(pct, 64); ok && err == nil {
+					c.previous[pkg] = f
+				}
+			}
+		}
+	}
+	if data, err := os.ReadFile(file); err == nil {
+		if blocks, err := ParseCoverProfile(data); err == nil {
+			c.profiles[""] = byPackage(blocks)
+		}
+	}
+	return c
+}
+
+func byPackage(blocks []CoverageBlock) map[string][]CoverageBlock {
+	out := map[string][]CoverageBlock{}
+	for _, b := range blocks {
+		pkg := path.Dir(b.File)
+		out[pkg] = append(out[pkg], b)
+	}
+	return out
+}
+
+func (c *Coverage) Name() string { return "Coverage" }
+
+// Label shows the total coverage, e.g. "Coverage 72.4%".
+func (c *Coverage) Label() string {
+	pkgs := c.Packages()
+	if len(pkgs) == 0 {
+		return "Coverage"
+	}
+	stmts, covered := 0, 0
+	for _, p := range pkgs {
+		stmts, covered = stmts+p.Stmts, covered+p.Covered
+	}
+	return fmt.Sprintf("Coverage %.1f%%", percent(covered, stmts))
+}
+
+// Value implements HandlerEdit.Value, e.g. "Coverage:T".
+func (c *Coverage) Value() string {
+	if c.Enabled() {
+		return "Coverage:T"
+	}
+	return "Coverage:F"
+}
+
+// Change implements HandlerEdit.Change, accepting "Coverage:T" or "Coverage:F".
+func (c *Coverage) Change(newValue string) {
+	key, val, ok := strings.Cut(newValue, ":")
+	if !ok || strings.TrimSpace(key) != "Coverage" {
+		return
+	}
+	val = strings.ToLower(strings.TrimSpace(val))
+	c.SetEnabled(val == "t" || val == "true")
+}
+
+func (c *Coverage) SetLog(f func(message ...any)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.log = f
+}
+
+// Enabled reports whether test rounds collect coverage.
+func (c *Coverage) Enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enabled
+}
+
+// SetEnabled toggles coverage collection and persists the choice.
+func (c *Coverage) SetEnabled(on bool) {
+	c.mu.Lock()
+	c.enabled = on
+	db := c.db
+	c.mu.Unlock()
+	if db != nil {
+		db.Set(StoreKeyCoverage, strconv.FormatBool(on))
+	}
+	if on {
+		c.logf("Coverage collected on each test round")
+	} else {
+		c.logf("Coverage disabled")
+	}
+}
+
+// Record merges the profile of a test round on target, replacing the blocks
+// of the packages it covers, then saves the merged profile and logs the
+// coverage of those packages.
+func (c *Coverage) Record(target string, profile []byte) error {
+	blocks, err := ParseCoverProfile(profile)
+	if err != nil {
+		return err
+	}
+	tested := byPackage(blocks)
+	if len(tested) == 0 {
+		return nil
+	}
+
+	before := map[string]float64{}
+	for _, p := range c.Packages() {
+		before[p.Package] = p.Percent
+	}
+	c.mu.Lock()
+	if c.profiles[target] == nil {
+		c.profiles[target] = map[string][]CoverageBlock{}
+	}
+	for pkg, b := range tested {
+		c.profiles[target][pkg] = b
+		delete(c.profiles[""], pkg) // superseded by a fresh run
+	}
+	for pkg, pct := range before {
+		if _, ok := tested[pkg]; ok {
+			c.previous[pkg] = pct
+		}
+	}
+	c.mu.Unlock()
+
+	var names []string
+	for pkg := range tested {
+		names = append(names, pkg)
+	}
+	sort.Strings(names)
+	byName := map[string]PackageCoverage{}
+	for _, p := range c.Packages() {
+		byName[p.Package] = p
+	}
+	for _, pkg := range names {
+		p := byName[pkg]
+		msg := fmt.Sprintf("%s %.1f%%", pkg, p.Percent)
+		if p.Delta != 0 {
+			msg += fmt.Sprintf(" (%+.1f)", p.Delta)
+		}
+		c.logf(msg)
+	}
+	return c.save()
+}
+
+// merged returns the blocks of every file, a block being covered when any
+// target ran it.
+func (c *Coverage) merged() map[string][]CoverageBlock {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seen := map[string]int{} // block key -> index in files[file]
+	files := map[string][]CoverageBlock{}
+	for _, pkgs := range c.profiles {
+		for _, blocks := range pkgs {
+			for _, b := range blocks {
+				k := b.key()
+				if i, ok := seen[k]; ok {
+					files[b.File][i].Count += b.Count
+					continue
+				}
+				seen[k] = len(files[b.File])
+				files[b.File] = append(files[b.File], b)
+			}
+		}
+	}
+	return files
+}
+
+// Packages summarizes the merged coverage per package and file, sorted by
+// package.
+func (c *Coverage) Packages() []PackageCoverage {
+	pkgs := map[string]*PackageCoverage{}
+	for file, blocks := range c.merged() {
+		fc := fileCoverage(file, blocks)
+		fc.Uncovered = nil
+		pkg := path.Dir(file)
+		p := pkgs[pkg]
+		if p == nil {
+			p = &PackageCoverage{Package: pkg}
+			pkgs[pkg] = p
+		}
+		p.Stmts += fc.Stmts
+		p.Covered += fc.Covered
+		p.Files = append(p.Files, fc)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []PackageCoverage
+	for _, p := range pkgs {
+		p.Percent = percent(p.Covered, p.Stmts)
+		if prev, ok := c.previous[p.Package]; ok {
+			p.Delta = round1(p.Percent - prev)
+		}
+		sort.Slice(p.Files, func(i, j int) bool { return p.Files[i].File < p.Files[j].File })
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Package < out[j].Package })
+	return out
+}
+
+// File returns the coverage of one file with its uncovered line ranges. name
+// is the file path relative to the project root (e.g. "models/user.go") or
+// as listed in the profile (import path + file name).
+func (c *Coverage) File(name string) (*FileCoverage, error) {
+	name = filepath.ToSlash(strings.TrimPrefix(name, "./"))
+	var match string
+	files := c.merged()
+	for file := range files {
+		if file == name || strings.HasSuffix(file, "/"+name) {
+			if match != "" && len(file) >= len(match) {
+				continue // keep the shortest match: the closest to name
+			}
+			match = file
+		}
+	}
+	if match == "" {
+		return nil, fmt.Errorf("no coverage for %s: run the tests of its package first", name)
+	}
+	fc := fileCoverage(match, files[match])
+	return &fc, nil
+}
+
+func fileCoverage(file string, blocks []CoverageBlock) FileCoverage {
+	fc := FileCoverage{File: file}
+	covered := map[int]bool{} // lines run by some block
+	var missed []CoverageBlock
+	for _, b := range blocks {
+		fc.Stmts += b.Stmts
+		if b.Count > 0 {
+			fc.Covered += b.Stmts
+			for l := b.StartLine; l <= b.EndLine; l++ {
+				covered[l] = true
+			}
+		} else {
+			missed = append(missed, b)
+		}
+	}
+	fc.Percent = percent(fc.Covered, fc.Stmts)
+
+	// Lines shared with a covered block (e.g. "} else {") are not reported
+	lines := map[int]bool{}
+	for _, b := range missed {
+		for l := b.StartLine; l <= b.EndLine; l++ {
+			if !covered[l] {
+				lines[l] = true
+			}
+		}
+	}
+	var sorted []int
+	for l := range lines {
+		sorted = append(sorted, l)
+	}
+	sort.Ints(sorted)
+	for _, l := range sorted {
+		if n := len(fc.Uncovered); n > 0 && fc.Uncovered[n-1].End == l-1 {
+			fc.Uncovered[n-1].End = l
+		} else {
+			fc.Uncovered = append(fc.Uncovered, LineRange{l, l})
+		}
+	}
+	return fc
+}
+
+// save writes the merged profile and the per-package summary.
+func (c *Coverage) save() error {
+	files := c.merged()
+	var names []string
+	for f := range files {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	buf.WriteString("mode: set\n")
+	for _, f := range names {
+		for _, b := range files[f] {
+			count := 0
+			if b.Count > 0 {
+				count = 1
+			}
+			fmt.Fprintf(&buf, "%s:%d.%d,%d.%d %d %d\n", b.File, b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.Stmts, count)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(c.file), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(c.file, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if c.db != nil {
+		var summary []string
+		for _, p := range c.Packages() {
+			summary = append(summary, p.Package+":"+strconv.FormatFloat(p.Percent, 'f', 1, 64))
+		}
+		return c.db.Set(StoreKeyCoverageSummary, strings.Join(summary, ","))
+	}
+	return nil
+}
+
+func percent(covered, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return round1(100 * float64(covered) / float64(total))
+}
+
+func round1(f float64) float64 {
+	v, _ := strconv.ParseFloat(strconv.FormatFloat(f, 'f', 1, 64), 64)
+	return v
+}
+
+func (c *Coverage) logf(message ...any) {
+	c.mu.Lock()
+	log := c.log
+	c.mu.Unlock()
+	if log != nil {
+		log(message...)
+	}
+}
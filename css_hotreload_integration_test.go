@@ -21,9 +21,9 @@ package mymodule
 func RenderCSS() string { return ".v1 { color: red; }" }
 `), 0644)
 
-	TestMode = true
 	h := &Handler{
 		RootDir: root,
+		Options: TestOptions(root),
 		Config:  NewConfig(root, nil),
 		Tui:     &mockTui{},
 		DB:      &mockDB{},
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/tinywasm/app/dashboard"
 	"github.com/tinywasm/context"
 	"github.com/tinywasm/fmt"
 	twjson "github.com/tinywasm/json"
@@ -18,6 +19,9 @@ import (
 	"syscall"
 )
 
+// actionWaitTimeout bounds how long a wait=true action request blocks.
+const actionWaitTimeout = 60 * time.Second
+
 // runDaemon starts the global MCP daemon on port 3030
 func runDaemon(cfg BootstrapConfig) {
 	var logger func(messages ...any)
@@ -48,15 +52,6 @@ func runDaemon(cfg BootstrapConfig) {
 		ui = NewHeadlessTUI(logger)
 	}
 
-	// Create SSE server (tinywasm/sse)
-	tinySSE := sse.New(&sse.Config{})
-	sseServer := tinySSE.Server(&sse.ServerConfig{
-		ChannelProvider:     &logChannelProvider{},
-		ClientChannelBuffer: 256,
-		HistoryReplayBuffer: 100,
-		ReplayAllOnConnect:  true,
-	})
-
 	// Load or create API key for this daemon instance
 	apiKey, err := loadOrCreateAPIKey(cfg.APIKeyPath)
 	if err != nil {
@@ -71,6 +66,15 @@ func runDaemon(cfg BootstrapConfig) {
 		auth = mcp.OpenAuthorizer()
 	}
 
+	// Create SSE server (tinywasm/sse)
+	tinySSE := sse.New(&sse.Config{})
+	sseServer := tinySSE.Server(&sse.ServerConfig{
+		ChannelProvider:     &logChannelProvider{auth: auth},
+		ClientChannelBuffer: 256,
+		HistoryReplayBuffer: 100,
+		ReplayAllOnConnect:  true,
+	})
+
 	mcpConfig := mcp.Config{
 		Name:    "TinyWasm - Global MCP Server",
 		Version: cfg.Version,
@@ -120,6 +124,66 @@ func runDaemon(cfg BootstrapConfig) {
 	dtp.mcpServer = mcpServer
 	dtp.ssePub = ssePub
 
+	// One tracker for every project so action ids survive project restarts
+	actions := NewActionTracker()
+	dtp.actions = actions
+	if hui, ok := ui.(*HeadlessTUI); ok {
+		hui.Actions = actions
+	}
+
+	// dispatchAction routes key to the running project first, then the daemon
+	// UI, then the daemon's own lifecycle keys. Returns false for unknown keys.
+	dispatchAction := func(key, value string) (*Action, bool) {
+		dtp.mu.Lock()
+		projectTui := dtp.projectTui
+		dtp.mu.Unlock()
+		if projectTui != nil {
+			if a, ok := projectTui.StartAction(key, value); ok {
+				return a, true
+			}
+		}
+		if hui, ok := ui.(*HeadlessTUI); ok {
+			if a, ok := hui.StartAction(key, value); ok {
+				return a, true
+			}
+		} else if ui.DispatchAction(key, value) {
+			return actions.Dispatched(key, value), true
+		}
+
+		switch key {
+		case "start":
+			return actions.Run(key, value, "daemon", func() error {
+				if value == "" {
+					return fmt.Errf("start requires a project path")
+				}
+				logger("Start command received for path:", value)
+				go dtp.startProject(value)
+				return nil
+			}), true
+		case "stop":
+			return actions.Run(key, value, "daemon", func() error {
+				logger("Stop command received from UI")
+				dtp.stopProject()
+				return nil
+			}), true
+		case "restart":
+			return actions.Run(key, value, "daemon", func() error {
+				logger("Restart command received from UI")
+				dtp.restartCurrentProject()
+				return nil
+			}), true
+		case "quit":
+			return actions.Run(key, value, "daemon", func() error {
+				logger("Quit command received from client — shutting down daemon")
+				dtp.stopProject()
+				daemonOnce.Do(func() { close(exitChan) })
+				return nil
+			}), true
+		}
+		logger("Unknown UI action:", key)
+		return nil, false
+	}
+
 	mux := http.NewServeMux()
 
 	// SSE endpoint (from tinywasm/sse)
@@ -166,6 +230,7 @@ func runDaemon(cfg BootstrapConfig) {
 			projectTui := dtp.projectTui
 			dtp.mu.Unlock()
 
+			revision := ssePub.StateRevision() // before the snapshot, see GET /tinywasm/state
 			var stateJSON []byte
 			if projectTui != nil {
 				stateJSON = projectTui.GetHandlerStates()
@@ -181,6 +246,7 @@ func runDaemon(cfg BootstrapConfig) {
 			var respBytes []byte
 			twjson.Encode(&sr, &respBytes)
 			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-State-Revision", fmt.Sprint(revision))
 			w.Write(respBytes)
 
 		case "tinywasm/action":
@@ -199,39 +265,26 @@ func runDaemon(cfg BootstrapConfig) {
 
 			key := string(unquote(mcp.ExtractJSONValue(pBytes, "key")))
 			value := string(unquote(mcp.ExtractJSONValue(pBytes, "value")))
+			wait := string(mcp.ExtractJSONValue(pBytes, "wait")) == "true"
 
-			handled := false
-			dtp.mu.Lock()
-			projectTui := dtp.projectTui
-			dtp.mu.Unlock()
-			if projectTui != nil && projectTui.DispatchAction(key, value) {
-				handled = true
-			} else if ui.DispatchAction(key, value) {
-				handled = true
+			a, ok := dispatchAction(key, value)
+			w.Header().Set("Content-Type", "application/json")
+			if !ok {
+				w.Write([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"error":{"code":-32602,"message":%s}}`, id, unknownActionMessage(key))))
+				return
 			}
-			if !handled {
-				switch key {
-				case "start":
-					if value != "" {
-						logger("Start command received for path:", value)
-						go dtp.startProject(value)
-					}
-				case "stop":
-					dtp.stopProject()
-				case "restart":
-					dtp.restartCurrentProject()
-				case "quit":
-					logger("Quit command received from client — shutting down daemon")
-					dtp.stopProject()
-					daemonOnce.Do(func() { close(exitChan) })
-				default:
-					logger("Unknown UI action:", key)
-				}
+			res := a.Result()
+			if wait {
+				res = a.Wait(actionWaitTimeout)
 			}
-
-			resp := fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"OK"}`, id)
-			w.Header().Set("Content-Type", "application/json")
-			w.Write([]byte(resp))
+			ar := stateResponse{
+				JSONRPC: "2.0",
+				ID:      fmt.RawJSON(id),
+				Result:  fmt.RawJSON(string(res.JSON())),
+			}
+			var respBytes []byte
+			twjson.Encode(&ar, &respBytes)
+			w.Write(respBytes)
 
 		default:
 			// Standard MCP protocol
@@ -261,40 +314,41 @@ func runDaemon(cfg BootstrapConfig) {
 		body, _ := io.ReadAll(r.Body)
 		key := string(unquote(mcp.ExtractJSONValue(body, "key")))
 		value := string(unquote(mcp.ExtractJSONValue(body, "value")))
+		wait := string(mcp.ExtractJSONValue(body, "wait")) == "true" || r.URL.Query().Get("wait") == "true"
 
-		dtp.mu.Lock()
-		projectTui := dtp.projectTui
-		dtp.mu.Unlock()
+		a, ok := dispatchAction(key, value)
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(fmt.Sprintf(`{"error":%s}`, unknownActionMessage(key))))
+			return
+		}
+		res := a.Result()
+		if wait {
+			res = a.Wait(actionWaitTimeout)
+		}
+		if res.Status == ActionPending {
+			w.WriteHeader(http.StatusAccepted)
+		}
+		w.Write(res.JSON())
+	})
 
-		handled := false
-		if projectTui != nil && projectTui.DispatchAction(key, value) {
-			handled = true
-		} else if ui.DispatchAction(key, value) {
-			handled = true
+	// Action status, for callers that did not wait
+	mux.HandleFunc("GET /tinywasm/action/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, token := getAuthCtx(r)
+		if _, err := auth.Authorize(token); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
 		}
 
-		if !handled {
-			switch key {
-			case "start":
-				if value != "" {
-					logger("Start command received for path:", value)
-					go dtp.startProject(value)
-				}
-			case "stop":
-				logger("Stop command received from UI")
-				dtp.stopProject()
-			case "restart":
-				logger("Restart command received from UI")
-				dtp.restartCurrentProject()
-			case "quit":
-				logger("Quit command received from client — shutting down daemon")
-				dtp.stopProject()
-				daemonOnce.Do(func() { close(exitChan) })
-			default:
-				logger("Unknown UI action:", key)
-			}
+		w.Header().Set("Content-Type", "application/json")
+		a, ok := actions.Get(r.PathValue("id"))
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"unknown action id"}`))
+			return
 		}
-		w.Write([]byte("OK"))
+		w.Write(a.Result().JSON())
 	})
 
 	// Register state provider
@@ -309,6 +363,9 @@ func runDaemon(cfg BootstrapConfig) {
 		projectTui := dtp.projectTui
 		dtp.mu.Unlock()
 		w.Header().Set("Content-Type", "application/json")
+		// Read the revision before the snapshot: a refresh published in between
+		// only makes the client fetch the state once more.
+		w.Header().Set("X-State-Revision", fmt.Sprint(ssePub.StateRevision()))
 		if projectTui != nil {
 			w.Write(projectTui.GetHandlerStates())
 		} else {
@@ -316,6 +373,9 @@ func runDaemon(cfg BootstrapConfig) {
 		}
 	})
 
+	// Browser dashboard: a Go+WASM client of the endpoints above
+	mux.Handle("GET /dashboard/", http.StripPrefix("/dashboard", dashboard.Handler()))
+
 	// Server version endpoint
 	mux.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(cfg.Version))
@@ -332,6 +392,7 @@ func runDaemon(cfg BootstrapConfig) {
 	}()
 
 	logger("Daemon listening on", server.Addr)
+	logger("Dashboard available at http://localhost:" + mcpPort + "/dashboard/")
 	if err := server.ListenAndServe(); err != http.ErrServerClosed {
 		logger("Server error:", err)
 	}
@@ -347,7 +408,8 @@ type daemonToolProvider struct {
 	logger        func(messages ...any)
 	projectCancel chan bool
 	projectDone   chan struct{}
-	projectTui    *HeadlessTUI // Current project's TUI (updated per project start)
+	projectTui    *HeadlessTUI   // Current project's TUI (updated per project start)
+	actions       *ActionTracker // Shared by every project TUI so ids stay unique
 	mu            sync.Mutex
 	lastPath      string // Keep track of the last path for remote restarts
 }
@@ -408,6 +470,126 @@ func (d *daemonToolProvider) Tools() []mcp.Tool {
 			Action:      'r',
 			Execute:     d.ExecuteGetLogs,
 		},
+		{
+			Name:        "app_wasm_size_report",
+			Description: "Report where the bytes of the compiled WASM go: total and gzipped size, delta vs the previous build, section sizes, code size per Go package and exceeded size budgets. Requires an active project.",
+			InputSchema: `{"type":"object","properties":{"top":{"type":"integer","description":"Number of packages to list, largest first (default 20, 0 = all)"},"refresh":{"type":"boolean","description":"Re-analyze the current build instead of returning the last report"},"history":{"type":"integer","description":"Also return the last N builds from the size history (time, sizes, triggering file, over budget)"}}}`,
+			Resource:    "wasm",
+			Action:      'r',
+			Execute:     d.executeBrowserTool("app_wasm_size_report"),
+		},
+		{
+			Name:        "app_build_release",
+			Description: "Build a deployable release into deploy/release: content-hashed filenames for wasm, JS, CSS and images, references rewritten in index.html, plus asset-manifest.json. Returns the manifest. Requires an active project.",
+			InputSchema: `{"type":"object","properties":{}}`,
+			Resource:    "release",
+			Action:      'c',
+			Execute:     d.executeBrowserTool("app_build_release"),
+		},
+		{
+			Name:        "app_build_artifacts",
+			Description: "List the kept wasm and server builds, oldest first: id, time, size, size mode, git commit, uncommitted changes and the edited file that triggered each build, plus the pinned wasm build if any. Requires an active project.",
+			InputSchema: `{"type":"object","properties":{"target":{"type":"string","enum":["wasm","server"],"description":"Only list builds of this target"}}}`,
+			Resource:    "artifacts",
+			Action:      'r',
+			Execute:     d.executeBrowserTool("app_build_artifacts"),
+		},
+		{
+			Name:        "app_pin_artifact",
+			Description: "Serve a previous wasm build (id from app_build_artifacts) instead of the latest one until unpinned. Omit id to unpin. Requires an active project.",
+			InputSchema: `{"type":"object","properties":{"id":{"type":"string","description":"Artifact id, e.g. wasm-12; empty to serve the latest build again"}}}`,
+			Resource:    "artifacts",
+			Action:      'u',
+			Execute:     d.executeBrowserTool("app_pin_artifact"),
+		},
+		{
+			Name:        "app_run_tests",
+			Description: "Run go test for a package pattern and optional test regexp and return structured results per package: status, duration, build errors and each test's status, duration and failure output. Requires an active project.",
+			InputSchema: `{"type":"object","properties":{"package":{"type":"string","description":"Package patterns relative to the project root, space separated (default ./...), e.g. ./models"},"run":{"type":"string","description":"Only run tests matching this regexp (go test -run)"},"target":{"type":"string","enum":["server","wasm"],"description":"Run on the host (server) or under GOOS=js GOARCH=wasm with Node.js (wasm); default: every target each package has tests for"}}}`,
+			Resource:    "tests",
+			Action:      'r',
+			Execute:     d.executeBrowserTool("app_run_tests"),
+		},
+		{
+			Name:        "app_coverage",
+			Description: "Test coverage merged from every test round. With a file: its percentage and uncovered line ranges. Without: percentage and delta per package and file. Requires an active project.",
+			InputSchema: `{"type":"object","properties":{"file":{"type":"string","description":"Source file relative to the project root, e.g. models/user.go; omit for the per-package summary"}}}`,
+			Resource:    "tests",
+			Action:      'r',
+			Execute:     d.executeBrowserTool("app_coverage"),
+		},
+		{
+			Name:        "app_diagnostics",
+			Description: "go vet findings per file and line, with the build contexts (wasm, server) reporting each. Set refresh to vet every package first. Requires an active project.",
+			InputSchema: `{"type":"object","properties":{"file":{"type":"string","description":"Only findings of this file, relative to the project root, e.g. web/client.go"},"refresh":{"type":"boolean","description":"Vet every package of both contexts before answering"}}}`,
+			Resource:    "diagnostics",
+			Action:      'r',
+			Execute:     d.executeBrowserTool("app_diagnostics"),
+		},
+		{
+			Name:        "app_wasm_imports",
+			Description: "Server-only or TinyGo-unfriendly packages in the wasm client build, with reason, estimated size and the import chain that pulled them in. Requires an active project.",
+			InputSchema: `{"type":"object","properties":{"refresh":{"type":"boolean","description":"Audit the current sources instead of returning the result of the last build"}}}`,
+			Resource:    "wasm",
+			Action:      'r',
+			Execute:     d.executeBrowserTool("app_wasm_imports"),
+		},
+		{
+			Name:        "app_server_profile",
+			Description: "Get or set the external server build profile: normal, race, debug or cover. Setting one rebuilds the server. Requires an active project.",
+			InputSchema: `{"type":"object","properties":{"profile":{"type":"string","enum":["normal","race","debug","cover"],"description":"Profile to switch to; omit to only read the current one"}}}`,
+			Resource:    "server",
+			Action:      'u',
+			Execute:     d.executeBrowserTool("app_server_profile"),
+		},
+		{
+			Name:        "app_debug_breakpoint",
+			Description: "Set (file, line, cond), clear (clear id) or list breakpoints in the server through the attached Delve. Requires an active project with Debug enabled.",
+			InputSchema: `{"type":"object","properties":{"file":{"type":"string","description":"Source file relative to the project root, e.g. web/server.go"},"line":{"type":"integer","description":"Line to stop at"},"cond":{"type":"string","description":"Go expression; stop only when it is true"},"clear":{"type":"integer","description":"Id of a breakpoint to remove"}}}`,
+			Resource:    "debugger",
+			Action:      'u',
+			Execute:     d.executeBrowserTool("app_debug_breakpoint"),
+		},
+		{
+			Name:        "app_debug_stack",
+			Description: "Stack, arguments and locals where the debugged server is stopped. Requires an active project with Debug enabled.",
+			InputSchema: `{"type":"object","properties":{"goroutine":{"type":"integer","description":"Goroutine id (default: the one that stopped)"},"frame":{"type":"integer","description":"Frame whose variables are read, 0 = innermost"},"depth":{"type":"integer","description":"Maximum frames (default 20)"}}}`,
+			Resource:    "debugger",
+			Action:      'r',
+			Execute:     d.executeBrowserTool("app_debug_stack"),
+		},
+		{
+			Name:        "app_debug_control",
+			Description: "continue, next, step, stepout or halt the debugged server. Requires an active project with Debug enabled.",
+			InputSchema: `{"type":"object","properties":{"action":{"type":"string","enum":["continue","next","step","stepout","halt"]}},"required":["action"]}`,
+			Resource:    "debugger",
+			Action:      'u',
+			Execute:     d.executeBrowserTool("app_debug_control"),
+		},
+		{
+			Name:        "app_profile",
+			Description: "Capture a cpu, heap, goroutine, allocs, block or mutex pprof profile of the project server (target server) or of tinywasm (target tinywasm), saved under deploy/profiles, with the go tool pprof -top summary. inject compiles dev-only pprof endpoints into a server without them. Requires an active project.",
+			InputSchema: `{"type":"object","properties":{"target":{"type":"string","enum":["server","tinywasm"],"description":"Process to profile (default server)"},"kind":{"type":"string","enum":["cpu","heap","goroutine","allocs","block","mutex"]},"seconds":{"type":"integer","description":"CPU sampling time (default 10)"},"top":{"type":"integer","description":"Entries of the summary (default 20)"},"inject":{"type":"boolean","description":"Compile dev-only pprof endpoints into the server (true) or remove them (false); restarts the server"}}}`,
+			Resource:    "profiles",
+			Action:      'c',
+			Execute:     d.executeBrowserTool("app_profile"),
+		},
+		{
+			Name:        "app_env_profile",
+			Description: "Read or edit the server environment profiles (variables and extra CLI args of the server process): use switches profile, var/value sets a variable (\"$KEY\" reads a .env key), args replaces the args. Secrets are masked. Requires an active project.",
+			InputSchema: `{"type":"object","properties":{"use":{"type":"string","description":"Profile to activate, created when new"},"profile":{"type":"string","description":"Profile edited by var/value and args (default: active)"},"var":{"type":"string","description":"Variable name, e.g. DATABASE_URL"},"value":{"type":"string","description":"Variable value; empty removes it"},"args":{"type":"string","description":"Extra server CLI args separated by spaces; empty clears them"}}}`,
+			Resource:    "server",
+			Action:      'u',
+			Execute:     d.executeBrowserTool("app_env_profile"),
+		},
+		{
+			Name:        "app_build_flags",
+			Description: "Read or change feature flags, -ldflags -X variables and build tags compiled into the wasm client and the server (shared or per env profile); a change recompiles both. Returns the effective values, compiler args and BuildInfo. Requires an active project.",
+			InputSchema: `{"type":"object","properties":{"feature":{"type":"string","description":"Feature flag to change"},"enabled":{"type":"boolean","description":"New state of feature; omit to flip it"},"var":{"type":"string","description":"Variable to set with -X, package path and name, e.g. main.apiBase"},"value":{"type":"string","description":"Value of var; empty removes it"},"tags":{"type":"string","description":"Extra build tags, comma-separated; empty clears them"},"profile":{"type":"string","description":"Env profile the change applies to; omit for every profile"}}}`,
+			Resource:    "build",
+			Action:      'u',
+			Execute:     d.executeBrowserTool("app_build_flags"),
+		},
 		{
 			Name:        "browser_screenshot",
 			Description: "Capture screenshot of current browser viewport to verify visual rendering, layout correctness, or UI state. Returns PNG image. Requires an active project.",
@@ -628,6 +810,11 @@ func (d *daemonToolProvider) runProjectLoop(ctx *context.Context, projectPath st
 	headlessTui.RelayLog = func(tabTitle, handlerName, color, msg string) {
 		d.ssePub.PublishTabLog(tabTitle, handlerName, color, msg)
 	}
+	// Ask clients to re-fetch the state only when a handler actually changed
+	headlessTui.OnStateChange = func([]StateEntry, []string) { d.ssePub.PublishStateRefresh() }
+	if d.actions != nil {
+		headlessTui.Actions = d.actions
+	}
 
 	// Register project TUI so /state and /action can reach project handlers
 	d.mu.Lock()
@@ -687,9 +874,13 @@ func (d *daemonToolProvider) runProjectLoop(ctx *context.Context, projectPath st
 			d.cfg.GoModHandler,
 			true,  // headless
 			false, // clientMode
+			d.cfg.Options.forProject(projectPath),
 			onProjectReady,
 			// Empty tools
 		)
+		// The handlers belong to the instance that just stopped; a restart
+		// registers fresh ones.
+		headlessTui.Clear()
 
 		select {
 		case <-cancel:
@@ -40,3 +40,30 @@ func TestStateResponse_EncodesCorrectly(t *testing.T) {
 		t.Errorf("id: got %v, want 1", envelope["id"])
 	}
 }
+
+func TestOptionsForProject_KeepsIDsUnique(t *testing.T) {
+	opts := Options{ID: "daemon", DisableGitIgnore: true}
+
+	a := opts.forProject("/work/a")
+	b := opts.forProject("/work/b")
+	if a.ID == b.ID {
+		t.Fatalf("projects share registry id %q", a.ID)
+	}
+	if !a.DisableGitIgnore {
+		t.Error("forProject must keep the other toggles")
+	}
+	if got := (Options{}).forProject("/work/a").ID; got != "" {
+		t.Errorf("empty ID must stay empty so ID() falls back to RootDir, got %q", got)
+	}
+}
+
+func TestUnknownActionMessage_EscapesKey(t *testing.T) {
+	body := fmt.Sprintf(`{"error":%s}`, unknownActionMessage(`x","injected":"1\`))
+	var got map[string]string
+	if err := stdjson.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, body)
+	}
+	if len(got) != 1 || got["error"] != `unknown action key: x","injected":"1\` {
+		t.Errorf("got %v", got)
+	}
+}
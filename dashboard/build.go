@@ -0,0 +1,36 @@
+//go:build ignore
+
+// build compiles web/client.go into public/client.wasm with tinywasm/client
+// and writes the matching public/script.js bootstrap. Run it through
+// go generate ./dashboard and commit both outputs.
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tinywasm/client"
+	"github.com/tinywasm/js"
+)
+
+func main() {
+	c := client.New(&client.Config{
+		SourceDir: func() string { return "web" },
+		OutputDir: func() string { return "public" },
+	})
+	c.SetLog(func(message ...any) {})
+	c.UseStandardGo()
+	c.UseDiskStorage()
+	if err := c.Compile(); err != nil {
+		log.Fatal("dashboard: ", err)
+	}
+
+	// The page is served under /dashboard/, so the module is fetched
+	// relative to it rather than from the site root.
+	script := strings.ReplaceAll(js.PageBootstrap().Content, `"/client.wasm"`, `"client.wasm"`)
+	if err := os.WriteFile(filepath.Join("public", "script.js"), []byte(script), 0o644); err != nil {
+		log.Fatal("dashboard: ", err)
+	}
+}
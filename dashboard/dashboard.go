@@ -0,0 +1,27 @@
+// Package dashboard serves the browser UI for the tinywasm daemon. The UI is
+// itself a tinywasm project: web/client.go is built with tinywasm/client and
+// renders with tinywasm/dom (see ./ui), talking to the daemon over the same
+// endpoints devtui uses, so it doubles as a dogfood test.
+//
+// public/client.wasm and public/script.js are generated by go generate and
+// committed, so a go install'ed daemon embeds them. Regenerate them after
+// changing web/ or ui/.
+package dashboard
+
+//go:generate go run build.go
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed public
+var public embed.FS
+
+// Handler serves the dashboard assets. Mount it under a prefix with
+// http.StripPrefix, e.g. "/dashboard/".
+func Handler() http.Handler {
+	sub, _ := fs.Sub(public, "public")
+	return http.FileServerFS(sub)
+}
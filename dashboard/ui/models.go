@@ -0,0 +1,45 @@
+package ui
+
+import "github.com/tinywasm/fmt"
+
+// stateEntry mirrors app.StateEntry, the devtui wire contract.
+// ormc:formonly
+type stateEntry struct {
+	TabTitle     string      `json:"tab_title"`
+	HandlerName  string      `json:"handler_name"`
+	HandlerColor string      `json:"handler_color"`
+	HandlerType  int         `json:"handler_type"`
+	Label        string      `json:"label"`
+	Value        string      `json:"value"`
+	Shortcuts    fmt.RawJSON `json:"shortcuts"` // [{"key":"description"}, ...]
+}
+
+// message is one /logs payload: an app.LogEntry, or an app.StateMessage
+// when HandlerType is 0.
+// ormc:formonly
+type message struct {
+	HandlerType  int    `json:"handler_type"`
+	Timestamp    string `json:"timestamp"`
+	Content      string `json:"content"`
+	TabTitle     string `json:"tab_title"`
+	HandlerName  string `json:"handler_name"`
+	HandlerColor string `json:"handler_color"`
+	Revision     int64  `json:"revision"`
+}
+
+// actionRequest is the POST /tinywasm/action body.
+// ormc:formonly
+type actionRequest struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Wait  bool   `json:"wait"`
+}
+
+// actionResult mirrors the fields of app.ActionResult the dashboard shows.
+// A 404 for an unknown key carries only Error.
+// ormc:formonly
+type actionResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error"`
+	NewValue string `json:"new_value"`
+}
@@ -0,0 +1,129 @@
+//go:build wasm
+
+package ui
+
+import (
+	"github.com/tinywasm/dom"
+	"github.com/tinywasm/fetch"
+	. "github.com/tinywasm/fmt"
+	"github.com/tinywasm/json"
+	"github.com/tinywasm/sse"
+)
+
+// tokenKey is the localStorage key holding the daemon API key.
+const tokenKey = "tinywasm_token"
+
+// readToken takes the API key from a #token=... fragment, remembering it,
+// or falls back to the one stored by a previous visit.
+func readToken() string {
+	if hash := dom.GetHash(); HasPrefix(hash, "#token=") {
+		token := hash[len("#token="):]
+		dom.LocalStorageSet(tokenKey, token)
+		dom.SetHash("")
+		return token
+	}
+	token, _ := dom.LocalStorageGet(tokenKey)
+	return token
+}
+
+// request sends an authenticated request and reports the body of a 2xx
+// response, or an error built from the daemon's {"error": ...} reply.
+func (d *dashboard) request(req *fetch.Request, done func(*fetch.Response, error)) {
+	req.ContentTypeJSON()
+	if d.token != "" {
+		req.Header("Authorization", "Bearer "+d.token)
+	}
+	req.Send(func(resp *fetch.Response, err error) {
+		switch {
+		case err != nil:
+			done(nil, err)
+		case resp.Status == 401:
+			done(nil, Err("unauthorized: reload with #token=<api key>"))
+		case resp.Status < 200 || resp.Status > 299:
+			var res actionResult
+			if json.Decode(resp.Body(), &res) == nil && res.Error != "" {
+				done(nil, Err(res.Error))
+				return
+			}
+			done(nil, Errf("HTTP %d", resp.Status))
+		default:
+			done(resp, nil)
+		}
+	})
+}
+
+// resync replaces the handler list with a full snapshot.
+func (d *dashboard) resync() {
+	d.request(fetch.Get("/tinywasm/state"), func(resp *fetch.Response, err error) {
+		if err != nil {
+			d.setStatus("state: " + err.Error())
+			return
+		}
+		rev, _ := Convert(resp.GetHeader("X-State-Revision")).Int64()
+		if err := d.model.resync(resp.Body(), rev); err != nil {
+			d.setStatus("state: " + err.Error())
+			return
+		}
+		d.refresh()
+	})
+}
+
+// listen subscribes to /logs. EventSource cannot send an Authorization
+// header, so the key travels as a query parameter.
+func (d *dashboard) listen() {
+	endpoint := "/logs"
+	if d.token != "" {
+		endpoint += "?token=" + d.token
+	}
+	client := sse.New(&sse.Config{}).Client(&sse.ClientConfig{
+		Endpoint:      endpoint,
+		RetryInterval: 1000,
+		MaxRetryDelay: 10000,
+	})
+	client.OnMessage(func(msg *sse.SSEMessage) {
+		isLog, resync, err := d.model.apply(msg.Data)
+		switch {
+		case err != nil:
+			return
+		case resync:
+			d.resync()
+		case isLog:
+			d.tabs.Update()
+			d.logs.Update()
+		}
+	})
+	client.OnError(func(err error) {
+		// A change missed meanwhile is fetched with the next state signal
+		d.setStatus("logs: reconnecting")
+	})
+	client.Connect()
+}
+
+// dispatch posts an action and shows its result in the status line.
+func (d *dashboard) dispatch(key, value string) {
+	d.setStatus(key + ": running")
+	var body []byte
+	if err := json.Encode(&actionRequest{Key: key, Value: value, Wait: true}, &body); err != nil {
+		d.setStatus(key + ": " + err.Error())
+		return
+	}
+	d.request(fetch.Post("/tinywasm/action").Body(body), func(resp *fetch.Response, err error) {
+		if err != nil {
+			d.setStatus(key + ": " + err.Error())
+			return
+		}
+		var res actionResult
+		if err := json.Decode(resp.Body(), &res); err != nil {
+			d.setStatus(key + ": " + err.Error())
+			return
+		}
+		switch {
+		case res.Error != "":
+			d.setStatus(key + ": " + res.Error)
+		case res.NewValue != "":
+			d.setStatus(key + ": " + res.Status + " (" + res.NewValue + ")")
+		default:
+			d.setStatus(key + ": " + res.Status)
+		}
+	})
+}
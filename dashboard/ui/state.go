@@ -0,0 +1,186 @@
+// Package ui is the browser dashboard served by the tinywasm daemon at
+// /dashboard. It speaks the same wire contract as devtui: the handler list
+// comes from GET /tinywasm/state, logs and state change signals stream from /logs and
+// actions are posted to /tinywasm/action.
+//
+// The model in this file is platform independent; the view and the network
+// code only build for wasm.
+package ui
+
+import (
+	"strings"
+
+	"github.com/tinywasm/json"
+)
+
+// Handler types, matching devtui.HandlerType*.
+const (
+	htDisplay     = 0
+	htEdit        = 1
+	htExecution   = 2
+	htInteractive = 3
+)
+
+// maxLogLines bounds the log lines kept per tab.
+const maxLogLines = 500
+
+type logLine struct {
+	time, handler, color, text string
+}
+
+// shortcut is one ShortcutProvider entry of a handler.
+type shortcut struct {
+	key, description string
+}
+
+// model is the dashboard state. It is only touched from browser callbacks,
+// which run one at a time, so it needs no locking.
+type model struct {
+	revision int64
+	entries  []*stateEntry // in daemon order
+	logs     map[string][]logLine
+	tabs     []string
+	active   string
+	status   string
+	drafts   map[string]string // handler name -> text typed but not sent
+}
+
+func newModel() *model {
+	return &model{logs: map[string][]logLine{}, drafts: map[string]string{}}
+}
+
+// resync replaces the handlers with a GET /tinywasm/state snapshot taken at
+// revision.
+func (m *model) resync(body []byte, revision int64) error {
+	var entries stateEntryList
+	if err := json.Decode(body, &entries); err != nil {
+		return err
+	}
+	m.entries = entries
+	m.revision = revision
+	for _, e := range entries {
+		m.addTab(e.TabTitle)
+	}
+	return nil
+}
+
+// apply handles one /logs payload. isLog tells which part of the page
+// changed; resync is set when the daemon signals a state change the last
+// snapshot does not include, and the snapshot must be fetched again.
+func (m *model) apply(data []byte) (isLog, resync bool, err error) {
+	var msg message
+	if err := json.Decode(data, &msg); err != nil {
+		return false, false, err
+	}
+	if msg.HandlerType != 0 {
+		m.appendLog(&msg)
+		return true, false, nil
+	}
+	return false, msg.Revision == 0 || msg.Revision > m.revision, nil
+}
+
+func (m *model) appendLog(msg *message) {
+	tab := msg.TabTitle
+	if tab == "" {
+		tab = "MCP"
+	}
+	m.addTab(tab)
+	lines := append(m.logs[tab], logLine{
+		time:    msg.Timestamp,
+		handler: msg.HandlerName,
+		color:   msg.HandlerColor,
+		text:    msg.Content,
+	})
+	if len(lines) > maxLogLines {
+		lines = lines[len(lines)-maxLogLines:]
+	}
+	m.logs[tab] = lines
+}
+
+func (m *model) addTab(title string) {
+	if title == "" {
+		return
+	}
+	for _, t := range m.tabs {
+		if t == title {
+			return
+		}
+	}
+	m.tabs = append(m.tabs, title)
+	if m.active == "" {
+		m.active = title
+	}
+}
+
+// shortcuts returns the shortcut entries of e in daemon order.
+func (e *stateEntry) shortcuts() []shortcut {
+	var out []shortcut
+	s := jsonStrings(e.Shortcuts)
+	for i := 0; i+1 < len(s); i += 2 {
+		out = append(out, shortcut{key: s[i], description: s[i+1]})
+	}
+	return out
+}
+
+// jsonStrings returns the string tokens of raw in order. The daemon encodes
+// removed handler names as a string array and shortcuts as single-entry
+// objects, neither of which fits a Fielder, so both are read this way.
+func jsonStrings(raw string) []string {
+	var out []string
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '"' {
+			continue
+		}
+		var b strings.Builder
+		for i++; i < len(raw) && raw[i] != '"'; i++ {
+			if raw[i] != '\\' || i+1 >= len(raw) {
+				b.WriteByte(raw[i])
+				continue
+			}
+			i++
+			switch raw[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'u':
+				if i+4 < len(raw) {
+					b.WriteRune(hexRune(raw[i+1 : i+5]))
+					i += 4
+				}
+			default: // \" \\ \/
+				b.WriteByte(raw[i])
+			}
+		}
+		out = append(out, b.String())
+	}
+	return out
+}
+
+// hexRune decodes the four hex digits of a \u escape.
+func hexRune(h string) rune {
+	var r rune
+	for _, c := range h {
+		r <<= 4
+		switch {
+		case c >= '0' && c <= '9':
+			r |= c - '0'
+		case c >= 'a' && c <= 'f':
+			r |= c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			r |= c - 'A' + 10
+		}
+	}
+	return r
+}
+
+// escape makes s safe as HTML text or as a single-quoted attribute value:
+// tinywasm/dom writes both verbatim.
+func escape(s string) string {
+	if !strings.ContainsAny(s, `&<>'"`) {
+		return s
+	}
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "'", "&#39;", `"`, "&quot;").Replace(s)
+}
@@ -0,0 +1,39 @@
+package ui
+
+import "testing"
+
+func TestModel_ResyncsOnNewerStateSignals(t *testing.T) {
+	m := newModel()
+	snapshot := `[{"tab_title":"BUILD","handler_name":"wasm","handler_type":1,"value":"L","shortcuts":[{"L":"large"}]}]`
+	if err := m.resync([]byte(snapshot), 3); err != nil {
+		t.Fatal(err)
+	}
+	if m.active != "BUILD" || len(m.entries) != 1 {
+		t.Fatalf("after resync: active=%q entries=%d", m.active, len(m.entries))
+	}
+	if sc := m.entries[0].shortcuts(); len(sc) != 1 || sc[0].key != "L" || sc[0].description != "large" {
+		t.Fatalf("shortcuts = %+v", sc)
+	}
+
+	// A signal the snapshot already includes is ignored, a newer one resyncs
+	if _, resync, _ := m.apply([]byte(`{"handler_type":0,"revision":3}`)); resync {
+		t.Fatal("stale signal requested a resync")
+	}
+	if _, resync, err := m.apply([]byte(`{"handler_type":0,"revision":4}`)); err != nil || !resync {
+		t.Fatalf("apply: resync=%v err=%v", resync, err)
+	}
+	if _, resync, _ := m.apply([]byte(`{"handler_type":0}`)); !resync {
+		t.Fatal("signal without revision did not request a resync")
+	}
+}
+
+func TestModel_LogsDefaultToMCPTab(t *testing.T) {
+	m := newModel()
+	isLog, _, err := m.apply([]byte(`{"handler_type":4,"content":"<b>hi</b>","handler_name":"mcp"}`))
+	if err != nil || !isLog {
+		t.Fatalf("isLog=%v err=%v", isLog, err)
+	}
+	if lines := m.logs["MCP"]; len(lines) != 1 || escape(lines[0].text) != "&lt;b&gt;hi&lt;/b&gt;" {
+		t.Fatalf("logs = %+v", m.logs)
+	}
+}
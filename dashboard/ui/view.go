@@ -0,0 +1,181 @@
+//go:build wasm
+
+package ui
+
+import (
+	"strings"
+
+	. "github.com/tinywasm/dom"
+	. "github.com/tinywasm/html"
+)
+
+// Run mounts the dashboard into the #app element and connects to the daemon.
+// Event handlers, fetch and SSE callbacks all run on the browser event loop,
+// so the model is never accessed concurrently.
+func Run() {
+	d := &dashboard{model: newModel(), token: readToken()}
+	d.tabs = &tabsView{d: d}
+	d.handlers = &handlersView{d: d}
+	d.logs = &logsView{d: d}
+	d.status = &statusView{d: d}
+	d.tabs.SetID("tabs")
+	d.handlers.SetID("handlers")
+	d.logs.SetID("logs")
+	d.status.SetID("status")
+
+	if err := Render("app", d); err != nil {
+		Log("dashboard:", err)
+		return
+	}
+	d.resync()
+	d.listen()
+}
+
+type dashboard struct {
+	Element
+	model *model
+	token string
+
+	tabs     *tabsView
+	handlers *handlersView
+	logs     *logsView
+	status   *statusView
+}
+
+func (d *dashboard) Render() *Element {
+	return Div(
+		Header(H1("TinyWASM"), d.tabs),
+		d.handlers,
+		d.logs,
+		d.status,
+	).Class("dashboard")
+}
+
+// setStatus shows msg in the footer.
+func (d *dashboard) setStatus(msg string) {
+	d.model.status = msg
+	d.status.Update()
+}
+
+// refresh redraws everything that depends on the handler list or the tab.
+func (d *dashboard) refresh() {
+	d.tabs.Update()
+	d.handlers.Update()
+	d.logs.Update()
+}
+
+type tabsView struct {
+	Element
+	d *dashboard
+}
+
+func (v *tabsView) Render() *Element {
+	nav := Nav()
+	for _, title := range v.d.model.tabs {
+		btn := Button(escape(title)).On("click", func(Event) {
+			v.d.model.active = title
+			v.d.refresh()
+		})
+		if title == v.d.model.active {
+			btn.Class("active")
+		}
+		nav.Add(btn)
+	}
+	return nav
+}
+
+type handlersView struct {
+	Element
+	d *dashboard
+}
+
+func (v *handlersView) Render() *Element {
+	m := v.d.model
+	list := Section()
+	for _, e := range m.entries {
+		if e.TabTitle != m.active {
+			continue
+		}
+		label := e.Label
+		if label == "" {
+			label = e.HandlerName
+		}
+		row := Div(Span(escape(label))).Class("handler").
+			Attr("style", "border-left-color:"+escape(e.HandlerColor))
+
+		name := e.HandlerName
+		switch e.HandlerType {
+		case htEdit, htInteractive:
+			value := e.Value
+			if draft, ok := m.drafts[name]; ok {
+				value = draft
+			}
+			// A stable id lets dom.Update restore focus while the user types
+			row.Add(NewElement("form").Add(
+				Input("text").ID(inputID(name)).Attr("value", escape(value)).
+					On("input", func(ev Event) { m.drafts[name] = ev.TargetValue() }),
+			).On("submit", func(ev Event) {
+				ev.PreventDefault()
+				if ref, ok := Get(inputID(name)); ok {
+					delete(m.drafts, name)
+					v.d.dispatch(name, ref.Value())
+				}
+			}))
+		case htExecution:
+			row.Add(Button("Run").On("click", func(Event) { v.d.dispatch(name, "") }))
+			if e.Value != "" {
+				row.Add(Code(escape(e.Value)))
+			}
+		default:
+			row.Add(Code(escape(e.Value)))
+		}
+
+		for _, sc := range e.shortcuts() {
+			key := sc.key
+			row.Add(Button(escape(key)).Class("shortcut").Attr("title", escape(sc.description)).
+				On("click", func(Event) { v.d.dispatch(key, key) }))
+		}
+		list.Add(row)
+	}
+	return list
+}
+
+// inputID returns the element id of the input editing handler name.
+func inputID(name string) string {
+	return "in-" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, name)
+}
+
+type logsView struct {
+	Element
+	d *dashboard
+}
+
+// Render lists the newest line first; the pane uses column-reverse so it
+// stays scrolled to the bottom without touching scrollTop.
+func (v *logsView) Render() *Element {
+	pane := Div()
+	lines := v.d.model.logs[v.d.model.active]
+	for i := len(lines) - 1; i >= 0; i-- {
+		l := lines[i]
+		pane.Add(Div(
+			NewElement("time").Add(escape(l.time)),
+			Strong(escape(l.handler)).Attr("style", "color:"+escape(l.color)),
+			Span(escape(l.text)),
+		))
+	}
+	return pane
+}
+
+type statusView struct {
+	Element
+	d *dashboard
+}
+
+func (v *statusView) Render() *Element {
+	return Footer(escape(v.d.model.status))
+}
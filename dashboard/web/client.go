@@ -0,0 +1,12 @@
+//go:build wasm
+
+// Command web is the dashboard frontend, compiled to public/client.wasm by
+// go generate ./dashboard.
+package main
+
+import "github.com/tinywasm/app/dashboard/ui"
+
+func main() {
+	ui.Run()
+	select {}
+}
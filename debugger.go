@@ -0,0 +1,712 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Project store keys of the Delve integration.
+const (
+	StoreKeyDebugger     = "TINYWASM_DEBUGGER" // "true" runs the server under Delve
+	StoreKeyDebuggerPort = "TINYWASM_DLV_PORT" // headless Delve port, default 2345
+)
+
+// DlvInstall is the command suggested when dlv is not in PATH.
+const DlvInstall = "go install github.com/go-delve/delve/cmd/dlv@latest"
+
+// DebugLaunchName names the attach configuration written to the IDE configs.
+const DebugLaunchName = "tinywasm: attach server (Delve)"
+
+const (
+	defaultDlvPort  = "2345"
+	debugDialPeriod = 100 * time.Millisecond // how often a starting Delve is dialed
+	debugDialLimit  = 30 * time.Second       // how long Delve may take to listen
+	debugWaitStop   = 2 * time.Second        // how long continue/step wait for a stop
+	debugCallLimit  = 10 * time.Second       // other JSON-RPC calls
+)
+
+// DebugBreakpoint is a breakpoint set in the server.
+type DebugBreakpoint struct {
+	ID       int    `json:"id"`
+	File     string `json:"file"` // relative to the project root when inside it
+	Line     int    `json:"line"`
+	Function string `json:"function,omitempty"`
+	Cond     string `json:"cond,omitempty"`
+	Hits     uint64 `json:"hits"`
+}
+
+// DebugFrame is one frame of a goroutine stack.
+type DebugFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// DebugVariable is a local or argument of the selected frame.
+type DebugVariable struct {
+	Name     string          `json:"name"`
+	Type     string          `json:"type"`
+	Value    string          `json:"value,omitempty"`
+	Children []DebugVariable `json:"children,omitempty"` // struct fields, elements
+}
+
+// DebugState is where the server is stopped: the goroutine, its stack and,
+// for the selected frame, arguments and locals. Only Running is set while
+// the server runs.
+type DebugState struct {
+	Running    bool            `json:"running"`
+	Exited     bool            `json:"exited,omitempty"`
+	Goroutine  int64           `json:"goroutine,omitempty"`
+	Breakpoint int             `json:"breakpoint,omitempty"` // id of the breakpoint hit
+	File       string          `json:"file,omitempty"`
+	Line       int             `json:"line,omitempty"`
+	Function   string          `json:"function,omitempty"`
+	Frame      int             `json:"frame"`
+	Frames     []DebugFrame    `json:"frames,omitempty"`
+	Args       []DebugVariable `json:"args,omitempty"`
+	Locals     []DebugVariable `json:"locals,omitempty"`
+}
+
+// Debugger runs the external server under a headless Delve (dlv exec
+// --continue) through the server's run hook, so every restart starts a new
+// Delve with the new binary. IDEs (launch configs written to .vscode and
+// .idea) and the app_debug_* tools debug it over JSON-RPC without stopping
+// tinywasm. Breakpoints are kept here and set again in each new Delve.
+type Debugger struct {
+	mu          sync.Mutex
+	db          DB
+	rootDir     string
+	addr        string
+	enabled     bool
+	breakpoints []debugBreakpoint
+	nextID      int
+	generation  int // of the Delve last started, see RunHook
+	client      *rpc.Client
+	onChange    func()
+	log         func(message ...any)
+}
+
+// debugBreakpoint is a kept breakpoint: its own id, stable across restarts,
+// and the one of the running Delve (0 until set there). File is absolute.
+type debugBreakpoint struct {
+	DebugBreakpoint
+	dlvID int
+}
+
+// NewDebugger debugs the server of the project at rootDir, with Delve
+// listening on the port of StoreKeyDebuggerPort.
+func NewDebugger(db DB, rootDir string) *Debugger {
+	d := &Debugger{db: db, rootDir: rootDir, addr: "127.0.0.1:" + defaultDlvPort}
+	if db != nil {
+		if port, err := db.Get(StoreKeyDebuggerPort); err == nil && port != "" {
+			d.addr = "127.0.0.1:" + port
+		}
+		if val, err := db.Get(StoreKeyDebugger); err == nil && val == "true" {
+			d.enabled = true
+		}
+	}
+	return d
+}
+
+func (d *Debugger) Name() string { return "Debugger" }
+
+// Label shows the Delve address while debugging, e.g. "Delve 127.0.0.1:2345".
+func (d *Debugger) Label() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.enabled {
+		return "Delve " + d.addr
+	}
+	return "Delve Debugger"
+}
+
+// Value implements HandlerEdit.Value, e.g. "Debug:T".
+func (d *Debugger) Value() string {
+	if d.Enabled() {
+		return "Debug:T"
+	}
+	return "Debug:F"
+}
+
+// Change implements HandlerEdit.Change, accepting "Debug:T" or "Debug:F".
+func (d *Debugger) Change(newValue string) {
+	key, val, ok := strings.Cut(newValue, ":")
+	if !ok || strings.TrimSpace(key) != "Debug" {
+		return
+	}
+	val = strings.ToLower(strings.TrimSpace(val))
+	d.SetEnabled(val == "t" || val == "true")
+}
+
+func (d *Debugger) SetLog(f func(message ...any)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log = f
+}
+
+// SetOnChange registers the server restart run when debugging is turned on
+// or off, e.g. switching to the debug build profile first.
+func (d *Debugger) SetOnChange(fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onChange = fn
+}
+
+// Addr returns the host:port of the headless Delve JSON-RPC/DAP server.
+func (d *Debugger) Addr() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.addr
+}
+
+// Enabled reports whether the server runs under Delve.
+func (d *Debugger) Enabled() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.enabled
+}
+
+// SetEnabled turns debugging on or off, persists the choice and restarts
+// the server with or without Delve.
+func (d *Debugger) SetEnabled(on bool) {
+	d.mu.Lock()
+	if d.enabled == on {
+		d.mu.Unlock()
+		return
+	}
+	d.enabled = on
+	db, onChange := d.db, d.onChange
+	d.mu.Unlock()
+	if db != nil {
+		db.Set(StoreKeyDebugger, strconv.FormatBool(on))
+	}
+	if on {
+		d.Start()
+	} else {
+		d.dropClient()
+		d.logf("Delve off: the server restarts without it")
+	}
+	if onChange != nil {
+		onChange()
+	}
+}
+
+// Start writes the IDE launch configs and checks that dlv is installed. It
+// does nothing while disabled.
+func (d *Debugger) Start() {
+	if !d.Enabled() {
+		return
+	}
+	if _, err := exec.LookPath("dlv"); err != nil {
+		d.logf("Delve not installed, install it with: " + DlvInstall)
+		return
+	}
+	if err := d.WriteLaunchConfigs(); err != nil {
+		d.logf("Warning: IDE launch config:", err)
+	}
+}
+
+// RunHook is the server's run hook: while enabled it runs the binary bin
+// under a headless Delve that continues at once, and sets the kept
+// breakpoints in it once it listens.
+func (d *Debugger) RunHook(bin string, args []string) (string, []string) {
+	if !d.Enabled() {
+		return bin, args
+	}
+	if _, err := exec.LookPath("dlv"); err != nil {
+		d.logf("Delve not installed, install it with: " + DlvInstall)
+		return bin, args
+	}
+	d.mu.Lock()
+	d.generation++
+	gen := d.generation
+	for i := range d.breakpoints {
+		d.breakpoints[i].dlvID = 0
+	}
+	d.mu.Unlock()
+	d.dropClient() // the previous Delve exits with the previous server
+	go d.restore(gen)
+	return "dlv", append([]string{"exec", bin, "--headless", "--listen=" + d.Addr(),
+		"--api-version=2", "--accept-multiclient", "--continue", "--"}, args...)
+}
+
+// restore waits for the Delve of generation gen to listen and sets the kept
+// breakpoints in it.
+func (d *Debugger) restore(gen int) {
+	current := func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.generation == gen
+	}
+	deadline := time.Now().Add(debugDialLimit)
+	for {
+		if !current() {
+			return
+		}
+		if _, err := d.rpcClient(); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			d.logf("Delve not listening on", d.Addr())
+			return
+		}
+		time.Sleep(debugDialPeriod)
+	}
+	d.mu.Lock()
+	kept := append([]debugBreakpoint{}, d.breakpoints...)
+	d.mu.Unlock()
+	restored := 0
+	for _, bp := range kept {
+		dlvID, err := d.create(bp.DebugBreakpoint)
+		if err != nil {
+			d.logf(fmt.Sprintf("Breakpoint %s:%d not set: %v", d.relFile(bp.File), bp.Line, err))
+			continue
+		}
+		if d.setDlvID(bp.ID, dlvID, gen) {
+			restored++
+		}
+	}
+	d.logf(fmt.Sprintf("Server running under Delve, JSON-RPC/DAP on %s (%d breakpoints)", d.Addr(), restored))
+}
+
+// setDlvID records the Delve id of the kept breakpoint id, unless it was
+// removed or another Delve started meanwhile.
+func (d *Debugger) setDlvID(id, dlvID, gen int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.generation != gen {
+		return false
+	}
+	for i := range d.breakpoints {
+		if d.breakpoints[i].ID == id {
+			d.breakpoints[i].dlvID = dlvID
+			return true
+		}
+	}
+	return false
+}
+
+// dropClient closes the connection to Delve; the next call dials again.
+func (d *Debugger) dropClient() {
+	d.mu.Lock()
+	client := d.client
+	d.client = nil
+	d.mu.Unlock()
+	if client != nil {
+		client.Close()
+	}
+}
+
+// WriteLaunchConfigs adds an attach configuration for the Delve address to
+// .vscode/launch.json, and to .idea/runConfigurations when the project is
+// opened in GoLand, replacing a previous one of the same name.
+func (d *Debugger) WriteLaunchConfigs() error {
+	host, port, _ := strings.Cut(d.Addr(), ":")
+	portNum, _ := strconv.Atoi(port)
+
+	path := filepath.Join(d.rootDir, ".vscode", "launch.json")
+	launch := map[string]any{}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &launch); err != nil {
+			return fmt.Errorf("%s is not plain JSON (comments?), add %q by hand: %w", path, DebugLaunchName, err)
+		}
+	}
+	if _, ok := launch["version"]; !ok {
+		launch["version"] = "0.2.0"
+	}
+	configs, _ := launch["configurations"].([]any)
+	kept := []any{}
+	for _, c := range configs {
+		if m, ok := c.(map[string]any); ok && m["name"] == DebugLaunchName {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	launch["configurations"] = append(kept, map[string]any{
+		"name":    DebugLaunchName,
+		"type":    "go",
+		"request": "attach",
+		"mode":    "remote",
+		"host":    host,
+		"port":    portNum,
+	})
+	data, err := json.MarshalIndent(launch, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(filepath.Join(d.rootDir, ".idea")); err == nil && info.IsDir() {
+		dir := filepath.Join(d.rootDir, ".idea", "runConfigurations")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		xml := `<component name="ProjectRunConfigurationManager">
+  <configuration default="false" name="` + DebugLaunchName + `" type="GoRemoteDebugConfigurationType" factoryName="Go Remote" host="` + host + `" port="` + port + `">
+    <option name="disconnectOption" value="LEAVE" />
+    <disconnect value="LEAVE" />
+    <method v="2" />
+  </configuration>
+</component>
+`
+		if err := os.WriteFile(filepath.Join(dir, "tinywasm_Delve.xml"), []byte(xml), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delve JSON-RPC (API v2) types, limited to the fields used here.
+type (
+	dlvFunction struct {
+		Name string `json:"name"`
+	}
+	dlvBreakpoint struct {
+		ID            int    `json:"id"`
+		File          string `json:"file"`
+		Line          int    `json:"line"`
+		FunctionName  string `json:"functionName,omitempty"`
+		Cond          string `json:"Cond"`
+		TotalHitCount uint64 `json:"totalHitCount"`
+	}
+	dlvLocation struct {
+		File     string       `json:"file"`
+		Line     int          `json:"line"`
+		Function *dlvFunction `json:"function,omitempty"`
+	}
+	dlvThread struct {
+		File        string         `json:"file"`
+		Line        int            `json:"line"`
+		Function    *dlvFunction   `json:"function,omitempty"`
+		GoroutineID int64          `json:"goroutineID"`
+		Breakpoint  *dlvBreakpoint `json:"breakPoint,omitempty"`
+	}
+	dlvGoroutine struct {
+		ID             int64       `json:"id"`
+		UserCurrentLoc dlvLocation `json:"userCurrentLoc"`
+	}
+	dlvState struct {
+		Running           bool          `json:"Running"`
+		CurrentThread     *dlvThread    `json:"currentThread,omitempty"`
+		SelectedGoroutine *dlvGoroutine `json:"currentGoroutine,omitempty"`
+		Exited            bool          `json:"exited"`
+	}
+	dlvVariable struct {
+		Name     string        `json:"name"`
+		Type     string        `json:"type"`
+		Value    string        `json:"value"`
+		Children []dlvVariable `json:"children"`
+	}
+	dlvLoadConfig struct {
+		FollowPointers     bool
+		MaxVariableRecurse int
+		MaxStringLen       int
+		MaxArrayValues     int
+		MaxStructFields    int
+	}
+	dlvScope struct {
+		GoroutineID  int64
+		Frame        int
+		DeferredCall int
+	}
+)
+
+// debugLoadConfig bounds how much of each variable Delve returns.
+var debugLoadConfig = dlvLoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 256, MaxArrayValues: 32, MaxStructFields: -1}
+
+// rpcClient connects to Delve on first use.
+func (d *Debugger) rpcClient() (*rpc.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client != nil {
+		return d.client, nil
+	}
+	client, err := jsonrpc.Dial("tcp", d.addr)
+	if err != nil {
+		return nil, &debugUnreachableError{d.addr, d.enabled, err}
+	}
+	d.client = client
+	return client, nil
+}
+
+// call runs a Delve RPC method; a broken connection is dropped so the next
+// call redials (Delve restarts with the server).
+func (d *Debugger) call(method string, in, out any, limit time.Duration) error {
+	client, err := d.rpcClient()
+	if err != nil {
+		return err
+	}
+	c := client.Go("RPCServer."+method, in, out, nil)
+	select {
+	case <-c.Done:
+	case <-time.After(limit):
+		return errDebugTimeout
+	}
+	if errors.Is(c.Error, rpc.ErrShutdown) {
+		d.mu.Lock()
+		if d.client == client {
+			d.client = nil
+		}
+		d.mu.Unlock()
+	}
+	return c.Error
+}
+
+var errDebugTimeout = errors.New("delve did not answer in time")
+
+// debugUnreachableError is returned while no Delve listens: debugging is
+// off, or the server is (re)starting.
+type debugUnreachableError struct {
+	addr    string
+	enabled bool
+	err     error
+}
+
+func (e *debugUnreachableError) Error() string {
+	if !e.enabled {
+		return "debugger is off: enable Debug in the BUILD tab"
+	}
+	return fmt.Sprintf("Delve not reachable on %s: %v", e.addr, e.err)
+}
+
+func (e *debugUnreachableError) Unwrap() error { return e.err }
+
+// SetBreakpoint stops the server at file:line, file relative to the project
+// root or absolute, when cond (a Go expression) is empty or true. The
+// breakpoint is kept and set again after each restart; while debugging is
+// on and Delve is not up yet, it is set once Delve starts.
+func (d *Debugger) SetBreakpoint(file string, line int, cond string) (DebugBreakpoint, error) {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(d.rootDir, file)
+	}
+	bp := DebugBreakpoint{File: file, Line: line, Cond: cond}
+	d.mu.Lock()
+	gen := d.generation
+	d.mu.Unlock()
+	dlvID, err := d.create(bp)
+	var unreachable *debugUnreachableError
+	if err != nil && !(errors.As(err, &unreachable) && d.Enabled()) {
+		return DebugBreakpoint{}, err
+	}
+
+	d.mu.Lock()
+	d.nextID++
+	bp.ID = d.nextID
+	kept := d.breakpoints[:0]
+	for _, b := range d.breakpoints {
+		if b.File != file || b.Line != line {
+			kept = append(kept, b)
+		}
+	}
+	if d.generation != gen {
+		dlvID = 0 // set in a Delve that is gone; restore sets it in the new one
+	}
+	d.breakpoints = append(kept, debugBreakpoint{bp, dlvID})
+	d.mu.Unlock()
+	return d.breakpoint(bp), nil
+}
+
+// create sets bp in the running Delve and returns its id there.
+func (d *Debugger) create(bp DebugBreakpoint) (int, error) {
+	in := struct{ Breakpoint dlvBreakpoint }{dlvBreakpoint{File: bp.File, Line: bp.Line, Cond: bp.Cond}}
+	var out struct{ Breakpoint dlvBreakpoint }
+	if err := d.call("CreateBreakpoint", in, &out, debugCallLimit); err != nil {
+		return 0, err
+	}
+	return out.Breakpoint.ID, nil
+}
+
+// ClearBreakpoint removes the breakpoint id.
+func (d *Debugger) ClearBreakpoint(id int) error {
+	d.mu.Lock()
+	dlvID, found := 0, false
+	for i, bp := range d.breakpoints {
+		if bp.ID == id {
+			dlvID, found = bp.dlvID, true
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			break
+		}
+	}
+	d.mu.Unlock()
+	if !found {
+		return fmt.Errorf("no breakpoint with id %d", id)
+	}
+	if dlvID == 0 {
+		return nil
+	}
+	var out struct{ Breakpoint *dlvBreakpoint }
+	err := d.call("ClearBreakpoint", struct {
+		Id   int
+		Name string
+	}{dlvID, ""}, &out, debugCallLimit)
+	var unreachable *debugUnreachableError
+	if errors.As(err, &unreachable) {
+		return nil // gone with its Delve
+	}
+	return err
+}
+
+// Breakpoints lists the kept breakpoints, with their hit counts while Delve
+// runs.
+func (d *Debugger) Breakpoints() ([]DebugBreakpoint, error) {
+	hits := map[int]dlvBreakpoint{}
+	var out struct{ Breakpoints []dlvBreakpoint }
+	err := d.call("ListBreakpoints", struct{ All bool }{false}, &out, debugCallLimit)
+	var unreachable *debugUnreachableError
+	if err != nil && !errors.As(err, &unreachable) {
+		return nil, err
+	}
+	for _, bp := range out.Breakpoints {
+		hits[bp.ID] = bp
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := []DebugBreakpoint{}
+	for _, bp := range d.breakpoints {
+		b := bp.DebugBreakpoint
+		if live, ok := hits[bp.dlvID]; ok && bp.dlvID != 0 {
+			b.Function, b.Hits = live.FunctionName, live.TotalHitCount
+		}
+		list = append(list, d.breakpoint(b))
+	}
+	return list, nil
+}
+
+// keptID maps the id of a breakpoint in the running Delve to the kept one.
+func (d *Debugger) keptID(dlvID int) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, bp := range d.breakpoints {
+		if bp.dlvID == dlvID && dlvID != 0 {
+			return bp.ID
+		}
+	}
+	return dlvID
+}
+
+func (d *Debugger) breakpoint(bp DebugBreakpoint) DebugBreakpoint {
+	bp.File = d.relFile(bp.File)
+	return bp
+}
+
+// Control resumes or halts the server: "continue", "next", "step",
+// "stepout" or "halt". Commands that do not stop within a short wait leave
+// the server running and return a running state.
+func (d *Debugger) Control(action string) (DebugState, error) {
+	names := map[string]string{"continue": "continue", "next": "next", "step": "step", "stepout": "stepOut", "halt": "halt"}
+	name, ok := names[strings.ToLower(action)]
+	if !ok {
+		return DebugState{}, fmt.Errorf("unknown action %q, use continue, next, step, stepout or halt", action)
+	}
+	var out struct{ State dlvState }
+	err := d.call("Command", struct {
+		Name string `json:"name"`
+	}{name}, &out, debugWaitStop)
+	if errors.Is(err, errDebugTimeout) {
+		return DebugState{Running: true}, nil
+	}
+	if err != nil {
+		return DebugState{}, err
+	}
+	return d.Stack(0, 0, 0)
+}
+
+// Stack reads where the server is stopped: the stack of goroutine (0: the
+// selected one) up to depth frames (0: 20) and the arguments and locals of
+// frame.
+func (d *Debugger) Stack(goroutine int64, frame, depth int) (DebugState, error) {
+	var st struct{ State *dlvState }
+	if err := d.call("State", struct{ NonBlocking bool }{true}, &st, debugCallLimit); err != nil {
+		return DebugState{}, err
+	}
+	if st.State == nil || st.State.Running || st.State.Exited {
+		return DebugState{Running: st.State != nil && st.State.Running, Exited: st.State != nil && st.State.Exited}, nil
+	}
+	state := DebugState{Frame: frame}
+	if th := st.State.CurrentThread; th != nil {
+		state.Goroutine = th.GoroutineID
+		if th.Breakpoint != nil {
+			state.Breakpoint = d.keptID(th.Breakpoint.ID)
+		}
+	}
+	if g := st.State.SelectedGoroutine; g != nil && state.Goroutine == 0 {
+		state.Goroutine = g.ID
+	}
+	if goroutine != 0 {
+		state.Goroutine = goroutine
+	}
+	if depth <= 0 {
+		depth = 20
+	}
+	var stack struct{ Locations []dlvLocation }
+	if err := d.call("Stacktrace", struct {
+		Id    int64
+		Depth int
+	}{state.Goroutine, depth}, &stack, debugCallLimit); err != nil {
+		return state, err
+	}
+	for _, loc := range stack.Locations {
+		f := DebugFrame{File: d.relFile(loc.File), Line: loc.Line}
+		if loc.Function != nil {
+			f.Function = loc.Function.Name
+		}
+		state.Frames = append(state.Frames, f)
+	}
+	if frame < len(state.Frames) {
+		state.File, state.Line, state.Function = state.Frames[frame].File, state.Frames[frame].Line, state.Frames[frame].Function
+	}
+	scope := struct {
+		Scope dlvScope
+		Cfg   dlvLoadConfig
+	}{dlvScope{GoroutineID: state.Goroutine, Frame: frame}, debugLoadConfig}
+	var args struct{ Args []dlvVariable }
+	if err := d.call("ListFunctionArgs", scope, &args, debugCallLimit); err != nil {
+		return state, err
+	}
+	var locals struct{ Variables []dlvVariable }
+	if err := d.call("ListLocalVars", scope, &locals, debugCallLimit); err != nil {
+		return state, err
+	}
+	state.Args, state.Locals = debugVariables(args.Args), debugVariables(locals.Variables)
+	return state, nil
+}
+
+func debugVariables(vars []dlvVariable) []DebugVariable {
+	var out []DebugVariable
+	for _, v := range vars {
+		out = append(out, DebugVariable{Name: v.Name, Type: v.Type, Value: v.Value, Children: debugVariables(v.Children)})
+	}
+	return out
+}
+
+// relFile makes file relative to the project root when inside it.
+func (d *Debugger) relFile(file string) string {
+	if rel, err := filepath.Rel(d.rootDir, file); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return file
+}
+
+func (d *Debugger) logf(message ...any) {
+	d.mu.Lock()
+	log := d.log
+	d.mu.Unlock()
+	if log != nil {
+		log(message...)
+	}
+}
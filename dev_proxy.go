@@ -0,0 +1,420 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoreKeyProxyRules holds the dev proxy rules, each query-escaped and
+// separated by ';' (see ParseProxyRule for the rule syntax).
+const StoreKeyProxyRules = "TINYWASM_PROXY_RULES"
+
+// proxyValueEscaper keeps header values with spaces on a single rule field.
+var proxyValueEscaper = strings.NewReplacer("%", "%25", " ", "%20")
+
+// ProxyRule sends the requests under Prefix to Upstream.
+type ProxyRule struct {
+	Prefix      string            // path prefix, e.g. "/api"
+	Upstream    string            // base URL, e.g. "http://localhost:8080"
+	Strip       bool              // drop Prefix from the forwarded path
+	SetHeaders  map[string]string // request headers added or replaced
+	DelHeaders  []string          // request headers removed
+	RespHeaders map[string]string // response headers added or replaced
+	Delay       time.Duration     // latency added before forwarding
+	ErrorStatus int               // injected error status, 0 for none
+	ErrorRate   float64           // share of requests answered with ErrorStatus, (0, 1]
+}
+
+// ParseProxyRule parses a rule written as
+//
+//	/api http://localhost:8080 [strip] [set:Name:Value] [del:Name]
+//	    [resp:Name:Value] [delay:200ms] [error:503[@10%]]
+//
+// Header values are percent-decoded, so "Bearer%20token" holds a space.
+func ParseProxyRule(s string) (ProxyRule, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return ProxyRule{}, fmt.Errorf("invalid proxy rule %q: use /prefix http://host:port [options]", s)
+	}
+	r := ProxyRule{Prefix: fields[0], Upstream: strings.TrimSuffix(fields[1], "/")}
+	if !strings.HasPrefix(r.Prefix, "/") {
+		return ProxyRule{}, fmt.Errorf("invalid proxy prefix %q: must start with /", r.Prefix)
+	}
+	if r.Prefix != "/" {
+		r.Prefix = strings.TrimSuffix(r.Prefix, "/")
+	}
+	if u, err := url.Parse(r.Upstream); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ProxyRule{}, fmt.Errorf("invalid proxy upstream %q: use http://host:port", fields[1])
+	}
+
+	for _, f := range fields[2:] {
+		opt, arg, _ := strings.Cut(f, ":")
+		var err error
+		switch opt {
+		case "strip":
+			r.Strip = true
+		case "set", "resp":
+			name, value, ok := strings.Cut(arg, ":")
+			if !ok || name == "" {
+				return ProxyRule{}, fmt.Errorf("invalid proxy option %q: use %s:Name:Value", f, opt)
+			}
+			if value, err = url.PathUnescape(value); err != nil {
+				return ProxyRule{}, fmt.Errorf("invalid proxy option %q: %v", f, err)
+			}
+			if opt == "set" {
+				r.SetHeaders = setHeader(r.SetHeaders, name, value)
+			} else {
+				r.RespHeaders = setHeader(r.RespHeaders, name, value)
+			}
+		case "del":
+			if arg == "" {
+				return ProxyRule{}, fmt.Errorf("invalid proxy option %q: use del:Name", f)
+			}
+			r.DelHeaders = append(r.DelHeaders, http.CanonicalHeaderKey(arg))
+		case "delay":
+			if r.Delay, err = time.ParseDuration(arg); err != nil || r.Delay < 0 {
+				return ProxyRule{}, fmt.Errorf("invalid proxy option %q: use delay:200ms", f)
+			}
+		case "error":
+			status, rate, hasRate := strings.Cut(arg, "@")
+			r.ErrorStatus, err = strconv.Atoi(status)
+			if err != nil || r.ErrorStatus < 400 || r.ErrorStatus > 599 {
+				return ProxyRule{}, fmt.Errorf("invalid proxy option %q: use error:503 or error:503@10%%", f)
+			}
+			r.ErrorRate = 1
+			if hasRate {
+				pct, err := strconv.ParseFloat(strings.TrimSuffix(rate, "%"), 64)
+				if err != nil || pct <= 0 || pct > 100 {
+					return ProxyRule{}, fmt.Errorf("invalid proxy option %q: rate must be in (0, 100]%%", f)
+				}
+				r.ErrorRate = pct / 100
+			}
+		default:
+			return ProxyRule{}, fmt.Errorf("unknown proxy option %q", f)
+		}
+	}
+	return r, nil
+}
+
+func setHeader(h map[string]string, name, value string) map[string]string {
+	if h == nil {
+		h = map[string]string{}
+	}
+	h[http.CanonicalHeaderKey(name)] = value
+	return h
+}
+
+// String formats r in the syntax ParseProxyRule reads.
+func (r ProxyRule) String() string {
+	parts := []string{r.Prefix, r.Upstream}
+	if r.Strip {
+		parts = append(parts, "strip")
+	}
+	for _, name := range sortedKeys(r.SetHeaders) {
+		parts = append(parts, "set:"+name+":"+proxyValueEscaper.Replace(r.SetHeaders[name]))
+	}
+	for _, name := range r.DelHeaders {
+		parts = append(parts, "del:"+name)
+	}
+	for _, name := range sortedKeys(r.RespHeaders) {
+		parts = append(parts, "resp:"+name+":"+proxyValueEscaper.Replace(r.RespHeaders[name]))
+	}
+	if r.Delay > 0 {
+		parts = append(parts, "delay:"+r.Delay.String())
+	}
+	if r.ErrorStatus != 0 {
+		e := "error:" + strconv.Itoa(r.ErrorStatus)
+		if r.ErrorRate < 1 {
+			e += "@" + strconv.FormatFloat(r.ErrorRate*100, 'f', -1, 64) + "%"
+		}
+		parts = append(parts, e)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Match reports whether path is under the rule's prefix.
+func (r ProxyRule) Match(path string) bool {
+	return r.Prefix == "/" || path == r.Prefix || strings.HasPrefix(path, r.Prefix+"/")
+}
+
+// DevProxy forwards backend API paths of the dev server to local upstream
+// processes, with header rewrites and optional latency and error injection
+// to exercise the client's loading and failure states. Each proxied request
+// is logged to the BUILD tab.
+type DevProxy struct {
+	mu    sync.Mutex
+	db    DB
+	rules []ProxyRule // sorted by descending prefix length
+	log   func(message ...any)
+}
+
+// NewDevProxy reads the rules from db.
+func NewDevProxy(db DB) *DevProxy {
+	p := &DevProxy{db: db}
+	if db != nil {
+		if v, err := db.Get(StoreKeyProxyRules); err == nil {
+			p.rules = parseProxyRules(v)
+		}
+	}
+	return p
+}
+
+func parseProxyRules(s string) []ProxyRule {
+	var rules []ProxyRule
+	for _, escaped := range strings.Split(s, ";") {
+		text, err := url.QueryUnescape(escaped)
+		if err != nil || strings.TrimSpace(text) == "" {
+			continue
+		}
+		if r, err := ParseProxyRule(text); err == nil {
+			rules = append(rules, r)
+		}
+	}
+	sortProxyRules(rules)
+	return rules
+}
+
+func sortProxyRules(rules []ProxyRule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if len(rules[i].Prefix) != len(rules[j].Prefix) {
+			return len(rules[i].Prefix) > len(rules[j].Prefix)
+		}
+		return rules[i].Prefix < rules[j].Prefix
+	})
+}
+
+func (p *DevProxy) Name() string  { return "DevProxy" }
+func (p *DevProxy) Label() string { return "API Proxy" }
+
+// Value implements HandlerEdit.Value: the proxied prefixes and their
+// upstreams, e.g. "/api→localhost:8080", or "-" when none.
+func (p *DevProxy) Value() string {
+	rules := p.Rules()
+	if len(rules) == 0 {
+		return "-"
+	}
+	parts := make([]string, len(rules))
+	for i, r := range rules {
+		host := r.Upstream
+		if u, err := url.Parse(r.Upstream); err == nil {
+			host = u.Host
+		}
+		parts[i] = r.Prefix + "→" + host
+	}
+	return strings.Join(parts, " ")
+}
+
+// Change implements HandlerEdit.Change: a rule (see ParseProxyRule) adds or
+// replaces the rule of its prefix, "-/prefix" removes it.
+func (p *DevProxy) Change(newValue string) {
+	in := strings.TrimSpace(newValue)
+	var err error
+	switch {
+	case in == "" || in == p.Value():
+		return
+	case strings.HasPrefix(in, "-/"):
+		err = p.RemoveRule(in[1:])
+	default:
+		var r ProxyRule
+		if r, err = ParseProxyRule(in); err == nil {
+			err = p.AddRule(r)
+		}
+	}
+	if err != nil {
+		p.logf(err)
+	}
+}
+
+func (p *DevProxy) SetLog(f func(message ...any)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log = f
+}
+
+// Rules returns the rules, longest prefix first.
+func (p *DevProxy) Rules() []ProxyRule {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]ProxyRule(nil), p.rules...)
+}
+
+// AddRule adds r, replacing the rule with the same prefix, and persists the set.
+func (p *DevProxy) AddRule(r ProxyRule) error {
+	if _, err := ParseProxyRule(r.String()); err != nil {
+		return err
+	}
+	rules := p.Rules()
+	replaced := false
+	for i := range rules {
+		if rules[i].Prefix == r.Prefix {
+			rules[i], replaced = r, true
+		}
+	}
+	if !replaced {
+		rules = append(rules, r)
+	}
+	if err := p.SetRules(rules); err != nil {
+		return err
+	}
+	p.logf("Proxy", r.String())
+	return nil
+}
+
+// RemoveRule drops the rule of prefix.
+func (p *DevProxy) RemoveRule(prefix string) error {
+	if prefix != "/" {
+		prefix = strings.TrimSuffix(prefix, "/")
+	}
+	rules := p.Rules()
+	for i := range rules {
+		if rules[i].Prefix == prefix {
+			if err := p.SetRules(append(rules[:i], rules[i+1:]...)); err != nil {
+				return err
+			}
+			p.logf("Proxy", prefix, "removed")
+			return nil
+		}
+	}
+	return fmt.Errorf("no proxy rule for %s", prefix)
+}
+
+// SetRules replaces the rule set and persists it.
+func (p *DevProxy) SetRules(rules []ProxyRule) error {
+	rules = append([]ProxyRule(nil), rules...)
+	sortProxyRules(rules)
+	escaped := make([]string, len(rules))
+	for i, r := range rules {
+		escaped[i] = url.QueryEscape(r.String())
+	}
+	if p.db != nil {
+		if err := p.db.Set(StoreKeyProxyRules, strings.Join(escaped, ";")); err != nil {
+			return err
+		}
+	}
+	p.mu.Lock()
+	p.rules = rules
+	p.mu.Unlock()
+	return nil
+}
+
+// match returns the rule with the longest prefix matching path.
+func (p *DevProxy) match(path string) (ProxyRule, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, r := range p.rules {
+		if r.Match(path) {
+			return r, true
+		}
+	}
+	return ProxyRule{}, false
+}
+
+// Routes registers the routes fns add behind the proxy: requests matching
+// a rule go to its upstream, the rest to those routes.
+func (p *DevProxy) Routes(fns ...func(*http.ServeMux)) func(*http.ServeMux) {
+	return func(mux *http.ServeMux) {
+		inner := http.NewServeMux()
+		for _, fn := range fns {
+			fn(inner)
+		}
+		mux.Handle("/", p.Wrap(inner))
+	}
+}
+
+// Wrap proxies the requests matching a rule and passes the rest to next.
+// A matched rule answers before any server backend, even with a 404.
+func (p *DevProxy) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := p.match(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		keepNotFound(w)
+		p.serve(w, r, rule)
+	})
+}
+
+func (p *DevProxy) serve(w http.ResponseWriter, r *http.Request, rule ProxyRule) {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	path := r.URL.Path
+	if rule.Strip && rule.Prefix != "/" {
+		if path = strings.TrimPrefix(path, rule.Prefix); path == "" {
+			path = "/"
+		}
+	}
+	target, _ := url.Parse(rule.Upstream)
+	dest := strings.TrimSuffix(rule.Upstream, "/") + path
+	note := ""
+
+	defer func() {
+		p.logf(fmt.Sprintf("%s %s → %s %d %s%s", r.Method, r.URL.RequestURI(), dest, rec.status,
+			time.Since(start).Round(time.Millisecond), note))
+	}()
+
+	if rule.Delay > 0 {
+		select {
+		case <-time.After(rule.Delay):
+		case <-r.Context().Done():
+			rec.status, note = 499, " (client gone)"
+			return
+		}
+	}
+	if rule.ErrorStatus != 0 && rand.Float64() < rule.ErrorRate {
+		for name, value := range rule.RespHeaders {
+			rec.Header().Set(name, value)
+		}
+		http.Error(rec, "tinywasm proxy: injected "+http.StatusText(rule.ErrorStatus), rule.ErrorStatus)
+		note = " (injected)"
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Path, pr.Out.URL.RawPath = path, ""
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			for name, value := range rule.SetHeaders {
+				pr.Out.Header.Set(name, value)
+			}
+			for _, name := range rule.DelHeaders {
+				pr.Out.Header.Del(name)
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			for name, value := range rule.RespHeaders {
+				resp.Header.Set(name, value)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if errors.Is(err, context.Canceled) {
+				rec.status, note = 499, " (client gone)"
+				return
+			}
+			note = " (" + err.Error() + ")"
+			http.Error(w, "tinywasm proxy: upstream "+rule.Upstream+" unreachable", http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(rec, r)
+}
+
+func (p *DevProxy) logf(message ...any) {
+	p.mu.Lock()
+	log := p.log
+	p.mu.Unlock()
+	if log != nil {
+		log(message...)
+	}
+}
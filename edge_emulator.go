@@ -0,0 +1,697 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Project store keys of the edge worker emulator.
+const (
+	StoreKeyEdgeEmulator = "TINYWASM_EDGE_EMULATOR" // "true" serves the worker locally
+	StoreKeyEdgePort     = "TINYWASM_EDGE_PORT"     // dev port, default 8787
+	StoreKeyEdgeVars     = "TINYWASM_EDGE_VARS"     // .env keys bound as env vars, comma-separated
+	StoreKeyEdgeKV       = "TINYWASM_EDGE_KV"       // KV namespace bindings, comma-separated
+	storeKeyEdgeKVData   = "TINYWASM_EDGE_KV_"      // + namespace: key:value;key:value (both query-escaped)
+)
+
+const (
+	defaultEdgePort = "8787"
+	edgeTokenHeader = "X-Tinywasm-Edge"
+	edgeStartWait   = 10 * time.Second // node host startup
+	edgeRestartWait = time.Second      // before restarting a crashed node host
+)
+
+// EdgeEmulator runs the edge worker (cmd/edgeworker) locally before it is
+// deployed. The worker is compiled with GOOS=js GOARCH=wasm and run by a
+// Node.js host that invokes it like worker.mjs does on the edge: a fetch
+// Request goes to binding.handleRequest and the Response is sent back. Env
+// vars and KV namespaces are bound from the project store. Requests reach
+// the host through a dev port that logs each one in the DEPLOY tab.
+type EdgeEmulator struct {
+	mu       sync.Mutex
+	db       DB
+	rootDir  string
+	edgeDir  string // relative worker sources, e.g. cmd/edgeworker
+	outDir   string // dev build and host files
+	port     string
+	enabled  bool
+	token    string
+	server   *http.Server // dev port
+	bindings net.Listener // env and KV for the host
+	node     *exec.Cmd
+	nodeDone chan struct{} // closed once node has exited
+	hostAddr string        // node host, 127.0.0.1:port
+	buildErr error
+	buildMu  sync.Mutex
+	startMu  sync.Mutex
+	log      func(message ...any)
+}
+
+// NewEdgeEmulator emulates the worker in edgeDir, building into outDir. The
+// emulator stops once exit is closed.
+func NewEdgeEmulator(db DB, rootDir, edgeDir, outDir string, exit <-chan bool) *EdgeEmulator {
+	e := &EdgeEmulator{db: db, rootDir: rootDir, edgeDir: edgeDir, outDir: outDir, port: defaultEdgePort}
+	if db != nil {
+		if port, err := db.Get(StoreKeyEdgePort); err == nil && port != "" {
+			e.port = port
+		}
+		if val, err := db.Get(StoreKeyEdgeEmulator); err == nil && val == "true" {
+			e.enabled = true
+		}
+	}
+	if exit != nil {
+		go func() {
+			<-exit
+			e.Stop()
+		}()
+	}
+	return e
+}
+
+func (e *EdgeEmulator) Name() string { return "EdgeEmulator" }
+
+// Label shows the dev URL while the emulator serves.
+func (e *EdgeEmulator) Label() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.server != nil {
+		return "Edge http://localhost:" + e.port
+	}
+	return "Edge Emulator"
+}
+
+// Value implements HandlerEdit.Value, e.g. "Edge Dev:T".
+func (e *EdgeEmulator) Value() string {
+	if e.Enabled() {
+		return "Edge Dev:T"
+	}
+	return "Edge Dev:F"
+}
+
+// Change implements HandlerEdit.Change, accepting "Edge Dev:T" or "Edge Dev:F".
+func (e *EdgeEmulator) Change(newValue string) {
+	key, val, ok := strings.Cut(newValue, ":")
+	if !ok || strings.TrimSpace(key) != "Edge Dev" {
+		return
+	}
+	val = strings.ToLower(strings.TrimSpace(val))
+	e.SetEnabled(val == "t" || val == "true")
+}
+
+func (e *EdgeEmulator) SetLog(f func(message ...any)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.log = f
+}
+
+// SetPort changes the dev port; it applies on the next Start.
+func (e *EdgeEmulator) SetPort(port string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.port = port
+}
+
+// URL returns the dev address of the worker.
+func (e *EdgeEmulator) URL() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return "http://localhost:" + e.port
+}
+
+// Enabled reports whether the emulator serves, or will once started.
+func (e *EdgeEmulator) Enabled() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enabled
+}
+
+// SetEnabled turns the emulator on or off and persists the choice.
+func (e *EdgeEmulator) SetEnabled(on bool) {
+	e.mu.Lock()
+	if e.enabled == on {
+		e.mu.Unlock()
+		return
+	}
+	e.enabled = on
+	db := e.db
+	e.mu.Unlock()
+	if db != nil {
+		db.Set(StoreKeyEdgeEmulator, strconv.FormatBool(on))
+	}
+	if !on {
+		e.Stop()
+		e.logf("Edge emulator stopped")
+		return
+	}
+	if err := e.Start(); err != nil {
+		e.logf("Edge emulator:", err)
+	}
+}
+
+// WorkerMain is the worker entry, relative to the project root.
+func (e *EdgeEmulator) WorkerMain() string {
+	return filepath.Join(e.edgeDir, "main.go")
+}
+
+// Start builds the worker and serves it on the dev port. It does nothing
+// while disabled. A failed build is logged and answered with 502 until a
+// save fixes it.
+func (e *EdgeEmulator) Start() error {
+	if !e.Enabled() {
+		return nil
+	}
+	e.startMu.Lock()
+	defer e.startMu.Unlock()
+	e.mu.Lock()
+	running := e.server != nil
+	e.mu.Unlock()
+	if running {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(e.rootDir, e.WorkerMain())); err != nil {
+		return fmt.Errorf("no edge worker at %s", e.WorkerMain())
+	}
+	if _, err := exec.LookPath("node"); err != nil {
+		return errors.New("Node.js not found in PATH: the emulator runs the worker in node")
+	}
+	if err := e.writeHost(); err != nil {
+		return err
+	}
+	if err := e.build(); err != nil {
+		e.logf("Edge worker build failed:", err)
+	}
+	if err := e.startBindings(); err != nil {
+		return err
+	}
+	if err := e.startNode(); err != nil {
+		e.Stop()
+		return err
+	}
+
+	e.mu.Lock()
+	port := e.port
+	e.mu.Unlock()
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		e.Stop()
+		return err
+	}
+	srv := &http.Server{Handler: e}
+	e.mu.Lock()
+	e.server = srv
+	e.mu.Unlock()
+	go srv.Serve(ln)
+	e.logf("Edge worker emulated on http://localhost:" + port)
+	return nil
+}
+
+// Stop closes the dev port and stops the node host.
+func (e *EdgeEmulator) Stop() {
+	e.mu.Lock()
+	srv, bindings, node, nodeDone := e.server, e.bindings, e.node, e.nodeDone
+	e.server, e.bindings, e.node, e.nodeDone, e.hostAddr = nil, nil, nil, nil, ""
+	e.mu.Unlock()
+	if srv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		srv.Shutdown(ctx)
+		cancel()
+	}
+	if bindings != nil {
+		bindings.Close()
+	}
+	if node != nil {
+		node.Process.Kill()
+		<-nodeDone
+	}
+}
+
+// Reload rebuilds the worker; the host loads the new module on its next
+// request.
+func (e *EdgeEmulator) Reload() error {
+	if err := e.build(); err != nil {
+		e.logf("Edge worker build failed:", err)
+		return err
+	}
+	e.logf("Edge worker rebuilt")
+	return nil
+}
+
+// ── devwatch.FilesEventHandlers ────────────────────────────────────
+
+// MainInputFileRelativePath lets the watcher send only the worker's files.
+func (e *EdgeEmulator) MainInputFileRelativePath() string { return e.WorkerMain() }
+
+// NewFileEvent rebuilds the worker when one of its Go files changes.
+func (e *EdgeEmulator) NewFileEvent(fileName, extension, filePath, event string) error {
+	e.mu.Lock()
+	running := e.server != nil
+	e.mu.Unlock()
+	if !running {
+		return nil
+	}
+	return e.Reload()
+}
+
+func (e *EdgeEmulator) SupportedExtensions() []string { return []string{".go"} }
+
+// UnobservedFiles returns the dev build directory.
+func (e *EdgeEmulator) UnobservedFiles() []string {
+	if rel, err := filepath.Rel(e.rootDir, e.outDir); err == nil {
+		return []string{rel}
+	}
+	return []string{e.outDir}
+}
+
+// build compiles the worker with GOOS=js GOARCH=wasm next to the host.
+func (e *EdgeEmulator) build() error {
+	e.buildMu.Lock()
+	defer e.buildMu.Unlock()
+	out := filepath.Join(e.outDir, "edge.wasm")
+	tmp := filepath.Join(e.outDir, "edge_temp.wasm")
+	if err := os.MkdirAll(e.outDir, 0755); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", tmp, "./"+filepath.ToSlash(e.edgeDir))
+	cmd.Dir = e.rootDir
+	cmd.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm")
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		err = os.Rename(tmp, out)
+	} else {
+		os.Remove(tmp)
+		err = fmt.Errorf("%w\n%s", err, strings.TrimSpace(string(output)))
+	}
+	e.mu.Lock()
+	e.buildErr = err
+	e.mu.Unlock()
+	return err
+}
+
+// writeHost writes the node host and the wasm_exec.js of this Go toolchain.
+func (e *EdgeEmulator) writeHost() error {
+	if err := os.MkdirAll(e.outDir, 0755); err != nil {
+		return err
+	}
+	goroot, err := exec.Command("go", "env", "GOROOT").Output()
+	if err != nil {
+		return fmt.Errorf("go env GOROOT: %w", err)
+	}
+	var wasmExec []byte
+	for _, dir := range []string{"lib/wasm", "misc/wasm"} {
+		if wasmExec, err = os.ReadFile(filepath.Join(strings.TrimSpace(string(goroot)), dir, "wasm_exec.js")); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("wasm_exec.js: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(e.outDir, "wasm_exec.js"), wasmExec, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(e.outDir, "host.mjs"), []byte(edgeHostSource), 0644)
+}
+
+// startNode runs the host and waits for the port it listens on. Once it
+// listens, a host that exits on its own is restarted by nodeExited.
+func (e *EdgeEmulator) startNode() error {
+	e.mu.Lock()
+	bindingsURL := "http://" + e.bindings.Addr().String()
+	token := e.token
+	e.mu.Unlock()
+
+	cmd := exec.Command("node", "host.mjs")
+	cmd.Dir = e.outDir
+	cmd.Env = append(os.Environ(), "TINYWASM_EDGE_BINDINGS="+bindingsURL, "TINYWASM_EDGE_TOKEN="+token)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	ready := make(chan string, 1)
+	done := make(chan struct{})
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if addr, ok := strings.CutPrefix(line, "tinywasm-edge listening "); ok {
+				ready <- addr
+				continue
+			}
+			e.logf("Edge:", line) // worker console output
+		}
+		close(ready)
+		err := cmd.Wait()
+		close(done)
+		e.nodeExited(cmd, err)
+	}()
+	select {
+	case addr, ok := <-ready:
+		if !ok {
+			<-done
+			return errors.New("edge host exited before listening")
+		}
+		e.mu.Lock()
+		e.node, e.nodeDone, e.hostAddr = cmd, done, addr
+		e.mu.Unlock()
+		return nil
+	case <-time.After(edgeStartWait):
+		cmd.Process.Kill()
+		<-done
+		return errors.New("edge host did not start")
+	}
+}
+
+// nodeExited clears the host address of a node host that exited without
+// Stop and starts a new one while the emulator is still serving.
+func (e *EdgeEmulator) nodeExited(cmd *exec.Cmd, err error) {
+	e.mu.Lock()
+	if e.node != cmd {
+		e.mu.Unlock()
+		return // stopped, or never listened
+	}
+	e.node, e.nodeDone, e.hostAddr = nil, nil, ""
+	e.mu.Unlock()
+	e.logf("Edge host exited:", err, "- restarting")
+
+	time.Sleep(edgeRestartWait)
+	e.startMu.Lock()
+	defer e.startMu.Unlock()
+	e.mu.Lock()
+	serving := e.bindings != nil && e.node == nil
+	e.mu.Unlock()
+	if !serving {
+		return
+	}
+	if err := e.startNode(); err != nil {
+		e.logf("Edge host:", err)
+	}
+}
+
+// ServeHTTP logs each request and passes it to the node host.
+func (e *EdgeEmulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	e.mu.Lock()
+	host, buildErr := e.hostAddr, e.buildErr
+	e.mu.Unlock()
+	switch {
+	case buildErr != nil:
+		http.Error(rec, "edge worker build failed: "+buildErr.Error(), http.StatusBadGateway)
+	case host == "":
+		http.Error(rec, "edge host not running", http.StatusBadGateway)
+	default:
+		proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: host})
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, "edge host: "+err.Error(), http.StatusBadGateway)
+		}
+		proxy.ServeHTTP(rec, r)
+	}
+	e.logf(fmt.Sprintf("%s %s %d %s", r.Method, r.URL.RequestURI(), rec.status, time.Since(start).Round(time.Millisecond)))
+}
+
+// ── bindings ───────────────────────────────────────────────────────
+
+// Vars returns the env var bindings: the .env keys named in StoreKeyEdgeVars.
+func (e *EdgeEmulator) Vars() map[string]string {
+	vars := map[string]string{}
+	for _, name := range e.list(StoreKeyEdgeVars) {
+		if v, err := e.db.Get(name); err == nil {
+			vars[name] = v
+		}
+	}
+	return vars
+}
+
+// Namespaces returns the KV namespace bindings.
+func (e *EdgeEmulator) Namespaces() []string { return e.list(StoreKeyEdgeKV) }
+
+func (e *EdgeEmulator) list(key string) []string {
+	if e.db == nil {
+		return nil
+	}
+	val, err := e.db.Get(key)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, n := range strings.Split(val, ",") {
+		if n = strings.TrimSpace(n); envVarName.MatchString(n) {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// KV returns the entries of namespace ns.
+func (e *EdgeEmulator) KV(ns string) map[string]string {
+	kv := map[string]string{}
+	if e.db == nil {
+		return kv
+	}
+	val, err := e.db.Get(storeKeyEdgeKVData + ns)
+	if err != nil {
+		return kv
+	}
+	for _, entry := range strings.Split(val, ";") {
+		k, v, ok := strings.Cut(entry, ":")
+		if !ok {
+			continue
+		}
+		key, err1 := url.QueryUnescape(k)
+		value, err2 := url.QueryUnescape(v)
+		if err1 == nil && err2 == nil && key != "" {
+			kv[key] = value
+		}
+	}
+	return kv
+}
+
+// KVPut stores key in namespace ns; KVDelete removes it.
+func (e *EdgeEmulator) KVPut(ns, key, value string) error {
+	return e.updateKV(ns, func(kv map[string]string) { kv[key] = value })
+}
+
+func (e *EdgeEmulator) KVDelete(ns, key string) error {
+	return e.updateKV(ns, func(kv map[string]string) { delete(kv, key) })
+}
+
+func (e *EdgeEmulator) updateKV(ns string, fn func(map[string]string)) error {
+	if e.db == nil {
+		return errors.New("no project store")
+	}
+	if !envVarName.MatchString(ns) {
+		return fmt.Errorf("invalid KV namespace %q", ns)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	kv := e.KV(ns)
+	fn(kv)
+	parts := make([]string, 0, len(kv))
+	for _, k := range sortedKeys(kv) {
+		parts = append(parts, url.QueryEscape(k)+":"+url.QueryEscape(kv[k]))
+	}
+	return e.db.Set(storeKeyEdgeKVData+ns, strings.Join(parts, ";"))
+}
+
+// startBindings serves env and KV to the host on a loopback port, behind a
+// per-run token.
+func (e *EdgeEmulator) startBindings() error {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	e.mu.Lock()
+	e.bindings, e.token = ln, hex.EncodeToString(b)
+	e.mu.Unlock()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /env", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"vars": e.Vars(), "kv": e.Namespaces()})
+	})
+	mux.HandleFunc("GET /kv/{ns}", func(w http.ResponseWriter, r *http.Request) {
+		prefix := r.URL.Query().Get("prefix")
+		keys := []map[string]string{}
+		kv := e.KV(r.PathValue("ns"))
+		for _, k := range sortedKeys(kv) {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, map[string]string{"name": k})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys, "list_complete": true})
+	})
+	mux.HandleFunc("/kv/{ns}/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		ns, key := r.PathValue("ns"), r.PathValue("key")
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			v, ok := e.KV(ns)[key]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			io.WriteString(w, v)
+			return
+		case http.MethodPut:
+			var body []byte
+			if body, err = io.ReadAll(r.Body); err == nil {
+				err = e.KVPut(ns, key, string(body))
+			}
+		case http.MethodDelete:
+			err = e.KVDelete(ns, key)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	})
+	token := e.token
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(edgeTokenHeader) != token {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	return nil
+}
+
+func (e *EdgeEmulator) logf(message ...any) {
+	e.mu.Lock()
+	log := e.log
+	e.mu.Unlock()
+	if log != nil {
+		log(message...)
+	}
+}
+
+// edgeHostSource is the node host. Like goflare's worker.mjs it instantiates
+// the module with globalThis.context = {env, ctx, binding, connect} and waits
+// for workers.ready(); the instance is kept until the module file changes.
+const edgeHostSource = `// Generated by tinywasm: edge worker emulator host. Do not edit.
+import http from "node:http";
+import fs from "node:fs";
+import "./wasm_exec.js";
+
+const bindings = process.env.TINYWASM_EDGE_BINDINGS;
+const headers = { "` + edgeTokenHeader + `": process.env.TINYWASM_EDGE_TOKEN };
+const wasmPath = new URL("./edge.wasm", import.meta.url);
+
+function connect() {
+  throw new Error("cloudflare:sockets connect() is not available in the tinywasm emulator");
+}
+
+function kvNamespace(ns) {
+  const url = (key) => bindings + "/kv/" + encodeURIComponent(ns) + "/" + encodeURIComponent(key);
+  const text = (value) =>
+    typeof value === "string" ? value : ArrayBuffer.isView(value) || value instanceof ArrayBuffer ? new TextDecoder().decode(value) : JSON.stringify(value);
+  return {
+    async get(key, options) {
+      const res = await fetch(url(key), { headers });
+      if (res.status === 404) return null;
+      const body = await res.text();
+      const type = typeof options === "string" ? options : options && options.type;
+      if (type === "json") return JSON.parse(body);
+      if (type === "arrayBuffer") return new TextEncoder().encode(body).buffer;
+      return body;
+    },
+    async put(key, value) {
+      const res = await fetch(url(key), { method: "PUT", headers, body: text(value) });
+      if (!res.ok) throw new Error(await res.text());
+    },
+    async delete(key) {
+      await fetch(url(key), { method: "DELETE", headers });
+    },
+    async list(options = {}) {
+      const q = options.prefix ? "?prefix=" + encodeURIComponent(options.prefix) : "";
+      const res = await fetch(bindings + "/kv/" + encodeURIComponent(ns) + q, { headers });
+      return res.json();
+    },
+  };
+}
+
+const env = {};
+async function loadEnv() {
+  const res = await fetch(bindings + "/env", { headers });
+  const { vars, kv } = await res.json();
+  for (const key of Object.keys(env)) delete env[key];
+  Object.assign(env, vars);
+  for (const ns of kv) env[ns] = kvNamespace(ns);
+}
+
+let worker, workerTime = 0;
+async function load() {
+  const time = fs.statSync(wasmPath).mtimeMs;
+  if (worker && time === workerTime) return worker;
+  const mod = await WebAssembly.compile(fs.readFileSync(wasmPath));
+  const go = new Go();
+  const binding = {};
+  let ready;
+  const readyPromise = new Promise((resolve) => (ready = resolve));
+  globalThis.tryCatch = (fn) => {
+    try {
+      return { result: fn() };
+    } catch (e) {
+      return { error: e };
+    }
+  };
+  globalThis.workers = { ready: () => ready() };
+  globalThis.context = { env, ctx: { waitUntil() {}, passThroughOnException() {} }, connect, binding };
+  const instance = await WebAssembly.instantiate(mod, { ...go.importObject, workers: globalThis.workers });
+  go.run(instance);
+  await readyPromise;
+  worker = binding;
+  workerTime = time;
+  return worker;
+}
+
+const server = http.createServer(async (req, res) => {
+  try {
+    const chunks = [];
+    for await (const chunk of req) chunks.push(chunk);
+    const hasBody = req.method !== "GET" && req.method !== "HEAD" && chunks.length > 0;
+    const request = new Request("http://" + (req.headers.host || "localhost") + req.url, {
+      method: req.method,
+      headers: Object.entries(req.headers).map(([k, v]) => [k, Array.isArray(v) ? v.join(", ") : v]),
+      body: hasBody ? Buffer.concat(chunks) : undefined,
+    });
+    await loadEnv();
+    const response = await (await load()).handleRequest(request);
+    res.writeHead(response.status, Object.fromEntries(response.headers));
+    res.end(Buffer.from(await response.arrayBuffer()));
+  } catch (e) {
+    console.error(e && e.stack ? e.stack : String(e));
+    res.writeHead(500, { "content-type": "text/plain" });
+    res.end("edge worker error: " + e);
+  }
+});
+server.listen(0, "127.0.0.1", () => console.log("tinywasm-edge listening 127.0.0.1:" + server.address().port));
+`
@@ -0,0 +1,412 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Project store keys of the server environment profiles.
+const (
+	StoreKeyEnvProfile  = "TINYWASM_ENV_PROFILE"  // active profile, default "dev"
+	StoreKeyEnvProfiles = "TINYWASM_ENV_PROFILES" // comma-separated profile names
+	StoreKeyEnvSecrets  = "TINYWASM_ENV_SECRETS"  // extra variable names to mask, comma-separated
+	storeKeyEnvVars     = "TINYWASM_ENV_VARS_"    // + profile: NAME:value;NAME:value (values query-escaped)
+	storeKeyEnvArgs     = "TINYWASM_ENV_ARGS_"    // + profile: query-escaped args separated by spaces
+)
+
+// DefaultEnvProfiles are offered until TINYWASM_ENV_PROFILES is set.
+var DefaultEnvProfiles = []string{"dev", "staging-local", "test"}
+
+// envSecretMask replaces secret values in logs and state output.
+const envSecretMask = "***"
+
+var (
+	envProfileName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	envVarName     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	envSecretName  = regexp.MustCompile(`(?i)SECRET|TOKEN|PASSW|API_?KEY|PRIVATE|CREDENTIAL|AUTH|DSN`)
+)
+
+// EnvProfile is a named set of variables and CLI args for the server.
+type EnvProfile struct {
+	Name   string            `json:"name"`
+	Active bool              `json:"active"`
+	Vars   map[string]string `json:"vars"` // secrets masked
+	Args   []string          `json:"args,omitempty"`
+}
+
+// EnvProfiles keeps named server environments (dev, staging-local, test...)
+// in the project store. The active profile's variables are given to the
+// server process alone, through the server's SetEnv, and its args are
+// appended to the server run args. A value "$KEY" reads the store key KEY,
+// so secrets already kept in .env are not copied around.
+type EnvProfiles struct {
+	mu       sync.Mutex
+	db       DB
+	active   string
+	onChange func()
+	log      func(message ...any)
+}
+
+// NewEnvProfiles loads the active profile.
+func NewEnvProfiles(db DB) *EnvProfiles {
+	e := &EnvProfiles{db: db, active: DefaultEnvProfiles[0]}
+	if db != nil {
+		if val, err := db.Get(StoreKeyEnvProfile); err == nil && val != "" {
+			e.active = val
+		}
+	}
+	return e
+}
+
+func (e *EnvProfiles) Name() string  { return "EnvProfile" }
+func (e *EnvProfiles) Label() string { return "Server Env" }
+
+// Value implements HandlerEdit.Value: the active profile.
+func (e *EnvProfiles) Value() string { return e.Profile() }
+
+// Change implements HandlerEdit.Change. A profile name switches to it, empty
+// input moves to the next profile and NAME=value sets a variable of the
+// active profile (NAME= removes it).
+func (e *EnvProfiles) Change(newValue string) {
+	in := strings.TrimSpace(newValue)
+	var err error
+	switch {
+	case strings.Contains(in, "="):
+		name, value, _ := strings.Cut(in, "=")
+		err = e.Set(e.Profile(), strings.TrimSpace(name), value)
+	case in == "":
+		names, cur := e.Profiles(), e.Profile()
+		next := names[0]
+		for i, n := range names {
+			if n == cur {
+				next = names[(i+1)%len(names)]
+			}
+		}
+		err = e.SetProfile(next)
+	default:
+		err = e.SetProfile(strings.ToLower(in))
+	}
+	if err != nil {
+		e.logf(err)
+	}
+}
+
+// RedactActionValue implements ActionRedactor: NAME=value records the
+// value masked when NAME is a secret.
+func (e *EnvProfiles) RedactActionValue(value string) string {
+	name, v, ok := strings.Cut(value, "=")
+	if !ok {
+		return value
+	}
+	return name + "=" + e.maskValue(strings.TrimSpace(name), v)
+}
+
+func (e *EnvProfiles) SetLog(f func(message ...any)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.log = f
+}
+
+// SetOnChange registers the server restart run when the active environment changes.
+func (e *EnvProfiles) SetOnChange(fn func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onChange = fn
+}
+
+// Profile returns the active profile.
+func (e *EnvProfiles) Profile() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.active
+}
+
+// Profiles lists the profile names, the active one included.
+func (e *EnvProfiles) Profiles() []string {
+	names := append([]string{}, DefaultEnvProfiles...)
+	if e.db != nil {
+		if val, err := e.db.Get(StoreKeyEnvProfiles); err == nil && val != "" {
+			names = strings.Split(val, ",")
+		}
+	}
+	active := e.Profile()
+	for _, n := range names {
+		if n == active {
+			return names
+		}
+	}
+	return append(names, active)
+}
+
+// SetProfile activates name, creating it when new, and restarts the server.
+func (e *EnvProfiles) SetProfile(name string) error {
+	if !envProfileName.MatchString(name) {
+		return fmt.Errorf("invalid env profile %q: use lowercase letters, digits, - and _", name)
+	}
+	e.addProfile(name)
+	e.mu.Lock()
+	if e.active == name {
+		e.mu.Unlock()
+		return nil
+	}
+	e.active = name
+	e.mu.Unlock()
+	if e.db != nil {
+		e.db.Set(StoreKeyEnvProfile, name)
+	}
+	e.logf("Server env profile", name+":", e.summary(name))
+	e.changed()
+	return nil
+}
+
+func (e *EnvProfiles) addProfile(name string) {
+	names := e.Profiles()
+	for _, n := range names {
+		if n == name {
+			return
+		}
+	}
+	if e.db != nil {
+		e.db.Set(StoreKeyEnvProfiles, strings.Join(append(names, name), ","))
+	}
+}
+
+// Set stores a variable of profile; an empty value removes it. The server
+// restarts when profile is active.
+func (e *EnvProfiles) Set(profile, name, value string) error {
+	if !envProfileName.MatchString(profile) {
+		return fmt.Errorf("invalid env profile %q", profile)
+	}
+	if !envVarName.MatchString(name) {
+		return fmt.Errorf("invalid variable name %q", name)
+	}
+	if e.db == nil {
+		return errors.New("no project store")
+	}
+	vars := e.Vars(profile)
+	if value == "" {
+		delete(vars, name)
+	} else {
+		vars[name] = value
+	}
+	e.addProfile(profile)
+	if err := e.db.Set(storeKeyEnvVars+profile, encodeEnvVars(vars)); err != nil {
+		return err
+	}
+	if profile == e.Profile() {
+		e.logf("Server env", name, "=", e.maskValue(name, value))
+		e.changed()
+	}
+	return nil
+}
+
+// SetArgs replaces the extra server CLI args of profile.
+func (e *EnvProfiles) SetArgs(profile string, args []string) error {
+	if !envProfileName.MatchString(profile) {
+		return fmt.Errorf("invalid env profile %q", profile)
+	}
+	if e.db == nil {
+		return errors.New("no project store")
+	}
+	escaped := make([]string, len(args))
+	for i, a := range args {
+		escaped[i] = url.QueryEscape(a)
+	}
+	e.addProfile(profile)
+	if err := e.db.Set(storeKeyEnvArgs+profile, strings.Join(escaped, " ")); err != nil {
+		return err
+	}
+	if profile == e.Profile() {
+		e.logf("Server args", e.Mask(strings.Join(args, " ")))
+		e.changed()
+	}
+	return nil
+}
+
+// Vars returns the variables of profile as stored, "$KEY" references unresolved.
+func (e *EnvProfiles) Vars(profile string) map[string]string {
+	vars := map[string]string{}
+	if e.db == nil {
+		return vars
+	}
+	val, err := e.db.Get(storeKeyEnvVars + profile)
+	if err != nil {
+		return vars
+	}
+	for _, entry := range strings.Split(val, ";") {
+		name, escaped, ok := strings.Cut(entry, ":")
+		if !ok || name == "" {
+			continue
+		}
+		if value, err := url.QueryUnescape(escaped); err == nil {
+			vars[name] = value
+		}
+	}
+	return vars
+}
+
+func encodeEnvVars(vars map[string]string) string {
+	names := make([]string, 0, len(vars))
+	for n := range vars {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, n := range names {
+		parts[i] = n + ":" + url.QueryEscape(vars[n])
+	}
+	return strings.Join(parts, ";")
+}
+
+// Args returns the extra server CLI args of profile.
+func (e *EnvProfiles) Args(profile string) []string {
+	if e.db == nil {
+		return nil
+	}
+	val, err := e.db.Get(storeKeyEnvArgs + profile)
+	if err != nil || val == "" {
+		return nil
+	}
+	var args []string
+	for _, f := range strings.Fields(val) {
+		if a, err := url.QueryUnescape(f); err == nil {
+			args = append(args, a)
+		}
+	}
+	return args
+}
+
+// RunArgs returns the args of the active profile, appended to the server run args.
+func (e *EnvProfiles) RunArgs() []string { return e.Args(e.Profile()) }
+
+// Env returns the resolved variables of the active profile.
+func (e *EnvProfiles) Env() map[string]string {
+	env := map[string]string{}
+	for name, value := range e.Vars(e.Profile()) {
+		env[name] = e.resolve(value)
+	}
+	return env
+}
+
+// resolve reads "$KEY" values from the project store.
+func (e *EnvProfiles) resolve(value string) string {
+	key, ok := strings.CutPrefix(value, "$")
+	if !ok || e.db == nil || !envVarName.MatchString(key) {
+		return value
+	}
+	v, _ := e.db.Get(key)
+	return v
+}
+
+// State lists every profile with its secrets masked.
+func (e *EnvProfiles) State() []EnvProfile {
+	active := e.Profile()
+	var out []EnvProfile
+	for _, name := range e.Profiles() {
+		p := EnvProfile{Name: name, Active: name == active, Vars: map[string]string{}}
+		for n, v := range e.Vars(name) {
+			p.Vars[n] = e.maskValue(n, v)
+		}
+		for _, a := range e.Args(name) {
+			p.Args = append(p.Args, e.Mask(a))
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// secret reports whether the variable name holds a secret.
+func (e *EnvProfiles) secret(name string) bool {
+	if envSecretName.MatchString(name) {
+		return true
+	}
+	if e.db != nil {
+		if val, err := e.db.Get(StoreKeyEnvSecrets); err == nil {
+			for _, s := range strings.Split(val, ",") {
+				if strings.EqualFold(strings.TrimSpace(s), name) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// maskValue hides value when name is a secret; "$KEY" references stay visible.
+func (e *EnvProfiles) maskValue(name, value string) string {
+	if value == "" || strings.HasPrefix(value, "$") || !e.secret(name) {
+		return value
+	}
+	return envSecretMask
+}
+
+// Mask replaces the resolved values of the active secrets in s, so the
+// server cannot print them to the TUI.
+func (e *EnvProfiles) Mask(s string) string {
+	for name, value := range e.Env() {
+		if len(value) >= 4 && e.secret(name) {
+			s = strings.ReplaceAll(s, value, envSecretMask)
+		}
+	}
+	return s
+}
+
+// MaskMessage applies Mask to the strings and errors of a log message.
+func (e *EnvProfiles) MaskMessage(message ...any) []any {
+	out := make([]any, len(message))
+	for i, m := range message {
+		switch v := m.(type) {
+		case string:
+			out[i] = e.Mask(v)
+		case error:
+			out[i] = e.Mask(v.Error())
+		default:
+			out[i] = m
+		}
+	}
+	return out
+}
+
+// summary is the masked variable list of profile for logs.
+func (e *EnvProfiles) summary(profile string) string {
+	vars := e.Vars(profile)
+	names := make([]string, 0, len(vars))
+	for n := range vars {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, n := range names {
+		parts[i] = n + "=" + e.maskValue(n, vars[n])
+	}
+	if args := e.Args(profile); len(args) > 0 {
+		parts = append(parts, "args: "+e.Mask(strings.Join(args, " ")))
+	}
+	if len(parts) == 0 {
+		return "no variables"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (e *EnvProfiles) changed() {
+	e.mu.Lock()
+	fn := e.onChange
+	e.mu.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+func (e *EnvProfiles) logf(message ...any) {
+	e.mu.Lock()
+	log := e.log
+	e.mu.Unlock()
+	if log != nil {
+		log(message...)
+	}
+}
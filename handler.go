@@ -2,16 +2,46 @@ package app
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"github.com/tinywasm/assetmin"
-	"github.com/tinywasm/image/min"
 	"github.com/tinywasm/client"
 	"github.com/tinywasm/deploy"
 	"github.com/tinywasm/devflow"
 	"github.com/tinywasm/devwatch"
+	"github.com/tinywasm/image/min"
 	"github.com/tinywasm/mcp"
 )
 
+// Options toggles process-level side effects of a single Handler instance.
+// The zero value is the production behavior.
+type Options struct {
+	ID                      string // registry key used by GetHandler (default: start directory)
+	DisableGitIgnore        bool   // never allow the GitClient to write .gitignore entries
+	DisableGlobalCleanup    bool   // don't kill stray server processes left by other runs
+	DisableBrowserAutoStart bool   // never open the browser when the server becomes ready
+}
+
+// TestOptions returns the Options used when running under tests, keyed by id.
+func TestOptions(id string) Options {
+	return Options{
+		ID:                      id,
+		DisableGitIgnore:        true,
+		DisableGlobalCleanup:    true,
+		DisableBrowserAutoStart: true,
+	}
+}
+
+// forProject returns o for the project at dir. A non-empty ID is a prefix
+// shared by every project of a daemon, so it is suffixed with dir to keep
+// registry keys unique.
+func (o Options) forProject(dir string) Options {
+	if o.ID != "" {
+		o.ID = o.ID + ":" + dir
+	}
+	return o
+}
+
 // Handler contains application state and dependencies
 // CRITICAL: This struct does NOT import DevTUI
 type Handler struct {
@@ -22,6 +52,7 @@ type Handler struct {
 	Tui           TuiInterface // Interface defined in TINYWASM, not DevTUI
 	ExitChan      chan bool
 	Logger        func(messages ...any) // Main logger for passing to components
+	Options       Options               // Per-instance side effect toggles
 
 	DB DB // Key-value store interface
 
@@ -35,19 +66,55 @@ type Handler struct {
 	GoHandler     *devflow.Go
 	GoNew         *devflow.GoNew
 	WasmClient    *client.WasmClient
+	WasmSize      *WasmSizeHandler
+	Imports       *ImportAudit
+	Precompress   *Precompressor
+	Release       *ReleaseBuilder
+	Proxy         *DevProxy
+	Artifacts     *ArtifactStore
+	BuildCache    *BuildCache
+	Hooks         *BuildHooks
+	Packages      *PackageGraph
+	Tests         *TestRunner
+	Vet           *Vet
+	ServerProfile *ServerProfile
+	EnvProfiles   *EnvProfiles
+	BuildVars     *BuildVars
+	Debugger      *Debugger
+	Profiler      *Profiler
 	Watcher       *devwatch.DevWatch
 	Browser       BrowserInterface
 	GitHubAuth    any
 
 	// Deploy dependencies
 	DeployManager *deploy.Daemon
+	EdgeEmulator  *EdgeEmulator
 
 	// Lifecycle management
 	startOnce        sync.Once
 	SectionBuild     any // Store reference to build tab
+	SectionTests     any // Store reference to tests tab
 	SectionDeploy    any // Store reference to deploy tab
 	SectionMCP       any // Store reference to mcp tab
 	RestartRequested bool
+	headless         bool // no TUI: budget violations fail the build
+
+	// Where the WasmClient keeps its output. Its Storage field is only safe
+	// to touch under the client's lock, so the in-memory storage is taken
+	// once at init and the switch to disk is recorded here.
+	wasmMemory *client.MemoryStorage
+	wasmOnDisk atomic.Bool
+
+	// A cached build served instead of the in-memory one (see installWasm),
+	// the client's own compiles so far, and whether the mode switch holds
+	// back the reload after one (see wasmModeSwitch)
+	wasmRestored restoredWasm
+	wasmCompiles atomic.Int64
+	wasmHold     atomic.Bool
+
+	// Steps features run around the builds of a saved file (build_phases.go)
+	wasmPhases   *buildPhases
+	serverPhases *buildPhases
 
 	// MCP Server for LLM integration (owns /mcp, /logs, /action, /state, /version routes)
 	MCP *mcp.Server
@@ -67,6 +134,30 @@ func (h *Handler) SetServerFactory(f ServerFactory) {
 	h.serverFactory = f
 }
 
+// ID returns the key this Handler is registered under.
+func (h *Handler) ID() string {
+	if h.Options.ID != "" {
+		return h.Options.ID
+	}
+	return h.RootDir
+}
+
+// serverBrowser returns the browser handed to the server factory.
+// With DisableBrowserAutoStart the server still reloads pages but never opens one.
+func (h *Handler) serverBrowser() BrowserInterface {
+	if h.Options.DisableBrowserAutoStart && h.Browser != nil {
+		return noAutoStartBrowser{h.Browser}
+	}
+	return h.Browser
+}
+
+// noAutoStartBrowser suppresses OpenBrowser on the wrapped browser.
+type noAutoStartBrowser struct {
+	BrowserInterface
+}
+
+func (noAutoStartBrowser) OpenBrowser(port string, https bool) {}
+
 // CheckDevMode checks the DB for "dev_mode" key and sets the DevMode field
 func (h *Handler) CheckDevMode() {
 	if h.DB != nil {
@@ -22,8 +22,12 @@ func (h *Handler) OnProjectReady(wg *sync.WaitGroup) {
 
 	// Ensure compilation happens (force recompile to load into memory)
 	// This prevents 503 errors on subsequent runs where generation is skipped
-	if err := h.WasmClient.RecompileMainWasm(); err != nil {
+	if err := h.RecompileWasm(); err != nil {
 		h.WasmClient.Logger("Initial compilation failed:", err)
+	} else {
+		h.recordWasmArtifact()
+		h.analyzeWasmSize()
+		h.Release.Rebuild() // serve a fresh release if release mode was left on
 	}
 
 	// DevWatch needs to know it should start watching files
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // handlerType constants — must match devtui.HandlerType* iota values.
@@ -15,6 +17,26 @@ const (
 	htInteractive = 3
 )
 
+// stateDebounce coalesces bursts of RefreshUI calls into a single state diff.
+const stateDebounce = 50 * time.Millisecond
+
+// logStateInterval bounds how often handler log lines trigger a state diff,
+// so a chatty build does not diff the whole state on every line.
+const logStateInterval = 500 * time.Millisecond
+
+// StateEntry is one handler's published state.
+// JSON tags match devtui.StateEntry exactly — this is the published wire contract.
+type StateEntry struct {
+	TabTitle     string              `json:"tab_title"`
+	HandlerName  string              `json:"handler_name"`
+	HandlerColor string              `json:"handler_color"`
+	HandlerType  int                 `json:"handler_type"`
+	Label        string              `json:"label"`
+	Value        string              `json:"value"`
+	Shortcut     string              `json:"shortcut"`  // primary key = handler Name()
+	Shortcuts    []map[string]string `json:"shortcuts"` // from ShortcutProvider
+}
+
 // capturedHandler holds everything HeadlessTUI knows about one registered handler.
 // The handler reference is retained so GetHandlerStates() reads Value()/Label()
 // dynamically — never stale, always reflects current handler state.
@@ -41,13 +63,32 @@ func (s *headlessSection) GetTitle() string { return s.Title }
 type HeadlessTUI struct {
 	logger   func(messages ...any)
 	RelayLog func(tabTitle, handlerName, color, msg string) // optional: relay to daemon SSE
-	handlers []capturedHandler                                // populated by AddHandler
+	handlers []capturedHandler                              // populated by AddHandler
 	mu       sync.RWMutex
+
+	// OnStateChange receives the entries that changed since the previous call
+	// and the names of handlers that disappeared. Optional: relay to daemon SSE.
+	OnStateChange func(changed []StateEntry, removed []string)
+	published     map[string]string // handlerName -> encoded entry last reported
+	stateMu       sync.Mutex        // serializes diffs against published
+	refreshing    atomic.Bool       // a debounced diff is already scheduled
+	logRefreshing atomic.Bool       // a log-triggered diff is already scheduled
+
+	// Actions assigns ids to dispatched actions and keeps their results.
+	// The daemon replaces it with one tracker shared by all projects.
+	Actions  *ActionTracker
+	running  map[string]*Action // action id -> action still executing
+	actionMu sync.Mutex
 }
 
 // NewHeadlessTUI creates a new HeadlessTUI
 func NewHeadlessTUI(logger func(messages ...any)) *HeadlessTUI {
-	return &HeadlessTUI{logger: logger, handlers: []capturedHandler{}}
+	return &HeadlessTUI{
+		logger:   logger,
+		handlers: []capturedHandler{},
+		Actions:  NewActionTracker(),
+		running:  map[string]*Action{},
+	}
 }
 
 // NewTabSection returns a headlessSection with an accessible title for log routing.
@@ -82,6 +123,10 @@ func (t *HeadlessTUI) AddHandler(handler any, color string, tabSection any) {
 			} else if t.logger != nil {
 				t.logger(msg)
 			}
+			t.logToAction(handlerName, msg)
+			// Handlers rarely report their own state changes; a log line is the
+			// usual sign that Value()/Label() moved, so check for a delta.
+			t.refreshFromLog()
 		})
 	}
 
@@ -135,6 +180,7 @@ func (t *HeadlessTUI) AddHandler(handler any, color string, tabSection any) {
 
 	// Register primary handler
 	t.handlers = append(t.handlers, ch)
+	defer t.RefreshUI() // async: publishes the new handler once registration completes
 
 	// Register ShortcutProvider shortcuts as additional dispatch entries
 	if sp, ok := handler.(shortcutProvider); ok {
@@ -159,6 +205,12 @@ func (t *HeadlessTUI) AddHandler(handler any, color string, tabSection any) {
 // GetHandlerStates reads current state dynamically from each handler reference.
 // JSON tags match devtui.StateEntry exactly — this is the published wire contract.
 func (t *HeadlessTUI) GetHandlerStates() []byte {
+	data, _ := json.Marshal(t.stateEntries())
+	return data
+}
+
+// stateEntries builds one StateEntry per primary handler, in registration order.
+func (t *HeadlessTUI) stateEntries() []StateEntry {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
@@ -169,18 +221,7 @@ func (t *HeadlessTUI) GetHandlerStates() []byte {
 		Shortcuts() []map[string]string
 	}
 
-	type stateEntry struct {
-		TabTitle     string              `json:"tab_title"`
-		HandlerName  string              `json:"handler_name"`
-		HandlerColor string              `json:"handler_color"`
-		HandlerType  int                 `json:"handler_type"`
-		Label        string              `json:"label"`
-		Value        string              `json:"value"`
-		Shortcut     string              `json:"shortcut"`      // primary key = handler Name()
-		Shortcuts    []map[string]string `json:"shortcuts"`    // from ShortcutProvider
-	}
-
-	entries := make([]stateEntry, 0, len(t.handlers))
+	entries := make([]StateEntry, 0, len(t.handlers))
 	seen := make(map[string]bool) // Track processed handlers to avoid duplicates
 	for _, h := range t.handlers {
 		// Only process primary handler (where key == handlerName), skip shortcut duplicates
@@ -192,7 +233,7 @@ func (t *HeadlessTUI) GetHandlerStates() []byte {
 		}
 		seen[h.handlerName] = true
 
-		e := stateEntry{
+		e := StateEntry{
 			TabTitle:     h.tabTitle,
 			HandlerName:  h.handlerName,
 			HandlerColor: h.handlerColor,
@@ -211,21 +252,141 @@ func (t *HeadlessTUI) GetHandlerStates() []byte {
 		}
 		entries = append(entries, e)
 	}
-	data, _ := json.Marshal(entries)
-	return data
+	return entries
+}
+
+// diffState compares the current state with the last reported one and sends
+// the difference to OnStateChange. Nothing is sent when the state is unchanged.
+func (t *HeadlessTUI) diffState() {
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+
+	if t.published == nil {
+		t.published = map[string]string{}
+	}
+	var changed []StateEntry
+	current := make(map[string]bool)
+	for _, e := range t.stateEntries() {
+		current[e.HandlerName] = true
+		enc, _ := json.Marshal(e)
+		if t.published[e.HandlerName] != string(enc) {
+			t.published[e.HandlerName] = string(enc)
+			changed = append(changed, e)
+		}
+	}
+	var removed []string
+	for name := range t.published {
+		if !current[name] {
+			delete(t.published, name)
+			removed = append(removed, name)
+		}
+	}
+
+	if (len(changed) > 0 || len(removed) > 0) && t.OnStateChange != nil {
+		t.OnStateChange(changed, removed)
+	}
 }
 
 // DispatchAction routes a remote action to the handler registered for that key.
 func (t *HeadlessTUI) DispatchAction(key, value string) bool {
+	_, ok := t.StartAction(key, value)
+	return ok
+}
+
+// StartAction runs the action registered for key in the background and
+// returns it so callers can wait for the result or look it up by id later.
+// Returns false when no handler is registered for key.
+func (t *HeadlessTUI) StartAction(key, value string) (*Action, bool) {
 	t.mu.RLock()
-	defer t.mu.RUnlock()
-	for _, h := range t.handlers {
-		if h.key != "" && h.key == key && h.action != nil {
-			go h.action(value) // non-blocking
-			return true
+	var target *capturedHandler
+	for i := range t.handlers {
+		if h := &t.handlers[i]; h.key != "" && h.key == key && h.action != nil {
+			target = h
+			break
 		}
 	}
-	return false
+	t.mu.RUnlock()
+	if target == nil {
+		return nil, false
+	}
+
+	recorded := value
+	if r, ok := target.handler.(ActionRedactor); ok {
+		recorded = r.RedactActionValue(value)
+	}
+	a := t.Actions.begin(key, recorded, target.handlerName)
+
+	// Handlers only log invalid values; validate first where they let us.
+	type modeValidator interface{ ValidateMode(string) error }
+	if v, ok := target.handler.(modeValidator); ok && target.handlerType == htEdit {
+		if err := v.ValidateMode(value); err != nil {
+			a.finish(ActionFailed, err, handlerValue(target.handler))
+			return a, true
+		}
+	}
+
+	t.actionMu.Lock()
+	t.running[a.ID()] = a
+	t.actionMu.Unlock()
+
+	go func(h capturedHandler) { // non-blocking
+		finish := func(status string, err error) {
+			t.actionMu.Lock()
+			delete(t.running, a.ID())
+			t.actionMu.Unlock()
+			a.finish(status, err, handlerValue(h.handler))
+			t.RefreshUI()
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				finish(ActionFailed, fmt.Errorf("action %s panicked: %v", key, r))
+			}
+		}()
+
+		// Reporters say when their work is over; edit handlers are done once
+		// Change returns. An Execute without a reporter may still be running
+		// in the background, so its outcome is unknown.
+		switch {
+		case isReporter(h.handler):
+			h.handler.(ActionReporter).RunAction(value, func(err error) { finish(ActionDone, err) })
+		case h.handlerType == htEdit:
+			h.action(value)
+			finish(ActionDone, nil)
+		default:
+			h.action(value)
+			finish(ActionDispatched, nil)
+		}
+	}(*target)
+	return a, true
+}
+
+// isReporter reports whether h reports the outcome of its own actions.
+func isReporter(h any) bool {
+	_, ok := h.(ActionReporter)
+	return ok
+}
+
+// logToAction attaches a handler log line to every action it is running.
+func (t *HeadlessTUI) logToAction(handlerName, msg string) {
+	t.actionMu.Lock()
+	var targets []*Action
+	for _, a := range t.running {
+		if a.result.Handler == handlerName {
+			targets = append(targets, a)
+		}
+	}
+	t.actionMu.Unlock()
+	for _, a := range targets {
+		a.log(msg)
+	}
+}
+
+// handlerValue returns h.Value() when the handler exposes one.
+func handlerValue(h any) string {
+	if v, ok := h.(interface{ Value() string }); ok {
+		return v.Value()
+	}
+	return ""
 }
 
 // Start does nothing in headless mode (no UI loop)
@@ -238,8 +399,43 @@ func (t *HeadlessTUI) Start(syncWaitGroup ...any) {
 	}
 }
 
-// RefreshUI does nothing
-func (t *HeadlessTUI) RefreshUI() {}
+// RefreshUI schedules a state diff; the changes reach OnStateChange after a
+// short debounce. It never calls into handlers synchronously, so it is safe to
+// invoke while a handler holds its own locks.
+func (t *HeadlessTUI) RefreshUI() {
+	if t.OnStateChange == nil || !t.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		time.Sleep(stateDebounce)
+		t.refreshing.Store(false)
+		t.diffState()
+	}()
+}
+
+// refreshFromLog schedules at most one state diff per logStateInterval,
+// independently of the log relay which forwards every line immediately.
+func (t *HeadlessTUI) refreshFromLog() {
+	if t.OnStateChange == nil || !t.logRefreshing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		time.Sleep(logStateInterval)
+		t.logRefreshing.Store(false)
+		t.RefreshUI()
+	}()
+}
+
+// Clear drops every registered handler and publishes their removal at once,
+// so clients do not keep entries of a project that stopped.
+func (t *HeadlessTUI) Clear() {
+	t.mu.Lock()
+	t.handlers = nil
+	t.mu.Unlock()
+	if t.OnStateChange != nil {
+		t.diffState()
+	}
+}
 
 // ReturnFocus does nothing
 func (t *HeadlessTUI) ReturnFocus() error {
@@ -0,0 +1,365 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Project store keys tuning the client import audit, comma separated import
+// paths, e.g. in .env:
+//
+//	TINYWASM_WASM_IMPORTS_ALLOW=net/http
+//	TINYWASM_WASM_IMPORTS_DENY=github.com/tinywasm/kvdb,example.com/app/db
+const (
+	StoreKeyWasmImportsAllow = "TINYWASM_WASM_IMPORTS_ALLOW" // never flagged
+	StoreKeyWasmImportsDeny  = "TINYWASM_WASM_IMPORTS_DENY"  // flagged as server-only
+)
+
+// Kinds of import leaks.
+const (
+	ImportLeakServer = "server" // cannot work in the browser
+	ImportLeakTinyGo = "tinygo" // works with Go but is heavy or unsupported by TinyGo
+)
+
+// wasmImportRules lists the standard packages that do not belong in the
+// client build, with the reason shown to the user.
+var wasmImportRules = map[string]struct{ kind, reason string }{
+	"os/exec":           {ImportLeakServer, "processes cannot be started in the browser"},
+	"os/signal":         {ImportLeakServer, "there are no signals in the browser"},
+	"os/user":           {ImportLeakServer, "there are no system users in the browser"},
+	"net":               {ImportLeakServer, "the browser has no sockets"},
+	"net/smtp":          {ImportLeakServer, "the browser has no sockets"},
+	"net/rpc":           {ImportLeakServer, "the browser has no sockets"},
+	"net/http/httptest": {ImportLeakServer, "test servers cannot listen in the browser"},
+	"net/http/pprof":    {ImportLeakServer, "profiling endpoints belong to the server"},
+	"crypto/tls":        {ImportLeakServer, "TLS is handled by the browser"},
+	"database/sql":      {ImportLeakServer, "database drivers cannot run in the browser"},
+	"log/syslog":        {ImportLeakServer, "there is no syslog in the browser"},
+	"plugin":            {ImportLeakServer, "plugins are not supported on js/wasm"},
+	"net/http":          {ImportLeakTinyGo, "large with Go (fetch transport) and unsupported by TinyGo; use the browser fetch API"},
+	"html/template":     {ImportLeakTinyGo, "reflection heavy and only partly supported by TinyGo"},
+	"text/template":     {ImportLeakTinyGo, "reflection heavy and only partly supported by TinyGo"},
+	"encoding/gob":      {ImportLeakTinyGo, "reflection heavy and unsupported by TinyGo"},
+	"encoding/xml":      {ImportLeakTinyGo, "reflection heavy and only partly supported by TinyGo"},
+}
+
+// ImportLeak is a package the client build should not contain.
+type ImportLeak struct {
+	Package string   `json:"package"`
+	Kind    string   `json:"kind"` // ImportLeakServer or ImportLeakTinyGo
+	Reason  string   `json:"reason"`
+	Size    int      `json:"size"`           // wasm bytes removed with it, from the last size report; 0 when unknown
+	Chain   []string `json:"chain"`          // shortest import chain from the client main package
+	File    string   `json:"file,omitempty"` // last project file on the chain, relative to the project root
+}
+
+// String renders l as a log line, e.g.
+// "net/http in wasm build (~412.0 KB): example.com/m/web → example.com/m/shared → net/http (shared/api.go) — large with ...".
+func (l ImportLeak) String() string {
+	s := l.Package + " in wasm build"
+	if l.Size > 0 {
+		s += " (~" + formatBytes(l.Size) + ")"
+	}
+	s += ": " + strings.Join(l.Chain, " → ")
+	if l.File != "" {
+		s += " (" + l.File + ")"
+	}
+	return s + " — " + l.Reason
+}
+
+// ImportAudit walks the import graph of the wasm client after each build and
+// flags server-only packages pulled in by files shared with the server
+// without build tags, shown in the BUILD tab and by app_wasm_imports.
+type ImportAudit struct {
+	mu        sync.Mutex
+	run       sync.Mutex // one audit at a time
+	db        DB
+	rootDir   string
+	clientDir string // client main package, relative to rootDir
+	leaks     []ImportLeak
+	audited   bool
+	log       func(message ...any)
+}
+
+// NewImportAudit audits the client main package in clientDir, reading the
+// allow and deny lists from db when not nil.
+func NewImportAudit(db DB, rootDir, clientDir string) *ImportAudit {
+	return &ImportAudit{db: db, rootDir: rootDir, clientDir: clientDir}
+}
+
+func (a *ImportAudit) Name() string  { return "ImportAudit" }
+func (a *ImportAudit) Label() string { return "Client Imports" }
+
+// Value summarizes the last audit, e.g. "2 leaks (net/http, os/exec)".
+func (a *ImportAudit) Value() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case !a.audited:
+		return "-"
+	case len(a.leaks) == 0:
+		return "ok"
+	}
+	var names []string
+	for _, l := range a.leaks {
+		names = append(names, l.Package)
+	}
+	noun := "leaks"
+	if len(a.leaks) == 1 {
+		noun = "leak"
+	}
+	return fmt.Sprintf("%d %s (%s)", len(a.leaks), noun, strings.Join(names, ", "))
+}
+
+func (a *ImportAudit) SetLog(f func(message ...any)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.log = f
+}
+
+// Leaks returns the findings of the last audit.
+func (a *ImportAudit) Leaks() []ImportLeak {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]ImportLeak{}, a.leaks...)
+}
+
+// Audit lists the client imports under GOOS=js GOARCH=wasm and flags the
+// packages of wasmImportRules and StoreKeyWasmImportsDeny. A flagged package
+// only reachable through another flagged one (net through net/http) is
+// folded into it. Sizes come from report, the size report of the same build,
+// when it has a name section. Findings are logged when they change.
+func (a *ImportAudit) Audit(report *WasmSizeReport) ([]ImportLeak, error) {
+	a.run.Lock()
+	defer a.run.Unlock()
+	graph, root, err := a.importGraph()
+	if err != nil {
+		return nil, err
+	}
+	allow, deny := a.list(StoreKeyWasmImportsAllow), a.list(StoreKeyWasmImportsDeny)
+	flagged := map[string]bool{}
+	stop := map[string]bool{} // chains end at flagged and allowed packages
+	for pkg := range graph.imports {
+		if allow[pkg] {
+			stop[pkg] = true
+			continue
+		}
+		if _, ok := wasmImportRules[pkg]; ok || deny[pkg] {
+			flagged[pkg], stop[pkg] = true, true
+		}
+	}
+
+	sizes := map[string]int{}
+	if report != nil && report.Named {
+		for _, p := range report.Packages {
+			sizes[p.Package] = p.Size
+		}
+	}
+	leaks := []ImportLeak{}
+	for pkg := range flagged {
+		chain := graph.chain(root, pkg, stop)
+		if chain == nil {
+			continue // only imported through another flagged or an allowed package
+		}
+		leak := ImportLeak{Package: pkg, Kind: ImportLeakServer, Reason: "listed in " + StoreKeyWasmImportsDeny, Chain: chain}
+		if rule, ok := wasmImportRules[pkg]; ok && !deny[pkg] {
+			leak.Kind, leak.Reason = rule.kind, rule.reason
+		}
+		for _, dep := range graph.exclusive(root, pkg) {
+			leak.Size += sizes[dep]
+		}
+		leak.File = a.importingFile(graph, chain)
+		leaks = append(leaks, leak)
+	}
+	sort.Slice(leaks, func(i, j int) bool {
+		if leaks[i].Kind != leaks[j].Kind {
+			return leaks[i].Kind == ImportLeakServer
+		}
+		if leaks[i].Size != leaks[j].Size {
+			return leaks[i].Size > leaks[j].Size
+		}
+		return leaks[i].Package < leaks[j].Package
+	})
+
+	a.mu.Lock()
+	changed := !a.audited || !sameLeaks(a.leaks, leaks)
+	hadLeaks := len(a.leaks) > 0
+	a.leaks, a.audited = leaks, true
+	log := a.log
+	a.mu.Unlock()
+	if changed && log != nil {
+		for _, l := range leaks {
+			log("Warning: " + l.String())
+		}
+		if len(leaks) > 0 {
+			log("Move the importing code behind //go:build !wasm or list the package in " + StoreKeyWasmImportsAllow)
+		} else if hadLeaks {
+			log("Client imports clean: no server-only packages in the wasm build")
+		}
+	}
+	return leaks, nil
+}
+
+func sameLeaks(a, b []ImportLeak) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Package != b[i].Package || strings.Join(a[i].Chain, " ") != strings.Join(b[i].Chain, " ") {
+			return false
+		}
+	}
+	return true
+}
+
+// list reads a comma separated set of import paths from the store.
+func (a *ImportAudit) list(key string) map[string]bool {
+	set := map[string]bool{}
+	if a.db == nil {
+		return set
+	}
+	val, err := a.db.Get(key)
+	if err != nil {
+		return set
+	}
+	for _, p := range strings.Split(val, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			set[p] = true
+		}
+	}
+	return set
+}
+
+// importGraph is the dependency graph of one main package.
+type importGraph struct {
+	imports map[string][]string // import path -> imports
+	files   map[string][]string // project packages: absolute paths of their Go files
+}
+
+// importGraph runs go list -deps for the client under the wasm build context.
+func (a *ImportAudit) importGraph() (importGraph, string, error) {
+	g := importGraph{imports: map[string][]string{}, files: map[string][]string{}}
+	cmd := exec.Command("go", "list", "-e", "-deps", "-json=ImportPath,Dir,Imports,GoFiles,Standard", "./"+filepath.ToSlash(a.clientDir))
+	cmd.Dir = a.rootDir
+	cmd.Env = append(os.Environ(), wasmTestEnv...)
+	out, err := cmd.Output()
+	if err != nil {
+		return g, "", fmt.Errorf("go list %s: %w", a.clientDir, err)
+	}
+	dec := json.NewDecoder(strings.NewReader(string(out)))
+	root := ""
+	for dec.More() {
+		var p struct {
+			ImportPath string
+			Dir        string
+			Imports    []string
+			GoFiles    []string
+			Standard   bool
+		}
+		if err := dec.Decode(&p); err != nil {
+			return g, "", err
+		}
+		g.imports[p.ImportPath] = p.Imports
+		if !p.Standard && strings.HasPrefix(p.Dir, a.rootDir) {
+			for _, f := range p.GoFiles {
+				g.files[p.ImportPath] = append(g.files[p.ImportPath], filepath.Join(p.Dir, f))
+			}
+		}
+		root = p.ImportPath // -deps lists the main package last
+	}
+	return g, root, nil
+}
+
+// chain returns the shortest import path from root to pkg that does not go
+// through a package of stop, or nil.
+func (g importGraph) chain(root, pkg string, stop map[string]bool) []string {
+	prev := map[string]string{root: ""}
+	queue := []string{root}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if cur == pkg {
+			var chain []string
+			for p := pkg; p != ""; p = prev[p] {
+				chain = append([]string{p}, chain...)
+			}
+			return chain
+		}
+		if stop[cur] {
+			continue
+		}
+		for _, next := range g.imports[cur] {
+			if _, seen := prev[next]; !seen {
+				prev[next] = cur
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
+
+// exclusive returns pkg and the packages only reachable from root through
+// it: what removing the import of pkg would drop from the build.
+func (g importGraph) exclusive(root, pkg string) []string {
+	without := g.reachable(root, pkg)
+	var out []string
+	for dep := range g.reachable(pkg, "") {
+		if !without[dep] {
+			out = append(out, dep)
+		}
+	}
+	return out
+}
+
+// reachable returns the packages reachable from start, not entering skip.
+func (g importGraph) reachable(start, skip string) map[string]bool {
+	seen := map[string]bool{start: true}
+	stack := []string{start}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, next := range g.imports[cur] {
+			if next != skip && !seen[next] {
+				seen[next] = true
+				stack = append(stack, next)
+			}
+		}
+	}
+	return seen
+}
+
+// importingFile finds the file of the last project package on chain that
+// imports the next package, where a build tag or a move fixes the leak.
+func (a *ImportAudit) importingFile(g importGraph, chain []string) string {
+	for i := len(chain) - 2; i >= 0; i-- {
+		files, ok := g.files[chain[i]]
+		if !ok {
+			continue
+		}
+		for _, file := range files {
+			f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+			if err != nil {
+				continue
+			}
+			for _, imp := range f.Imports {
+				if path, _ := strconv.Unquote(imp.Path.Value); path == chain[i+1] {
+					if rel, err := filepath.Rel(a.rootDir, file); err == nil {
+						return filepath.ToSlash(rel)
+					}
+					return file
+				}
+			}
+		}
+		return ""
+	}
+	return ""
+}
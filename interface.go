@@ -46,7 +46,7 @@ type BrowserInterface interface {
 }
 
 // ServerInterface is the common contract for all server backends.
-// Implemented by: tinywasm/server.ServerHandler, tinywasm/wasi.WasiServer
+// Implemented by: tinywasm/server.ServerHandler, WasiServer
 type ServerInterface interface {
 	// Lifecycle
 	StartServer(wg *sync.WaitGroup)
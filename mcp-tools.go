@@ -1,11 +1,512 @@
 package app
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tinywasm/context"
 	"github.com/tinywasm/mcp"
 )
 
 // Tools returns metadata for all Handler MCP tools.
 // app_rebuild is intentionally not exposed: tinywasm recompiles automatically on file change.
 func (h *Handler) Tools() []mcp.Tool {
-	return []mcp.Tool{}
+	return []mcp.Tool{
+		{
+			Name:        "app_wasm_size_report",
+			Description: "Report where the bytes of the compiled WASM go: total and gzipped size, delta vs the previous build, section sizes, code size per Go package and exceeded size budgets. Use it to find which imports bloat the frontend.",
+			InputSchema: `{"type":"object","properties":{"top":{"type":"integer","description":"Number of packages to list, largest first (default 20, 0 = all)"},"refresh":{"type":"boolean","description":"Re-analyze the current build instead of returning the last report"},"history":{"type":"integer","description":"Also return the last N builds from the size history (time, sizes, triggering file, over budget)"}}}`,
+			Resource:    "wasm",
+			Action:      'r',
+			Execute:     h.executeWasmSizeReport,
+		},
+		{
+			Name:        "app_build_release",
+			Description: "Build a deployable release into deploy/release: content-hashed filenames for wasm, JS, CSS and images, references rewritten in index.html, plus asset-manifest.json. Returns the manifest. Does not change what the dev server serves; toggle Release in the BUILD tab for that.",
+			InputSchema: `{"type":"object","properties":{}}`,
+			Resource:    "release",
+			Action:      'c',
+			Execute:     h.executeBuildRelease,
+		},
+		{
+			Name:        "app_build_artifacts",
+			Description: "List the kept wasm and server builds, oldest first: id, time, size, size mode, git commit, uncommitted changes and the edited file that triggered each build, plus the pinned wasm build if any.",
+			InputSchema: `{"type":"object","properties":{"target":{"type":"string","enum":["wasm","server"],"description":"Only list builds of this target"}}}`,
+			Resource:    "artifacts",
+			Action:      'r',
+			Execute:     h.executeBuildArtifacts,
+		},
+		{
+			Name:        "app_pin_artifact",
+			Description: "Serve a previous wasm build (id from app_build_artifacts) instead of the latest one and reload the browser; it stays pinned across rebuilds until unpinned. Omit id to unpin. Use it to check whether the last edit caused a regression.",
+			InputSchema: `{"type":"object","properties":{"id":{"type":"string","description":"Artifact id, e.g. wasm-12; empty to serve the latest build again"}}}`,
+			Resource:    "artifacts",
+			Action:      'u',
+			Execute:     h.executePinArtifact,
+		},
+		{
+			Name:        "app_run_tests",
+			Description: "Run go test for a package pattern and optional test regexp and return structured results per package and target: status, duration, build errors and every test with its status, duration and, for failures, its output. Packages with wasm-only test files also run under GOOS=js GOARCH=wasm.",
+			InputSchema: `{"type":"object","properties":{"package":{"type":"string","description":"Package patterns relative to the project root, space separated (default ./...), e.g. ./models"},"run":{"type":"string","description":"Only run tests matching this regexp (go test -run)"},"target":{"type":"string","enum":["server","wasm"],"description":"Run on the host (server) or under GOOS=js GOARCH=wasm with Node.js (wasm); default: every target each package has tests for"}}}`,
+			Resource:    "tests",
+			Action:      'r',
+			Execute:     h.executeRunTests,
+		},
+		{
+			Name:        "app_coverage",
+			Description: "Test coverage merged from every test round (on save, Run All Tests, app_run_tests without a run filter). With a file: its percentage and uncovered line ranges, to target untested code precisely. Without: percentage and delta per package and file.",
+			InputSchema: `{"type":"object","properties":{"file":{"type":"string","description":"Source file relative to the project root, e.g. models/user.go; omit for the per-package summary"}}}`,
+			Resource:    "tests",
+			Action:      'r',
+			Execute:     h.executeCoverage,
+		},
+		{
+			Name:        "app_diagnostics",
+			Description: "go vet findings of the project, refreshed for each saved package: file, line, column, analyzer, message and the build contexts reporting it (wasm for code the client depends on, server for the !wasm side). Packages that fail to type check report their errors under the compile analyzer, and data races of a server built with the race profile under the race analyzer with the full stacks in detail. Set refresh to vet every package first.",
+			InputSchema: `{"type":"object","properties":{"file":{"type":"string","description":"Only findings of this file, relative to the project root, e.g. web/client.go"},"refresh":{"type":"boolean","description":"Vet every package of both contexts before answering"}}}`,
+			Resource:    "diagnostics",
+			Action:      'r',
+			Execute:     h.executeDiagnostics,
+		},
+		{
+			Name:        "app_wasm_imports",
+			Description: "Packages in the wasm client build that belong on the server or do not work with TinyGo (os/exec, net, database/sql, net/http, text/template...), each with the reason, the estimated wasm bytes it pulls in, the shortest import chain from the client main package and the project file that starts the leak. Audited after every wasm build; set refresh to audit now.",
+			InputSchema: `{"type":"object","properties":{"refresh":{"type":"boolean","description":"Audit the current sources instead of returning the result of the last build"}}}`,
+			Resource:    "wasm",
+			Action:      'r',
+			Execute:     h.executeWasmImports,
+		},
+		{
+			Name:        "app_server_profile",
+			Description: "Get or set how the external server is compiled: normal, race (-race, data races reported by app_diagnostics), debug (-gcflags=all=-N -l for debuggers) or cover (-cover, counters written to deploy/servercover when the server exits). Setting a profile rebuilds and restarts the server. Returns the active profile, its go build flags and the races seen since the last build.",
+			InputSchema: `{"type":"object","properties":{"profile":{"type":"string","enum":["normal","race","debug","cover"],"description":"Profile to switch to; omit to only read the current one"}}}`,
+			Resource:    "server",
+			Action:      'u',
+			Execute:     h.executeServerProfile,
+		},
+		{
+			Name:        "app_debug_breakpoint",
+			Description: "Set, clear or list breakpoints in the external server through the headless Delve attached to it (enable Debug in the BUILD tab first). With file and line sets a breakpoint, optionally conditional; with clear removes that breakpoint id. Always returns the current breakpoints.",
+			InputSchema: `{"type":"object","properties":{"file":{"type":"string","description":"Source file relative to the project root, e.g. web/server.go"},"line":{"type":"integer","description":"Line to stop at"},"cond":{"type":"string","description":"Go expression; stop only when it is true, e.g. r.URL.Path == \"/api\""},"clear":{"type":"integer","description":"Id of a breakpoint to remove"}}}`,
+			Resource:    "debugger",
+			Action:      'u',
+			Execute:     h.executeDebugBreakpoint,
+		},
+		{
+			Name:        "app_debug_stack",
+			Description: "Where the debugged server is stopped: goroutine, breakpoint hit, stack frames and the arguments and locals of the selected frame. Returns running=true while the server runs.",
+			InputSchema: `{"type":"object","properties":{"goroutine":{"type":"integer","description":"Goroutine id (default: the one that stopped)"},"frame":{"type":"integer","description":"Frame whose variables are read, 0 = innermost"},"depth":{"type":"integer","description":"Maximum frames (default 20)"}}}`,
+			Resource:    "debugger",
+			Action:      'r',
+			Execute:     h.executeDebugStack,
+		},
+		{
+			Name:        "app_debug_control",
+			Description: "Resume or stop the debugged server: continue, next, step, stepout or halt. Returns the new stop location with stack and locals, or running=true when it did not stop within 2s.",
+			InputSchema: `{"type":"object","properties":{"action":{"type":"string","enum":["continue","next","step","stepout","halt"]}},"required":["action"]}`,
+			Resource:    "debugger",
+			Action:      'u',
+			Execute:     h.executeDebugControl,
+		},
+		{
+			Name:        "app_profile",
+			Description: "Capture a pprof profile of the external server (its own /debug/pprof, or dev-only endpoints compiled in with inject=true) or of tinywasm itself, save it under deploy/profiles and return the go tool pprof -top table. Use cpu to find hotspots, heap/allocs for memory, goroutine for leaks and blocked handlers.",
+			InputSchema: `{"type":"object","properties":{"target":{"type":"string","enum":["server","tinywasm"],"description":"Process to profile (default server)"},"kind":{"type":"string","enum":["cpu","heap","goroutine","allocs","block","mutex"]},"seconds":{"type":"integer","description":"CPU sampling time (default 10)"},"top":{"type":"integer","description":"Entries of the summary (default 20)"},"inject":{"type":"boolean","description":"Compile dev-only pprof endpoints into the server (true) or remove them (false); restarts the server"}}}`,
+			Resource:    "profiles",
+			Action:      'c',
+			Execute:     h.executeProfile,
+		},
+		{
+			Name:        "app_env_profile",
+			Description: "Read or edit the environment profiles of the external server (dev, staging-local, test...): variables set in the server process environment and extra CLI args. use switches the active profile; var/value set a variable of profile (default the active one), an empty value removes it and \"$KEY\" reads the .env key KEY; args replaces the extra args. Changes to the active profile restart the server. Secret values are masked in the output.",
+			InputSchema: `{"type":"object","properties":{"use":{"type":"string","description":"Profile to activate, created when new"},"profile":{"type":"string","description":"Profile edited by var/value and args (default: active)"},"var":{"type":"string","description":"Variable name, e.g. DATABASE_URL"},"value":{"type":"string","description":"Variable value; empty removes it"},"args":{"type":"string","description":"Extra server CLI args separated by spaces; empty clears them"}}}`,
+			Resource:    "server",
+			Action:      'u',
+			Execute:     h.executeEnvProfile,
+		},
+		{
+			Name:        "app_build_flags",
+			Description: "Read or change the build-time configuration compiled into the wasm client and the server: feature flags (build tag feature_<name> and buildinfo.Feature(name)), -ldflags -X variables (e.g. main.apiBase) and extra build tags. Values can be shared or set for one env profile. Any change recompiles the client and restarts the server. Returns the effective flags, variables, tags, the compiler args of each build and the BuildInfo (commit, time, mode, profile) they embed.",
+			InputSchema: `{"type":"object","properties":{"feature":{"type":"string","description":"Feature flag to change"},"enabled":{"type":"boolean","description":"New state of feature; omit to flip it"},"var":{"type":"string","description":"Variable to set with -X, package path and name, e.g. main.apiBase"},"value":{"type":"string","description":"Value of var; empty removes it"},"tags":{"type":"string","description":"Extra build tags, comma-separated; empty clears them"},"profile":{"type":"string","description":"Env profile the change applies to; omit for every profile"}}}`,
+			Resource:    "build",
+			Action:      'u',
+			Execute:     h.executeBuildFlags,
+		},
+	}
+}
+
+func (h *Handler) executeRunTests(ctx *context.Context, req mcp.Request) (*mcp.Result, error) {
+	if h.Tests == nil {
+		return mcp.Text("Test runner not initialized yet."), nil
+	}
+	args := []byte(req.Params.Arguments)
+	patterns := strings.Fields(string(unquote(mcp.ExtractJSONValue(args, "package"))))
+	run := string(unquote(mcp.ExtractJSONValue(args, "run")))
+	target := string(unquote(mcp.ExtractJSONValue(args, "target")))
+	result, err := h.Tests.Run(patterns, run, target)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.Text(string(data)), nil
+}
+
+func (h *Handler) executeCoverage(ctx *context.Context, req mcp.Request) (*mcp.Result, error) {
+	if h.Tests == nil || h.Tests.Coverage() == nil {
+		return mcp.Text("Test runner not initialized yet."), nil
+	}
+	var out any
+	if file := string(unquote(mcp.ExtractJSONValue([]byte(req.Params.Arguments), "file"))); file != "" {
+		fc, err := h.Tests.Coverage().File(file)
+		if err != nil {
+			return nil, err
+		}
+		out = fc
+	} else {
+		out = h.Tests.Coverage().Packages()
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.Text(string(data)), nil
+}
+
+func (h *Handler) executeDiagnostics(ctx *context.Context, req mcp.Request) (*mcp.Result, error) {
+	if h.Vet == nil {
+		return mcp.Text("go vet not initialized yet."), nil
+	}
+	args := []byte(req.Params.Arguments)
+	if string(unquote(mcp.ExtractJSONValue(args, "refresh"))) == "true" {
+		if _, err := h.Vet.RunAll(); err != nil {
+			return nil, err
+		}
+	}
+	file := string(unquote(mcp.ExtractJSONValue(args, "file")))
+	diags := h.Vet.Diagnostics(file)
+	if h.ServerProfile != nil {
+		diags = append(diags, h.ServerProfile.Diagnostics(file)...)
+	}
+	data, err := json.MarshalIndent(diags, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.Text(string(data)), nil
+}
+
+func (h *Handler) executeWasmImports(ctx *context.Context, req mcp.Request) (*mcp.Result, error) {
+	if h.Imports == nil {
+		return mcp.Text("WASM client not initialized yet."), nil
+	}
+	leaks := h.Imports.Leaks()
+	if string(unquote(mcp.ExtractJSONValue([]byte(req.Params.Arguments), "refresh"))) == "true" || h.Imports.Value() == "-" {
+		var err error
+		if leaks, err = h.Imports.Audit(h.WasmSize.Report()); err != nil {
+			return nil, err
+		}
+	}
+	data, err := json.MarshalIndent(leaks, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.Text(string(data)), nil
+}
+
+func (h *Handler) executeServerProfile(ctx *context.Context, req mcp.Request) (*mcp.Result, error) {
+	if h.ServerProfile == nil {
+		return mcp.Text("Server not initialized yet."), nil
+	}
+	if name := string(unquote(mcp.ExtractJSONValue([]byte(req.Params.Arguments), "profile"))); name != "" {
+		if err := h.ServerProfile.SetProfile(name); err != nil {
+			return nil, err
+		}
+	}
+	out := struct {
+		Profile     string       `json:"profile"`
+		Profiles    []string     `json:"profiles"`
+		CompileArgs []string     `json:"compile_args"`
+		Races       []RaceReport `json:"races"`
+	}{h.ServerProfile.Profile(), ServerProfiles, h.ServerProfile.CompileArgs(), h.ServerProfile.Races()}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.Text(string(data)), nil
+}
+
+func (h *Handler) executeDebugBreakpoint(ctx *context.Context, req mcp.Request) (*mcp.Result, error) {
+	if h.Debugger == nil {
+		return mcp.Text("Server not initialized yet."), nil
+	}
+	args := []byte(req.Params.Arguments)
+	if id, err := strconv.Atoi(string(mcp.ExtractJSONValue(args, "clear"))); err == nil {
+		if err := h.Debugger.ClearBreakpoint(id); err != nil {
+			return nil, err
+		}
+	}
+	if file := string(unquote(mcp.ExtractJSONValue(args, "file"))); file != "" {
+		line, err := strconv.Atoi(string(mcp.ExtractJSONValue(args, "line")))
+		if err != nil {
+			return nil, errors.New("line is required with file")
+		}
+		if _, err := h.Debugger.SetBreakpoint(file, line, string(unquote(mcp.ExtractJSONValue(args, "cond")))); err != nil {
+			return nil, err
+		}
+	}
+	list, err := h.Debugger.Breakpoints()
+	if err != nil {
+		return nil, err
+	}
+	out := struct {
+		Addr        string            `json:"addr"`
+		Breakpoints []DebugBreakpoint `json:"breakpoints"`
+	}{h.Debugger.Addr(), list}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.Text(string(data)), nil
+}
+
+func (h *Handler) executeDebugStack(ctx *context.Context, req mcp.Request) (*mcp.Result, error) {
+	if h.Debugger == nil {
+		return mcp.Text("Server not initialized yet."), nil
+	}
+	args := []byte(req.Params.Arguments)
+	goroutine, _ := strconv.ParseInt(string(mcp.ExtractJSONValue(args, "goroutine")), 10, 64)
+	frame, _ := strconv.Atoi(string(mcp.ExtractJSONValue(args, "frame")))
+	depth, _ := strconv.Atoi(string(mcp.ExtractJSONValue(args, "depth")))
+	state, err := h.Debugger.Stack(goroutine, frame, depth)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.Text(string(data)), nil
+}
+
+func (h *Handler) executeDebugControl(ctx *context.Context, req mcp.Request) (*mcp.Result, error) {
+	if h.Debugger == nil {
+		return mcp.Text("Server not initialized yet."), nil
+	}
+	state, err := h.Debugger.Control(string(unquote(mcp.ExtractJSONValue([]byte(req.Params.Arguments), "action"))))
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.Text(string(data)), nil
+}
+
+func (h *Handler) executeProfile(ctx *context.Context, req mcp.Request) (*mcp.Result, error) {
+	if h.Profiler == nil {
+		return mcp.Text("Server not initialized yet."), nil
+	}
+	args := []byte(req.Params.Arguments)
+	if inject := string(mcp.ExtractJSONValue(args, "inject")); inject != "" {
+		if err := h.Profiler.SetInject(inject == "true"); err != nil {
+			return nil, err
+		}
+	}
+	kind := string(unquote(mcp.ExtractJSONValue(args, "kind")))
+	if kind == "" {
+		return mcp.Text(fmt.Sprintf("Server pprof injection: %v. Pass kind to capture a profile.", h.Profiler.Inject())), nil
+	}
+	seconds, _ := strconv.Atoi(string(mcp.ExtractJSONValue(args, "seconds")))
+	top, _ := strconv.Atoi(string(mcp.ExtractJSONValue(args, "top")))
+	capture, err := h.Profiler.Capture(string(unquote(mcp.ExtractJSONValue(args, "target"))), kind, seconds, top)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(capture, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.Text(string(data)), nil
+}
+
+func (h *Handler) executeEnvProfile(ctx *context.Context, req mcp.Request) (*mcp.Result, error) {
+	if h.EnvProfiles == nil {
+		return mcp.Text("Server not initialized yet."), nil
+	}
+	args := []byte(req.Params.Arguments)
+	if use := string(unquote(mcp.ExtractJSONValue(args, "use"))); use != "" {
+		if err := h.EnvProfiles.SetProfile(use); err != nil {
+			return nil, err
+		}
+	}
+	profile := string(unquote(mcp.ExtractJSONValue(args, "profile")))
+	if profile == "" {
+		profile = h.EnvProfiles.Profile()
+	}
+	if name := string(unquote(mcp.ExtractJSONValue(args, "var"))); name != "" {
+		if err := h.EnvProfiles.Set(profile, name, string(unquote(mcp.ExtractJSONValue(args, "value")))); err != nil {
+			return nil, err
+		}
+	}
+	if raw := mcp.ExtractJSONValue(args, "args"); len(raw) > 0 {
+		if err := h.EnvProfiles.SetArgs(profile, strings.Fields(string(unquote(raw)))); err != nil {
+			return nil, err
+		}
+	}
+	out := struct {
+		Active   string       `json:"active"`
+		Profiles []EnvProfile `json:"profiles"`
+	}{h.EnvProfiles.Profile(), h.EnvProfiles.State()}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.Text(string(data)), nil
+}
+
+func (h *Handler) executeBuildFlags(ctx *context.Context, req mcp.Request) (*mcp.Result, error) {
+	if h.BuildVars == nil {
+		return mcp.Text("WASM client not initialized yet."), nil
+	}
+	args := []byte(req.Params.Arguments)
+	profile := string(unquote(mcp.ExtractJSONValue(args, "profile")))
+	if name := string(unquote(mcp.ExtractJSONValue(args, "feature"))); name != "" {
+		var err error
+		switch enabled := string(mcp.ExtractJSONValue(args, "enabled")); {
+		case enabled != "":
+			err = h.BuildVars.SetFeature(profile, name, enabled == "true")
+		case profile != "":
+			err = h.BuildVars.SetFeature(profile, name, !h.BuildVars.Features()[name])
+		default:
+			_, err = h.BuildVars.Flip(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if symbol := string(unquote(mcp.ExtractJSONValue(args, "var"))); symbol != "" {
+		if err := h.BuildVars.SetVar(profile, symbol, string(unquote(mcp.ExtractJSONValue(args, "value")))); err != nil {
+			return nil, err
+		}
+	}
+	if raw := mcp.ExtractJSONValue(args, "tags"); len(raw) > 0 {
+		var tags []string
+		for _, t := range strings.Split(string(unquote(raw)), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tags = append(tags, t)
+			}
+		}
+		if err := h.BuildVars.SetTags(profile, tags); err != nil {
+			return nil, err
+		}
+	}
+	mode := h.WasmClient.CurrentSizeMode
+	out := struct {
+		Features  map[string]bool     `json:"features"`
+		Vars      map[string]string   `json:"vars"`
+		Tags      []string            `json:"tags"`
+		Args      map[string][]string `json:"args"`
+		BuildInfo BuildInfo           `json:"build_info"`
+	}{
+		h.BuildVars.Features(), h.BuildVars.Vars(), h.BuildVars.Tags(),
+		map[string][]string{BuildTargetWasm: h.WasmClient.CompilingArguments(), BuildTargetServer: h.BuildVars.Args(BuildTargetServer, h.ServerProfile.Profile())},
+		h.BuildVars.Info(BuildTargetWasm, mode),
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.Text(string(data)), nil
+}
+
+func (h *Handler) executeBuildArtifacts(ctx *context.Context, req mcp.Request) (*mcp.Result, error) {
+	if h.Artifacts == nil {
+		return mcp.Text("WASM client not initialized yet."), nil
+	}
+	target := string(unquote(mcp.ExtractJSONValue([]byte(req.Params.Arguments), "target")))
+	out := struct {
+		Pinned    *Artifact  `json:"pinned,omitempty"`
+		Artifacts []Artifact `json:"artifacts"`
+	}{h.Artifacts.Pinned(), h.Artifacts.List(target)}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.Text(string(data)), nil
+}
+
+func (h *Handler) executePinArtifact(ctx *context.Context, req mcp.Request) (*mcp.Result, error) {
+	if h.Artifacts == nil {
+		return mcp.Text("WASM client not initialized yet."), nil
+	}
+	id := string(unquote(mcp.ExtractJSONValue([]byte(req.Params.Arguments), "id")))
+	if id == "" {
+		h.Artifacts.Unpin()
+		return mcp.Text("Serving the latest build."), nil
+	}
+	a, err := h.Artifacts.Pin(id)
+	if err != nil {
+		return nil, err
+	}
+	return mcp.Text("Serving " + a.ID + " " + describeArtifact(*a) + " until unpinned."), nil
+}
+
+func (h *Handler) executeBuildRelease(ctx *context.Context, req mcp.Request) (*mcp.Result, error) {
+	if h.Release == nil {
+		return mcp.Text("WASM client not initialized yet."), nil
+	}
+	m, err := h.Release.Build()
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.Text(string(out)), nil
+}
+
+func (h *Handler) executeWasmSizeReport(ctx *context.Context, req mcp.Request) (*mcp.Result, error) {
+	if h.WasmSize == nil {
+		return mcp.Text("WASM client not initialized yet."), nil
+	}
+	args := []byte(req.Params.Arguments)
+	top := 20
+	if v, err := strconv.Atoi(string(mcp.ExtractJSONValue(args, "top"))); err == nil && v >= 0 {
+		top = v
+	}
+
+	report := h.WasmSize.Report()
+	if report == nil || string(mcp.ExtractJSONValue(args, "refresh")) == "true" {
+		var err error
+		var budgetErr *WasmBudgetError // the violations are part of the report
+		if report, err = h.WasmSize.Analyze(); err != nil && !errors.As(err, &budgetErr) {
+			return nil, err
+		}
+	}
+
+	out := struct {
+		WasmSizeReport
+		History []WasmSizeRecord `json:"history,omitempty"`
+	}{WasmSizeReport: *report}
+	if top > 0 && len(out.Packages) > top {
+		out.Packages = out.Packages[:top]
+	}
+	if n, err := strconv.Atoi(string(mcp.ExtractJSONValue(args, "history"))); err == nil && n > 0 {
+		out.History = h.WasmSize.History()
+		if len(out.History) > n {
+			out.History = out.History[len(out.History)-n:]
+		}
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.Text(string(data)), nil
 }
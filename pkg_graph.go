@@ -0,0 +1,270 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tinywasm/devwatch"
+)
+
+// PackageGraph is the import graph of the module's own packages in the host
+// ("server") and GOOS=js GOARCH=wasm ("wasm") build contexts. Like the
+// depfind graph behind the watcher it is read with go/build, without the go
+// command, and kept up to date per saved file: only the directory of a
+// changed file is read again. devwatch keeps its finder private and reads
+// the host context alone, so the test runner, vet and the build cache share
+// this one.
+type PackageGraph struct {
+	mu      sync.Mutex
+	rootDir string
+	module  string
+	modTime time.Time                            // of go.mod when the graph was built
+	pkgs    map[string]map[string]*build.Package // by target, then directory
+	dirty   map[string]bool                      // directories to read again
+	stamps  map[string]string                    // .go file names, sizes and mtimes by directory
+}
+
+// graphTargets are the build contexts the graph is kept for.
+var graphTargets = []string{TestTargetServer, TestTargetWasm}
+
+// NewPackageGraph reads the module at rootDir on first use.
+func NewPackageGraph(rootDir string) *PackageGraph {
+	if abs, err := filepath.Abs(rootDir); err == nil {
+		rootDir = abs
+	}
+	return &PackageGraph{rootDir: rootDir, dirty: map[string]bool{}, stamps: map[string]string{}}
+}
+
+// Changed marks the package of file to be read again on the next query.
+func (g *PackageGraph) Changed(file string) {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	g.mu.Lock()
+	g.dirty[filepath.Dir(file)] = true
+	g.mu.Unlock()
+}
+
+// Packages returns the module packages of target by import path.
+func (g *PackageGraph) Packages(target string) (map[string]PackageInfo, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.refresh(); err != nil {
+		return nil, err
+	}
+	out := map[string]PackageInfo{}
+	for dir, p := range g.pkgs[target] {
+		name := g.importPath(dir)
+		out[name] = PackageInfo{
+			ImportPath:   name,
+			Dir:          dir,
+			Imports:      p.Imports,
+			TestImports:  p.TestImports,
+			XTestImports: p.XTestImports,
+			TestGoFiles:  p.TestGoFiles,
+			XTestGoFiles: p.XTestGoFiles,
+		}
+	}
+	return out, nil
+}
+
+// refresh builds the graph on first use or when go.mod changed, and reads
+// the dirty directories again otherwise. g.mu is held.
+func (g *PackageGraph) refresh() error {
+	info, err := os.Stat(filepath.Join(g.rootDir, "go.mod"))
+	if err != nil {
+		return err
+	}
+	if g.pkgs != nil && info.ModTime().Equal(g.modTime) {
+		for dir := range g.dirty {
+			g.read(dir)
+		}
+		g.dirty = map[string]bool{}
+		return nil
+	}
+
+	module := readModulePath(filepath.Join(g.rootDir, "go.mod"))
+	if module == "" {
+		return errors.New("go.mod: no module path")
+	}
+	g.module, g.modTime, g.dirty, g.stamps = module, info.ModTime(), map[string]bool{}, map[string]string{}
+	g.pkgs = map[string]map[string]*build.Package{}
+	for _, target := range graphTargets {
+		g.pkgs[target] = map[string]*build.Package{}
+	}
+	return filepath.WalkDir(g.rootDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if p != g.rootDir {
+			name := d.Name()
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor" || name == "node_modules" {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+				return filepath.SkipDir // another module
+			}
+		}
+		g.read(p)
+		return nil
+	})
+}
+
+// read imports dir in every target, dropping it when it holds no package.
+func (g *PackageGraph) read(dir string) {
+	g.stamps[dir] = dirStamp(dir)
+	for _, target := range graphTargets {
+		ctx := build.Default
+		if target == TestTargetWasm {
+			ctx.GOOS, ctx.GOARCH, ctx.CgoEnabled = "js", "wasm", false
+		}
+		p, err := ctx.ImportDir(dir, 0)
+		var noGo *build.NoGoError
+		if err != nil && !(errors.As(err, &noGo) && len(p.TestGoFiles)+len(p.XTestGoFiles) > 0) {
+			delete(g.pkgs[target], dir)
+			continue
+		}
+		g.pkgs[target][dir] = p
+	}
+}
+
+// Deps maps the directory of each module package the package in dir
+// (relative to the module root) imports under target, directly or not, to
+// its import path. dir itself is included.
+func (g *PackageGraph) Deps(target, dir string) (map[string]string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	pkgs, err := g.walk(target, filepath.Join(g.rootDir, dir), false)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]string{}
+	for d := range pkgs {
+		out[d] = g.importPath(d)
+	}
+	return out, nil
+}
+
+// walk returns the module packages reachable from dir under target by
+// directory. loose also follows the imports of the files excluded by build
+// constraints, which other tags or modes may build. Directories whose .go
+// files changed since they were read are read again, so a graph no watcher
+// reports to stays current. g.mu is held.
+func (g *PackageGraph) walk(target, dir string, loose bool) (map[string]*build.Package, error) {
+	if err := g.refresh(); err != nil {
+		return nil, err
+	}
+	out := map[string]*build.Package{}
+	queue := []string{dir}
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+		if _, ok := out[d]; ok {
+			continue
+		}
+		if dirStamp(d) != g.stamps[d] {
+			g.read(d)
+		}
+		p := g.pkgs[target][d]
+		if p == nil {
+			if d == dir {
+				return nil, fmt.Errorf("%s: no buildable Go package", dir)
+			}
+			continue
+		}
+		out[d] = p
+		imports := p.Imports
+		if loose {
+			imports = append(append([]string{}, imports...), ignoredImports(p)...)
+		}
+		for _, imp := range imports {
+			if rel, ok := strings.CutPrefix(imp, g.module); ok && (rel == "" || rel[0] == '/') {
+				queue = append(queue, filepath.Join(g.rootDir, filepath.FromSlash(rel)))
+			}
+		}
+	}
+	return out, nil
+}
+
+// ignoredImports returns the imports of the files of p excluded by build
+// constraints.
+func ignoredImports(p *build.Package) []string {
+	var imports []string
+	for _, name := range p.IgnoredGoFiles {
+		f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(p.Dir, name), nil, parser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+		for _, spec := range f.Imports {
+			imports = append(imports, strings.Trim(spec.Path.Value, `"`))
+		}
+	}
+	return imports
+}
+
+// dirStamp sums up the .go files of dir: names, sizes and mtimes.
+func dirStamp(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			fmt.Fprintf(&b, "%s %d %d\n", e.Name(), info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return b.String()
+}
+
+// importPath returns the import path of the module directory dir.
+func (g *PackageGraph) importPath(dir string) string {
+	rel, err := filepath.Rel(g.rootDir, dir)
+	if err != nil || rel == "." {
+		return g.module
+	}
+	return path.Join(g.module, filepath.ToSlash(rel))
+}
+
+// readModulePath returns the module path declared in the go.mod file.
+func readModulePath(gomod string) string {
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module"); ok {
+			return strings.Trim(strings.TrimSpace(rest), `"`)
+		}
+	}
+	return ""
+}
+
+// Watcher returns the handler that marks saved packages for the graph. It is
+// registered before the handlers that query it.
+func (g *PackageGraph) Watcher() devwatch.FilesEventHandlers { return graphWatcher{g} }
+
+type graphWatcher struct{ graph *PackageGraph }
+
+func (w graphWatcher) MainInputFileRelativePath() string { return "" }
+func (w graphWatcher) UnobservedFiles() []string         { return nil }
+func (w graphWatcher) SupportedExtensions() []string     { return []string{".go"} }
+
+func (w graphWatcher) NewFileEvent(fileName, extension, filePath, event string) error {
+	if event != "scan" {
+		w.graph.Changed(filePath)
+	}
+	return errBackgroundOnly
+}
@@ -0,0 +1,440 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StoreKeyPrecompress disables compression when set to "false" (toggled from
+// the BUILD tab; useful when debugging raw responses).
+const StoreKeyPrecompress = "TINYWASM_PRECOMPRESS"
+
+// precompressMinSize skips bodies too small to benefit from compression.
+const precompressMinSize = 256
+
+// precompressExts are the files WriteDir writes .gz/.br variants for.
+var precompressExts = map[string]bool{
+	".wasm": true, ".js": true, ".css": true, ".html": true,
+	".svg": true, ".json": true, ".txt": true, ".map": true,
+}
+
+// Precompressor serves the wasm and asset routes gzip or brotli encoded,
+// negotiated from Accept-Encoding, and mirrors the same variants next to the
+// files written to disk for the external server.
+type Precompressor struct {
+	// Brotli encodes data as brotli. It defaults to the `brotli` CLI when
+	// installed and is nil otherwise (gzip only).
+	Brotli func(data []byte) ([]byte, error)
+
+	mu      sync.Mutex
+	db      DB
+	enabled bool
+	cache   map[string]*encodedBody // by URL path; holds the latest body only
+	diskDir func() string           // public dir when assets are served from disk, "" otherwise
+	log     func(message ...any)
+}
+
+type encodedBody struct {
+	hash string
+	gz   []byte
+	br   []byte // nil when brotli is unavailable or failed
+}
+
+// NewPrecompressor reads the toggle from db (enabled by default).
+// diskDir returns the public directory while the build output lives on disk.
+func NewPrecompressor(db DB, diskDir func() string) *Precompressor {
+	p := &Precompressor{
+		Brotli:  brotliCLI(),
+		db:      db,
+		enabled: true,
+		cache:   make(map[string]*encodedBody),
+		diskDir: diskDir,
+	}
+	if db != nil {
+		if v, err := db.Get(StoreKeyPrecompress); err == nil && v == "false" {
+			p.enabled = false
+		}
+	}
+	return p
+}
+
+func (p *Precompressor) Name() string { return "Compression" }
+
+func (p *Precompressor) Label() string {
+	if p.Brotli != nil {
+		return "Compression (gzip, br)"
+	}
+	return "Compression (gzip)"
+}
+
+// Value implements HandlerEdit.Value, e.g. "Precompress:T".
+func (p *Precompressor) Value() string {
+	if p.Enabled() {
+		return "Precompress:T"
+	}
+	return "Precompress:F"
+}
+
+// Change implements HandlerEdit.Change, accepting "Precompress:T" or "Precompress:F".
+func (p *Precompressor) Change(newValue string) {
+	key, val, ok := strings.Cut(newValue, ":")
+	if !ok || strings.TrimSpace(key) != "Precompress" {
+		return
+	}
+	val = strings.ToLower(strings.TrimSpace(val))
+	p.SetEnabled(val == "t" || val == "true")
+}
+
+func (p *Precompressor) SetLog(f func(message ...any)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log = f
+}
+
+// Enabled reports whether responses and disk output are compressed.
+func (p *Precompressor) Enabled() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.enabled
+}
+
+// SetEnabled toggles compression, persists the choice and brings the disk
+// variants in line with it.
+func (p *Precompressor) SetEnabled(on bool) {
+	p.mu.Lock()
+	p.enabled = on
+	db, log := p.db, p.log
+	p.mu.Unlock()
+
+	if db != nil {
+		db.Set(StoreKeyPrecompress, strconv.FormatBool(on))
+	}
+	if log != nil {
+		if on {
+			log("Compression enabled")
+		} else {
+			log("Compression disabled: assets are served uncompressed")
+		}
+	}
+	p.RefreshDisk()
+}
+
+// Routes registers fns on a private mux and mounts it at "/" behind Wrap.
+// assetmin already owns "/" for index.html, so the combined mux takes its place.
+func (p *Precompressor) Routes(fns ...func(*http.ServeMux)) func(*http.ServeMux) {
+	return func(mux *http.ServeMux) {
+		inner := http.NewServeMux()
+		for _, fn := range fns {
+			fn(inner)
+		}
+		mux.Handle("/", p.Wrap(inner))
+	}
+}
+
+// Wrap negotiates the encoding of next's responses. next always sees a request
+// without Accept-Encoding, so it answers with the identity body that is then
+// compressed once per content hash and cached. Only a 200 of a compressible
+// type without Content-Encoding is buffered; anything else streams through.
+// Encoded responses keep next's Cache-Control (e.g. the immutable hashed
+// release assets) and default to no-cache, revalidated by ETag.
+func (p *Precompressor) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept := r.Header.Get("Accept-Encoding")
+		r = r.Clone(r.Context())
+		r.Header.Del("Accept-Encoding")
+
+		if !p.Enabled() || r.Method != http.MethodGet || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &encodableResponse{w: w}
+		next.ServeHTTP(rec, r)
+		if !rec.buffered {
+			return
+		}
+		body := rec.body.Bytes()
+		if len(body) < precompressMinSize {
+			w.WriteHeader(http.StatusOK)
+			w.Write(body)
+			return
+		}
+
+		enc := p.encode(r.URL.Path, body)
+		h := w.Header()
+		h.Add("Vary", "Accept-Encoding")
+		if h.Get("Cache-Control") == "" {
+			h.Set("Cache-Control", "no-cache")
+		}
+		etag, out := `"`+enc.hash+`"`, body
+		switch negotiateEncoding(accept, enc.br != nil) {
+		case "br":
+			h.Set("Content-Encoding", "br")
+			etag, out = `"`+enc.hash+`-br"`, enc.br
+		case "gzip":
+			h.Set("Content-Encoding", "gzip")
+			etag, out = `"`+enc.hash+`-gz"`, enc.gz
+		}
+		h.Set("ETag", etag)
+		if match := r.Header.Get("If-None-Match"); match == etag || match == "*" {
+			h.Del("Content-Encoding")
+			h.Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		h.Set("Content-Length", strconv.Itoa(len(out)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(out)
+	})
+}
+
+// encode returns the cached variants for path, compressing on content change.
+func (p *Precompressor) encode(path string, body []byte) *encodedBody {
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:8])
+
+	p.mu.Lock()
+	cached := p.cache[path]
+	brotli := p.Brotli
+	p.mu.Unlock()
+	if cached != nil && cached.hash == hash {
+		return cached
+	}
+
+	enc := &encodedBody{hash: hash, gz: gzipBytes(body)}
+	if brotli != nil {
+		if br, err := brotli(body); err == nil {
+			enc.br = br
+		} else {
+			p.logf("Brotli compression failed:", err)
+		}
+	}
+	p.mu.Lock()
+	p.cache[path] = enc
+	p.mu.Unlock()
+	return enc
+}
+
+// RefreshDisk updates the variants in the disk output directory, if any.
+func (p *Precompressor) RefreshDisk() {
+	if p.diskDir == nil {
+		return
+	}
+	if dir := p.diskDir(); dir != "" {
+		if err := p.WriteDir(dir); err != nil {
+			p.logf("Precompress:", err)
+		}
+	}
+}
+
+// WriteDir writes name.gz (and name.br) next to each compressible file in dir,
+// skipping variants newer than their source. When disabled it removes them so
+// a server doing static precompressed lookups falls back to the plain files.
+func (p *Precompressor) WriteDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	enabled := p.Enabled()
+	p.mu.Lock()
+	brotli := p.Brotli
+	p.mu.Unlock()
+
+	var errs []error
+	for _, e := range entries {
+		if e.IsDir() || !precompressExts[filepath.Ext(e.Name())] {
+			continue
+		}
+		src := filepath.Join(dir, e.Name())
+		variants := map[string]func([]byte) ([]byte, error){
+			".gz": func(b []byte) ([]byte, error) { return gzipBytes(b), nil },
+		}
+		if brotli != nil {
+			variants[".br"] = brotli
+		}
+		if !enabled {
+			for _, ext := range []string{".gz", ".br"} {
+				if err := os.Remove(src + ext); err != nil && !errors.Is(err, os.ErrNotExist) {
+					errs = append(errs, err)
+				}
+			}
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var data []byte
+		for ext, compress := range variants {
+			if v, err := os.Stat(src + ext); err == nil && !v.ModTime().Before(info.ModTime()) {
+				continue // up to date
+			}
+			if data == nil {
+				if data, err = os.ReadFile(src); err != nil {
+					errs = append(errs, err)
+					break
+				}
+			}
+			out, err := compress(data)
+			if err == nil {
+				err = os.WriteFile(src+ext, out, 0644)
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Precompressor) logf(message ...any) {
+	p.mu.Lock()
+	log := p.log
+	p.mu.Unlock()
+	if log != nil {
+		log(message...)
+	}
+}
+
+// negotiateEncoding picks br, gzip or "" (identity) from an Accept-Encoding
+// header, honoring q=0 exclusions and preferring brotli on ties.
+func negotiateEncoding(accept string, brotli bool) string {
+	q := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = f
+			}
+		}
+		if name = strings.ToLower(name); name != "" {
+			q[name] = weight
+		}
+	}
+	weight := func(enc string) float64 {
+		if w, ok := q[enc]; ok {
+			return w
+		}
+		return q["*"]
+	}
+	best, bestQ := "", 0.0
+	if brotli && weight("br") > 0 {
+		best, bestQ = "br", weight("br")
+	}
+	if w := weight("gzip"); w > bestQ {
+		best = "gzip"
+	}
+	return best
+}
+
+func compressibleType(ct string) bool {
+	ct, _, _ = strings.Cut(ct, ";")
+	switch ct = strings.TrimSpace(ct); {
+	case strings.HasPrefix(ct, "text/"):
+		return true
+	case ct == "application/wasm", ct == "application/javascript",
+		ct == "application/json", ct == "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	gz, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	gz.Write(data)
+	gz.Close()
+	return buf.Bytes()
+}
+
+// brotliCLI returns an encoder backed by the brotli command, or nil when it
+// isn't installed (the standard library has no brotli encoder).
+func brotliCLI() func([]byte) ([]byte, error) {
+	path, err := exec.LookPath("brotli")
+	if err != nil {
+		return nil
+	}
+	return func(data []byte) ([]byte, error) {
+		cmd := exec.Command(path, "-c", "-q", "9")
+		cmd.Stdin = bytes.NewReader(data)
+		return cmd.Output()
+	}
+}
+
+// encodableResponse buffers a response Wrap can encode: a 200 of a
+// compressible type without Content-Encoding. The decision is made when the
+// status is written; any other response goes straight to w.
+type encodableResponse struct {
+	w        http.ResponseWriter
+	status   int
+	buffered bool
+	body     bytes.Buffer
+}
+
+func (e *encodableResponse) Header() http.Header { return e.w.Header() }
+
+func (e *encodableResponse) WriteHeader(code int) {
+	if e.status != 0 {
+		return
+	}
+	e.status = code
+	h := e.w.Header()
+	e.buffered = code == http.StatusOK && h.Get("Content-Encoding") == "" && compressibleType(h.Get("Content-Type"))
+	if !e.buffered {
+		e.w.WriteHeader(code)
+	}
+}
+
+func (e *encodableResponse) Write(p []byte) (int, error) {
+	if e.status == 0 {
+		if h := e.w.Header(); h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(p)) // as net/http would
+		}
+		e.WriteHeader(http.StatusOK)
+	}
+	if e.buffered {
+		return e.body.Write(p)
+	}
+	return e.w.Write(p)
+}
+
+// Flush passes flushes of streamed responses on.
+func (e *encodableResponse) Flush() {
+	if e.status != 0 && !e.buffered {
+		http.NewResponseController(e.w).Flush()
+	}
+}
+
+// bufferedResponse captures an inner handler's whole response, e.g. for the
+// release crawl.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if b.status == 0 {
+		b.status = code
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
@@ -0,0 +1,479 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Project store keys of the profiler.
+const (
+	StoreKeyServerPprof = "TINYWASM_SERVER_PPROF" // "true" injects dev-only pprof endpoints into the server
+	StoreKeyPprofPort   = "TINYWASM_PPROF_PORT"   // port of the injected endpoints, default 6061
+)
+
+// Profile targets.
+const (
+	ProfileTargetServer = "server"   // the external server process
+	ProfileTargetSelf   = "tinywasm" // this process (daemon, TUI, builders)
+)
+
+// ProfileKinds lists the profiles that can be captured; cpu samples for a
+// number of seconds, the others are snapshots.
+var ProfileKinds = []string{"cpu", "heap", "goroutine", "allocs", "block", "mutex"}
+
+// PprofTag is the build tag that compiles the injected pprof file into the server.
+const PprofTag = "tinywasm_pprof"
+
+// pprofDevFile is the file the build overlay adds to the server main package.
+const pprofDevFile = "tinywasm_pprof_dev.go"
+
+// pprofOverlayDir holds the injected file and its go build -overlay map,
+// hidden inside the profiles directory so the watcher skips it.
+const pprofOverlayDir = ".overlay"
+
+const (
+	defaultPprofPort       = "6061"
+	defaultProfileSeconds  = 10
+	defaultProfileTop      = 20
+	profileRequestOverhead = 10 * time.Second
+)
+
+// ProfileCapture is a profile saved under the project.
+type ProfileCapture struct {
+	Target  string    `json:"target"`
+	Kind    string    `json:"kind"`
+	Seconds int       `json:"seconds,omitempty"` // cpu only
+	Time    time.Time `json:"time"`
+	File    string    `json:"file"`   // relative to the project root
+	Source  string    `json:"source"` // pprof URL or "in-process"
+	Top     string    `json:"top"`    // go tool pprof -top
+}
+
+// Profiler captures CPU, heap, goroutine... profiles of the external server
+// and of tinywasm itself, keeps them in deploy/profiles and summarizes them
+// with go tool pprof. Servers that do not expose /debug/pprof get a dev-only
+// listener compiled in with the tinywasm_pprof tag while injection is on,
+// added through go build -overlay so the server sources stay untouched.
+type Profiler struct {
+	mu         sync.Mutex
+	db         DB
+	rootDir    string
+	serverDir  string // relative, holds the server main file
+	serverMain string
+	dir        string // absolute profiles directory
+	serverPort func() string
+	inject     bool
+	gitIgnore  func(entry string) error
+	last       string // last TUI request, e.g. "server cpu 10s"
+	onChange   func()
+	log        func(message ...any)
+}
+
+// NewProfiler stores profiles in dir. serverDir and serverMain locate the
+// server main package, where the pprof file is injected.
+func NewProfiler(db DB, rootDir, serverDir, serverMain, dir string, serverPort func() string) *Profiler {
+	p := &Profiler{db: db, rootDir: rootDir, serverDir: serverDir, serverMain: serverMain, dir: dir, serverPort: serverPort, last: "server cpu 10s"}
+	if db != nil {
+		if val, err := db.Get(StoreKeyServerPprof); err == nil && val == "true" {
+			p.inject = true
+			p.writeDevFile() // restore a deleted file
+		}
+	}
+	return p
+}
+
+func (p *Profiler) Name() string  { return "Profiler" }
+func (p *Profiler) Label() string { return "Profile" }
+
+// Value implements HandlerEdit.Value: the last request, so Enter repeats it.
+func (p *Profiler) Value() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.last
+}
+
+// Change implements HandlerEdit.Change: "[server|tinywasm] <kind> [seconds]",
+// e.g. "heap", "tinywasm goroutine" or "server cpu 30s". The capture runs in
+// the background and its summary is logged.
+func (p *Profiler) Change(newValue string) {
+	p.RunAction(newValue, func(error) {})
+}
+
+// RunAction implements ActionReporter: done is called once the capture is saved.
+func (p *Profiler) RunAction(newValue string, done func(error)) {
+	target, kind, seconds := ProfileTargetServer, "cpu", defaultProfileSeconds
+	for _, f := range strings.Fields(strings.ToLower(newValue)) {
+		switch {
+		case f == ProfileTargetServer || f == ProfileTargetSelf:
+			target = f
+		case strings.TrimSuffix(f, "s") != "" && isDigits(strings.TrimSuffix(f, "s")):
+			seconds, _ = strconv.Atoi(strings.TrimSuffix(f, "s"))
+		default:
+			kind = f
+		}
+	}
+	req := target + " " + kind
+	if kind == "cpu" {
+		req += " " + strconv.Itoa(seconds) + "s"
+	}
+	p.mu.Lock()
+	p.last = req
+	p.mu.Unlock()
+	go func() {
+		c, err := p.Capture(target, kind, seconds, 10)
+		if err != nil {
+			p.logf("Profile", req+":", err)
+			done(err)
+			return
+		}
+		p.logf("Profile", req, "saved to", c.File+"\n"+c.Top)
+		done(nil)
+	}()
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func (p *Profiler) SetLog(f func(message ...any)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log = f
+}
+
+// SetGitIgnoreAdd sets the callback that ignores the injected file.
+func (p *Profiler) SetGitIgnoreAdd(fn func(entry string) error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gitIgnore = fn
+}
+
+// SetOnChange registers the server restart run when injection is toggled.
+func (p *Profiler) SetOnChange(fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onChange = fn
+}
+
+// Inject reports whether the dev-only pprof endpoints are compiled into the server.
+func (p *Profiler) Inject() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.inject
+}
+
+// SetInject writes or removes the pprof overlay of the server, persists the
+// choice and restarts the server.
+func (p *Profiler) SetInject(on bool) error {
+	p.mu.Lock()
+	if p.inject == on {
+		p.mu.Unlock()
+		return nil
+	}
+	p.inject = on
+	db, onChange := p.db, p.onChange
+	p.mu.Unlock()
+	var err error
+	if on {
+		err = p.writeDevFile()
+	} else {
+		err = os.RemoveAll(p.overlayDir())
+	}
+	if err != nil {
+		return err
+	}
+	if db != nil {
+		db.Set(StoreKeyServerPprof, strconv.FormatBool(on))
+	}
+	if on {
+		p.logf("Server pprof endpoints on", p.injectedAddr(), "(dev builds only, -tags="+PprofTag+")")
+	}
+	if onChange != nil {
+		onChange()
+	}
+	return nil
+}
+
+// CompileArgs returns the build tag and the overlay of the injected file
+// while injection is on.
+func (p *Profiler) CompileArgs() []string {
+	if p.Inject() {
+		return []string{"-tags=" + PprofTag, "-overlay=" + filepath.Join(p.overlayDir(), "overlay.json")}
+	}
+	return nil
+}
+
+// UnobservedFiles keeps the watcher off the overlay.
+func (p *Profiler) UnobservedFiles() []string {
+	if rel, err := filepath.Rel(p.rootDir, p.overlayDir()); err == nil {
+		return []string{rel}
+	}
+	return []string{p.overlayDir()}
+}
+
+// InjectToggle returns the BUILD tab toggle of the injected endpoints.
+func (p *Profiler) InjectToggle() any { return profilerInject{p} }
+
+func (p *Profiler) overlayDir() string {
+	return filepath.Join(p.dir, pprofOverlayDir)
+}
+
+func (p *Profiler) injectedAddr() string {
+	port := defaultPprofPort
+	if p.db != nil {
+		if v, err := p.db.Get(StoreKeyPprofPort); err == nil && v != "" {
+			port = v
+		}
+	}
+	return "127.0.0.1:" + port
+}
+
+// writeDevFile writes the pprof listener and the overlay that compiles it
+// into the package of the server main file.
+func (p *Profiler) writeDevFile() error {
+	pkg := "main"
+	if f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(p.rootDir, p.serverDir, p.serverMain), nil, parser.PackageClauseOnly); err == nil {
+		pkg = f.Name.Name
+	}
+	src := `//go:build ` + PprofTag + `
+
+// Code generated by tinywasm. DO NOT EDIT.
+// Dev-only pprof endpoints, compiled in only with -tags=` + PprofTag + `.
+// Added to the server package by go build -overlay; turn off
+// "Server pprof" in the BUILD tab to remove it.
+
+package ` + pkg + `
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+func init() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	go http.ListenAndServe("` + p.injectedAddr() + `", mux)
+}
+`
+	dir := p.overlayDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file := filepath.Join(dir, pprofDevFile)
+	if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+		return err
+	}
+	overlay, err := json.Marshal(map[string]map[string]string{
+		"Replace": {filepath.Join(p.rootDir, p.serverDir, pprofDevFile): file},
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "overlay.json"), overlay, 0644); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	gitIgnore := p.gitIgnore
+	p.mu.Unlock()
+	if gitIgnore != nil {
+		if rel, err := filepath.Rel(p.rootDir, dir); err == nil {
+			_ = gitIgnore(filepath.ToSlash(rel))
+		}
+	}
+	return nil
+}
+
+// Capture takes a profile of target (ProfileTargetServer or
+// ProfileTargetSelf), saves it in the profiles directory and summarizes its
+// top entries. seconds applies to cpu profiles (0: 10), top bounds the
+// summary (0: 20).
+func (p *Profiler) Capture(target, kind string, seconds, top int) (*ProfileCapture, error) {
+	if !profileKindValid(kind) {
+		return nil, fmt.Errorf("unknown profile %q, use one of %s", kind, strings.Join(ProfileKinds, ", "))
+	}
+	if seconds <= 0 {
+		seconds = defaultProfileSeconds
+	}
+	if top <= 0 {
+		top = defaultProfileTop
+	}
+	c := &ProfileCapture{Target: target, Kind: kind, Time: time.Now()}
+	if kind == "cpu" {
+		c.Seconds = seconds
+	}
+	var data []byte
+	var err error
+	switch target {
+	case ProfileTargetServer, "":
+		c.Target = ProfileTargetServer
+		data, c.Source, err = p.fetchServer(kind, seconds)
+	case ProfileTargetSelf:
+		data, err = profileSelf(kind, seconds)
+		c.Source = "in-process"
+	default:
+		return nil, fmt.Errorf("unknown target %q, use %s or %s", target, ProfileTargetServer, ProfileTargetSelf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(p.dir, c.Target+"-"+kind+"-"+c.Time.Format("20060102-150405")+".pb.gz")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, err
+	}
+	c.File = path
+	if rel, err := filepath.Rel(p.rootDir, path); err == nil {
+		c.File = filepath.ToSlash(rel)
+	}
+	c.Top = pprofTop(path, top)
+	return c, nil
+}
+
+func profileKindValid(kind string) bool {
+	for _, k := range ProfileKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchServer asks the server's own /debug/pprof first, then the injected
+// endpoints. Anything that is not a gzipped profile, such as an SPA fallback
+// page, counts as not exposed.
+func (p *Profiler) fetchServer(kind string, seconds int) ([]byte, string, error) {
+	endpoint := "/debug/pprof/" + kind
+	if kind == "cpu" {
+		endpoint = "/debug/pprof/profile?seconds=" + strconv.Itoa(seconds)
+	}
+	urls := []string{}
+	if p.serverPort != nil {
+		urls = append(urls, "http://127.0.0.1:"+p.serverPort()+endpoint)
+	}
+	if p.Inject() {
+		urls = append(urls, "http://"+p.injectedAddr()+endpoint)
+	}
+	client := &http.Client{Timeout: time.Duration(seconds)*time.Second + profileRequestOverhead}
+	var errs []error
+	for _, url := range urls {
+		data, err := fetchProfile(client, url)
+		if err == nil {
+			return data, url, nil
+		}
+		errs = append(errs, err)
+	}
+	if !p.Inject() {
+		errs = append(errs, errors.New(`the server does not expose /debug/pprof: turn on "Server pprof" in the BUILD tab (or app_profile inject) to compile dev-only endpoints in`))
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+func fetchProfile(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s %s", url, resp.Status, bytes.TrimSpace(data))
+	}
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return nil, fmt.Errorf("%s: not a pprof profile", url)
+	}
+	return data, nil
+}
+
+// profileSelf profiles this process.
+func profileSelf(kind string, seconds int) ([]byte, error) {
+	var buf bytes.Buffer
+	if kind == "cpu" {
+		if err := pprof.StartCPUProfile(&buf); err != nil {
+			return nil, err
+		}
+		time.Sleep(time.Duration(seconds) * time.Second)
+		pprof.StopCPUProfile()
+		return buf.Bytes(), nil
+	}
+	prof := pprof.Lookup(kind)
+	if prof == nil {
+		return nil, fmt.Errorf("no %s profile", kind)
+	}
+	if err := prof.WriteTo(&buf, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pprofTop is the "go tool pprof -top" table of a profile, or why it could
+// not be produced.
+func pprofTop(path string, top int) string {
+	out, err := exec.Command("go", "tool", "pprof", "-top", "-nodecount="+strconv.Itoa(top), path).CombinedOutput()
+	if err != nil {
+		return fmt.Sprintf("go tool pprof: %v\n%s", err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func (p *Profiler) logf(message ...any) {
+	p.mu.Lock()
+	log := p.log
+	p.mu.Unlock()
+	if log != nil {
+		log(message...)
+	}
+}
+
+// profilerInject is the BUILD tab toggle of the injected pprof endpoints.
+type profilerInject struct{ p *Profiler }
+
+func (t profilerInject) Name() string  { return "ServerPprof" }
+func (t profilerInject) Label() string { return "Server pprof" }
+
+// Value implements HandlerEdit.Value, e.g. "Pprof:T".
+func (t profilerInject) Value() string {
+	if t.p.Inject() {
+		return "Pprof:T"
+	}
+	return "Pprof:F"
+}
+
+// Change implements HandlerEdit.Change, accepting "Pprof:T" or "Pprof:F".
+func (t profilerInject) Change(newValue string) {
+	key, val, ok := strings.Cut(newValue, ":")
+	if !ok || strings.TrimSpace(key) != "Pprof" {
+		return
+	}
+	val = strings.ToLower(strings.TrimSpace(val))
+	if err := t.p.SetInject(val == "t" || val == "true"); err != nil {
+		t.p.logf("Server pprof:", err)
+	}
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tinywasm/devwatch"
+)
+
+// handlers is the registry of live Handler instances keyed by their ID.
+// Start registers each instance so tests and embedders can reach a specific
+// project when several run in the same process.
+var (
+	handlers   = map[string]*Handler{}
+	handlersMu sync.RWMutex
+)
+
+// RegisterHandler makes h reachable through GetHandler under id.
+// A later registration with the same id replaces the previous instance.
+func RegisterHandler(id string, h *Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[id] = h
+}
+
+// UnregisterHandler removes id from the registry, but only while it still
+// points to h so a restarted instance is never dropped by its predecessor.
+func UnregisterHandler(id string, h *Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	if handlers[id] == h {
+		delete(handlers, id)
+	}
+}
+
+// GetHandler returns the Handler registered under id, or nil.
+func GetHandler(id string) *Handler {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	return handlers[id]
+}
+
+// WaitForHandler waits until a Handler is registered under id or timeout
+func WaitForHandler(id string, timeout time.Duration) *Handler {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if h := GetHandler(id); h != nil {
+			return h
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// WaitWatcherReady waits until the Watcher of the Handler registered under id
+// is initialized or timeout
+func WaitWatcherReady(id string, timeout time.Duration) *devwatch.DevWatch {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if h := GetHandler(id); h != nil && h.Watcher != nil {
+			return h.Watcher
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
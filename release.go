@@ -0,0 +1,360 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoreKeyRelease persists the BUILD tab release toggle ("true"/"false").
+const StoreKeyRelease = "TINYWASM_RELEASE"
+
+// ReleaseManifestFile is written next to the release assets.
+const ReleaseManifestFile = "asset-manifest.json"
+
+// releaseRefPattern matches local asset references in html, js, css and
+// svg: "/script.js", '/client.wasm', url(/img/logo.webp), and the relative
+// src="script.js" or url(../img/logo.webp).
+var releaseRefPattern = regexp.MustCompile(`(["'(])((?:\.{0,2}/)?[\w\-][\w\-./]*\.(?:wasm|js|css|svg|png|jpe?g|webp|gif|ico|json|woff2?|ttf))([?#"')])`)
+
+// releaseRelativeExts resolve relative references against their own path.
+// A relative string in JavaScript may be relative to the page or to the
+// module, so only absolute ones are rewritten there.
+var releaseRelativeExts = map[string]bool{".html": true, ".css": true, ".svg": true}
+
+// releaseTextExts are rewritten before hashing since they may reference other assets.
+var releaseTextExts = map[string]bool{".html": true, ".js": true, ".css": true, ".svg": true}
+
+// AssetManifest maps each asset path to its content-hashed name.
+// It is written as asset-manifest.json and returned by app_build_release.
+type AssetManifest struct {
+	Mode  string            `json:"mode,omitempty"` // WasmClient size mode of the build
+	Time  string            `json:"time"`
+	Dir   string            `json:"dir"`
+	Files map[string]string `json:"files"` // "/script.js" -> "/script.1a2b3c4d.js"
+}
+
+// ReleaseBuilder turns the dev build into a deployable directory with
+// content-hashed filenames and, when enabled from the BUILD tab, serves it in
+// place of the dev routes so the browser loads exactly what gets deployed.
+type ReleaseBuilder struct {
+	mu        sync.Mutex
+	build     sync.Mutex // one release build at a time
+	db        DB
+	enabled   bool
+	routes    []func(*http.ServeMux) // dev routes the release is crawled from
+	outDir    string
+	publicDir string // fallback for files the routes don't serve (images)
+	mode      func() string
+	after     func(dir string) // e.g. write precompressed variants
+	last      *AssetManifest
+	log       func(message ...any)
+}
+
+// NewReleaseBuilder creates a builder that crawls routes, starting at "/",
+// into outDir. The toggle is restored from db.
+func NewReleaseBuilder(db DB, outDir, publicDir string, routes ...func(*http.ServeMux)) *ReleaseBuilder {
+	r := &ReleaseBuilder{db: db, routes: routes, outDir: outDir, publicDir: publicDir}
+	if db != nil {
+		if v, err := db.Get(StoreKeyRelease); err == nil && v == "true" {
+			r.enabled = true
+		}
+	}
+	return r
+}
+
+// SetMode sets the function reporting the wasm size mode recorded in the manifest.
+func (r *ReleaseBuilder) SetMode(f func() string) { r.mode = f }
+
+// SetAfterBuild sets a hook run on the output directory after each build.
+func (r *ReleaseBuilder) SetAfterBuild(f func(dir string)) { r.after = f }
+
+func (r *ReleaseBuilder) Name() string  { return "Release" }
+func (r *ReleaseBuilder) Label() string { return "Release Build" }
+
+// Value implements HandlerEdit.Value, e.g. "Release:F".
+func (r *ReleaseBuilder) Value() string {
+	if r.Enabled() {
+		return "Release:T"
+	}
+	return "Release:F"
+}
+
+// Change implements HandlerEdit.Change, accepting "Release:T" or "Release:F".
+func (r *ReleaseBuilder) Change(newValue string) {
+	key, val, ok := strings.Cut(newValue, ":")
+	if !ok || strings.TrimSpace(key) != "Release" {
+		return
+	}
+	val = strings.ToLower(strings.TrimSpace(val))
+	r.SetEnabled(val == "t" || val == "true")
+}
+
+func (r *ReleaseBuilder) SetLog(f func(message ...any)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log = f
+}
+
+// Enabled reports whether the release output is served instead of the dev routes.
+func (r *ReleaseBuilder) Enabled() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enabled
+}
+
+// SetEnabled switches release mode, persists it and builds the release when enabled.
+func (r *ReleaseBuilder) SetEnabled(on bool) {
+	r.mu.Lock()
+	r.enabled = on
+	db := r.db
+	r.mu.Unlock()
+	if db != nil {
+		db.Set(StoreKeyRelease, strconv.FormatBool(on))
+	}
+	if !on {
+		r.logf("Release mode off: serving the dev build")
+		return
+	}
+	if _, err := r.Build(); err != nil {
+		r.logf("Release build failed:", err)
+	}
+}
+
+// Manifest returns the manifest of the last build, or nil.
+func (r *ReleaseBuilder) Manifest() *AssetManifest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+// Rebuild refreshes the release after a dev build when release mode is on.
+func (r *ReleaseBuilder) Rebuild() {
+	if !r.Enabled() {
+		return
+	}
+	if _, err := r.Build(); err != nil {
+		r.logf("Release build failed:", err)
+	}
+}
+
+// Build crawls the dev routes from index.html, writes every referenced asset
+// under a content-hashed name with references rewritten, then index.html and
+// asset-manifest.json. The output directory is replaced on each build.
+// Build works whether or not release mode is on.
+func (r *ReleaseBuilder) Build() (*AssetManifest, error) {
+	r.build.Lock()
+	defer r.build.Unlock()
+
+	dev := http.NewServeMux()
+	for _, fn := range r.routes {
+		fn(dev)
+	}
+	c := &releaseCrawl{dev: dev, publicDir: r.publicDir, files: map[string][]byte{}, hashed: map[string]string{}}
+	index, err := c.fetch("/index.html", "/")
+	if err != nil {
+		return nil, err
+	}
+	index, err = c.rewrite("/index.html", index, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &AssetManifest{Time: time.Now().Format(time.RFC3339), Dir: r.outDir, Files: c.hashed}
+	if r.mode != nil {
+		m.Mode = r.mode()
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	c.files["/index.html"] = index
+	c.files["/"+ReleaseManifestFile] = manifest
+
+	// Write aside and swap so the release being served is never half written.
+	tmp := r.outDir + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+	for name, data := range c.files {
+		dst := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(dst, data, 0644); err != nil {
+			return nil, err
+		}
+	}
+	// The previous release moves aside first, so it is only removed once
+	// the new one is in place
+	old := r.outDir + ".old"
+	if err := os.RemoveAll(old); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(r.outDir, old); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := os.Rename(tmp, r.outDir); err != nil {
+		os.Rename(old, r.outDir)
+		return nil, err
+	}
+	if err := os.RemoveAll(old); err != nil {
+		r.logf("Removing the previous release:", err)
+	}
+	if r.after != nil {
+		r.after(r.outDir)
+	}
+
+	r.mu.Lock()
+	r.last = m
+	r.mu.Unlock()
+	r.logf("Release built:", len(m.Files), "assets in", r.outDir)
+	return m, nil
+}
+
+// Routes mounts the dev routes behind a switch that serves the release
+// output while release mode is on.
+func (r *ReleaseBuilder) Routes() func(*http.ServeMux) {
+	return func(mux *http.ServeMux) {
+		dev := http.NewServeMux()
+		for _, fn := range r.routes {
+			fn(dev)
+		}
+		release := r.serveRelease()
+		mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if r.Enabled() && r.Manifest() != nil {
+				release.ServeHTTP(w, req)
+				return
+			}
+			dev.ServeHTTP(w, req)
+		}))
+	}
+}
+
+// serveRelease serves the output directory: hashed assets are immutable,
+// index.html and the manifest must always be revalidated.
+func (r *ReleaseBuilder) serveRelease() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := path.Clean("/" + req.URL.Path)
+		if name == "/" || path.Ext(name) == "" { // client-side routes get the app shell
+			if catchAllsDeferred(req) {
+				http.NotFound(w, req) // unless a server backend answers them
+				return
+			}
+			name = "/index.html"
+		}
+		file := filepath.Join(r.outDir, filepath.FromSlash(name))
+		if _, err := os.Stat(file); err != nil {
+			http.NotFound(w, req)
+			return
+		}
+		if name == "/index.html" || name == "/"+ReleaseManifestFile {
+			w.Header().Set("Cache-Control", "no-cache")
+		} else {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+		http.ServeFile(w, req, file)
+	})
+}
+
+func (r *ReleaseBuilder) logf(message ...any) {
+	r.mu.Lock()
+	log := r.log
+	r.mu.Unlock()
+	if log != nil {
+		log(message...)
+	}
+}
+
+// releaseCrawl collects the assets of one release build.
+type releaseCrawl struct {
+	dev       http.Handler
+	publicDir string
+	files     map[string][]byte // output path -> content
+	hashed    map[string]string // asset path -> hashed path
+}
+
+// fetch gets an asset from the dev routes, falling back to publicDir for files
+// they don't serve. assetmin answers unknown paths with index.html, so an HTML
+// body for a non-HTML path counts as missing.
+func (c *releaseCrawl) fetch(name, url string) ([]byte, error) {
+	rec := &bufferedResponse{header: http.Header{}}
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	c.dev.ServeHTTP(rec, req)
+	isHTML := strings.HasPrefix(rec.header.Get("Content-Type"), "text/html")
+	if (rec.status == http.StatusOK || rec.status == 0) && isHTML == (path.Ext(name) == ".html") {
+		return rec.body.Bytes(), nil
+	}
+	if c.publicDir != "" {
+		if data, err := os.ReadFile(filepath.Join(c.publicDir, filepath.FromSlash(name))); err == nil {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("release: %s not found (status %d)", name, rec.status)
+}
+
+// asset returns the hashed path of name, building it and its references first.
+func (c *releaseCrawl) asset(name string, visiting map[string]bool) (string, error) {
+	if h, ok := c.hashed[name]; ok {
+		return h, nil
+	}
+	if visiting[name] {
+		return "", fmt.Errorf("release: reference cycle through %s", name)
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	data, err := c.fetch(name, name)
+	if err != nil {
+		return "", err
+	}
+	if releaseTextExts[path.Ext(name)] {
+		if data, err = c.rewrite(name, data, visiting); err != nil {
+			return "", err
+		}
+	}
+	sum := sha256.Sum256(data)
+	ext := path.Ext(name)
+	hashed := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:4]) + ext
+	c.hashed[name] = hashed
+	c.files[hashed] = data
+	return hashed, nil
+}
+
+// rewrite replaces every local asset reference in data, the content of
+// name, with its absolute hashed path.
+func (c *releaseCrawl) rewrite(name string, data []byte, visiting map[string]bool) ([]byte, error) {
+	if visiting == nil {
+		visiting = map[string]bool{}
+	}
+	var errs []error
+	out := releaseRefPattern.ReplaceAllFunc(data, func(m []byte) []byte {
+		sub := releaseRefPattern.FindSubmatch(m)
+		ref := string(sub[2])
+		if !strings.HasPrefix(ref, "/") {
+			if !releaseRelativeExts[path.Ext(name)] {
+				return m
+			}
+			ref = path.Join(path.Dir(name), ref)
+		}
+		hashed, err := c.asset(ref, visiting)
+		if err != nil {
+			errs = append(errs, err)
+			return m
+		}
+		return bytes.Join([][]byte{sub[1], []byte(hashed), sub[3]}, nil)
+	})
+	return out, errors.Join(errs...)
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"net/http"
+	"sync"
+)
+
+// restoredWasm is a build restored from the build cache while the client
+// keeps its output in memory. The wasm route answers with it until the
+// client compiles again, so the client's own storage is never written.
+type restoredWasm struct {
+	mu   sync.RWMutex
+	data []byte
+	set  bool
+}
+
+// put serves data instead of the client's build; nil serves no build.
+func (s *restoredWasm) put(data []byte) {
+	s.mu.Lock()
+	s.data, s.set = data, true
+	s.mu.Unlock()
+}
+
+// clear serves the client's build again.
+func (s *restoredWasm) clear() {
+	s.mu.Lock()
+	s.data, s.set = nil, false
+	s.mu.Unlock()
+}
+
+func (s *restoredWasm) get() ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data, s.set
+}
+
+// Routes mounts register, the client's routes, on a private mux reached
+// through wasmPath, which serves the restored build while there is one.
+// The client only registers its wasm route.
+func (s *restoredWasm) Routes(wasmPath func() string, register func(*http.ServeMux)) func(*http.ServeMux) {
+	return func(mux *http.ServeMux) {
+		inner := http.NewServeMux()
+		register(inner)
+		mux.HandleFunc(wasmPath(), func(w http.ResponseWriter, r *http.Request) {
+			data, ok := s.get()
+			if !ok {
+				inner.ServeHTTP(w, r)
+				return
+			}
+			if len(data) == 0 {
+				http.Error(w, "WASM compiling...", http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "application/wasm")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write(data)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tinywasm/client"
+)
+
+func TestInstallWasm_ServesRestoredBuildWithoutTouchingClientStorage(t *testing.T) {
+	wasm := client.New(&client.Config{
+		SourceDir: func() string { return "web" },
+		OutputDir: func() string { return "public" },
+	})
+	wasm.SetAppRootDir(t.TempDir())
+	h := &Handler{WasmClient: wasm}
+	h.wasmMemory, _ = wasm.Storage.(*client.MemoryStorage)
+
+	route := func() string { return "/client.wasm" }
+	mux := http.NewServeMux()
+	h.wasmRestored.Routes(route, wasm.RegisterRoutes)(mux)
+	get := func() (int, string) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/client.wasm", nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	if err := h.installWasm([]byte("cached")); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := get(); code != 200 || body != "cached" {
+		t.Errorf("restored build: %d %q", code, body)
+	}
+	if data, _, err := h.wasmOutput(); err != nil || string(data) != "cached" {
+		t.Errorf("wasmOutput() = %q, %v", data, err)
+	}
+	if len(h.wasmMemory.WasmContent) != 0 {
+		t.Error("the client's storage was written")
+	}
+
+	// A compile of the client replaces it: its own (empty) storage answers
+	h.wasmRestored.clear()
+	if code, _ := get(); code != http.StatusServiceUnavailable {
+		t.Errorf("after clear: %d", code)
+	}
+}
@@ -3,16 +3,17 @@ package app
 import (
 	"fmt"
 	"path/filepath"
+	"reflect"
 	"time"
 
-	"github.com/tinywasm/devflow"
 	"github.com/tinywasm/assetmin"
-	"github.com/tinywasm/image/min"
-	"github.com/tinywasm/ssr"
 	"github.com/tinywasm/client"
+	"github.com/tinywasm/devflow"
 	"github.com/tinywasm/devwatch"
+	"github.com/tinywasm/image/min"
 	"github.com/tinywasm/js"
 	"github.com/tinywasm/server"
+	"github.com/tinywasm/ssr"
 )
 
 // syncJSRuntime synchronizes the global JS runtime state with the WASM client's configuration.
@@ -38,6 +39,24 @@ func (h *Handler) AddSectionBUILD() any {
 	return SectionBuild
 }
 
+// diskPublicDir returns the public dir while the build output is on disk
+// (external server mode), "" while it is served from memory.
+func (h *Handler) diskPublicDir() string {
+	if !h.wasmOnDisk.Load() {
+		return ""
+	}
+	return filepath.Join(h.RootDir, h.Config.WebPublicDir())
+}
+
+// reloadBrowser refreshes the outputs derived from the build (on-disk
+// precompressed variants, the release when release mode is on), which the
+// change may have made stale, before reloading the page.
+func (h *Handler) reloadBrowser() error {
+	h.Precompress.RefreshDisk()
+	h.Release.Rebuild()
+	return h.Browser.Reload()
+}
+
 // InitBuildHandlers initializes all build Handlers AFTER the project root is determined.
 // This is called from OnProjectReady() to ensure paths are correct.
 func (h *Handler) InitBuildHandlers() {
@@ -53,6 +72,32 @@ func (h *Handler) InitBuildHandlers() {
 		Database:  h.DB,
 	})
 
+	// Compiles of an already built source state are restored from the cache
+	// (see compileWasm). The client starts on memory storage; its Storage is
+	// read here, before any goroutine can switch it.
+	h.BuildCache = NewBuildCache(h.DB, "")
+	h.wasmMemory, _ = h.WasmClient.Storage.(*client.MemoryStorage)
+
+	// User-defined commands run by the watcher around each build
+	h.Hooks = NewBuildHooks(h.DB, h.Config.RootDir)
+	h.Hooks.SetReload(h.reloadBrowser)
+
+	// go test for the packages affected by each saved file (TESTS tab); the
+	// runner, vet and the build cache share one package graph
+	h.Packages = NewPackageGraph(h.RootDir)
+	h.BuildCache.SetGraph(h.Packages)
+	h.Tests = NewTestRunner(h.DB, h.RootDir, h.ExitChan)
+	h.Tests.SetGraph(h.Packages)
+	h.Tests.SetCoverage(NewCoverage(h.DB, filepath.Join(h.RootDir, h.Config.DeployCoverageFile())))
+
+	// go vet of saved packages, in the wasm and server build contexts
+	h.Vet = NewVet(h.DB, h.RootDir, h.Config.CmdWebClientDir(), h.Config.CmdAppServerDir(), h.ExitChan)
+	h.Vet.SetGraph(h.Packages)
+
+	h.WasmSize = NewWasmSizeHandler(h.wasmOutput)
+	h.WasmSize.SetStore(h.DB, h.headless)
+	h.Imports = NewImportAudit(h.DB, h.RootDir, h.Config.CmdWebClientDir())
+
 	// Configurar AssetMin
 	publicDir := filepath.Join(h.RootDir, h.Config.WebPublicDir())
 	h.AssetsHandler = assetmin.NewAssetMin(&assetmin.Config{
@@ -70,11 +115,37 @@ func (h *Handler) InitBuildHandlers() {
 	h.AssetsHandler.UpdateSSRModule("bootstrap", "", []*js.Script{js.PageBootstrap()}, "", nil)
 
 	// 3. SERVER
-	h.Server = h.serverFactory(h.ExitChan, h.Tui, h.Browser)
+	h.Server = h.newServer()
 
-	// Register routes directly
-	h.Server.RegisterRoutes(h.AssetsHandler.RegisterRoutes)
-	h.Server.RegisterRoutes(h.WasmClient.RegisterRoutes)
+	// Kept builds; a pinned one replaces the latest wasm in the dev and release routes.
+	// Resolved from the project root so an unset Handler.RootDir never writes into the cwd.
+	projectRoot, err := filepath.Abs(h.Config.RootDir)
+	if err != nil {
+		projectRoot = h.Config.RootDir
+	}
+	h.Artifacts = NewArtifactStore(h.DB, filepath.Join(projectRoot, h.Config.DeployArtifactsDir()), projectRoot)
+	h.Artifacts.SetMode(func() string { return h.WasmClient.CurrentSizeMode })
+	h.Artifacts.SetServedFromDisk(func() bool { return h.diskPublicDir() != "" })
+	h.Artifacts.SetOnPin(func() {
+		if err := h.reloadBrowser(); err != nil {
+			h.Artifacts.logf("Error reloading Browser:", err)
+		}
+	})
+	wasmRoute := func() string { return "/" + filepath.Base(h.WasmClient.MainOutputFileAbsolutePath()) }
+
+	// Register routes behind the release switch and the Precompressor (gzip/brotli negotiation)
+	h.Precompress = NewPrecompressor(h.DB, h.diskPublicDir)
+	h.Release = NewReleaseBuilder(h.DB, filepath.Join(h.RootDir, h.Config.DeployReleaseDir()), publicDir,
+		h.Artifacts.Routes(wasmRoute, DeferCatchAll(h.AssetsHandler.RegisterRoutes), h.wasmRestored.Routes(wasmRoute, h.WasmClient.RegisterRoutes)))
+	h.Release.SetMode(func() string { return h.WasmClient.CurrentSizeMode })
+	h.Release.SetAfterBuild(func(dir string) {
+		if err := h.Precompress.WriteDir(dir); err != nil {
+			h.Release.logf("Precompress:", err)
+		}
+	})
+	// API paths matching a proxy rule bypass both and go to their local upstream
+	h.Proxy = NewDevProxy(h.DB)
+	h.Server.RegisterRoutes(h.Proxy.Routes(h.Precompress.Routes(h.Release.Routes())))
 
 	// Wire server-specific callbacks via type assertion
 	type externalModeSupport interface {
@@ -86,19 +157,93 @@ func (h *Handler) InitBuildHandlers() {
 			//    Must happen BEFORE assetmin flushes because assetmin embeds the
 			//    wasm filename (which depends on client mode) into main.js /
 			//    index.html. Dependency is on client *state*, not disk I/O.
-			h.WasmClient.UseDiskStorage()
-			if err := h.WasmClient.Compile(); err != nil {
+			h.useWasmDisk()
+			if err := h.compileWasm(); err != nil {
 				return fmt.Errorf("wasm compile failed: %w", err)
 			}
+			h.recordWasmArtifact()
+			h.analyzeWasmSize()
 
 			// 2. AssetMin: flush ALL in-memory assets to web/public/ (overwrite).
 			if err := h.AssetsHandler.FlushToDisk(); err != nil {
 				return fmt.Errorf("assetmin flush failed: %w", err)
 			}
-			return nil
+
+			// 3. Precompressed .gz/.br variants next to the flushed files.
+			h.Precompress.RefreshDisk()
+
+			// 4. after-assets hooks see the flushed files; a failure blocks the start.
+			return h.Hooks.Run(PhaseAfterAssets, "")
 		})
 	}
 
+	// Build profile of the external server (normal, race, debug, cover)
+	h.ServerProfile = NewServerProfile(h.DB, h.RootDir, filepath.Join(h.RootDir, h.Config.DeployServerCoverDir()))
+	h.ServerProfile.SetOnChange(func() {
+		if err := h.Server.RestartServer(); err != nil {
+			h.ServerProfile.logf("Error restarting Server:", err)
+		}
+	})
+
+	// Build vars and feature flags reach both builds: recompiling the client
+	// runs OnWasmExecChange, which restarts (and rebuilds) the server
+	rebuildAll := func() {
+		if err := h.compileWasm(); err != nil {
+			h.WasmClient.Logger("Recompile failed:", err)
+			return
+		}
+		h.wasmBuilt()
+	}
+
+	// Environment profiles: variables of the server process and extra run args
+	h.EnvProfiles = NewEnvProfiles(h.DB)
+	builtProfile := h.EnvProfiles.Profile()
+	h.EnvProfiles.SetOnChange(func() {
+		if p := h.EnvProfiles.Profile(); p != builtProfile {
+			builtProfile = p // profile build vars differ: rebuild the client too
+			rebuildAll()
+			return
+		}
+		if err := h.Server.RestartServer(); err != nil {
+			h.EnvProfiles.logf("Error restarting Server:", err)
+		}
+	})
+
+	h.BuildVars = NewBuildVars(h.DB, h.RootDir, h.EnvProfiles.Profile)
+	h.BuildVars.SetOnChange(rebuildAll)
+	h.WasmClient.CompilingArguments = func() []string {
+		mode := h.WasmClient.CurrentSizeMode
+		args := h.BuildVars.Args(BuildTargetWasm, mode)
+		if !h.WasmClient.RequiresTinyGo(mode) {
+			args = append([]string{"-tags=dev"}, args...) // replaces the client's own -tags dev
+		}
+		return mergeBuildTags(args)
+	}
+
+	// pprof captures of the server (own or injected endpoints) and of tinywasm
+	h.Profiler = NewProfiler(h.DB, h.RootDir, h.Config.CmdAppServerDir(), h.Config.ServerFileName(), filepath.Join(h.RootDir, h.Config.DeployProfilesDir()), h.Config.ServerPort)
+	if h.GitHandler != nil {
+		h.Profiler.SetGitIgnoreAdd(h.GitHandler.GitIgnoreAdd)
+	}
+	h.Profiler.SetOnChange(func() {
+		if err := h.Server.RestartServer(); err != nil {
+			h.Profiler.logf("Error restarting Server:", err)
+		}
+	})
+
+	// Delve runs the external server; debugging wants the debug profile,
+	// whose switch restarts the server, any other toggle restarts it here
+	h.Debugger = NewDebugger(h.DB, h.RootDir)
+	h.Debugger.SetOnChange(func() {
+		if h.Debugger.Enabled() && h.ServerProfile.Profile() != ServerProfileDebug {
+			h.ServerProfile.SetProfile(ServerProfileDebug)
+			return
+		}
+		if err := h.Server.RestartServer(); err != nil {
+			h.Debugger.logf("Error restarting Server:", err)
+		}
+	})
+
 	// Configure server specific arguments
 	type serverConfigurator interface {
 		SetRunArgs(func() []string)
@@ -117,15 +262,52 @@ func (h *Handler) InitBuildHandlers() {
 		srv.SetOutputDir(h.Config.DeployAppServerDir())
 		srv.SetMainInputFile(h.Config.ServerFileName())
 		srv.SetPort(h.Config.ServerPort())
-		srv.SetDisableGlobalCleanup(TestMode)
-		srv.SetCompileArgs(func() []string { return []string{"-p", "1"} })
+		srv.SetDisableGlobalCleanup(h.Options.DisableGlobalCleanup)
+		srv.SetCompileArgs(func() []string {
+			args := append(h.ServerProfile.CompileArgs(), h.Profiler.CompileArgs()...)
+			return mergeBuildTags(append(args, h.BuildVars.Args(BuildTargetServer, h.ServerProfile.Profile())...))
+		})
 		srv.SetRunArgs(func() []string {
-			return []string{
+			return append([]string{
 				"-server_port=" + h.Config.ServerPort(),
 				"-server_public_dir=" + filepath.Join(h.RootDir, h.Config.WebPublicDir()),
+			}, h.EnvProfiles.RunArgs()...)
+		})
+	}
+
+	// The variables of the env and build profiles reach the server process
+	// (or wasi module) alone; the tinywasm environment stays untouched.
+	// tinywasm/server takes them, and the Delve run hook, once its external
+	// process runner supports SetEnv and SetRunHook
+	if srv, ok := h.Server.(interface {
+		SetEnv(func() map[string]string)
+	}); ok {
+		srv.SetEnv(func() map[string]string {
+			env := h.EnvProfiles.Env()
+			for name, value := range h.ServerProfile.Env() {
+				env[name] = value
 			}
+			return env
 		})
 	}
+	if srv, ok := h.Server.(interface {
+		SetRunHook(func(bin string, args []string) (string, []string))
+	}); ok {
+		srv.SetRunHook(h.Debugger.RunHook)
+	}
+
+	// Steps around the client and server builds a saved file triggers, one
+	// per feature
+	h.wasmPhases, h.serverPhases = &buildPhases{}, &buildPhases{}
+	h.wasmPhases.OnEdit(h.WasmSize.NoteEdit)
+	h.wasmPhases.OnEdit(func(file string) { h.Artifacts.NoteEdit(ArtifactWasm, file) })
+	h.serverPhases.OnEdit(func(file string) { h.Artifacts.NoteEdit(ArtifactServer, file) })
+	h.wasmPhases.Before(h.Hooks.Generate)
+	h.serverPhases.Before(h.Hooks.Generate)
+	h.serverPhases.After(func(string) error { h.ServerProfile.Rebuilt(); return nil }) // races of the previous binary no longer apply
+	h.serverPhases.After(h.recordServerArtifact)
+	h.Hooks.Phases(h.wasmPhases, PhaseBeforeWasm, PhaseAfterWasm)
+	h.Hooks.Phases(h.serverPhases, PhaseBeforeServer, PhaseAfterServer)
 
 	// 4. BROWSER
 	// Browser is already injected in Start()
@@ -135,12 +317,16 @@ func (h *Handler) InitBuildHandlers() {
 		//AppRootDir: h.Config.RootDir, (Removed in favor of AddDirectoriesToWatch)
 		FilesEventHandlers: []devwatch.FilesEventHandlers{
 			h.GoModHandler,
-			h.WasmClient,
-			h.Server,
-			h.AssetsHandler,
+			h.Packages.Watcher(),
+			h.Hooks.Watcher(),
+			phasedBuild{h.WasmClient, h.wasmPhases, h.compileWasmFile, []string{"create", "write"}, h.Config.RootDir},
+			phasedBuild{h.Server, h.serverPhases, h.Server.NewFileEvent, nil, h.Config.RootDir},
+			assetHooks{h.AssetsHandler, h.Hooks},
+			h.Tests.Watcher(),
+			h.Vet.Watcher(),
 		},
 		FolderEvents:  nil,
-		BrowserReload: func() error { return h.Browser.Reload() },
+		BrowserReload: h.reloadBrowser,
 		ExitChan:      h.ExitChan,
 		UnobservedFiles: func() []string {
 			uf := []string{
@@ -154,10 +340,15 @@ func (h *Handler) InitBuildHandlers() {
 			uf = append(uf, h.AssetsHandler.UnobservedFiles()...)
 			uf = append(uf, h.WasmClient.UnobservedFiles()...)
 			uf = append(uf, h.Server.UnobservedFiles()...)
+			uf = append(uf, h.Profiler.UnobservedFiles()...)
 			return uf
 		},
 	})
 
+	h.Hooks.SetCovered(h.WasmClient.SupportedExtensions()...)
+	h.Hooks.SetCovered(h.Server.SupportedExtensions()...)
+	h.Hooks.SetCovered(h.AssetsHandler.SupportedExtensions()...)
+
 	// 6. GO.MOD HANDLER
 	// Use injected handler
 	h.GoModHandler.SetLog(h.Watcher.Logger)
@@ -178,14 +369,35 @@ func (h *Handler) InitBuildHandlers() {
 	h.AssetsHandler.SetImageProcessor(h.ImageHandler)
 
 	// 6. Register Handlers with TUI for logging
-	h.Tui.AddHandler(h.WasmClient, colorPurpleMedium, h.SectionBuild)
+	h.Tui.AddHandler(wasmModeSwitch{h.WasmClient, h}, colorPurpleMedium, h.SectionBuild)
 	h.Tui.AddHandler(h.WasmClient.WebClientGenerator(), colorPurpleMedium, h.SectionBuild)
-	h.Tui.AddHandler(h.Server, colorBlueMedium, h.SectionBuild)
+	h.Tui.AddHandler(h.WasmSize, colorPurpleLight, h.SectionBuild)
+	h.Tui.AddHandler(h.Imports, colorPurpleLight, h.SectionBuild)
+	h.Tui.AddHandler(h.Precompress, colorPurpleLight, h.SectionBuild)
+	h.Tui.AddHandler(h.Release, colorPurpleLight, h.SectionBuild)
+	h.Tui.AddHandler(h.Artifacts, colorPurpleLight, h.SectionBuild)
+	h.Tui.AddHandler(h.BuildCache, colorPurpleLight, h.SectionBuild)
+	h.Tui.AddHandler(h.Hooks, colorPurpleLight, h.SectionBuild)
+	h.Tui.AddHandler(h.Vet, colorPurpleLight, h.SectionBuild)
+	h.Tui.AddHandler(serverLogTap{h.Server, h.ServerProfile.Scan, h.EnvProfiles.MaskMessage}, colorBlueMedium, h.SectionBuild)
+	h.Tui.AddHandler(h.ServerProfile, colorBlueMedium, h.SectionBuild)
+	h.Tui.AddHandler(h.EnvProfiles, colorBlueMedium, h.SectionBuild)
+	h.Tui.AddHandler(h.Proxy, colorBlueMedium, h.SectionBuild)
+	h.Tui.AddHandler(h.BuildVars, colorPurpleLight, h.SectionBuild)
+	h.Tui.AddHandler(h.Debugger, colorBlueMedium, h.SectionBuild)
+	h.Tui.AddHandler(h.Profiler, colorBlueMedium, h.SectionBuild)
+	h.Tui.AddHandler(h.Profiler.InjectToggle(), colorBlueMedium, h.SectionBuild)
 	h.Tui.AddHandler(h.AssetsHandler, colorGreenMedium, h.SectionBuild)
 	h.Tui.AddHandler(h.ImageHandler, colorTealMedium, h.SectionBuild)
 	h.Tui.AddHandler(h.Watcher, colorYellowMedium, h.SectionBuild)
 	h.Tui.AddHandler(h.Config, colorTealMedium, h.SectionBuild)
 	h.Tui.AddHandler(h.Browser, colorPinkMedium, h.SectionBuild)
+	h.Tui.AddHandler(h.Tests, colorGreenLight, h.SectionTests)
+	h.Tui.AddHandler(h.Tests.RunAll(), colorGreenLight, h.SectionTests)
+	h.Tui.AddHandler(h.Tests.Coverage(), colorGreenMedium, h.SectionTests)
+
+	// Debugging left on in a previous session attaches once the server runs
+	h.Debugger.Start()
 
 	// SSR extractor — construir e inyectar ANTES de ReloadSSRModule/LoadSSRModules
 	ssrExtractor := ssr.New(h.RootDir)
@@ -205,9 +417,7 @@ func (h *Handler) InitBuildHandlers() {
 	}
 
 	// SSRFileWatcher — assetmin enruta .go internamente (css/svg/html/image)
-	ssrWatcher := h.AssetsHandler.NewSSRFileWatcher(func() error {
-		return h.Browser.Reload()
-	})
+	ssrWatcher := h.AssetsHandler.NewSSRFileWatcher(h.reloadBrowser)
 	h.Watcher.AddFilesEventHandlers(ssrWatcher)
 
 	// Add main project root to watcher
@@ -244,21 +454,68 @@ func (h *Handler) InitBuildHandlers() {
 	// to ensure it uses the TUI logger instead of file logger
 
 	// 7. Wire up TinyWasm to AssetMin
+	// The client calls this after its own successful compiles (a size mode
+	// change), which replace a build restored from the cache
 	h.WasmClient.OnWasmExecChange = func() {
-		syncJSRuntime(h.WasmClient)
-		h.AssetsHandler.UpdateSSRModule("bootstrap", "", []*js.Script{js.PageBootstrap()}, "", nil)
-		h.AssetsHandler.RefreshJSAssets()
-
-		// Restart server to pick up new mode arguments
-		if err := h.Server.RestartServer(); err != nil {
-			h.WasmClient.Logger("Error restarting Server:", err)
-		}
-
-		if err := h.Browser.Reload(); err != nil {
-			h.WasmClient.Logger("Error reloading Browser:", err)
+		h.wasmRestored.clear()
+		h.wasmCompiles.Add(1)
+		if !h.wasmHold.Load() {
+			h.wasmBuilt()
 		}
 	}
 
 	// 8. Initialize deploy Handlers (depends on Watcher)
 	h.InitDeployHandlers()
 }
+
+// wasmBuilt runs after every successful build of the client, compiled or
+// restored from the cache: it refreshes the outputs derived from it,
+// restarts the server and reloads the browser.
+func (h *Handler) wasmBuilt() {
+	h.recordWasmArtifact()
+	h.analyzeWasmSize()
+	syncJSRuntime(h.WasmClient)
+	h.AssetsHandler.UpdateSSRModule("bootstrap", "", []*js.Script{js.PageBootstrap()}, "", nil)
+	h.AssetsHandler.RefreshJSAssets()
+
+	// Restart server to pick up new mode arguments
+	if err := h.Server.RestartServer(); err != nil {
+		h.WasmClient.Logger("Error restarting Server:", err)
+	}
+
+	if err := h.reloadBrowser(); err != nil {
+		h.WasmClient.Logger("Error reloading Browser:", err)
+	}
+}
+
+// newServer builds the server with the factory. Without a factory, or when
+// it returns no server (e.g. an unavailable backend), the error is logged and
+// the default tinywasm/server handler takes its place.
+func (h *Handler) newServer() ServerInterface {
+	browser := h.serverBrowser()
+	if h.serverFactory != nil {
+		if srv := h.serverFactory(h.ExitChan, h.Tui, browser); !isNilServer(srv) {
+			return srv
+		}
+	}
+	if h.Logger != nil {
+		h.Logger("Server factory returned no server, falling back to the default server")
+	}
+	srv := server.New().SetExitChan(h.ExitChan).SetUI(h.Tui)
+	if h.DB != nil {
+		srv.SetStore(h.DB)
+	}
+	if browser != nil {
+		srv.SetOpenBrowser(browser.OpenBrowser)
+	}
+	return srv
+}
+
+// isNilServer also catches a typed nil pointer inside the interface.
+func isNilServer(srv ServerInterface) bool {
+	if srv == nil {
+		return true
+	}
+	v := reflect.ValueOf(srv)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
@@ -29,6 +29,16 @@ func (h *Handler) InitDeployHandlers() {
 	h.Tui.AddHandler(d.EdgeWorker(), colorYellowLight, h.SectionDeploy)
 	h.Watcher.AddFilesEventHandlers(d)
 
+	// Local emulation of the edge worker, rebuilt when its sources change
+	h.EdgeEmulator = NewEdgeEmulator(h.DB, h.RootDir, h.Config.CmdEdgeWorkerDir(), filepath.Join(h.RootDir, h.Config.DeployEdgeWorkerDir(), "dev"), h.ExitChan)
+	h.Tui.AddHandler(h.EdgeEmulator, colorYellowLight, h.SectionDeploy)
+	h.Watcher.AddFilesEventHandlers(h.EdgeEmulator)
+	go func() { // the first build can take a while
+		if err := h.EdgeEmulator.Start(); err != nil {
+			h.EdgeEmulator.logf("Edge emulator:", err)
+		}
+	}()
+
 	if d.IsConfigured() {
 		h.Tui.AddHandler(d.Puller(), colorOrangeLight, h.SectionDeploy)
 	} else {
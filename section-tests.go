@@ -0,0 +1,8 @@
+package app
+
+// AddSectionTESTS creates the TESTS tab in the TUI
+func (h *Handler) AddSectionTESTS() any {
+	section := h.Tui.NewTabSection("TESTS", "Running Tests on Save")
+	h.SectionTests = section
+	return section
+}
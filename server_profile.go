@@ -0,0 +1,398 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoreKeyServerProfile holds the build profile of the external server.
+const StoreKeyServerProfile = "TINYWASM_SERVER_PROFILE"
+
+// Server build profiles, selected from the BUILD tab or app_server_profile.
+const (
+	ServerProfileNormal = "normal"
+	ServerProfileRace   = "race"  // -race; data races are reported as diagnostics
+	ServerProfileDebug  = "debug" // optimizations and inlining off for debuggers
+	ServerProfileCover  = "cover" // -cover; counters written to GOCOVERDIR on exit
+)
+
+// ServerProfiles lists the profiles in the order the TUI cycles through them.
+var ServerProfiles = []string{ServerProfileNormal, ServerProfileRace, ServerProfileDebug, ServerProfileCover}
+
+// serverProfileFlags are the go build flags each profile adds to "-p 1".
+var serverProfileFlags = map[string][]string{
+	ServerProfileRace:  {"-race"},
+	ServerProfileDebug: {"-gcflags=all=-N -l"},
+	ServerProfileCover: {"-cover"},
+}
+
+// raceReportsMax bounds the distinct races kept.
+const raceReportsMax = 50
+
+// StackFrame is one call of a race report stack.
+type StackFrame struct {
+	Func string `json:"func"`
+	File string `json:"file"` // relative to the project root when inside it
+	Line int    `json:"line"`
+}
+
+// RaceAccess is one side of a data race, or the creation of a goroutine.
+type RaceAccess struct {
+	Op        string       `json:"op"`        // "Read", "Previous write", "Goroutine 7 (running) created"...
+	Goroutine string       `json:"goroutine"` // "goroutine 7", "main goroutine"
+	Stack     []StackFrame `json:"stack"`
+}
+
+// RaceReport is a "WARNING: DATA RACE" block printed by a -race server.
+type RaceReport struct {
+	Time     string       `json:"time"`
+	Count    int          `json:"count"` // times this race was reported since the last build
+	Accesses []RaceAccess `json:"accesses"`
+	Report   string       `json:"report"` // raw text
+}
+
+// Diagnostic locates r at its first project frame, like a vet finding.
+func (r RaceReport) Diagnostic() Diagnostic {
+	d := Diagnostic{Analyzer: "race", Contexts: []string{VetContextServer}, Detail: r.Report}
+	var parts []string
+	for i, a := range r.Accesses {
+		if len(a.Stack) == 0 || strings.HasSuffix(a.Op, "created") {
+			continue
+		}
+		parts = append(parts, strings.ToLower(a.Op)+" by "+a.Goroutine+" in "+a.Stack[0].Func)
+		if d.File == "" || i == 0 {
+			if f := projectFrame(a.Stack); f.File != "" {
+				d.File, d.Line = f.File, f.Line
+			}
+		}
+	}
+	d.Message = "data race: " + strings.Join(parts, ", ")
+	if r.Count > 1 {
+		d.Message += fmt.Sprintf(" (%d times)", r.Count)
+	}
+	return d
+}
+
+// projectFrame returns the first frame with a relative (project) file, or
+// the first frame.
+func projectFrame(stack []StackFrame) StackFrame {
+	for _, f := range stack {
+		if !filepath.IsAbs(f.File) {
+			return f
+		}
+	}
+	if len(stack) > 0 {
+		return stack[0]
+	}
+	return StackFrame{}
+}
+
+// key identifies a race by the code locations of its accesses.
+func (r RaceReport) key() string {
+	var locs []string
+	for _, a := range r.Accesses {
+		if f := projectFrame(a.Stack); f.File != "" {
+			locs = append(locs, a.Op+"@"+f.File+":"+strconv.Itoa(f.Line))
+		}
+	}
+	return strings.Join(locs, " ")
+}
+
+var (
+	raceAccessLine = regexp.MustCompile(`^(.+?) at 0x[0-9a-f]+ by (.+):$`)
+	raceCreateLine = regexp.MustCompile(`^(Goroutine \d+ \(\w+\) created) at:$`)
+	raceFileLine   = regexp.MustCompile(`^\s+(.+):(\d+)(?: \+0x[0-9a-f]+)?$`)
+)
+
+// ParseRaceReport reads the lines between the "==================" separators
+// of a race detector report. Absolute files under rootDir are made relative.
+func ParseRaceReport(text, rootDir string) RaceReport {
+	r := RaceReport{Time: time.Now().Format(time.RFC3339), Count: 1, Report: strings.TrimSpace(text)}
+	var cur *RaceAccess
+	fn := ""
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || trimmed == "WARNING: DATA RACE" || strings.HasPrefix(trimmed, "====="):
+		case raceAccessLine.MatchString(line):
+			m := raceAccessLine.FindStringSubmatch(line)
+			r.Accesses = append(r.Accesses, RaceAccess{Op: m[1], Goroutine: m[2]})
+			cur = &r.Accesses[len(r.Accesses)-1]
+		case raceCreateLine.MatchString(line):
+			m := raceCreateLine.FindStringSubmatch(line)
+			r.Accesses = append(r.Accesses, RaceAccess{Op: m[1]})
+			cur = &r.Accesses[len(r.Accesses)-1]
+		case cur != nil && raceFileLine.MatchString(line) && fn != "":
+			m := raceFileLine.FindStringSubmatch(line)
+			file := m[1]
+			if rel, err := filepath.Rel(rootDir, file); err == nil && !strings.HasPrefix(rel, "..") {
+				file = filepath.ToSlash(rel)
+			}
+			n, _ := strconv.Atoi(m[2])
+			cur.Stack = append(cur.Stack, StackFrame{Func: fn, File: file, Line: n})
+			fn = ""
+		case cur != nil && strings.HasPrefix(line, "  "):
+			fn = trimmed
+		}
+	}
+	return r
+}
+
+// ServerProfile selects how the external server is compiled: plain, with
+// the race detector, without optimizations for debugging or with coverage
+// counters. It reads the server output to collect race reports, which
+// app_diagnostics returns next to the go vet findings.
+type ServerProfile struct {
+	mu       sync.Mutex
+	db       DB
+	rootDir  string
+	coverDir string // GOCOVERDIR of the cover profile
+	profile  string
+	onChange func()
+	races    []RaceReport
+	pending  strings.Builder // server output not yet split in lines
+	block    []string        // lines of the race report being read
+	inRace   bool
+	log      func(message ...any)
+}
+
+// NewServerProfile reads the profile from db (normal by default). coverDir
+// receives the coverage counters of the cover profile.
+func NewServerProfile(db DB, rootDir, coverDir string) *ServerProfile {
+	p := &ServerProfile{db: db, rootDir: rootDir, coverDir: coverDir, profile: ServerProfileNormal}
+	if db != nil {
+		if val, err := db.Get(StoreKeyServerProfile); err == nil && serverProfileValid(val) {
+			p.profile = val
+		}
+	}
+	return p
+}
+
+func serverProfileValid(name string) bool {
+	for _, p := range ServerProfiles {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ServerProfile) Name() string  { return "ServerProfile" }
+func (p *ServerProfile) Label() string { return "Server Build" }
+
+// Value implements HandlerEdit.Value: the active profile.
+func (p *ServerProfile) Value() string { return p.Profile() }
+
+// Change implements HandlerEdit.Change. Empty input moves to the next profile.
+func (p *ServerProfile) Change(newValue string) {
+	name := strings.ToLower(strings.TrimSpace(newValue))
+	if name == "" {
+		cur := p.Profile()
+		for i, prof := range ServerProfiles {
+			if prof == cur {
+				name = ServerProfiles[(i+1)%len(ServerProfiles)]
+			}
+		}
+	}
+	if err := p.SetProfile(name); err != nil {
+		p.logf(err)
+	}
+}
+
+func (p *ServerProfile) SetLog(f func(message ...any)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log = f
+}
+
+// SetOnChange registers the rebuild run after the profile changes.
+func (p *ServerProfile) SetOnChange(fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onChange = fn
+}
+
+// Profile returns the active profile.
+func (p *ServerProfile) Profile() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.profile
+}
+
+// SetProfile switches profile, persists it and rebuilds the server.
+func (p *ServerProfile) SetProfile(name string) error {
+	if !serverProfileValid(name) {
+		return fmt.Errorf("unknown server profile %q, use one of %s", name, strings.Join(ServerProfiles, ", "))
+	}
+	p.mu.Lock()
+	if p.profile == name {
+		p.mu.Unlock()
+		return nil
+	}
+	p.profile = name
+	p.races = nil
+	db, onChange := p.db, p.onChange
+	p.mu.Unlock()
+	if db != nil {
+		if err := db.Set(StoreKeyServerProfile, name); err != nil {
+			return err
+		}
+	}
+	p.logf("Server build profile:", name, strings.Join(p.CompileArgs(), " "))
+	if onChange != nil {
+		onChange()
+	}
+	return nil
+}
+
+// Env returns the variables the active profile adds to the server process:
+// GOCOVERDIR pointing at coverDir for the cover profile.
+func (p *ServerProfile) Env() map[string]string {
+	if p.Profile() != ServerProfileCover || p.coverDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(p.coverDir, 0755); err != nil {
+		p.logf("Warning: coverage dir:", err)
+	}
+	return map[string]string{"GOCOVERDIR": p.coverDir}
+}
+
+// CompileArgs returns the go build flags of the active profile.
+func (p *ServerProfile) CompileArgs() []string {
+	return append([]string{"-p", "1"}, serverProfileFlags[p.Profile()]...)
+}
+
+// Races returns the distinct data races reported since the last build.
+func (p *ServerProfile) Races() []RaceReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]RaceReport{}, p.races...)
+}
+
+// Diagnostics returns the races located in file (every race when empty).
+func (p *ServerProfile) Diagnostics(file string) []Diagnostic {
+	var out []Diagnostic
+	for _, r := range p.Races() {
+		if d := r.Diagnostic(); file == "" || d.File == filepath.ToSlash(file) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Rebuilt drops the races of the previous server build.
+func (p *ServerProfile) Rebuilt() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.races = nil
+}
+
+// Scan reads server output as the server logger receives it, in chunks
+// that need not end at a line break, and collects race reports.
+func (p *ServerProfile) Scan(message ...any) {
+	text := fmt.Sprint(message...)
+	p.mu.Lock()
+	if !p.inRace && p.pending.Len() == 0 && !strings.Contains(text, "\n") {
+		p.mu.Unlock()
+		return // a log line of the server handler, not process output
+	}
+	p.pending.WriteString(text)
+	buf := p.pending.String()
+	cut := strings.LastIndex(buf, "\n")
+	if cut < 0 {
+		p.mu.Unlock()
+		return
+	}
+	p.pending.Reset()
+	p.pending.WriteString(buf[cut+1:])
+	var found []RaceReport
+	for _, line := range strings.Split(buf[:cut], "\n") {
+		if strings.HasPrefix(line, "==================") {
+			if p.inRace && len(p.block) > 1 {
+				found = append(found, ParseRaceReport(strings.Join(p.block, "\n"), p.rootDir))
+				p.block, p.inRace = nil, false
+				continue
+			}
+			p.block, p.inRace = []string{line}, false
+			continue
+		}
+		if p.block != nil && !p.inRace {
+			if strings.TrimSpace(line) == "WARNING: DATA RACE" {
+				p.inRace = true
+			} else {
+				p.block = nil
+				continue
+			}
+		}
+		if p.inRace {
+			p.block = append(p.block, line)
+		}
+	}
+	var added []RaceReport
+	for _, r := range found {
+		if p.addRace(r) {
+			added = append(added, r)
+		}
+	}
+	p.mu.Unlock()
+	for _, r := range added {
+		d := r.Diagnostic()
+		p.logf(fmt.Sprintf("Warning: %s:%d: %s", d.File, d.Line, d.Message))
+	}
+}
+
+// addRace records r, or counts it when the same race was already seen.
+// Reports whether r is new. Called with mu held.
+func (p *ServerProfile) addRace(r RaceReport) bool {
+	key := r.key()
+	for i := range p.races {
+		if p.races[i].key() == key {
+			p.races[i].Count++
+			p.races[i].Time = r.Time
+			return false
+		}
+	}
+	if len(p.races) == raceReportsMax {
+		p.races = p.races[1:]
+	}
+	p.races = append(p.races, r)
+	return true
+}
+
+func (p *ServerProfile) logf(message ...any) {
+	p.mu.Lock()
+	log := p.log
+	p.mu.Unlock()
+	if log != nil {
+		log(message...)
+	}
+}
+
+// serverLogTap stands in for the server in the TUI so the process output it
+// logs also reaches ServerProfile.Scan, after mask hid the env secrets.
+type serverLogTap struct {
+	ServerInterface
+	tap  func(message ...any)
+	mask func(message ...any) []any
+}
+
+func (t serverLogTap) SetLog(f func(message ...any)) {
+	if s, ok := t.ServerInterface.(interface{ SetLog(func(...any)) }); ok {
+		s.SetLog(func(message ...any) {
+			if t.mask != nil {
+				message = t.mask(message...)
+			}
+			t.tap(message...)
+			f(message...)
+		})
+	}
+}
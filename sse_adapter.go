@@ -2,11 +2,26 @@ package app
 
 import (
 	"net/http"
+
+	"github.com/tinywasm/mcp"
 )
 
-// logChannelProvider implements sse.ChannelProvider
-type logChannelProvider struct{}
+// logChannelProvider implements sse.ChannelProvider. When auth is set the
+// stream requires the API key, either as a Bearer header (devtui) or as a
+// token query parameter, since a browser EventSource cannot send headers.
+type logChannelProvider struct {
+	auth mcp.Authorizer
+}
 
 func (p *logChannelProvider) ResolveChannels(r *http.Request) ([]string, error) {
+	if p.auth != nil {
+		token := r.URL.Query().Get("token")
+		if h := r.Header.Get("Authorization"); len(h) > 7 && h[:7] == "Bearer " {
+			token = h[7:]
+		}
+		if _, err := p.auth.Authorize(token); err != nil {
+			return nil, err
+		}
+	}
 	return []string{"logs"}, nil
 }
@@ -0,0 +1,32 @@
+package app
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tinywasm/mcp"
+)
+
+func TestLogChannelProvider_RequiresToken(t *testing.T) {
+	p := &logChannelProvider{auth: mcp.NewTokenAuthorizer("secret")}
+
+	cases := []struct {
+		name, url, header string
+		ok                bool
+	}{
+		{"none", "/logs", "", false},
+		{"wrong query", "/logs?token=nope", "", false},
+		{"query", "/logs?token=secret", "", true},
+		{"bearer", "/logs", "Bearer secret", true},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", c.url, nil)
+		if c.header != "" {
+			r.Header.Set("Authorization", c.header)
+		}
+		_, err := p.ResolveChannels(r)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: err = %v, want ok=%v", c.name, err, c.ok)
+		}
+	}
+}
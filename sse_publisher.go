@@ -24,13 +24,25 @@ type LogEntry struct {
 	HandlerType  int    `json:"handler_type"`
 }
 
+// StateMessage is the SSE wire format for state changes: HandlerType 0
+// (TypeStateRefresh) tells clients to re-fetch GET /tinywasm/state, as devtui
+// does. Revision increases by one per message; the X-State-Revision header of
+// a snapshot carries the revision it already includes, so a client can skip
+// older messages.
+type StateMessage struct {
+	HandlerType int    `json:"handler_type"`
+	Revision    uint64 `json:"revision"`
+}
+
 // SSEPublisher wraps an ssePublisher hub with tinywasm-specific publishing logic.
 type SSEPublisher struct {
-	hub   ssePublisher
-	mu    sync.Mutex
-	ring  [100]string
-	head  int
-	count int
+	hub      ssePublisher
+	mu       sync.Mutex
+	ring     [100]string
+	head     int
+	count    int
+	stateMu  sync.Mutex
+	revision uint64
 }
 
 func NewSSEPublisher(hub ssePublisher) *SSEPublisher { return &SSEPublisher{hub: hub} }
@@ -85,10 +97,25 @@ func (p *SSEPublisher) PublishLog(msg string) {
 }
 
 // PublishStateRefresh sends a lightweight signal to connected devtui clients
+// asking them to re-fetch the complete state, under the next revision. It
+// holds stateMu while publishing so revisions reach the hub in order.
 func (p *SSEPublisher) PublishStateRefresh() {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	p.revision++
 	if p.hub == nil {
 		return
 	}
-	signal, _ := json.Marshal(map[string]any{"handler_type": 0}) // TypeStateRefresh
-	p.hub.Publish(signal, "logs")
+	msg, _ := json.Marshal(StateMessage{
+		HandlerType: 0, // TypeStateRefresh
+		Revision:    p.revision,
+	})
+	p.hub.Publish(msg, "logs")
+}
+
+// StateRevision returns the revision of the latest state message.
+func (p *SSEPublisher) StateRevision() uint64 {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	return p.revision
 }
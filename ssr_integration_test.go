@@ -32,12 +32,10 @@ func RenderCSS() string { return ".my-class { color: red; }" }
 	os.WriteFile(filepath.Join(root, "go.mod"), []byte("module testapp\ngo 1.21\n"), 0644)
 	os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\nimport _ \"testapp/mymodule\"\nfunc main() {}"), 0644)
 
-	// Set TestMode to true to avoid slow tasks
-	TestMode = true
-
 	// Mock Handler
 	h := &Handler{
 		RootDir: root,
+		Options: TestOptions(root),
 		Config:  NewConfig(root, nil),
 		Tui:     &mockTui{},
 		DB:      &mockDB{},
@@ -77,11 +75,9 @@ func RenderCSS() string { return ".v1 { color: red; }" }
 	os.WriteFile(filepath.Join(root, "go.mod"), []byte("module testapp\ngo 1.21\n"), 0644)
 	os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\nimport _ \"testapp/mymodule\"\nfunc main() {}"), 0644)
 
-	// Set TestMode to true to avoid slow tasks
-	TestMode = true
-
 	h := &Handler{
 		RootDir: root,
+		Options: TestOptions(root),
 		Config:  NewConfig(root, nil),
 		Tui:     &mockTui{},
 		DB:      &mockDB{},
@@ -130,6 +126,7 @@ func TestSSRNoBlockOnStartup(t *testing.T) {
 	// Create a module with a slow loading process (simulated via mock)
 	h := &Handler{
 		RootDir: root,
+		Options: TestOptions(root),
 		Config:  NewConfig(root, nil),
 		Tui:     &mockTui{},
 		DB:      &mockDB{},
@@ -175,11 +172,9 @@ func RenderCSS() string { return ".proxy { color: green; }" }
 	os.WriteFile(filepath.Join(root, "go.mod"), []byte("module testapp\ngo 1.21\n"), 0644)
 	os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\nimport _ \"testapp/proxy_pkg\"\nfunc main() {}"), 0644)
 
-	// Set TestMode to true to avoid slow tasks
-	TestMode = true
-
 	h := &Handler{
 		RootDir: root,
+		Options: TestOptions(root),
 		Config:  NewConfig(root, nil),
 		Tui:     &mockTui{},
 		DB:      &mockDB{},
@@ -209,6 +204,7 @@ func TestImageHotReload(t *testing.T) {
 
 	h := &Handler{
 		RootDir: root,
+		Options: TestOptions(root),
 		Config:  NewConfig(root, nil),
 		Tui:     &mockTui{},
 		DB:      &mockDB{},
@@ -233,10 +229,10 @@ func TestImageHotReload(t *testing.T) {
 
 func TestSSRIconInjection(t *testing.T) {
 	root := t.TempDir()
-	TestMode = true
 
 	h := &Handler{
 		RootDir: root,
+		Options: TestOptions(root),
 		Config:  NewConfig(root, nil),
 		Tui:     &mockTui{},
 		DB:      &mockDB{},
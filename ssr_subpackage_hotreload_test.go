@@ -47,12 +47,11 @@ func (c *cssSheet) String() string { return ".contact-form { color: red; }" }
 func RenderCSS() *cssSheet { return &cssSheet{} }
 `), 0644)
 
-	TestMode = true
-
 	var capturedSSRCallback func(string)
 
 	h := &Handler{
 		RootDir: root,
+		Options: TestOptions(root),
 		Config:  NewConfig(root, nil),
 		Tui:     &mockTui{},
 		DB:      &mockDB{},
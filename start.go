@@ -16,14 +16,12 @@ import (
 	"github.com/tinywasm/sse"
 )
 
-// TestMode disables browser auto-start when running tests
-var TestMode bool
-
 // Start is called from main.go with UI, Browser and DB passed as parameters
 // CRITICAL: UI, Browser and DB instances created in main.go, passed here as interfaces
 // mcpToolHandlers: optional external Handlers that implement Tools() for MCP tool discovery
+// opts: per-instance side effect toggles (see Options); zero value for production
 // onProjectReady: optional callback called after handler initialization (for daemon mode to set up proxy)
-func Start(startDir string, logger any, ui TuiInterface, browser BrowserInterface, db DB, ExitChan chan bool, serverFactory ServerFactory, githubAuth any, gitHandler devflow.GitClient, goModHandler devflow.GoModInterface, headless bool, clientMode bool, onProjectReady func(*Handler), mcpToolHandlers ...mcp.ToolProvider) bool {
+func Start(startDir string, logger any, ui TuiInterface, browser BrowserInterface, db DB, ExitChan chan bool, serverFactory ServerFactory, githubAuth any, gitHandler devflow.GitClient, goModHandler devflow.GoModInterface, headless bool, clientMode bool, opts Options, onProjectReady func(*Handler), mcpToolHandlers ...mcp.ToolProvider) bool {
 
 	var loggerFunc func(messages ...any)
 	if l, ok := logger.(func(...any)); ok {
@@ -46,12 +44,20 @@ func Start(startDir string, logger any, ui TuiInterface, browser BrowserInterfac
 		goModHandler.SetRootDir(moduleRoot)
 	}
 
+	// Key the registry by the start directory so it stays stable even if the
+	// wizard later moves RootDir to the newly created project.
+	if opts.ID == "" {
+		opts.ID = startDir
+	}
+
 	h := &Handler{
 		FrameworkName: "TINYWASM",
 		RootDir:       startDir,
 		Tui:           ui, // UI passed from main.go
 		ExitChan:      ExitChan,
 		Logger:        loggerFunc,
+		Options:       opts,
+		headless:      headless,
 
 		DB:            db,
 		serverFactory: serverFactory,
@@ -69,7 +75,7 @@ func Start(startDir string, logger any, ui TuiInterface, browser BrowserInterfac
 	h.CheckDevMode()
 
 	// Wire gitignore notification
-	if !TestMode && gitHandler != nil {
+	if !h.Options.DisableGitIgnore && gitHandler != nil {
 		gitHandler.SetShouldWrite(h.IsInitializedProject)
 	}
 
@@ -92,6 +98,7 @@ func Start(startDir string, logger any, ui TuiInterface, browser BrowserInterfac
 	// ADD SECTIONS using the passed UI interface
 	// CRITICAL: Initialize sections BEFORE starting lifecycle
 	h.SectionBuild = h.AddSectionBUILD()
+	h.AddSectionTESTS()
 	h.AddSectionDEPLOY()
 	h.SectionMCP = h.AddSectionMCP()
 
@@ -221,7 +228,8 @@ func Start(startDir string, logger any, ui TuiInterface, browser BrowserInterfac
 		}
 
 		h.Tui.AddHandler(h.MCP, colorOrangeLight, h.SectionMCP)
-		SetActiveHandler(h)
+		RegisterHandler(h.ID(), h)
+		defer UnregisterHandler(h.ID(), h)
 
 		mux := http.NewServeMux()
 		mux.Handle("/logs", sseServer)
@@ -266,6 +274,8 @@ func Start(startDir string, logger any, ui TuiInterface, browser BrowserInterfac
 		go h.Tui.Start(&wg, ExitChan)
 	} else {
 		// Headless mode: no HTTP, no UI. Keep alive until ExitChan is closed.
+		RegisterHandler(h.ID(), h)
+		defer UnregisterHandler(h.ID(), h)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
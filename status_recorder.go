@@ -0,0 +1,17 @@
+package app
+
+import "net/http"
+
+// statusRecorder keeps the status written through it for request logs.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController flush streamed responses.
+func (w *statusRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -93,7 +93,7 @@ func (m *MemoryStore) GetFile(path string) ([]byte, error) {
 func (m *MemoryStore) SetFile(path string, data []byte) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.data[path] = data
+	m.data[path] = append([]byte(nil), data...) // kvdb reuses its buffer
 	return nil
 }
 
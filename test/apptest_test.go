@@ -0,0 +1,47 @@
+package test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/app/apptest"
+)
+
+func TestAppTest_EditRecompilesAndReloads(t *testing.T) {
+	p := apptest.NewProject(t, "example.com/apptestdemo", nil)
+	env := apptest.Start(t, p, nil)
+
+	if status, _ := env.Server.Get("/client.wasm"); status != 200 {
+		t.Fatalf("expected initial wasm to be served, got status %d", status)
+	}
+
+	env.Edit("web/client.go", strings.Replace(apptest.DefaultClient, "select {}", "println(\"edited\")\n\tselect {}", 1))
+
+	if err := env.WaitCompile(60 * time.Second); err != nil {
+		t.Fatalf("compile after edit: %v\n%s", err, env.Logs)
+	}
+	if err := env.WaitReload(10 * time.Second); err != nil {
+		t.Fatalf("reload after edit: %v\n%s", err, env.Logs)
+	}
+
+	// Each successful compile is followed by a size report with a delta;
+	// gzipping the binary is slow under -race, hence the generous deadline
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		if r := env.Handler.WasmSize.Report(); r != nil && r.Previous > 0 {
+			if r.Total == 0 || len(r.Packages) == 0 {
+				t.Fatalf("empty size report: %+v", r)
+			}
+			if r.Trigger != filepath.Join("web", "client.go") {
+				t.Errorf("size report should name the edited file, got %q", r.Trigger)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no size report comparing two builds\n%s", env.Logs)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
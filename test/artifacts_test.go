@@ -0,0 +1,187 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/app"
+	"github.com/tinywasm/app/apptest"
+)
+
+func TestArtifactStore_KeepsLastBuildsWithGitState(t *testing.T) {
+	repo := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Skipf("git unavailable: %v %s", err, out)
+		}
+	}
+	git("init", "-q")
+	os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main"), 0644)
+	git("add", ".")
+	git("commit", "-qm", "init")
+
+	dir := filepath.Join(t.TempDir(), "artifacts")
+	s := app.NewArtifactStore(newBudgetDB(t, map[string]string{app.StoreKeyArtifactsKeep: "3"}), dir, repo)
+
+	s.NoteEdit(app.ArtifactWasm, "web/client.go")
+	first, err := s.Record(app.ArtifactWasm, "client.wasm", []byte("\x00asm 1"), "L")
+	if err != nil || first == nil {
+		t.Fatal(first, err)
+	}
+	if first.Commit == "" || first.Dirty || first.Trigger != "web/client.go" || first.Mode != "L" {
+		t.Errorf("first artifact = %+v", first)
+	}
+	if a, _ := s.Record(app.ArtifactWasm, "client.wasm", []byte("\x00asm 1"), "L"); a != nil {
+		t.Error("an identical rebuild should not be kept twice")
+	}
+
+	os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main // edit"), 0644)
+	for _, v := range []string{"2", "3", "4"} {
+		if _, err := s.Record(app.ArtifactWasm, "client.wasm", []byte("\x00asm "+v), "L"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Record(app.ArtifactServer, "server", []byte("ELF"), "")
+
+	wasm := s.List(app.ArtifactWasm)
+	if len(wasm) != 3 || wasm[0].ID != "wasm-2" || !wasm[2].Dirty || wasm[2].Trigger != "" {
+		t.Fatalf("kept wasm builds = %+v", wasm)
+	}
+	if _, err := os.Stat(first.File); !os.IsNotExist(err) {
+		t.Error("pruned artifacts should be removed from disk")
+	}
+	if len(s.List("")) != 4 || len(s.List(app.ArtifactServer)) != 1 {
+		t.Errorf("targets are kept separately: %+v", s.List(""))
+	}
+
+	reopened := app.NewArtifactStore(nil, dir, repo)
+	if got := reopened.List(""); len(got) != 4 || got[3].ID != s.List("")[3].ID {
+		t.Errorf("index not restored: %+v", got)
+	}
+	if a, _ := reopened.Record(app.ArtifactWasm, "client.wasm", []byte("\x00asm 5"), "L"); a == nil || a.ID != "wasm-6" {
+		t.Errorf("ids must not be reused across sessions: %+v", a)
+	}
+}
+
+func TestArtifactStore_PinServesPreviousWasm(t *testing.T) {
+	s := app.NewArtifactStore(nil, t.TempDir(), "")
+	mode := "L"
+	s.SetMode(func() string { return mode })
+	pins := 0
+	s.SetOnPin(func() { pins++ })
+
+	old, _ := s.Record(app.ArtifactWasm, "client.wasm", []byte("\x00asm old"), "L")
+	s.Record(app.ArtifactWasm, "client.wasm", []byte("\x00asm new"), "L")
+	srv, _ := s.Record(app.ArtifactServer, "server", []byte("ELF"), "")
+
+	latest := "\x00asm latest"
+	mux := http.NewServeMux()
+	s.Routes(func() string { return "/client.wasm" }, func(mux *http.ServeMux) {
+		mux.HandleFunc("/client.wasm", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(latest)) })
+		mux.HandleFunc("/script.js", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("js")) })
+	})(mux)
+	body := func(path string) string {
+		b, _ := io.ReadAll(get(mux, path).Body)
+		return string(b)
+	}
+
+	if _, err := s.Pin(srv.ID); err == nil || !strings.Contains(err.Error(), srv.File) {
+		t.Errorf("server binaries cannot be served: %v", err)
+	}
+	if _, err := s.Pin("wasm-99"); err == nil {
+		t.Error("unknown ids should fail")
+	}
+	if _, err := s.Pin(old.ID); err != nil {
+		t.Fatal(err)
+	}
+	if body("/client.wasm") != "\x00asm old" || body("/script.js") != "js" || s.Value() != old.ID || pins != 1 {
+		t.Errorf("pinned: wasm %q, value %q, pins %d", body("/client.wasm"), s.Value(), pins)
+	}
+	if res := get(mux, "/client.wasm"); res.Header.Get("X-Tinywasm-Artifact") != old.ID {
+		t.Errorf("headers = %v", res.Header)
+	}
+
+	// New builds are still kept but the pin holds
+	s.Record(app.ArtifactWasm, "client.wasm", []byte("\x00asm newer"), "L")
+	if body("/client.wasm") != "\x00asm old" {
+		t.Error("a rebuild should not drop the pin")
+	}
+
+	s.Change("latest")
+	if body("/client.wasm") != latest || s.Value() != "latest" || pins != 2 {
+		t.Errorf("unpinned: wasm %q, value %q", body("/client.wasm"), s.Value())
+	}
+
+	// A build in another size mode needs a different wasm_exec.js
+	s.Change(old.ID)
+	mode = "S"
+	s.Record(app.ArtifactWasm, "client.wasm", []byte("\x00asm tiny"), "S")
+	if s.Pinned() != nil {
+		t.Error("a size mode change should unpin")
+	}
+	if _, err := s.Pin(old.ID); err == nil {
+		t.Error("pinning a build of another size mode should fail")
+	}
+}
+
+func TestArtifactStore_RecordsProjectBuilds(t *testing.T) {
+	env := apptest.Start(t, apptest.NewProject(t, "example.com/artifactsdemo", nil), nil)
+
+	kept := env.Handler.Artifacts.List(app.ArtifactWasm)
+	if len(kept) == 0 {
+		t.Fatalf("initial build not kept\n%s", env.Logs)
+	}
+	a := kept[len(kept)-1]
+	if !strings.HasPrefix(a.File, filepath.Join(env.Project.Dir, "deploy", "artifacts")) || a.Mode == "" {
+		t.Errorf("artifact = %+v", a)
+	}
+	if _, err := env.Handler.Artifacts.Pin(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	res := get(env.Server, "/client.wasm")
+	if res.StatusCode != 200 || res.Header.Get("X-Tinywasm-Artifact") != a.ID {
+		t.Errorf("pinned wasm not served: status %d, headers %v", res.StatusCode, res.Header)
+	}
+}
+
+func TestArtifactStore_RelativeDirStoresAbsolutePaths(t *testing.T) {
+	root := t.TempDir()
+	t.Chdir(root)
+
+	s := app.NewArtifactStore(nil, filepath.Join("deploy", "artifacts"), "")
+	a, err := s.Record(app.ArtifactWasm, "client.wasm", []byte("\x00asm"), "L")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(a.File) || !strings.HasPrefix(a.File, root) {
+		t.Errorf("artifact file = %q, want an absolute path under %q", a.File, root)
+	}
+}
+
+func TestInitBuildHandlers_ArtifactsUnderProjectRoot(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "go.mod"), []byte("module testapp\ngo 1.21\n"), 0644)
+
+	h := NewTestHandler(root) // Handler.RootDir left empty, as in the other tests
+	h.Browser = &MockBrowser{}
+	h.Tui = newUiMockTest()
+	h.GitHandler = &MockGitClient{}
+	h.Logger = func(...any) {}
+	h.GoModHandler = &MockGoModHandler{}
+	h.DB = &MockDB{data: map[string]string{}}
+	h.InitBuildHandlers()
+
+	a, err := h.Artifacts.Record(app.ArtifactWasm, "client.wasm", []byte("\x00asm"), "L")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(a.File, root) {
+		t.Errorf("artifact written to %q, outside the project %q", a.File, root)
+	}
+}
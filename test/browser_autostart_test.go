@@ -33,12 +33,11 @@ func TestBrowserAutoStartCalledOnce(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// Temporarily disable TestMode to allow AutoStart to be called
-	originalTestMode := app.TestMode
-	app.TestMode = false
-	defer func() { app.TestMode = originalTestMode }()
+	// Re-enable browser auto-start so OpenBrowser calls can be observed
+	opts := app.TestOptions(tmp)
+	opts.DisableBrowserAutoStart = false
 
-	ctx := startTestApp(t, tmp)
+	ctx := startTestApp(t, tmp, opts)
 	defer ctx.Cleanup()
 
 	// Wait a bit more for all goroutines to settle (AutoStart has 100ms delay)
@@ -64,7 +63,11 @@ func TestBrowserAutoStartNotCalledInWizard(t *testing.T) {
 
 	// Empty directory - NO go.mod (wizard mode)
 
-	ctx := startTestApp(t, tmp)
+	// Keep auto-start enabled: only the wizard itself may hold the browser back
+	opts := app.TestOptions(tmp)
+	opts.DisableBrowserAutoStart = false
+
+	ctx := startTestApp(t, tmp, opts)
 	defer ctx.Cleanup()
 
 	// Wait a bit more for goroutines to settle
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/app"
+	"github.com/tinywasm/app/apptest"
+)
+
+func newCacheModule(t *testing.T) (dir string, write func(name, src string)) {
+	t.Helper()
+	dir = t.TempDir()
+	write = func(name, src string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/cachedemo\n\ngo 1.22\n")
+	write("main.go", "package main\n\nfunc main() { println(1) }\n")
+	return dir, write
+}
+
+func TestBuildCache_KeyFollowsSourceState(t *testing.T) {
+	dir, write := newCacheModule(t)
+	c := app.NewBuildCache(nil, t.TempDir())
+	spec := app.BuildSpec{Dir: dir, Compiler: "go", Env: []string{"GOOS=js", "GOARCH=wasm"}, Flags: []string{"mode=L"}}
+	key := func(s app.BuildSpec) string {
+		t.Helper()
+		k, err := c.Key(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	base := key(spec)
+	if key(spec) != base {
+		t.Fatal("key is not deterministic")
+	}
+	write("main.go", "package main\n\nfunc main() { println(2) }\n")
+	edited := key(spec)
+	if edited == base {
+		t.Error("a source edit should change the key")
+	}
+	write("main.go", "package main\n\nfunc main() { println(1) }\n")
+	if key(spec) != base {
+		t.Error("reverting the edit should give back the original key")
+	}
+
+	// Files excluded by build constraints still count: another mode may build them
+	write("server.go", "//go:build !wasm\n\npackage main\n")
+	if key(spec) == base {
+		t.Error("constrained files should be part of the key")
+	}
+	os.Remove(filepath.Join(dir, "server.go"))
+
+	flags := spec
+	flags.Flags = []string{"mode=S"}
+	env := spec
+	env.Env = []string{"GOOS=js", "GOARCH=wasm", "GOEXPERIMENT=loopvar"}
+	if key(flags) == base || key(env) == base {
+		t.Error("mode flags and environment should change the key")
+	}
+	write("go.mod", "module example.com/cachedemo\n\ngo 1.23\n")
+	if key(spec) == base {
+		t.Error("go.mod should change the key")
+	}
+}
+
+func TestBuildCache_GetPutAndToggle(t *testing.T) {
+	db := newBudgetDB(t, nil)
+	c := app.NewBuildCache(db, t.TempDir())
+	key := "ab0123456789"
+	if _, ok := c.Get(key, ".wasm"); ok {
+		t.Fatal("empty cache should miss")
+	}
+	if err := c.Put(key, ".wasm", []byte("\x00asm")); err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := c.Get(key, ".wasm"); !ok || string(data) != "\x00asm" {
+		t.Fatalf("get = %q, %v", data, ok)
+	}
+
+	c.Change("BuildCache:F")
+	if _, ok := c.Get(key, ".wasm"); ok || c.Value() != "BuildCache:F" {
+		t.Error("a disabled cache should miss")
+	}
+	if v, _ := db.Get(app.StoreKeyBuildCache); v != "false" || app.NewBuildCache(db, t.TempDir()).Enabled() {
+		t.Errorf("toggle not persisted: %q", v)
+	}
+}
+
+func TestBuildCache_RestoresProjectWasm(t *testing.T) {
+	// Keep the Go build cache warm while the tinywasm cache moves to a temp dir
+	if gocache, err := exec.Command("go", "env", "GOCACHE").Output(); err == nil {
+		t.Setenv("GOCACHE", strings.TrimSpace(string(gocache)))
+	}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	env := apptest.Start(t, apptest.NewProject(t, "example.com/buildcachedemo", nil), nil)
+
+	_, before := env.Server.Get("/client.wasm")
+	hits, _ := env.Handler.BuildCache.Stats()
+	if err := env.Handler.RecompileWasm(); err != nil {
+		t.Fatal(err)
+	}
+	_, after := env.Server.Get("/client.wasm")
+	if h, _ := env.Handler.BuildCache.Stats(); h != hits+1 {
+		t.Fatalf("recompiling an unchanged project should hit the cache (hits %d -> %d)\n%s", hits, h, env.Logs)
+	}
+	if len(before) == 0 || string(after) != string(before) {
+		t.Error("the cached build differs from the compiled one")
+	}
+}
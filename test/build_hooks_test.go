@@ -0,0 +1,163 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/app"
+	"github.com/tinywasm/app/apptest"
+)
+
+func TestParseBuildHooks(t *testing.T) {
+	hooks, err := app.ParseBuildHooks(`
+# phase       glob           command
+before-wasm   models/*.go    go generate ./models
+after-assets  web/**/*.css   npx postcss --env=dev   web/ui
+before-server wasm           ./wasm.sh
+bogus         *.go           true
+after-wasm    *.go
+`)
+	if err == nil || !strings.Contains(err.Error(), "line 6") || !strings.Contains(err.Error(), "line 7") {
+		t.Errorf("invalid lines should be reported, got %v", err)
+	}
+	want := []app.BuildHook{
+		{Phase: app.PhaseBeforeWasm, Glob: "models/*.go", Command: "go generate ./models"},
+		{Phase: app.PhaseAfterAssets, Glob: "web/**/*.css", Command: "npx postcss --env=dev   web/ui"},
+		{Phase: app.PhaseBeforeServer, Glob: "wasm", Command: "./wasm.sh"},
+	}
+	if fmt.Sprint(hooks) != fmt.Sprint(want) {
+		t.Errorf("hooks = %q", hooks)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	for _, c := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.go", "models/user.go", true},
+		{"models/*.go", "models/user.go", true},
+		{"models/*.go", "models/sub/user.go", false},
+		{"models/**/*.go", "models/user.go", true},
+		{"models/**/*.go", "models/a/b/user.go", true},
+		{"**/*.templ", "web/ui/page.templ", true},
+		{"web/*.css", "web/ui/x.css", false},
+		{"*_model.go", filepath.Join("pkg", "user_model.go"), true},
+	} {
+		if got := app.MatchGlob(c.pattern, c.name); got != c.want {
+			t.Errorf("MatchGlob(%q, %q) = %v", c.pattern, c.name, got)
+		}
+	}
+}
+
+func TestBuildHooks_RunStopsAtFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks in this test are sh scripts")
+	}
+	dir := t.TempDir()
+	db := apptest.NewDB(dir, nil)
+	h := app.NewBuildHooks(db, dir)
+	for _, hook := range []string{
+		`before-wasm models/*.go echo "gen $TINYWASM_HOOK_FILE $TINYWASM_HOOK_PHASE" >> gen.txt`,
+		`before-wasm models/*.go echo broken; exit 3`,
+		`before-wasm models/*.go touch never.txt`,
+		`after-wasm  *.go        touch after.txt`,
+	} {
+		h.Change(hook)
+	}
+	if v := h.Value(); v != "4 hooks" {
+		t.Fatalf("value after adding = %q", v)
+	}
+	var logs []string
+	h.SetLog(func(msg ...any) { logs = append(logs, fmt.Sprint(msg...)) })
+
+	if err := h.Run(app.PhaseBeforeWasm, "web/client.go"); err != nil {
+		t.Fatalf("no hook matches web/client.go: %v", err)
+	}
+	os.MkdirAll(filepath.Join(dir, "models"), 0755)
+	os.WriteFile(filepath.Join(dir, "models", "user.go"), []byte("package models\n"), 0644)
+	err := h.Run(app.PhaseBeforeWasm, "models/user.go")
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Fatalf("err = %v", err)
+	}
+	if out, _ := os.ReadFile(filepath.Join(dir, "gen.txt")); string(out) != "gen models/user.go before-wasm\n" {
+		t.Errorf("gen.txt = %q", out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "never.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("hooks after a failure should not run")
+	}
+	if !strings.Contains(strings.Join(logs, "\n"), "broken") || !strings.HasPrefix(h.Value(), "⚠") {
+		t.Errorf("value %q / logs %q should show the failure", h.Value(), logs)
+	}
+
+	// Another handler seeing the same change gets the outcome without a rerun
+	if again := h.Run(app.PhaseBeforeWasm, "models/user.go"); again == nil {
+		t.Error("the failure should be reported again")
+	}
+	if out, _ := os.ReadFile(filepath.Join(dir, "gen.txt")); strings.Count(string(out), "gen") != 1 {
+		t.Errorf("hooks ran again for the same content: %q", out)
+	}
+
+	// Editing the hooks clears the stale failure
+	h.Change("-2")
+	if stored, _ := db.Get(app.StoreKeyBuildHooks); h.Value() != "3 hooks" || strings.Count(stored, ";") != 2 {
+		v := h.Value()
+		t.Errorf("value after removing = %q, stored %q", v, stored)
+	}
+	if err := h.Run(app.PhaseBeforeWasm, "models/user.go"); err != nil {
+		t.Errorf("reloaded hooks: %v, value %q", err, h.Value())
+	}
+}
+
+func TestBuildHooks_GateWasmCompile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks in this test are sh scripts")
+	}
+	p := apptest.NewProject(t, "example.com/hooksdemo", nil)
+	db := apptest.NewDB(p.Dir, nil)
+	err := app.NewBuildHooks(db, p.Dir).SetHooks([]app.BuildHook{
+		{Phase: app.PhaseBeforeWasm, Glob: "web/*.go", Command: "echo generating $TINYWASM_HOOK_FILE; test ! -f block"},
+		{Phase: app.PhaseAfterWasm, Glob: "web/*.go", Command: "touch compiled.txt"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := apptest.Start(t, p, &apptest.Config{DB: db})
+
+	env.Edit("web/client.go", strings.Replace(apptest.DefaultClient, "select {}", "println(1)\n\tselect {}", 1))
+	if err := env.WaitCompile(60 * time.Second); err != nil {
+		t.Fatalf("compile after edit: %v\n%s", err, env.Logs)
+	}
+	if err := env.WaitLog("generating web/client.go", 5*time.Second); err != nil {
+		t.Fatalf("before-wasm hook did not run: %v\n%s", err, env.Logs)
+	}
+	if err := apptestPoll(5*time.Second, func() bool { _, err := os.Stat(p.Path("compiled.txt")); return err == nil }); err != nil {
+		t.Errorf("after-wasm hook did not run\n%s", env.Logs)
+	}
+
+	p.WriteFile("block", "")
+	env.Edit("web/client.go", strings.Replace(apptest.DefaultClient, "select {}", "println(2)\n\tselect {}", 1))
+	if err := env.WaitCompile(3 * time.Second); !errors.Is(err, apptest.ErrTimeout) {
+		t.Errorf("a failing before-wasm hook should block the compile, got %v", err)
+	}
+	if !strings.HasPrefix(env.Handler.Hooks.Value(), "⚠ before-wasm") {
+		t.Errorf("hooks value = %q", env.Handler.Hooks.Value())
+	}
+}
+
+func apptestPoll(timeout time.Duration, cond func() bool) error {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return apptest.ErrTimeout
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return nil
+}
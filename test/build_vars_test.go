@@ -0,0 +1,96 @@
+package test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/app"
+)
+
+func TestBuildVars_ProfilesOverrideSharedValues(t *testing.T) {
+	db := newBudgetDB(t, nil)
+	profile := "dev"
+	b := app.NewBuildVars(db, t.TempDir(), func() string { return profile })
+	rebuilds := 0
+	b.SetOnChange(func() { rebuilds++ })
+
+	b.SetVar("", "main.apiBase", "http://localhost:8080/api?v=1")
+	b.SetVar("test", "main.apiBase", "http://mock")
+	b.SetFeature("", "checkout", true)
+	b.SetFeature("", "beta", false)
+	b.SetTags("test", []string{"sqlite"})
+	if rebuilds != 5 {
+		t.Errorf("%d rebuilds", rebuilds)
+	}
+	if b.Vars()["main.apiBase"] != "http://localhost:8080/api?v=1" || strings.Join(b.Tags(), ",") != "feature_checkout" {
+		t.Errorf("dev: %q %q", b.Vars(), b.Tags())
+	}
+
+	profile = "test"
+	if b.Vars()["main.apiBase"] != "http://mock" || strings.Join(b.Tags(), ",") != "sqlite,feature_checkout" {
+		t.Errorf("test: %q %q", b.Vars(), b.Tags())
+	}
+	args := b.Args(app.BuildTargetWasm, "L")
+	if len(args) != 2 || args[0] != "-tags=sqlite,feature_checkout" {
+		t.Fatalf("args = %q", args)
+	}
+	for _, want := range []string{"-X main.apiBase=http://mock", "-X github.com/tinywasm/app/buildinfo.Profile=test", "buildinfo.Features=checkout", "buildinfo.Mode=L", "buildinfo.Target=wasm"} {
+		if !strings.Contains(args[1], want) {
+			t.Errorf("%q missing in %s", want, args[1])
+		}
+	}
+
+	// TUI: a name flips the flag, +/- set it, pkg.Var=value sets a variable
+	b.Change("beta")
+	b.Change("-checkout")
+	if b.Value() != "+beta -checkout" {
+		t.Errorf("value = %q", b.Value())
+	}
+	b.Change("main.title=My App")
+	if !strings.Contains(b.Args(app.BuildTargetServer, "race")[1], "-X 'main.title=My App'") {
+		t.Errorf("args = %q", b.Args(app.BuildTargetServer, "race"))
+	}
+	if err := b.SetVar("", "apiBase", "x"); err == nil {
+		t.Error("variable without package accepted")
+	}
+}
+
+func TestBuildVars_CompiledIntoBinary(t *testing.T) {
+	// A module with the buildinfo package at its real import path
+	dir := t.TempDir()
+	src, err := os.ReadFile("../buildinfo/buildinfo.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"go.mod":                 "module github.com/tinywasm/app\n\ngo 1.22\n",
+		"buildinfo/buildinfo.go": string(src),
+		"cmd/demo/main.go": "package main\n\nimport \"github.com/tinywasm/app/buildinfo\"\n\nvar apiBase = \"unset\"\nvar extra = \"off\"\n\n" +
+			"func main() { println(apiBase, extra, buildinfo.Mode, buildinfo.Profile, buildinfo.Feature(\"checkout\"), buildinfo.Feature(\"beta\"), buildinfo.Time != \"\") }\n",
+		"cmd/demo/checkout.go": "//go:build feature_checkout\n\npackage main\n\nfunc init() { extra = \"on\" }\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	b := app.NewBuildVars(newBudgetDB(t, nil), dir, func() string { return "staging-local" })
+	b.SetVar("", "main.apiBase", "https://api.example.com/v1?key=a b")
+	b.SetFeature("", "checkout", true)
+	build := exec.Command("go", append(append([]string{"build"}, b.Args(app.BuildTargetServer, "normal")...), "-o", "demo", "./cmd/demo")...)
+	build.Dir = dir
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	out, err := exec.Command(filepath.Join(dir, "demo")).CombinedOutput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "https://api.example.com/v1?key=a b on normal staging-local true false true" {
+		t.Errorf("output = %q", got)
+	}
+}
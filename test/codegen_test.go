@@ -0,0 +1,89 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/app"
+)
+
+func TestGenerators(t *testing.T) {
+	for _, c := range []struct {
+		src  string
+		want []string
+	}{
+		{"package models\n\n// ormc:formonly\ntype User struct{}\n", []string{app.GeneratorOrmc}},
+		{"package models\n\n//go:generate stringer -type=Kind\n", []string{app.GeneratorGoGenerate}},
+		{"package models\n// ormc:formonly\n//go:generate sh -c true\n", []string{app.GeneratorOrmc, app.GeneratorGoGenerate}},
+		{"// DO NOT EDIT. generated by github.com/tinywasm/orm\n\npackage models\n// ormc:formonly\n", nil},
+		{"package models\n\n// see go:generate and ormc: in the docs\n", nil},
+	} {
+		if got := app.Generators([]byte(c.src)); fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("Generators(%q) = %q, want %q", c.src, got, c.want)
+		}
+	}
+}
+
+func TestBuildHooks_GenerateRunsOncePerEdit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the generator in this test is a sh script")
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/gendemo\n\ngo 1.22\n"), 0644)
+	models := filepath.Join(dir, "models")
+	os.MkdirAll(models, 0755)
+	os.WriteFile(filepath.Join(models, "user_gen.go"), []byte("package models\n\nconst A = 1\n"), 0644)
+	model := func(gen string) {
+		src := "package models\n\n//go:generate sh -c \"" + gen + "\"\ntype User struct{}\n"
+		os.WriteFile(filepath.Join(models, "user.go"), []byte(src), 0644)
+	}
+
+	h := app.NewBuildHooks(nil, dir)
+	var logs []string
+	h.SetLog(func(msg ...any) { logs = append(logs, fmt.Sprint(msg...)) })
+
+	model(`echo generating; printf 'package models\\n\\nconst B = 2\\nconst C = 3\\n' > user_gen.go`)
+	if err := h.Generate("models/user.go"); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := os.ReadFile(filepath.Join(models, "user_gen.go")); !strings.Contains(string(out), "const B = 2") {
+		t.Fatalf("generator did not run: %q\n%s", out, strings.Join(logs, "\n"))
+	}
+	all := strings.Join(logs, "\n")
+	if !strings.Contains(all, "generating") || !strings.Contains(all, "user_gen.go +2 -1") {
+		t.Errorf("logs should carry the output and the diff:\n%s", all)
+	}
+
+	// The server recorder sees the same edit after the wasm one
+	logs = nil
+	if err := h.Generate("models/user.go"); err != nil || len(logs) != 0 {
+		t.Errorf("unchanged file should not regenerate: %v %q", err, logs)
+	}
+	// Generated files carry no directive of their own
+	if err := h.Generate("models/user_gen.go"); err != nil || len(logs) != 0 {
+		t.Errorf("generated file: %v %q", err, logs)
+	}
+
+	logs = nil
+	model("echo broken; exit 4")
+	err := h.Generate("models/user.go")
+	if err == nil || !strings.HasPrefix(h.Value(), "⚠ go generate: models/user.go") || !strings.Contains(strings.Join(logs, "\n"), "broken") {
+		t.Fatalf("a failing generator should block the build: %v, value %q, logs %q", err, h.Value(), logs)
+	}
+	logs = nil
+	if again := h.Generate("models/user.go"); again == nil || len(logs) != 0 {
+		t.Errorf("the failure is reported again without re-running: %v %q", again, logs)
+	}
+
+	model("true")
+	if err := h.Generate("models/user.go"); err != nil || h.Value() != "none" {
+		t.Errorf("fixed generator: %v, value %q", err, h.Value())
+	}
+	if !strings.Contains(strings.Join(logs, "\n"), "up to date") {
+		t.Errorf("logs = %q", logs)
+	}
+}
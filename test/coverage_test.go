@@ -0,0 +1,97 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/app"
+)
+
+func TestCoverage_MergesTargetsAndReportsUncoveredLines(t *testing.T) {
+	db := newBudgetDB(t, nil)
+	file := filepath.Join(t.TempDir(), "deploy", "coverage.out")
+	c := app.NewCoverage(db, file)
+	var logs []string
+	c.SetLog(func(msg ...any) { logs = append(logs, strings.TrimSpace(fmt.Sprintln(msg...))) })
+
+	err := c.Record(app.TestTargetServer, []byte(`mode: set
+example.com/m/models/user.go:3.20,5.2 2 1
+example.com/m/models/user.go:7.20,9.10 1 0
+example.com/m/models/user.go:9.10,12.2 2 0
+example.com/m/models/user.go:14.1,15.2 1 0
+example.com/m/web/ui.go:3.1,4.2 4 0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc, err := c.File("models/user.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fc.Stmts != 6 || fc.Covered != 2 || fc.Percent != 33.3 || fmt.Sprint(fc.Uncovered) != "[{7 12} {14 15}]" {
+		t.Errorf("user.go = %+v", fc)
+	}
+
+	// A wasm run covering other blocks adds up; re-testing replaces the package
+	c.Record(app.TestTargetWasm, []byte("mode: set\nexample.com/m/models/user.go:14.1,15.2 1 3\n"))
+	if fc, _ := c.File("example.com/m/models/user.go"); fc.Covered != 3 || fmt.Sprint(fc.Uncovered) != "[{7 12}]" {
+		t.Errorf("merged = %+v", fc)
+	}
+	c.Record(app.TestTargetServer, []byte("mode: set\nexample.com/m/models/user.go:3.20,5.2 2 1\nexample.com/m/models/user.go:7.20,9.10 1 1\nexample.com/m/models/user.go:9.10,12.2 2 0\nexample.com/m/models/user.go:14.1,15.2 1 0\n"))
+	pkgs := c.Packages()
+	if len(pkgs) != 2 || pkgs[0].Package != "example.com/m/models" || pkgs[0].Percent != 66.7 || pkgs[0].Delta != 16.7 {
+		t.Fatalf("packages = %+v", pkgs)
+	}
+	if fc, _ := c.File("models/user.go"); fmt.Sprint(fc.Uncovered) != "[{10 12}]" {
+		t.Errorf("line 9 is shared with a covered block: %+v", fc.Uncovered)
+	}
+	if !strings.Contains(strings.Join(logs, "\n"), "example.com/m/models 66.7% (+16.7)") {
+		t.Errorf("logs = %q", logs)
+	}
+	if _, err := c.File("models/none.go"); err == nil {
+		t.Error("unknown files should fail")
+	}
+
+	// The merged profile and the summary survive a restart
+	if data, _ := os.ReadFile(file); !strings.HasPrefix(string(data), "mode: set\n") {
+		t.Errorf("coverage.out = %q", data)
+	}
+	if v, _ := db.Get(app.StoreKeyCoverageSummary); v != "example.com/m/models:66.7,example.com/m/web:0.0" {
+		t.Errorf("summary = %q", v)
+	}
+	reopened := app.NewCoverage(db, file)
+	if got := reopened.Packages(); len(got) != 2 || got[0].Percent != 66.7 || reopened.Label() != "Coverage 40.0%" {
+		t.Errorf("reopened = %+v, label %q", got, reopened.Label())
+	}
+}
+
+func TestTestRunner_CollectsCoverage(t *testing.T) {
+	dir := newTestModule(t)
+	r := app.NewTestRunner(nil, dir, nil)
+	r.SetCoverage(app.NewCoverage(nil, filepath.Join(dir, "deploy", "coverage.out")))
+
+	if _, err := r.Run([]string{"./a", "./c"}, "", app.TestTargetServer); err != nil {
+		t.Fatal(err)
+	}
+	fc, err := r.Coverage().File("a/a.go")
+	if err != nil || fc.Percent != 100 {
+		t.Fatalf("a.go = %+v, %v", fc, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "deploy", "coverage.out")); err != nil {
+		t.Error(err)
+	}
+
+	// A -run filter would understate coverage: it is not recorded
+	os.WriteFile(filepath.Join(dir, "a", "a.go"), []byte("package a\n\nfunc Two() int { return 2 }\n\nfunc Three() int { return 3 }\n"), 0644)
+	r.Run([]string{"./a"}, "TestTwo", app.TestTargetServer)
+	if fc, _ := r.Coverage().File("a/a.go"); fc.Percent != 100 {
+		t.Errorf("filtered run recorded: %+v", fc)
+	}
+	r.Run([]string{"./a"}, "", app.TestTargetServer)
+	if fc, _ := r.Coverage().File("a/a.go"); fc.Percent != 50 || fmt.Sprint(fc.Uncovered) != "[{5 5}]" {
+		t.Errorf("a.go = %+v", fc)
+	}
+}
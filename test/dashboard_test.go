@@ -0,0 +1,45 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/app/dashboard"
+)
+
+func TestDashboard_ServesWasmClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /dashboard/", http.StripPrefix("/dashboard", dashboard.Handler()))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// The generated files are committed: a go install'ed daemon embeds them
+	cases := []struct {
+		path, contentType, contains string
+	}{
+		{"/dashboard/", "text/html", "script.js"},
+		{"/dashboard/script.js", "javascript", `"client.wasm"`},
+		{"/dashboard/client.wasm", "application/wasm", "\x00asm"},
+	}
+	for _, c := range cases {
+		resp, err := http.Get(srv.URL + c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: status %d", c.path, resp.StatusCode)
+			continue
+		}
+		if ct := resp.Header.Get("Content-Type"); !strings.Contains(ct, c.contentType) {
+			t.Errorf("%s: Content-Type %q, want %q", c.path, ct, c.contentType)
+		}
+		if !strings.Contains(string(body), c.contains) {
+			t.Errorf("%s: body does not contain %q", c.path, c.contains)
+		}
+	}
+}
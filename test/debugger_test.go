@@ -0,0 +1,296 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/app"
+)
+
+// fakeDelve answers the subset of Delve's JSON-RPC API v2 the debugger uses.
+type fakeDelve struct {
+	mu          sync.Mutex
+	root        string
+	breakpoints []map[string]any
+	commands    []string
+	locals      string // Cfg and Scope of the last ListLocalVars, as JSON
+}
+
+type RPCServer struct{ d *fakeDelve }
+
+func (s *RPCServer) CreateBreakpoint(in struct{ Breakpoint map[string]any }, out *struct{ Breakpoint map[string]any }) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	bp := in.Breakpoint
+	bp["id"] = len(s.d.breakpoints) + 1
+	s.d.breakpoints = append(s.d.breakpoints, bp)
+	out.Breakpoint = bp
+	return nil
+}
+
+func (s *RPCServer) ListBreakpoints(in struct{ All bool }, out *struct{ Breakpoints []map[string]any }) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	out.Breakpoints = append([]map[string]any{{"id": -1, "file": "<autogenerated>"}}, s.d.breakpoints...)
+	return nil
+}
+
+func (s *RPCServer) ClearBreakpoint(in struct{ Id int }, out *struct{ Breakpoint map[string]any }) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	for i, bp := range s.d.breakpoints {
+		if bp["id"] == float64(in.Id) || bp["id"] == in.Id {
+			s.d.breakpoints = append(s.d.breakpoints[:i], s.d.breakpoints[i+1:]...)
+			return nil
+		}
+	}
+	return rpc.ServerError("no breakpoint with id")
+}
+
+func (s *RPCServer) Command(in struct {
+	Name string `json:"name"`
+}, out *struct{ State map[string]any }) error {
+	s.d.commands = append(s.d.commands, in.Name)
+	return nil
+}
+
+func (s *RPCServer) State(in struct{ NonBlocking bool }, out *struct{ State map[string]any }) error {
+	out.State = map[string]any{
+		"Running":       false,
+		"currentThread": map[string]any{"goroutineID": 18, "breakPoint": map[string]any{"id": 1}},
+	}
+	return nil
+}
+
+func (s *RPCServer) Stacktrace(in struct {
+	Id    int64
+	Depth int
+}, out *struct{ Locations []map[string]any }) error {
+	if in.Id != 18 {
+		return rpc.ServerError("unknown goroutine")
+	}
+	out.Locations = []map[string]any{
+		{"file": filepath.Join(s.d.root, "web", "server.go"), "line": 25, "function": map[string]any{"name": "main.handler"}},
+		{"file": "/usr/local/go/src/net/http/server.go", "line": 2166, "function": map[string]any{"name": "net/http.HandlerFunc.ServeHTTP"}},
+	}
+	return nil
+}
+
+func (s *RPCServer) ListFunctionArgs(in json.RawMessage, out *struct{ Args []map[string]any }) error {
+	out.Args = []map[string]any{{"name": "r", "type": "*net/http.Request", "children": []map[string]any{{"name": "Method", "type": "string", "value": "GET"}}}}
+	return nil
+}
+
+func (s *RPCServer) ListLocalVars(in json.RawMessage, out *struct{ Variables []map[string]any }) error {
+	s.d.locals = string(in)
+	out.Variables = []map[string]any{{"name": "n", "type": "int", "value": "3"}}
+	return nil
+}
+
+// startFakeDelve serves the fake on a free port and points the debugger at it.
+func startFakeDelve(t *testing.T, root string) (*fakeDelve, app.DB) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	fake := &fakeDelve{root: root}
+	srv := rpc.NewServer()
+	if err := srv.Register(&RPCServer{fake}); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return fake, newBudgetDB(t, map[string]string{app.StoreKeyDebuggerPort: port})
+}
+
+func TestDebugger_Breakpoints(t *testing.T) {
+	root := t.TempDir()
+	fake, db := startFakeDelve(t, root)
+	d := app.NewDebugger(db, root)
+
+	bp, err := d.SetBreakpoint("web/server.go", 25, `r.Method == "POST"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bp.ID != 1 || bp.File != "web/server.go" || bp.Cond != `r.Method == "POST"` {
+		t.Errorf("breakpoint = %+v", bp)
+	}
+	// Delve gets absolute paths
+	if fake.breakpoints[0]["file"] != filepath.Join(root, "web", "server.go") {
+		t.Errorf("sent file %v", fake.breakpoints[0]["file"])
+	}
+	list, err := d.Breakpoints()
+	if err != nil || len(list) != 1 || list[0].Line != 25 {
+		t.Fatalf("internal breakpoints must be hidden: %+v %v", list, err)
+	}
+	if err := d.ClearBreakpoint(1); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := d.Breakpoints(); len(list) != 0 {
+		t.Errorf("not cleared: %+v", list)
+	}
+}
+
+func TestDebugger_StackAndControl(t *testing.T) {
+	root := t.TempDir()
+	fake, db := startFakeDelve(t, root)
+	d := app.NewDebugger(db, root)
+
+	st, err := d.Stack(0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Running || st.Goroutine != 18 || st.Breakpoint != 1 || st.File != "web/server.go" || st.Line != 25 || st.Function != "main.handler" {
+		t.Errorf("state = %+v", st)
+	}
+	if len(st.Frames) != 2 || st.Frames[1].File != "/usr/local/go/src/net/http/server.go" {
+		t.Errorf("frames = %+v", st.Frames)
+	}
+	if len(st.Args) != 1 || st.Args[0].Children[0].Value != "GET" || len(st.Locals) != 1 || st.Locals[0].Value != "3" {
+		t.Errorf("args %+v locals %+v", st.Args, st.Locals)
+	}
+	if !strings.Contains(fake.locals, `"GoroutineID":18`) || !strings.Contains(fake.locals, `"MaxStringLen":256`) {
+		t.Errorf("ListLocalVars request = %s", fake.locals)
+	}
+
+	if _, err := d.Control("stepout"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Control("jump"); err == nil {
+		t.Error("unknown action accepted")
+	}
+	if strings.Join(fake.commands, ",") != "stepOut" {
+		t.Errorf("commands = %q", fake.commands)
+	}
+}
+
+func TestDebugger_Toggle(t *testing.T) {
+	db := newBudgetDB(t, nil)
+	d := app.NewDebugger(db, t.TempDir())
+	t.Setenv("PATH", t.TempDir()) // no dlv: enabling only logs how to install it
+	var logs []string
+	d.SetLog(func(msg ...any) { logs = append(logs, strings.TrimSpace(fmt.Sprintln(msg...))) })
+	changes := 0
+	d.SetOnChange(func() { changes++ })
+
+	if d.Value() != "Debug:F" || d.Addr() != "127.0.0.1:2345" {
+		t.Fatalf("defaults %q %q", d.Value(), d.Addr())
+	}
+	d.Change("Debug:T")
+	if d.Value() != "Debug:T" || changes != 1 || d.Label() != "Delve 127.0.0.1:2345" {
+		t.Errorf("value %q, label %q, %d changes", d.Value(), d.Label(), changes)
+	}
+	if len(logs) == 0 || !strings.Contains(logs[0], app.DlvInstall) {
+		t.Errorf("logs = %q", logs)
+	}
+	if v, _ := db.Get(app.StoreKeyDebugger); v != "true" || !app.NewDebugger(db, t.TempDir()).Enabled() {
+		t.Errorf("not persisted: %q", v)
+	}
+	// Without dlv the server runs as is
+	if bin, args := d.RunHook("/srv/server", []string{"-port=6060"}); bin != "/srv/server" || strings.Join(args, " ") != "-port=6060" {
+		t.Errorf("run hook without dlv: %q %q", bin, args)
+	}
+	d.Change("Debug:F")
+	if d.Enabled() || changes != 2 {
+		t.Errorf("still enabled, %d changes", changes)
+	}
+}
+
+func TestDebugger_RunHookRestoresBreakpoints(t *testing.T) {
+	root := t.TempDir()
+	fake, db := startFakeDelve(t, root)
+	db.Set(app.StoreKeyDebugger, "true")
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, "dlv"), []byte("#!/bin/sh\n"), 0755)
+	t.Setenv("PATH", bin)
+	d := app.NewDebugger(db, root)
+
+	if _, err := d.SetBreakpoint("web/server.go", 25, ""); err != nil {
+		t.Fatal(err)
+	}
+	// Each restart starts a new Delve, without the breakpoints of the last one
+	fake.mu.Lock()
+	fake.breakpoints = nil
+	fake.mu.Unlock()
+	name, args := d.RunHook("/srv/server", []string{"-port=6060"})
+	want := "exec /srv/server --headless --listen=" + d.Addr() + " --api-version=2 --accept-multiclient --continue -- -port=6060"
+	if name != "dlv" || strings.Join(args, " ") != want {
+		t.Fatalf("run hook: %s %q", name, args)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fake.mu.Lock()
+		n := len(fake.breakpoints)
+		fake.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("breakpoints not restored: %d", n)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := d.ClearBreakpoint(1); err != nil {
+		t.Fatal(err)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.breakpoints) != 0 {
+		t.Errorf("cleared breakpoint left in Delve: %v", fake.breakpoints)
+	}
+}
+
+func TestDebugger_WriteLaunchConfigs(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, ".vscode"), 0755)
+	os.MkdirAll(filepath.Join(root, ".idea"), 0755)
+	launch := filepath.Join(root, ".vscode", "launch.json")
+	os.WriteFile(launch, []byte(`{"version":"0.2.0","configurations":[{"name":"mine","type":"node"},{"name":"tinywasm: attach server (Delve)","port":1}]}`), 0644)
+
+	d := app.NewDebugger(newBudgetDB(t, map[string]string{app.StoreKeyDebuggerPort: "40000"}), root)
+	if err := d.WriteLaunchConfigs(); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Configurations []map[string]any
+	}
+	data, _ := os.ReadFile(launch)
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Configurations) != 2 || got.Configurations[0]["name"] != "mine" {
+		t.Fatalf("configurations = %+v", got.Configurations)
+	}
+	if c := got.Configurations[1]; c["name"] != app.DebugLaunchName || c["mode"] != "remote" || c["port"] != float64(40000) || c["host"] != "127.0.0.1" {
+		t.Errorf("attach config = %+v", c)
+	}
+	idea, err := os.ReadFile(filepath.Join(root, ".idea", "runConfigurations", "tinywasm_Delve.xml"))
+	if err != nil || !strings.Contains(string(idea), `port="40000"`) {
+		t.Errorf("GoLand config: %s %v", idea, err)
+	}
+
+	// JSONC written by hand is left alone
+	os.WriteFile(launch, []byte("{\n  // mine\n}"), 0644)
+	if err := d.WriteLaunchConfigs(); err == nil {
+		t.Error("commented launch.json overwritten")
+	}
+}
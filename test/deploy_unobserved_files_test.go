@@ -85,7 +85,7 @@ export default {
 
 	// Verify goflare app.Handler exists and has correct UnobservedFiles
 	if h == nil {
-		t.Fatal("ActiveHandler should be set")
+		t.Fatal("Handler should be set")
 	}
 	if h.DeployManager == nil {
 		t.Fatal("DeployManager should be initialized")
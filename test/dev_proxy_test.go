@@ -0,0 +1,139 @@
+package test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/app"
+)
+
+func TestDevProxy_ForwardsMatchingRoutes(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "api")
+		fmt.Fprintf(w, "%s %s auth=%q cookie=%q host=%s", r.Method, r.URL.RequestURI(),
+			r.Header.Get("Authorization"), r.Header.Get("Cookie"), r.Host)
+	}))
+	defer upstream.Close()
+
+	db := newBudgetDB(t, nil)
+	p := app.NewDevProxy(db)
+	var logs SafeBuffer
+	p.SetLog(func(m ...any) { logs.Write([]byte(fmt.Sprintln(m...))) })
+
+	p.Change("/api " + upstream.URL + " strip set:Authorization:Bearer%20dev del:Cookie resp:Access-Control-Allow-Origin:*")
+	p.Change("/api/slow " + upstream.URL + " delay:50ms")
+	p.Change("/api/down " + upstream.URL + " error:503")
+
+	mux := http.NewServeMux()
+	p.Routes(func(inner *http.ServeMux) {
+		inner.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "index") })
+	})(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	get := func(path string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		req.Header.Set("Cookie", "session=1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp, string(b)
+	}
+
+	host := strings.TrimPrefix(upstream.URL, "http://")
+	resp, body := get("/api/users?page=2")
+	if want := `GET /users?page=2 auth="Bearer dev" cookie="" host=` + host; body != want {
+		t.Errorf("proxied: %q, want %q", body, want)
+	}
+	if resp.Header.Get("Access-Control-Allow-Origin") != "*" || resp.Header.Get("X-Upstream") != "api" {
+		t.Errorf("response headers: %v", resp.Header)
+	}
+
+	start := time.Now()
+	if _, body := get("/api/slow/x"); !strings.HasPrefix(body, "GET /api/slow/x ") || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("delayed: %q after %s", body, time.Since(start))
+	}
+	if resp, body := get("/api/down"); resp.StatusCode != 503 || !strings.Contains(body, "injected") {
+		t.Errorf("injected: %d %q", resp.StatusCode, body)
+	}
+	if _, body := get("/apix"); body != "index" {
+		t.Errorf("fallthrough: %q", body)
+	}
+
+	out := logs.String()
+	for _, want := range []string{"GET /api/users?page=2 → " + upstream.URL + "/users 200", "GET /api/down → " + upstream.URL + "/api/down 503", "(injected)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("logs missing %q:\n%s", want, out)
+		}
+	}
+
+	// The rules survive a restart, '=' and spaces included
+	p.Change("/auth " + upstream.URL + "/v1?x=1 set:X-Debug:a=b error:502@25%")
+	reloaded := app.NewDevProxy(db)
+	if got, want := reloaded.Value(), "/api/down→"+host+" /api/slow→"+host+" /auth→"+host+" /api→"+host; got != want {
+		t.Errorf("value = %q, want %q", got, want)
+	}
+	for _, r := range reloaded.Rules() {
+		if r.Prefix == "/auth" && (r.SetHeaders["X-Debug"] != "a=b" || r.ErrorRate != 0.25 || r.ErrorStatus != 502) {
+			t.Errorf("auth rule = %+v", r)
+		}
+		if r.Prefix == "/api" && r.SetHeaders["Authorization"] != "Bearer dev" {
+			t.Errorf("api rule = %+v", r)
+		}
+	}
+
+	p.Change("-/api")
+	if _, body := get("/api/users"); body != "index" {
+		t.Errorf("after removal: %q", body)
+	}
+}
+
+func TestDevProxy_ParseErrors(t *testing.T) {
+	for _, rule := range []string{
+		"api http://localhost:8080",
+		"/api localhost:8080",
+		"/api http://localhost:8080 delay:soon",
+		"/api http://localhost:8080 error:200",
+		"/api http://localhost:8080 error:503@0%",
+		"/api http://localhost:8080 rewrite",
+	} {
+		if _, err := app.ParseProxyRule(rule); err == nil {
+			t.Errorf("%q accepted", rule)
+		}
+	}
+
+	r, err := app.ParseProxyRule("/api/ http://localhost:8080/ strip resp:Cache-Control:no-store error:503@12.5%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.String(); got != "/api http://localhost:8080 strip resp:Cache-Control:no-store error:503@12.5%" {
+		t.Errorf("String() = %q", got)
+	}
+
+	p := app.NewDevProxy(newBudgetDB(t, nil))
+	var logs SafeBuffer
+	p.SetLog(func(m ...any) { logs.Write([]byte(fmt.Sprintln(m...))) })
+	p.Change("/api nowhere")
+	if p.Value() != "-" || !strings.Contains(logs.String(), "invalid proxy upstream") {
+		t.Errorf("value %q, logs %q", p.Value(), logs.String())
+	}
+}
+
+func TestDevProxy_UnreachableUpstream(t *testing.T) {
+	p := app.NewDevProxy(nil)
+	p.AddRule(app.ProxyRule{Prefix: "/api", Upstream: "http://127.0.0.1:" + freePort()})
+	rec := httptest.NewRecorder()
+	p.Wrap(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest("GET", "/api/x", nil))
+	if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "unreachable") {
+		t.Errorf("%d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,160 @@
+package test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/app"
+)
+
+// edgeWorkerMain speaks the goflare workers binding protocol directly:
+// context.binding.handleRequest returns a Promise of a Response.
+const edgeWorkerMain = `package main
+
+import "syscall/js"
+
+const version = "v1"
+
+func await(p js.Value) js.Value {
+	ch := make(chan js.Value, 1)
+	then := js.FuncOf(func(_ js.Value, args []js.Value) any { ch <- args[0]; return nil })
+	defer then.Release()
+	p.Call("then", then)
+	return <-ch
+}
+
+func main() {
+	ctx := js.Global().Get("context")
+	env := ctx.Get("env")
+	ctx.Get("binding").Set("handleRequest", js.FuncOf(func(_ js.Value, args []js.Value) any {
+		req := args[0]
+		return js.Global().Get("Promise").New(js.FuncOf(func(_ js.Value, p []js.Value) any {
+			resolve := p[0]
+			go func() {
+				path := js.Global().Get("URL").New(req.Get("url")).Get("pathname").String()
+				if body := await(req.Call("text")).String(); body != "" {
+					await(env.Get("CACHE").Call("put", "greeting", body))
+				}
+				stored := await(env.Get("CACHE").Call("get", "greeting"))
+				println("handled", path)
+				text := version + " " + req.Get("method").String() + " " + path + " " + stored.String() + env.Get("SUFFIX").String()
+				resolve.Invoke(js.Global().Get("Response").New(text, map[string]any{"status": 201}))
+			}()
+			return nil
+		}))
+	}))
+	js.Global().Get("workers").Call("ready")
+	select {}
+}
+`
+
+func TestEdgeEmulator_ServesWorkerWithBindings(t *testing.T) {
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("node not installed")
+	}
+	dir := t.TempDir()
+	mainPath := filepath.Join(dir, "cmd", "edgeworker", "main.go")
+	os.MkdirAll(filepath.Dir(mainPath), 0755)
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module edgeapp\n\ngo 1.22\n"), 0644)
+	os.WriteFile(mainPath, []byte(edgeWorkerMain), 0644)
+
+	db := newBudgetDB(t, map[string]string{
+		app.StoreKeyEdgeVars: "SUFFIX",
+		"SUFFIX":             "!",
+		app.StoreKeyEdgeKV:   "CACHE",
+	})
+	exit := make(chan bool)
+	defer close(exit)
+	e := app.NewEdgeEmulator(db, dir, "cmd/edgeworker", filepath.Join(dir, "deploy", "edgeworker", "dev"), exit)
+	var logs SafeBuffer
+	e.SetLog(func(m ...any) { logs.Write([]byte(fmt.Sprintln(m...))) })
+	e.SetPort(freePort())
+
+	e.Change("Edge Dev:T")
+	if !e.Enabled() || e.Value() != "Edge Dev:T" || !strings.HasPrefix(e.Label(), "Edge http://localhost:") {
+		t.Fatalf("not started: %q\n%s", e.Label(), logs.String())
+	}
+	if v, _ := db.Get(app.StoreKeyEdgeEmulator); v != "true" {
+		t.Errorf("not persisted: %q", v)
+	}
+
+	do := func(method, path, body string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, e.URL()+path, strings.NewReader(body))
+		resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	// '=' ';' and newlines survive the .env line format
+	if code, body := do("POST", "/hello", "hola=mundo;\nx"); code != 201 || body != "v1 POST /hello hola=mundo;\nx!" {
+		t.Errorf("worker: %d %q", code, body)
+	}
+	if got := e.KV("CACHE")["greeting"]; got != "hola=mundo;\nx" {
+		t.Errorf("kv = %q", got)
+	}
+	if !strings.Contains(logs.String(), "POST /hello 201") || !strings.Contains(logs.String(), "handled /hello") {
+		t.Errorf("logs = %s", logs.String())
+	}
+
+	// A saved worker source is rebuilt and served without restarting the host
+	os.WriteFile(mainPath, []byte(strings.Replace(edgeWorkerMain, `"v1"`, `"v2"`, 1)), 0644)
+	if err := e.NewFileEvent("main.go", ".go", mainPath, "write"); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := do("GET", "/again", ""); code != 201 || body != "v2 GET /again hola=mundo;\nx!" {
+		t.Errorf("after reload: %d %q", code, body)
+	}
+
+	// A crashed host is restarted behind the same dev port
+	if err := exec.Command("pkill", "-f", "node host.mjs").Run(); err != nil {
+		t.Fatal("pkill:", err)
+	}
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		code, body := do("GET", "/back", "")
+		if code == 201 && body == "v2 GET /back hola=mundo;\nx!" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("host not restarted: %d %q\n%s", code, body, logs.String())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !strings.Contains(logs.String(), "Edge host exited") {
+		t.Errorf("crash not logged: %s", logs.String())
+	}
+
+	e.Change("Edge Dev:F")
+	if _, err := http.Get(e.URL()); err == nil {
+		t.Error("dev port still open")
+	}
+}
+
+func TestEdgeEmulator_KVStore(t *testing.T) {
+	db := newBudgetDB(t, nil)
+	e := app.NewEdgeEmulator(db, t.TempDir(), "cmd/edgeworker", t.TempDir(), nil)
+	e.KVPut("SESSIONS", "user:1", "a=b")
+	e.KVPut("SESSIONS", "user;2", "c")
+	e.KVDelete("SESSIONS", "user;2")
+	if kv := e.KV("SESSIONS"); len(kv) != 1 || kv["user:1"] != "a=b" {
+		t.Errorf("kv = %q", kv)
+	}
+	if err := e.KVPut("bad-ns", "k", "v"); err == nil {
+		t.Error("invalid namespace accepted")
+	}
+	if err := e.Start(); err != nil || e.Enabled() {
+		t.Errorf("disabled emulator started: %v", err)
+	}
+}
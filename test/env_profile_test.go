@@ -0,0 +1,182 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/app"
+	"github.com/tinywasm/app/apptest"
+	"github.com/tinywasm/kvdb"
+)
+
+func TestEnvProfiles_StoreRoundTrip(t *testing.T) {
+	store := app.NewMemoryStore()
+	db, _ := kvdb.New(".env", nil, store)
+	e := app.NewEnvProfiles(db)
+	// '=' and newlines would break the .env line format
+	dsn := "postgres://u:p@localhost/app?sslmode=disable&x=1"
+	if err := e.Set("staging-local", "DATABASE_URL", dsn); err != nil {
+		t.Fatal(err)
+	}
+	e.Set("staging-local", "GREETING", "hola\nmundo; a:b")
+	e.SetArgs("staging-local", []string{"-log_level=debug", "-title=My App"})
+
+	reloaded, _ := kvdb.New(".env", nil, store)
+	e2 := app.NewEnvProfiles(reloaded)
+	vars := e2.Vars("staging-local")
+	if vars["DATABASE_URL"] != dsn || vars["GREETING"] != "hola\nmundo; a:b" {
+		t.Errorf("vars = %q", vars)
+	}
+	if args := e2.Args("staging-local"); strings.Join(args, "|") != "-log_level=debug|-title=My App" {
+		t.Errorf("args = %q", args)
+	}
+	if strings.Join(e2.Profiles(), ",") != "dev,staging-local,test" {
+		t.Errorf("profiles = %q", e2.Profiles())
+	}
+	if err := e.Set("dev", "BAD-NAME", "x"); err == nil {
+		t.Error("invalid variable name accepted")
+	}
+}
+
+func TestEnvProfiles_SwitchChangesEnvAndRestarts(t *testing.T) {
+	t.Setenv("TWENV_SHARED", "from-shell")
+	db := newBudgetDB(t, map[string]string{"STRIPE_KEY": "sk_test_123456"})
+	e := app.NewEnvProfiles(db)
+	restarts := 0
+	e.SetOnChange(func() { restarts++ })
+	e.Set("test", "TWENV_SHARED", "t")
+	e.Set("test", "TWENV_ONLY_TEST", "1")
+	e.Set("test", "STRIPE_API_KEY", "$STRIPE_KEY")
+	e.SetArgs("test", []string{"-seed"})
+	if restarts != 0 || len(e.Env()) != 0 {
+		t.Fatalf("inactive profile applied: %d restarts, %q", restarts, e.Env())
+	}
+
+	e.Change("test")
+	if restarts != 1 || e.Value() != "test" || strings.Join(e.RunArgs(), " ") != "-seed" {
+		t.Errorf("switch: %d restarts, %q %q", restarts, e.Value(), e.RunArgs())
+	}
+	env := e.Env()
+	if env["TWENV_SHARED"] != "t" || env["TWENV_ONLY_TEST"] != "1" || env["STRIPE_API_KEY"] != "sk_test_123456" {
+		t.Errorf("env = %q", env)
+	}
+	if v, _ := db.Get(app.StoreKeyEnvProfile); v != "test" {
+		t.Errorf("not persisted: %q", v)
+	}
+
+	e.Change("TWENV_ONLY_TEST=2") // sets a variable of the active profile
+	if e.Env()["TWENV_ONLY_TEST"] != "2" || restarts != 2 {
+		t.Errorf("set: %q, %d restarts", e.Env()["TWENV_ONLY_TEST"], restarts)
+	}
+
+	// The variables are the server's alone
+	if _, set := os.LookupEnv("TWENV_ONLY_TEST"); set || os.Getenv("TWENV_SHARED") != "from-shell" {
+		t.Errorf("tinywasm environment changed: %q", os.Getenv("TWENV_SHARED"))
+	}
+	e.Change("dev")
+	if len(e.Env()) != 0 || e.RunArgs() != nil {
+		t.Errorf("dev: %q %q", e.Env(), e.RunArgs())
+	}
+	if err := e.SetProfile("Prod!"); err == nil {
+		t.Error("invalid profile accepted")
+	}
+}
+
+func TestEnvProfiles_MasksSecrets(t *testing.T) {
+	for _, name := range []string{"SESSION_SECRET", "DATABASE_URL", "PORT_HINT"} {
+		t.Setenv(name, "") // restored after the test
+	}
+	db := newBudgetDB(t, map[string]string{app.StoreKeyEnvSecrets: "DATABASE_URL"})
+	e := app.NewEnvProfiles(db)
+	e.Set("dev", "SESSION_SECRET", "s3cr3t-value")
+	e.Set("dev", "DATABASE_URL", "postgres://u:hunter2@db/app")
+	e.Set("dev", "PORT_HINT", "8080")
+
+	var dev app.EnvProfile
+	for _, p := range e.State() {
+		if p.Name == "dev" {
+			dev = p
+		}
+	}
+	if !dev.Active || dev.Vars["SESSION_SECRET"] != "***" || dev.Vars["DATABASE_URL"] != "***" || dev.Vars["PORT_HINT"] != "8080" {
+		t.Errorf("state = %+v", dev)
+	}
+	msg := e.MaskMessage("connecting to postgres://u:hunter2@db/app with s3cr3t-value", errors.New("auth s3cr3t-value rejected"), 8080)
+	if msg[0] != "connecting to *** with ***" || msg[1] != "auth *** rejected" || msg[2] != 8080 {
+		t.Errorf("masked = %q", msg)
+	}
+}
+
+func TestEnvProfiles_ActionResultMasksSecrets(t *testing.T) {
+	t.Setenv("DB_PASSWORD", "")
+	e := app.NewEnvProfiles(newBudgetDB(t, nil))
+	tui := app.NewHeadlessTUI(func(msg ...any) {})
+	tui.AddHandler(e, "#00DD00", &headlessSection{Title: "BUILD"})
+
+	a, ok := tui.StartAction("EnvProfile", "DB_PASSWORD=hunter2")
+	if !ok {
+		t.Fatal("StartAction should find EnvProfile")
+	}
+	res := a.Wait(2 * time.Second)
+	if res.Status != app.ActionDone || res.Value != "DB_PASSWORD=***" {
+		t.Errorf("result: %s %q", res.Status, res.Value)
+	}
+	if got, _ := tui.Actions.Get(res.ID); got.Result().Value != "DB_PASSWORD=***" {
+		t.Errorf("tracked value = %q", got.Result().Value)
+	}
+	if e.Vars("dev")["DB_PASSWORD"] != "hunter2" {
+		t.Errorf("the handler got %q", e.Vars("dev")["DB_PASSWORD"])
+	}
+	if got := e.RedactActionValue("PORT=8080"); got != "PORT=8080" {
+		t.Errorf("plain variable redacted: %q", got)
+	}
+}
+
+// hookedServer is a server with the optional SetEnv and SetRunHook setters.
+type hookedServer struct {
+	*apptest.MemoryServer
+	env     func() map[string]string
+	runHook func(bin string, args []string) (string, []string)
+}
+
+func (s *hookedServer) SetEnv(fn func() map[string]string) { s.env = fn }
+
+func (s *hookedServer) SetRunHook(fn func(bin string, args []string) (string, []string)) {
+	s.runHook = fn
+}
+
+func TestInitBuildHandlers_ServerEnvAndRunHook(t *testing.T) {
+	t.Setenv("TWENV_GREETING", "")
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module testapp\ngo 1.21\n"), 0644)
+
+	h := NewTestHandler(tmpDir)
+	h.Browser = &MockBrowser{}
+	h.Tui = newUiMockTest()
+	h.GitHandler = &MockGitClient{}
+	h.GoModHandler = &MockGoModHandler{}
+	h.DB = &MockDB{data: map[string]string{}}
+	srv := &hookedServer{MemoryServer: apptest.NewMemoryServer()}
+	h.SetServerFactory(func(chan bool, app.TuiInterface, app.BrowserInterface) app.ServerInterface { return srv })
+
+	h.InitBuildHandlers()
+
+	if srv.env == nil || srv.runHook == nil {
+		t.Fatalf("env %v, run hook %v", srv.env != nil, srv.runHook != nil)
+	}
+	h.EnvProfiles.Set(h.EnvProfiles.Profile(), "TWENV_GREETING", "hola")
+	if got := srv.env()["TWENV_GREETING"]; got != "hola" {
+		t.Errorf("server env = %q", got)
+	}
+	if os.Getenv("TWENV_GREETING") != "" {
+		t.Error("the variable leaked into the tinywasm environment")
+	}
+	// Debugging off: the binary runs as is
+	if bin, args := srv.runHook("/srv/server", []string{"-port=6060"}); bin != "/srv/server" || strings.Join(args, " ") != "-port=6060" {
+		t.Errorf("run hook: %q %q", bin, args)
+	}
+}
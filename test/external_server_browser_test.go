@@ -91,13 +91,12 @@ func main() {
 		t.Fatal(err)
 	}
 
-	// IMPORTANT: Disable TestMode so AutoStart actually runs
-	originalTestMode := app.TestMode
-	app.TestMode = false
-	defer func() { app.TestMode = originalTestMode }()
+	// Re-enable browser auto-start so OpenBrowser calls can be observed
+	opts := app.TestOptions(tmp)
+	opts.DisableBrowserAutoStart = false
 
 	// Start app - should detect external server and switch to external mode
-	ctx := startTestApp(t, tmp)
+	ctx := startTestApp(t, tmp, opts)
 	defer ctx.Cleanup()
 
 	// Wait for external server to compile and start + browser to open
@@ -173,11 +172,10 @@ func main() {}
 
 	// NO server.go file = internal server mode
 
-	originalTestMode := app.TestMode
-	app.TestMode = false
-	defer func() { app.TestMode = originalTestMode }()
+	opts := app.TestOptions(tmp)
+	opts.DisableBrowserAutoStart = false
 
-	ctx := startTestApp(t, tmp)
+	ctx := startTestApp(t, tmp, opts)
 	defer ctx.Cleanup()
 
 	// Wait for browser to open
@@ -115,7 +115,7 @@ func main() {
 		time.Sleep(50 * time.Millisecond)
 	}
 
-	h := app.GetActiveHandler()
+	h := ctx.Handler
 	if h == nil || h.WasmClient == nil {
 		t.Fatal("WasmClient not initialized")
 	}
@@ -99,12 +99,12 @@ func main() {
 	defer ctx.Cleanup()
 
 	// Wait for initialization
-	Watcher := app.WaitWatcherReady(6 * time.Second)
+	Watcher := app.WaitWatcherReady(ctx.Handler.ID(), 6*time.Second)
 	if Watcher == nil {
 		t.Fatal("Watcher is nil")
 	}
 
-	h := app.GetActiveHandler()
+	h := ctx.Handler
 	if h == nil || h.WasmClient == nil {
 		t.Fatal("WasmClient not initialized")
 	}
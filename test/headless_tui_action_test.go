@@ -0,0 +1,207 @@
+package test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/app"
+)
+
+// modeHandler mimics the WASM size-mode handler: it validates modes and logs
+// failures instead of returning them.
+type modeHandler struct {
+	mu    sync.Mutex
+	value string
+	log   func(...any)
+}
+
+func (h *modeHandler) Name() string  { return "WASM" }
+func (h *modeHandler) Label() string { return "Size" }
+func (h *modeHandler) Value() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.value
+}
+func (h *modeHandler) SetLog(f func(...any)) { h.log = f }
+func (h *modeHandler) ValidateMode(v string) error {
+	if v != "L" && v != "M" && v != "S" && v != "X" {
+		return errors.New("invalid mode " + v)
+	}
+	return nil
+}
+func (h *modeHandler) Change(v string) {
+	if v == "X" {
+		h.log("Error: compiling in mode X: tinygo not found")
+		return
+	}
+	h.mu.Lock()
+	h.value = v
+	h.mu.Unlock()
+	h.log("Switched to mode " + v)
+}
+
+func newModeTUI() (*app.HeadlessTUI, *modeHandler) {
+	tui := app.NewHeadlessTUI(func(msg ...any) {})
+	h := &modeHandler{value: "L"}
+	tui.AddHandler(h, "#00DD00", &headlessSection{Title: "BUILD"})
+	return tui, h
+}
+
+func TestHeadlessTUI_StartActionReportsNewValue(t *testing.T) {
+	tui, _ := newModeTUI()
+
+	a, ok := tui.StartAction("WASM", "S")
+	if !ok {
+		t.Fatal("StartAction should find WASM")
+	}
+	res := a.Wait(2 * time.Second)
+	if res.Status != app.ActionDone {
+		t.Fatalf("status = %q, want %q (error %q)", res.Status, app.ActionDone, res.Error)
+	}
+	if res.NewValue != "S" {
+		t.Errorf("new_value = %q, want S", res.NewValue)
+	}
+	if len(res.Logs) != 1 || res.Logs[0] != "Switched to mode S" {
+		t.Errorf("logs = %q, want the handler's switch line", res.Logs)
+	}
+	if got, ok := tui.Actions.Get(res.ID); !ok || got != a {
+		t.Errorf("action %s not found in tracker", res.ID)
+	}
+}
+
+func TestHeadlessTUI_StartActionRejectsInvalidMode(t *testing.T) {
+	tui, h := newModeTUI()
+
+	a, _ := tui.StartAction("WASM", "Q")
+	select {
+	case <-a.Done():
+	default:
+		t.Fatal("invalid mode should fail before running the handler")
+	}
+	res := a.Result()
+	if res.Status != app.ActionFailed || res.Error != "invalid mode Q" {
+		t.Errorf("got status %q error %q", res.Status, res.Error)
+	}
+	if res.NewValue != "L" || h.Value() != "L" {
+		t.Errorf("value changed to %q", h.Value())
+	}
+}
+
+func TestHeadlessTUI_StartActionDoesNotGuessFailureFromLogs(t *testing.T) {
+	tui, _ := newModeTUI()
+
+	a, _ := tui.StartAction("WASM", "X")
+	res := a.Wait(2 * time.Second)
+	if res.Status != app.ActionDone || res.Error != "" {
+		t.Fatalf("got status %q error %q, want done: only the handler reports failures", res.Status, res.Error)
+	}
+	if len(res.Logs) != 1 || res.Logs[0] != "Error: compiling in mode X: tinygo not found" {
+		t.Errorf("logs = %q", res.Logs)
+	}
+}
+
+// jobHandler starts background work and reports its outcome through done.
+type jobHandler struct {
+	mu   sync.Mutex
+	log  func(...any)
+	runs map[string]func(error) // value -> done
+}
+
+func (h *jobHandler) Name() string          { return "Job" }
+func (h *jobHandler) Label() string         { return "Run job" }
+func (h *jobHandler) SetLog(f func(...any)) { h.log = f }
+func (h *jobHandler) Execute()              { h.RunAction("", func(error) {}) }
+func (h *jobHandler) RunAction(value string, done func(error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.runs == nil {
+		h.runs = map[string]func(error){}
+	}
+	h.runs[value] = done
+}
+
+// finish completes the run started with value once it has started.
+func (h *jobHandler) finish(t *testing.T, value string, err error) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		h.mu.Lock()
+		done := h.runs[value]
+		h.mu.Unlock()
+		if done != nil {
+			done(err)
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run %q never started", value)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHeadlessTUI_ReporterDecidesCompletion(t *testing.T) {
+	tui := app.NewHeadlessTUI(func(msg ...any) {})
+	h := &jobHandler{}
+	tui.AddHandler(h, "#00DD00", &headlessSection{Title: "BUILD"})
+
+	first, _ := tui.StartAction("Job", "a")
+	second, _ := tui.StartAction("Job", "b")
+	h.finish(t, "b", nil)
+	h.log("compiling")
+
+	// Two actions on one handler are tracked independently
+	if res := second.Wait(2 * time.Second); res.Status != app.ActionDone {
+		t.Fatalf("second status = %q, want done", res.Status)
+	}
+	if res := first.Result(); res.Status != app.ActionPending {
+		t.Fatalf("first status = %q, want pending until the handler reports", res.Status)
+	}
+
+	h.finish(t, "a", errors.New("boom"))
+	res := first.Wait(2 * time.Second)
+	if res.Status != app.ActionFailed || res.Error != "boom" {
+		t.Errorf("got status %q error %q", res.Status, res.Error)
+	}
+	if len(res.Logs) != 1 || res.Logs[0] != "compiling" {
+		t.Errorf("logs = %q, want the line logged while running", res.Logs)
+	}
+}
+
+// fireHandler only starts work; it cannot say when it is over.
+type fireHandler struct{}
+
+func (fireHandler) Name() string  { return "Fire" }
+func (fireHandler) Label() string { return "Fire" }
+func (fireHandler) Execute()      {}
+
+func TestHeadlessTUI_ExecuteWithoutReporterIsDispatched(t *testing.T) {
+	tui := app.NewHeadlessTUI(func(msg ...any) {})
+	tui.AddHandler(fireHandler{}, "#00DD00", &headlessSection{Title: "BUILD"})
+
+	a, _ := tui.StartAction("Fire", "")
+	if res := a.Wait(2 * time.Second); res.Status != app.ActionDispatched {
+		t.Errorf("status = %q, want %q", res.Status, app.ActionDispatched)
+	}
+}
+
+func TestActionTracker_IDsAreUniqueAndBounded(t *testing.T) {
+	tracker := app.NewActionTracker()
+	first := tracker.Run("stop", "", "daemon", func() error { return nil })
+	for i := 0; i < 150; i++ {
+		tracker.Dispatched("key", "")
+	}
+	last := tracker.Run("quit", "", "daemon", func() error { return errors.New("boom") })
+
+	if first.ID() == last.ID() {
+		t.Fatal("action ids must be unique")
+	}
+	if _, ok := tracker.Get(first.ID()); ok {
+		t.Error("oldest action should have been evicted from history")
+	}
+	res := last.Result()
+	if res.Status != app.ActionFailed || res.Error != "boom" {
+		t.Errorf("got status %q error %q", res.Status, res.Error)
+	}
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/app"
+)
+
+// stateHandler is an edit handler whose value can change concurrently with diffs.
+type stateHandler struct {
+	mu    sync.Mutex
+	name  string
+	value string
+}
+
+func (h *stateHandler) Name() string  { return h.name }
+func (h *stateHandler) Label() string { return h.name }
+func (h *stateHandler) Value() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.value
+}
+func (h *stateHandler) Change(v string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.value = v
+}
+
+type stateChange struct {
+	changed []app.StateEntry
+	removed []string
+}
+
+func waitStateChange(t *testing.T, ch <-chan stateChange) stateChange {
+	t.Helper()
+	select {
+	case c := <-ch:
+		return c
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for state change")
+		return stateChange{}
+	}
+}
+
+func TestHeadlessTUI_PublishesOnlyChangedHandlers(t *testing.T) {
+	changes := make(chan stateChange, 8)
+	tui := app.NewHeadlessTUI(func(msg ...any) {})
+	tui.OnStateChange = func(changed []app.StateEntry, removed []string) {
+		changes <- stateChange{changed, removed}
+	}
+
+	mode := &stateHandler{name: "WASM", value: "L"}
+	server := &stateHandler{name: "Server", value: "stopped"}
+	section := &headlessSection{Title: "BUILD"}
+	tui.AddHandler(mode, "#00DD00", section)
+	tui.AddHandler(server, "#0000FF", section)
+
+	// Registration burst is coalesced into one delta carrying both handlers
+	first := waitStateChange(t, changes)
+	if len(first.changed) != 2 {
+		t.Fatalf("expected both handlers in the initial delta, got %+v", first.changed)
+	}
+
+	// A dispatched action refreshes state once it has run
+	if !tui.DispatchAction("WASM", "S") {
+		t.Fatal("DispatchAction should find WASM")
+	}
+	delta := waitStateChange(t, changes)
+	if len(delta.changed) != 1 || delta.changed[0].HandlerName != "WASM" || delta.changed[0].Value != "S" {
+		t.Fatalf("expected only WASM=S in delta, got %+v", delta.changed)
+	}
+
+	// Refreshing without changes publishes nothing
+	tui.RefreshUI()
+	select {
+	case c := <-changes:
+		t.Fatalf("unexpected delta without state change: %+v", c)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestHeadlessTUI_ClearPublishesRemovals(t *testing.T) {
+	changes := make(chan stateChange, 8)
+	tui := app.NewHeadlessTUI(func(msg ...any) {})
+	tui.OnStateChange = func(changed []app.StateEntry, removed []string) {
+		changes <- stateChange{changed, removed}
+	}
+
+	tui.AddHandler(&stateHandler{name: "WASM", value: "L"}, "#00DD00", &headlessSection{Title: "BUILD"})
+	waitStateChange(t, changes)
+
+	// Stopping a project clears its handlers; clients must drop them
+	tui.Clear()
+	c := waitStateChange(t, changes)
+	if len(c.removed) != 1 || c.removed[0] != "WASM" {
+		t.Fatalf("expected WASM to be removed, got %+v", c)
+	}
+	if states := string(tui.GetHandlerStates()); states != "[]" {
+		t.Errorf("expected empty state after Clear, got %s", states)
+	}
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/app"
+)
+
+// newLeakModule writes a module whose client shares api.go with the server
+// without a build tag; api.go pulls net/http and os/exec into the wasm build.
+func newLeakModule(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":          "module example.com/leakdemo\n\ngo 1.22\n",
+		"web/client.go":   "//go:build wasm\n\npackage main\n\nimport \"example.com/leakdemo/shared\"\n\nfunc main() { println(shared.Name()) }\n",
+		"web/server.go":   "//go:build !wasm\n\npackage main\n\nimport \"os/exec\"\n\nfunc main() { exec.Command(\"true\").Run() }\n",
+		"shared/name.go":  "package shared\n\nfunc Name() string { return \"n\" }\n",
+		"shared/api.go":   "package shared\n\nimport (\n\t\"net/http\"\n\t\"os/exec\"\n)\n\nvar _ = http.StatusOK\n\nfunc Run() error { return exec.Command(\"true\").Run() }\n",
+		"shared/views.go": "package shared\n\nimport \"strings\"\n\nvar _ = strings.ToUpper\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestImportAudit_FlagsServerImportsWithChain(t *testing.T) {
+	dir := newLeakModule(t)
+	db := newBudgetDB(t, nil)
+	a := app.NewImportAudit(db, dir, "web")
+	var logs []string
+	a.SetLog(func(msg ...any) { logs = append(logs, strings.TrimSpace(fmt.Sprintln(msg...))) })
+
+	// Sizes come from the name section of the same build
+	report := &app.WasmSizeReport{Named: true, Packages: []app.WasmPackageSize{
+		{Package: "net/http", Size: 300 << 10},
+		{Package: "net", Size: 100 << 10},
+		{Package: "strings", Size: 10 << 10}, // also used by views.go: not counted
+		{Package: "os/exec", Size: 20 << 10},
+	}}
+	leaks, err := a.Audit(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range leaks {
+		got = append(got, l.Package+" "+l.Kind)
+	}
+	// net is only reachable through net/http: folded into it
+	if strings.Join(got, ", ") != "os/exec server, net/http tinygo" {
+		t.Fatalf("leaks = %q", got)
+	}
+	exec, http := leaks[0], leaks[1]
+	if strings.Join(http.Chain, " → ") != "example.com/leakdemo/web → example.com/leakdemo/shared → net/http" || http.File != "shared/api.go" {
+		t.Errorf("net/http = %+v", http)
+	}
+	if http.Size < 400<<10 || http.Size >= 410<<10 || exec.Size < 20<<10 {
+		t.Errorf("sizes: net/http %d, os/exec %d", http.Size, exec.Size)
+	}
+	if a.Value() != "2 leaks (os/exec, net/http)" || !strings.Contains(strings.Join(logs, "\n"), "Warning: os/exec in wasm build (~") {
+		t.Errorf("value %q, logs:\n%s", a.Value(), strings.Join(logs, "\n"))
+	}
+
+	// Unchanged findings are not logged again
+	n := len(logs)
+	a.Audit(report)
+	if len(logs) != n {
+		t.Errorf("repeated logs: %q", logs[n:])
+	}
+
+	// Allowing net/http keeps its dependencies quiet too; deny adds project packages
+	db.Set(app.StoreKeyWasmImportsAllow, "net/http")
+	db.Set(app.StoreKeyWasmImportsDeny, "example.com/leakdemo/shared")
+	leaks, _ = a.Audit(nil)
+	if len(leaks) != 1 || leaks[0].Package != "example.com/leakdemo/shared" || leaks[0].File != "web/client.go" || leaks[0].Size != 0 {
+		t.Errorf("leaks = %+v", leaks)
+	}
+}
+
+func TestImportAudit_CleanClient(t *testing.T) {
+	dir := newLeakModule(t)
+	os.WriteFile(filepath.Join(dir, "shared", "api.go"), []byte("//go:build !wasm\n\npackage shared\n\nimport \"os/exec\"\n\nfunc Run() error { return exec.Command(\"true\").Run() }\n"), 0644)
+	a := app.NewImportAudit(nil, dir, "web")
+	if a.Value() != "-" {
+		t.Errorf("before the first audit: %q", a.Value())
+	}
+	if leaks, err := a.Audit(nil); err != nil || len(leaks) != 0 || a.Value() != "ok" {
+		t.Errorf("leaks = %+v, %v, value %q", leaks, err, a.Value())
+	}
+}
@@ -0,0 +1,234 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/app"
+	"github.com/tinywasm/app/apptest"
+)
+
+var wasmBody = bytes.Repeat([]byte("\x00asm tinywasm "), 400)
+
+// newPrecompressed serves wasmBody at /app.wasm and a tiny body at /small.js,
+// recording the Accept-Encoding each request reached the inner handler with.
+func newPrecompressed(t *testing.T, db app.DB) (*app.Precompressor, http.Handler, *[]string) {
+	t.Helper()
+	var seen []string
+	p := app.NewPrecompressor(db, nil)
+	p.Brotli = nil
+	h := p.Routes(func(mux *http.ServeMux) {
+		mux.HandleFunc("/app.wasm", func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, r.Header.Get("Accept-Encoding"))
+			w.Header().Set("Content-Type", "application/wasm")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write(wasmBody)
+		})
+		mux.HandleFunc("/small.js", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/javascript")
+			w.Write([]byte("console.log(1)"))
+		})
+	})
+	mux := http.NewServeMux()
+	h(mux)
+	return p, mux, &seen
+}
+
+func get(h http.Handler, path string, header ...string) *http.Response {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+func gunzip(t *testing.T, b []byte) []byte {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestPrecompressor_NegotiatesGzip(t *testing.T) {
+	_, h, seen := newPrecompressed(t, nil)
+
+	res := get(h, "/app.wasm", "Accept-Encoding", "gzip, deflate")
+	body, _ := io.ReadAll(res.Body)
+	if res.Header.Get("Content-Encoding") != "gzip" || res.Header.Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("headers = %v", res.Header)
+	}
+	if !bytes.Equal(gunzip(t, body), wasmBody) || len(body) >= len(wasmBody) {
+		t.Fatalf("gzip body does not round-trip (%d bytes)", len(body))
+	}
+	if res.Header.Get("Cache-Control") != "no-cache" || res.Header.Get("Content-Type") != "application/wasm" {
+		t.Errorf("inner headers lost: %v", res.Header)
+	}
+	if (*seen)[0] != "" {
+		t.Errorf("inner handler should get an identity request, got Accept-Encoding %q", (*seen)[0])
+	}
+
+	etag := res.Header.Get("ETag")
+	if res := get(h, "/app.wasm", "Accept-Encoding", "gzip", "If-None-Match", etag); res.StatusCode != http.StatusNotModified {
+		t.Errorf("If-None-Match %s: status %d", etag, res.StatusCode)
+	}
+
+	res = get(h, "/app.wasm")
+	body, _ = io.ReadAll(res.Body)
+	if res.Header.Get("Content-Encoding") != "" || !bytes.Equal(body, wasmBody) || res.Header.Get("ETag") == etag {
+		t.Errorf("identity response: encoding %q, %d bytes, etag %s", res.Header.Get("Content-Encoding"), len(body), res.Header.Get("ETag"))
+	}
+
+	res = get(h, "/small.js", "Accept-Encoding", "gzip")
+	if res.Header.Get("Content-Encoding") != "" {
+		t.Error("tiny bodies should not be compressed")
+	}
+}
+
+func TestPrecompressor_BuffersOnlyEncodableResponses(t *testing.T) {
+	big := bytes.Repeat([]byte("console.log('tinywasm');"), 40)
+	p := app.NewPrecompressor(nil, nil)
+	p.Brotli = nil
+	mux := http.NewServeMux()
+	p.Routes(func(mux *http.ServeMux) {
+		mux.HandleFunc("/app.abc123.js", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/javascript")
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			w.Write(big)
+		})
+		mux.HandleFunc("/main.js", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/javascript")
+			w.Write(big)
+		})
+		mux.HandleFunc("/encoded.js", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/javascript")
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipBody(big))
+		})
+		mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(big)
+			http.NewResponseController(w).Flush()
+		})
+	})(mux)
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Encoded responses keep an immutable Cache-Control, others revalidate
+	if rec := serve("/app.abc123.js"); rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" {
+		t.Errorf("hashed asset: %v", rec.Header())
+	}
+	if rec := serve("/main.js"); rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("asset: %v", rec.Header())
+	}
+	// Already encoded and non-compressible responses stream through as is
+	if rec := serve("/encoded.js"); !bytes.Equal(gunzip(t, rec.Body.Bytes()), big) || rec.Header().Get("ETag") != "" {
+		t.Errorf("encoded response re-encoded: %v", rec.Header())
+	}
+	if rec := serve("/stream"); !rec.Flushed || rec.Header().Get("Content-Encoding") != "" || !bytes.Equal(rec.Body.Bytes(), big) {
+		t.Errorf("stream buffered: flushed %v, %v", rec.Flushed, rec.Header())
+	}
+}
+
+func gzipBody(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestPrecompressor_PrefersBrotliWhenAccepted(t *testing.T) {
+	p, h, _ := newPrecompressed(t, nil)
+	p.Brotli = func(b []byte) ([]byte, error) { return []byte("BR"), nil }
+
+	for accept, want := range map[string]string{
+		"gzip, br":         "br",
+		"br;q=0, gzip":     "gzip",
+		"gzip;q=0.5, br":   "br",
+		"br;q=0.4, gzip":   "gzip",
+		"identity":         "",
+		"*":                "br",
+		"gzip;q=0, br;q=0": "",
+	} {
+		if got := get(h, "/app.wasm", "Accept-Encoding", accept).Header.Get("Content-Encoding"); got != want {
+			t.Errorf("Accept-Encoding %q: got %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestPrecompressor_ToggleIsPersisted(t *testing.T) {
+	db := newBudgetDB(t, nil)
+	p, h, _ := newPrecompressed(t, db)
+	p.Change("Precompress:F")
+	if p.Value() != "Precompress:F" {
+		t.Fatalf("value = %q", p.Value())
+	}
+	if res := get(h, "/app.wasm", "Accept-Encoding", "gzip"); res.Header.Get("Content-Encoding") != "" {
+		t.Error("disabled compression still encodes")
+	}
+	if v, _ := db.Get(app.StoreKeyPrecompress); v != "false" {
+		t.Errorf("stored toggle = %q", v)
+	}
+	if app.NewPrecompressor(db, nil).Enabled() {
+		t.Error("toggle not restored from the store")
+	}
+}
+
+func TestPrecompressor_WriteDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "client.wasm"), wasmBody, 0644)
+	os.WriteFile(filepath.Join(dir, "photo.webp"), wasmBody, 0644)
+
+	p := app.NewPrecompressor(nil, func() string { return dir })
+	p.Brotli = nil
+	p.RefreshDisk()
+
+	gz, err := os.ReadFile(filepath.Join(dir, "client.wasm.gz"))
+	if err != nil || !bytes.Equal(gunzip(t, gz), wasmBody) {
+		t.Fatalf("client.wasm.gz: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "photo.webp.gz")); err == nil {
+		t.Error("already-compressed formats should be skipped")
+	}
+
+	p.SetEnabled(false)
+	if _, err := os.Stat(filepath.Join(dir, "client.wasm.gz")); !os.IsNotExist(err) {
+		t.Error("disabling compression should remove stale variants")
+	}
+}
+
+func TestPrecompressor_ServesBuildRoutes(t *testing.T) {
+	env := apptest.Start(t, apptest.NewProject(t, "example.com/precompressdemo", nil), nil)
+
+	res := get(env.Server, "/client.wasm", "Accept-Encoding", "gzip")
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != 200 || res.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("status %d, headers %v", res.StatusCode, res.Header)
+	}
+	if wasm := gunzip(t, body); !strings.HasPrefix(string(wasm), "\x00asm") {
+		t.Error("decoded body is not a wasm module")
+	}
+	if status, raw := env.Server.Get("/client.wasm"); status != 200 || !strings.HasPrefix(string(raw), "\x00asm") {
+		t.Errorf("identity request: status %d", status)
+	}
+}
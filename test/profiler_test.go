@@ -0,0 +1,150 @@
+package test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/app"
+)
+
+// pprofServer serves net/http/pprof, or an SPA page for every path when spa is set.
+func pprofServer(t *testing.T, spa bool) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	if spa {
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "<html>app</html>") })
+	} else {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	}
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port
+}
+
+func TestProfiler_CapturesServerProfile(t *testing.T) {
+	root := t.TempDir()
+	port := pprofServer(t, false)
+	p := app.NewProfiler(nil, root, "web", "server.go", filepath.Join(root, "deploy", "profiles"), func() string { return port })
+
+	c, err := p.Capture("", "goroutine", 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Target != "server" || c.Source != "http://127.0.0.1:"+port+"/debug/pprof/goroutine" || !strings.HasPrefix(c.File, "deploy/profiles/server-goroutine-") {
+		t.Errorf("capture = %+v", c)
+	}
+	if _, err := os.Stat(filepath.Join(root, c.File)); err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(c.Top, "flat%") {
+		t.Errorf("top:\n%s", c.Top)
+	}
+
+	c, err = p.Capture("server", "cpu", 1, 5)
+	if err != nil || c.Seconds != 1 || !strings.HasSuffix(c.Source, "/debug/pprof/profile?seconds=1") {
+		t.Errorf("cpu capture = %+v, %v", c, err)
+	}
+	if _, err := p.Capture("server", "threads", 0, 0); err == nil {
+		t.Error("unknown kind accepted")
+	}
+}
+
+func TestProfiler_FallsBackToInjectedEndpoints(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "web"), 0755)
+	os.WriteFile(filepath.Join(root, "web", "server.go"), []byte("//go:build !wasm\n\npackage main\n\nfunc main() {}\n"), 0644)
+	spa, injected := pprofServer(t, true), pprofServer(t, false)
+	db := newBudgetDB(t, map[string]string{app.StoreKeyPprofPort: injected})
+	p := app.NewProfiler(db, root, "web", "server.go", filepath.Join(root, "deploy", "profiles"), func() string { return spa })
+
+	// An SPA fallback page is not a profile
+	if _, err := p.Capture("server", "heap", 0, 0); err == nil || !strings.Contains(err.Error(), "Server pprof") {
+		t.Fatalf("err = %v", err)
+	}
+
+	restarts := 0
+	p.SetOnChange(func() { restarts++ })
+	var ignored []string
+	p.SetGitIgnoreAdd(func(entry string) error { ignored = append(ignored, entry); return nil })
+	p.InjectToggle().(interface{ Change(string) }).Change("Pprof:T")
+	overlay := filepath.Join(root, "deploy", "profiles", ".overlay")
+	args := p.CompileArgs()
+	if !p.Inject() || restarts != 1 || strings.Join(args, " ") != "-tags="+app.PprofTag+" -overlay="+filepath.Join(overlay, "overlay.json") {
+		t.Fatalf("inject %v, %d restarts, args %q", p.Inject(), restarts, args)
+	}
+	if strings.Join(ignored, ",") != "deploy/profiles/.overlay" || strings.Join(p.UnobservedFiles(), ",") != filepath.Join("deploy", "profiles", ".overlay") {
+		t.Errorf("ignored %q, unobserved %q", ignored, p.UnobservedFiles())
+	}
+	c, err := p.Capture("server", "heap", 0, 0)
+	if err != nil || c.Source != "http://127.0.0.1:"+injected+"/debug/pprof/heap" {
+		t.Fatalf("capture = %+v, %v", c, err)
+	}
+
+	// The injected file reaches the server package through the overlay only
+	src, err := os.ReadFile(filepath.Join(overlay, "tinywasm_pprof_dev.go"))
+	if err != nil || !strings.Contains(string(src), `"127.0.0.1:`+injected+`"`) {
+		t.Fatalf("dev file: %s %v", src, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "web", "tinywasm_pprof_dev.go")); !os.IsNotExist(err) {
+		t.Errorf("dev file written into the server sources: %v", err)
+	}
+	os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/pprofdemo\n\ngo 1.22\n"), 0644)
+	list := exec.Command("go", append([]string{"list", "-f", "{{.GoFiles}}"}, append(args, "./web")...)...)
+	list.Dir = root
+	if out, err := list.CombinedOutput(); err != nil || !strings.Contains(string(out), "tinywasm_pprof_dev.go") {
+		t.Errorf("overlay build: %v\n%s", err, out)
+	}
+	build := exec.Command("go", append([]string{"vet"}, append(args, "./web")...)...)
+	build.Dir = root
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Errorf("overlay build: %v\n%s", err, out)
+	}
+	if v, _ := db.Get(app.StoreKeyServerPprof); v != "true" {
+		t.Errorf("not persisted: %q", v)
+	}
+
+	p.SetInject(false)
+	if _, err := os.Stat(overlay); !os.IsNotExist(err) || p.CompileArgs() != nil {
+		t.Errorf("overlay left behind: %v", err)
+	}
+}
+
+func TestProfiler_ProfilesItselfFromTUI(t *testing.T) {
+	root := t.TempDir()
+	p := app.NewProfiler(nil, root, "web", "server.go", filepath.Join(root, "deploy", "profiles"), nil)
+	logs := make(chan string, 1)
+	p.SetLog(func(msg ...any) { logs <- fmt.Sprintln(msg...) })
+
+	p.Change("tinywasm heap")
+	if p.Value() != "tinywasm heap" {
+		t.Errorf("value = %q", p.Value())
+	}
+	select {
+	case log := <-logs:
+		if !strings.Contains(log, "saved to deploy/profiles/tinywasm-heap-") || !strings.Contains(log, "flat%") {
+			t.Errorf("log:\n%s", log)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("no capture logged")
+	}
+	p.Change("cpu 3s")
+	if p.Value() != "server cpu 3s" {
+		t.Errorf("value = %q", p.Value())
+	}
+	<-logs // no server listening: the error is logged
+}
@@ -0,0 +1,43 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/tinywasm/app"
+)
+
+func TestHandlerRegistry_InstancesCoexist(t *testing.T) {
+	a := &app.Handler{Options: app.TestOptions("project-a")}
+	b := &app.Handler{Options: app.TestOptions("project-b")}
+
+	app.RegisterHandler(a.ID(), a)
+	app.RegisterHandler(b.ID(), b)
+	defer app.UnregisterHandler(a.ID(), a)
+	defer app.UnregisterHandler(b.ID(), b)
+
+	if got := app.GetHandler("project-a"); got != a {
+		t.Errorf("project-a resolved to %p, want %p", got, a)
+	}
+	if got := app.GetHandler("project-b"); got != b {
+		t.Errorf("project-b resolved to %p, want %p", got, b)
+	}
+}
+
+func TestHandlerRegistry_UnregisterKeepsReplacement(t *testing.T) {
+	old := &app.Handler{Options: app.TestOptions("restarted")}
+	replacement := &app.Handler{Options: app.TestOptions("restarted")}
+
+	app.RegisterHandler(old.ID(), old)
+	app.RegisterHandler(replacement.ID(), replacement)
+
+	// The previous instance shutting down late must not drop its successor
+	app.UnregisterHandler(old.ID(), old)
+	if got := app.GetHandler("restarted"); got != replacement {
+		t.Fatalf("replacement was dropped by its predecessor, got %p", got)
+	}
+
+	app.UnregisterHandler(replacement.ID(), replacement)
+	if got := app.GetHandler("restarted"); got != nil {
+		t.Errorf("expected empty registry entry, got %p", got)
+	}
+}
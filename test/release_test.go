@@ -0,0 +1,207 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/app"
+	"github.com/tinywasm/app/apptest"
+)
+
+// releaseRoutes mimics assetmin + WasmClient: index.html at "/" (also the
+// fallback for unknown paths), script.js loading the wasm, and style.css
+// pointing at an image that only exists on disk.
+func releaseRoutes(wasm *string) func(*http.ServeMux) {
+	return func(mux *http.ServeMux) {
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<link rel="stylesheet" href="/style.css"><script src="/script.js"></script>`))
+		})
+		mux.HandleFunc("/script.js", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/javascript")
+			w.Write([]byte(`fetch("/client.wasm")`))
+		})
+		mux.HandleFunc("/style.css", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte(`body{background:url(/img/bg.webp)}`))
+		})
+		mux.HandleFunc("/client.wasm", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/wasm")
+			w.Write([]byte(*wasm))
+		})
+	}
+}
+
+func newRelease(t *testing.T, wasm *string) (*app.ReleaseBuilder, string) {
+	t.Helper()
+	root := t.TempDir()
+	public := filepath.Join(root, "public")
+	os.MkdirAll(filepath.Join(public, "img"), 0755)
+	os.WriteFile(filepath.Join(public, "img", "bg.webp"), []byte("RIFFwebp"), 0644)
+	out := filepath.Join(root, "release")
+	return app.NewReleaseBuilder(nil, out, public, releaseRoutes(wasm)), out
+}
+
+var hashedName = regexp.MustCompile(`^/(img/)?\w+\.[0-9a-f]{8}\.\w+$`)
+
+func TestReleaseBuilder_HashesAndRewritesReferences(t *testing.T) {
+	wasm := "\x00asm v1"
+	r, out := newRelease(t, &wasm)
+
+	m, err := r.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, asset := range []string{"/script.js", "/style.css", "/client.wasm", "/img/bg.webp"} {
+		hashed := m.Files[asset]
+		if !hashedName.MatchString(hashed) {
+			t.Fatalf("%s -> %q, want a content-hashed name (manifest %v)", asset, hashed, m.Files)
+		}
+		if _, err := os.Stat(filepath.Join(out, hashed)); err != nil {
+			t.Errorf("%s not written: %v", hashed, err)
+		}
+	}
+
+	index, _ := os.ReadFile(filepath.Join(out, "index.html"))
+	script, _ := os.ReadFile(filepath.Join(out, m.Files["/script.js"]))
+	css, _ := os.ReadFile(filepath.Join(out, m.Files["/style.css"]))
+	if !strings.Contains(string(index), `src="`+m.Files["/script.js"]+`"`) || !strings.Contains(string(index), m.Files["/style.css"]) {
+		t.Errorf("index.html not rewritten: %s", index)
+	}
+	if string(script) != `fetch("`+m.Files["/client.wasm"]+`")` || !strings.Contains(string(css), "url("+m.Files["/img/bg.webp"]+")") {
+		t.Errorf("references not rewritten: %s / %s", script, css)
+	}
+
+	var onDisk app.AssetManifest
+	data, _ := os.ReadFile(filepath.Join(out, app.ReleaseManifestFile))
+	if err := json.Unmarshal(data, &onDisk); err != nil || onDisk.Files["/client.wasm"] != m.Files["/client.wasm"] {
+		t.Errorf("asset-manifest.json = %s (%v)", data, err)
+	}
+
+	// A new wasm changes its name and, through the rewritten reference, the
+	// loader's name too; untouched assets keep theirs.
+	wasm = "\x00asm v2"
+	m2, err := r.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m2.Files["/client.wasm"] == m.Files["/client.wasm"] || m2.Files["/script.js"] == m.Files["/script.js"] {
+		t.Error("changed content should change hashed names up the reference chain")
+	}
+	if m2.Files["/style.css"] != m.Files["/style.css"] {
+		t.Error("unchanged assets should keep their names")
+	}
+	if _, err := os.Stat(filepath.Join(out, m.Files["/client.wasm"])); !os.IsNotExist(err) {
+		t.Error("stale release files should be removed")
+	}
+}
+
+func TestReleaseBuilder_ResolvesRelativeReferences(t *testing.T) {
+	root := t.TempDir()
+	public := filepath.Join(root, "public")
+	os.MkdirAll(filepath.Join(public, "img"), 0755)
+	os.WriteFile(filepath.Join(public, "img", "bg.webp"), []byte("RIFFwebp"), 0644)
+	out := filepath.Join(root, "release")
+	r := app.NewReleaseBuilder(nil, out, public, func(mux *http.ServeMux) {
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<link rel="stylesheet" href="css/site.css"><script src="./script.js"></script>`))
+		})
+		mux.HandleFunc("/script.js", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/javascript")
+			w.Write([]byte(`import("./lazy.js")`)) // module-relative: left as is
+		})
+		mux.HandleFunc("/css/site.css", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte(`body{background:url(../img/bg.webp)}`))
+		})
+	})
+
+	m, err := r.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, _ := os.ReadFile(filepath.Join(out, "index.html"))
+	css, _ := os.ReadFile(filepath.Join(out, m.Files["/css/site.css"]))
+	script, _ := os.ReadFile(filepath.Join(out, m.Files["/script.js"]))
+	if !strings.Contains(string(index), `href="`+m.Files["/css/site.css"]+`"`) || !strings.Contains(string(index), `src="`+m.Files["/script.js"]+`"`) {
+		t.Errorf("index.html not rewritten: %s (manifest %v)", index, m.Files)
+	}
+	if m.Files["/img/bg.webp"] == "" || string(css) != "body{background:url("+m.Files["/img/bg.webp"]+")}" {
+		t.Errorf("css not rewritten: %s", css)
+	}
+	if string(script) != `import("./lazy.js")` {
+		t.Errorf("script = %s", script)
+	}
+
+	// Rebuilding swaps the directory without leaving the old one behind
+	if _, err := r.Build(); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{out + ".old", out + ".tmp"} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("%s left behind: %v", dir, err)
+		}
+	}
+}
+
+func TestReleaseBuilder_ServesReleaseWhenEnabled(t *testing.T) {
+	wasm := "\x00asm"
+	r, _ := newRelease(t, &wasm)
+	mux := http.NewServeMux()
+	r.Routes()(mux)
+
+	if body, _ := io.ReadAll(get(mux, "/").Body); !strings.Contains(string(body), `"/script.js"`) {
+		t.Errorf("dev index expected before enabling release, got %s", body)
+	}
+
+	r.Change("Release:T")
+	if r.Value() != "Release:T" || r.Manifest() == nil {
+		t.Fatalf("enabling release should build it: %q", r.Value())
+	}
+	res := get(mux, "/")
+	body, _ := io.ReadAll(res.Body)
+	if !strings.Contains(string(body), r.Manifest().Files["/script.js"]) || res.Header.Get("Cache-Control") != "no-cache" {
+		t.Errorf("release index: %s (Cache-Control %q)", body, res.Header.Get("Cache-Control"))
+	}
+	res = get(mux, r.Manifest().Files["/client.wasm"])
+	if res.StatusCode != 200 || !strings.Contains(res.Header.Get("Cache-Control"), "immutable") {
+		t.Errorf("hashed asset: status %d, Cache-Control %q", res.StatusCode, res.Header.Get("Cache-Control"))
+	}
+	if res := get(mux, "/client.wasm"); res.StatusCode != http.StatusNotFound {
+		t.Errorf("unhashed names are not part of the release, got %d", res.StatusCode)
+	}
+	if res := get(mux, "/settings/profile"); res.StatusCode != 200 {
+		t.Errorf("client-side routes should get index.html, got %d", res.StatusCode)
+	}
+
+	r.Change("Release:F")
+	if body, _ := io.ReadAll(get(mux, "/").Body); !strings.Contains(string(body), `"/script.js"`) {
+		t.Errorf("disabling release should serve the dev build again, got %s", body)
+	}
+}
+
+func TestReleaseBuilder_BuildsProject(t *testing.T) {
+	env := apptest.Start(t, apptest.NewProject(t, "example.com/releasedemo", nil), nil)
+
+	m, err := env.Handler.Release.Build()
+	if err != nil {
+		t.Fatalf("release build: %v\n%s", err, env.Logs)
+	}
+	if !hashedName.MatchString(m.Files["/client.wasm"]) || !hashedName.MatchString(m.Files["/script.js"]) {
+		t.Fatalf("manifest = %+v", m)
+	}
+	wasm, err := os.ReadFile(filepath.Join(m.Dir, m.Files["/client.wasm"]))
+	if err != nil || !strings.HasPrefix(string(wasm), "\x00asm") {
+		t.Errorf("released wasm: %v", err)
+	}
+	if !strings.HasPrefix(m.Dir, env.Project.Dir) || filepath.Base(m.Dir) != "release" {
+		t.Errorf("release written to %s", m.Dir)
+	}
+}
@@ -122,7 +122,7 @@ type TestContext struct {
 
 // startTestApp starts the app for testing and disables Browser auto-start.
 // Returns a TestContext containing the handler, mocks, and a cleanup function.
-// Accepts optional overrides for Browser, GitClient, GoModHandler, DB, or TuiInterface.
+// Accepts optional overrides for Browser, GitClient, GoModHandler, DB, TuiInterface or app.Options.
 func startTestApp(t *testing.T, RootDir string, opts ...any) *TestContext {
 	ExitChan := make(chan bool)
 	logs := &SafeBuffer{}
@@ -154,8 +154,11 @@ func startTestApp(t *testing.T, RootDir string, opts ...any) *TestContext {
 
 	// 3. Apply overrides from variadic arguments
 	var goModH devflow.GoModInterface
+	options := app.TestOptions(RootDir)
 	for _, o := range opts {
 		switch v := o.(type) {
+		case app.Options:
+			options = v
 		case *MockBrowser:
 			ctx.Browser = v
 		case *MockGitClient:
@@ -205,11 +208,11 @@ func startTestApp(t *testing.T, RootDir string, opts ...any) *TestContext {
 
 	appDone := make(chan struct{})
 	go func() {
-		app.Start(RootDir, logger, ctx.UI, ctx.Browser, ctx.DB, ExitChan, factory, devflow.NewMockGitHubAuth(), ctx.GitHandler, goModH, false, false, nil)
+		app.Start(RootDir, logger, ctx.UI, ctx.Browser, ctx.DB, ExitChan, factory, devflow.NewMockGitHubAuth(), ctx.GitHandler, goModH, false, false, options, nil)
 		close(appDone)
 	}()
 	// Wait for handler registration
-	h := app.WaitForActiveHandler(8 * time.Second)
+	h := app.WaitForHandler(options.ID, 8*time.Second)
 	if h == nil {
 		t.Fatal("Failed to get active app.Handler")
 	}
@@ -217,7 +220,7 @@ func startTestApp(t *testing.T, RootDir string, opts ...any) *TestContext {
 
 	ctx.Cleanup = func() {
 		close(ExitChan)
-		app.SetActiveHandler(nil)
+		app.UnregisterHandler(options.ID, h)
 		os.Unsetenv("PORT")
 		os.Unsetenv("TINYWASM_MCP_PORT")
 		select {
@@ -0,0 +1,136 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/app"
+)
+
+const raceOutput = `2024/05/01 10:00:00 Serving static files from: public on port 6060
+==================
+WARNING: DATA RACE
+Read at 0x00c000018188 by goroutine 7:
+  main.handler()
+      /src/app/web/server.go:25 +0x2e
+  net/http.HandlerFunc.ServeHTTP()
+      /usr/local/go/src/net/http/server.go:2166 +0x47
+
+Previous write at 0x00c000018188 by goroutine 6:
+  main.handler()
+      /src/app/web/server.go:26 +0xc4
+
+Goroutine 7 (running) created at:
+  net/http.(*Server).Serve()
+      /usr/local/go/src/net/http/server.go:3285 +0x8ec
+==================
+`
+
+func TestParseRaceReport(t *testing.T) {
+	start := strings.Index(raceOutput, "==================")
+	r := app.ParseRaceReport(raceOutput[start:], "/src/app")
+	if len(r.Accesses) != 3 || r.Accesses[0].Op != "Read" || r.Accesses[1].Goroutine != "goroutine 6" {
+		t.Fatalf("accesses = %+v", r.Accesses)
+	}
+	if f := r.Accesses[0].Stack[1]; f.Func != "net/http.HandlerFunc.ServeHTTP()" || f.File != "/usr/local/go/src/net/http/server.go" || f.Line != 2166 {
+		t.Errorf("frame = %+v", f)
+	}
+	d := r.Diagnostic()
+	if d.File != "web/server.go" || d.Line != 25 || d.Analyzer != "race" || !strings.Contains(d.Detail, "Goroutine 7 (running) created") {
+		t.Errorf("diagnostic = %+v", d)
+	}
+	if d.Message != "data race: read by goroutine 7 in main.handler(), previous write by goroutine 6 in main.handler()" {
+		t.Errorf("message = %q", d.Message)
+	}
+}
+
+func TestServerProfile_ScansChunkedOutput(t *testing.T) {
+	p := app.NewServerProfile(nil, "/src/app", "")
+	var logs []string
+	p.SetLog(func(msg ...any) { logs = append(logs, strings.TrimSpace(fmt.Sprintln(msg...))) })
+
+	// The runner forwards output in arbitrary chunks, mixed with handler lines
+	out := raceOutput + raceOutput
+	for i := 0; i < len(out); i += 37 {
+		p.Scan(out[i:min(i+37, len(out))])
+		if i == 37*3 {
+			p.Scan("Restarting External Server...")
+		}
+	}
+	races := p.Races()
+	if len(races) != 1 || races[0].Count != 2 {
+		t.Fatalf("races = %+v", races)
+	}
+	if len(logs) != 1 || !strings.HasPrefix(logs[0], "Warning: web/server.go:25: data race: read by goroutine 7") {
+		t.Errorf("logs = %q", logs)
+	}
+	if d := p.Diagnostics("web/server.go"); len(d) != 1 || !strings.HasSuffix(d[0].Message, "(2 times)") {
+		t.Errorf("diagnostics = %+v", d)
+	}
+	if len(p.Diagnostics("web/client.go")) != 0 {
+		t.Error("file filter ignored")
+	}
+	p.Rebuilt()
+	if len(p.Races()) != 0 {
+		t.Error("a rebuild clears the races")
+	}
+}
+
+func TestServerProfile_RaceBuildReportsRaces(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/racedemo\n\ngo 1.22\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nimport \"time\"\n\nfunc main() {\n\tn := 0\n\tgo func() { n++ }()\n\tn++\n\ttime.Sleep(100 * time.Millisecond)\n\tprintln(n)\n}\n"), 0644)
+	p := app.NewServerProfile(nil, dir, "")
+	if err := p.SetProfile(app.ServerProfileRace); err != nil {
+		t.Fatal(err)
+	}
+	build := exec.Command("go", append(append([]string{"build"}, p.CompileArgs()...), "-o", "srv", ".")...)
+	build.Dir = dir
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Skipf("race detector unavailable: %v %s", err, out)
+	}
+	out, _ := exec.Command(filepath.Join(dir, "srv")).CombinedOutput()
+	p.Scan(string(out))
+	d := p.Diagnostics("")
+	if len(d) == 0 || d[0].File != "main.go" || d[0].Line != 7 && d[0].Line != 8 {
+		t.Errorf("diagnostics = %+v\n%s", d, out)
+	}
+}
+
+func TestServerProfile_Select(t *testing.T) {
+	t.Setenv("GOCOVERDIR", "")
+	db := newBudgetDB(t, nil)
+	coverDir := filepath.Join(t.TempDir(), "servercover")
+	p := app.NewServerProfile(db, t.TempDir(), coverDir)
+	rebuilds := 0
+	p.SetOnChange(func() { rebuilds++ })
+	if p.Value() != "normal" || strings.Join(p.CompileArgs(), " ") != "-p 1" {
+		t.Fatalf("default %q %q", p.Value(), p.CompileArgs())
+	}
+
+	p.Change("debug")
+	if strings.Join(p.CompileArgs(), " ") != "-p 1 -gcflags=all=-N -l" || rebuilds != 1 {
+		t.Errorf("debug: %q, %d rebuilds", p.CompileArgs(), rebuilds)
+	}
+	p.Change("") // cycles to the next profile
+	if p.Value() != "cover" || p.Env()["GOCOVERDIR"] != coverDir || os.Getenv("GOCOVERDIR") != "" {
+		t.Errorf("cover: %q env %q, GOCOVERDIR=%q", p.Value(), p.Env(), os.Getenv("GOCOVERDIR"))
+	}
+	if _, err := os.Stat(coverDir); err != nil {
+		t.Error(err)
+	}
+	if err := p.SetProfile("fast"); err == nil || p.Value() != "cover" {
+		t.Errorf("unknown profile accepted: %v", err)
+	}
+	if v, _ := db.Get(app.StoreKeyServerProfile); v != "cover" || app.NewServerProfile(db, t.TempDir(), coverDir).Value() != "cover" {
+		t.Errorf("profile not persisted: %q", v)
+	}
+	p.SetProfile(app.ServerProfileNormal)
+	if p.Env() != nil || rebuilds != 3 {
+		t.Errorf("env %q, %d rebuilds", p.Env(), rebuilds)
+	}
+}
@@ -91,7 +91,7 @@ func main() {
 		t.Fatal(err)
 	}
 
-	Watcher := app.WaitWatcherReady(8 * time.Second)
+	Watcher := app.WaitWatcherReady(ctx.Handler.ID(), 8*time.Second)
 	if Watcher == nil {
 		t.Fatal("Watcher is nil")
 	}
@@ -1,13 +1,12 @@
 package test
 
 import (
-	"github.com/tinywasm/app"
 	"github.com/tinywasm/server"
 )
 
-// init sets app.TestMode=true for all tests in this package.
+// init sets server.TestMode=true for all tests in this package.
+// app side effects are disabled per instance via app.TestOptions.
 func init() {
-	app.TestMode = true
 	server.TestMode = true
 }
 
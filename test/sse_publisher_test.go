@@ -2,6 +2,7 @@ package test
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/tinywasm/app"
@@ -28,3 +29,43 @@ func TestSSEPublisherRecentLogs(t *testing.T) {
 		t.Errorf("Last log should be 'msg 150', got '%s'", logs[99])
 	}
 }
+
+type recordingHub struct {
+	mu   sync.Mutex
+	msgs [][]byte
+}
+
+func (h *recordingHub) Publish(data []byte, channel string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.msgs = append(h.msgs, data)
+}
+
+func (h *recordingHub) messages() [][]byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([][]byte(nil), h.msgs...)
+}
+
+func TestSSEPublisherStateRevisions(t *testing.T) {
+	hub := &recordingHub{}
+	pub := app.NewSSEPublisher(hub)
+
+	pub.PublishStateRefresh()
+	pub.PublishStateRefresh()
+
+	if got := pub.StateRevision(); got != 2 {
+		t.Fatalf("StateRevision = %d, want 2", got)
+	}
+
+	msgs := hub.messages()
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 published messages, got %d", len(msgs))
+	}
+	for i, raw := range msgs {
+		// A bare refresh signal: devtui re-fetches the state on handler_type 0
+		if want := fmt.Sprintf(`{"handler_type":0,"revision":%d}`, i+1); string(raw) != want {
+			t.Errorf("message %d = %s, want %s", i, raw, want)
+		}
+	}
+}
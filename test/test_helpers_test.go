@@ -4,11 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"sync"
-	"time"
 
 	"github.com/tinywasm/app"
 	"github.com/tinywasm/devflow"
-	"github.com/tinywasm/devwatch"
 )
 
 // NewTestHandler creates a app.Handler configured for testing.
@@ -103,24 +101,3 @@ func (s *SafeBuffer) LastLog() string {
 	}
 	return s.messageLines[len(s.messageLines)-1]
 }
-
-// WaitWatcherReady waits until the Watcher is initialized or timeout
-func WaitWatcherReady(timeout time.Duration) *devwatch.DevWatch {
-	deadline := time.Now().Add(timeout)
-	for time.Now().Before(deadline) {
-		h := app.GetActiveHandler()
-		if h != nil && h.Watcher != nil {
-			return h.Watcher
-		}
-		time.Sleep(10 * time.Millisecond)
-	}
-	return nil
-}
-
-// EnableDebugWatchEvents switches to debug mode for detailed event logging
-func EnableDebugWatchEvents() {
-	h := app.GetActiveHandler()
-	if h != nil && h.Watcher != nil {
-		// We can't easily switch the running watchEvents, but we can log more
-	}
-}
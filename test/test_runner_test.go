@@ -0,0 +1,183 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/app"
+)
+
+func TestParseTestJSON(t *testing.T) {
+	out := `{"Action":"start","Package":"example.com/m/a"}
+{"Action":"run","Package":"example.com/m/a","Test":"TestOK"}
+{"Action":"output","Package":"example.com/m/a","Test":"TestOK","Output":"=== RUN   TestOK\n"}
+{"Action":"pass","Package":"example.com/m/a","Test":"TestOK","Elapsed":0.01}
+{"Action":"run","Package":"example.com/m/a","Test":"TestBad"}
+{"Action":"output","Package":"example.com/m/a","Test":"TestBad/sub","Output":"    a_test.go:12: want 2, got 3\n"}
+{"Action":"fail","Package":"example.com/m/a","Test":"TestBad/sub","Elapsed":0}
+{"Action":"fail","Package":"example.com/m/a","Test":"TestBad","Elapsed":0.02}
+{"Action":"output","Package":"example.com/m/a","Output":"FAIL\n"}
+{"Action":"fail","Package":"example.com/m/a","Elapsed":0.5}
+{"ImportPath":"example.com/m/b [example.com/m/b.test]","Action":"build-output","Output":"b/b.go:3:1: syntax error\n"}
+{"ImportPath":"example.com/m/b [example.com/m/b.test]","Action":"build-fail"}
+{"Action":"start","Package":"example.com/m/b"}
+{"Action":"output","Package":"example.com/m/b","Output":"FAIL\texample.com/m/b [build failed]\n"}
+{"Action":"fail","Package":"example.com/m/b","Elapsed":0,"FailedBuild":"example.com/m/b [example.com/m/b.test]"}
+not json
+{"Action":"start","Package":"example.com/m/c"}
+{"Action":"skip","Package":"example.com/m/c","Elapsed":0}
+`
+	got := app.ParseTestJSON([]byte(out), app.TestTargetServer)
+	if len(got) != 3 {
+		t.Fatalf("packages = %+v", got)
+	}
+	a, b, c := got[0], got[1], got[2]
+	if a.Status != app.TestFail || a.Duration != 0.5 || len(a.Tests) != 3 || a.Target != app.TestTargetServer {
+		t.Errorf("a = %+v", a)
+	}
+	if a.Tests[0].Status != app.TestPass || a.Tests[0].Output != "" {
+		t.Errorf("passing tests keep no output: %+v", a.Tests[0])
+	}
+	if sub := a.Tests[1]; sub.Name != "TestBad/sub" || !strings.Contains(sub.Output, "want 2, got 3") {
+		t.Errorf("subtest = %+v", sub)
+	}
+	if b.Status != app.TestFail || !strings.Contains(b.Output, "syntax error") {
+		t.Errorf("build failures carry the compiler output: %+v", b)
+	}
+	if c.Status != app.TestSkip || c.Output != "no test files" {
+		t.Errorf("c = %+v", c)
+	}
+}
+
+// newTestModule writes a module where b imports a, c stands alone and w has
+// wasm-only tests.
+func newTestModule(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":         "module example.com/testsdemo\n\ngo 1.22\n",
+		"a/a.go":         "package a\n\nfunc Two() int { return 2 }\n",
+		"a/a_test.go":    "package a\n\nimport \"testing\"\n\nfunc TestTwo(t *testing.T) {\n\tif Two() != 2 {\n\t\tt.Fatal(\"two\")\n\t}\n}\n",
+		"b/b.go":         "package b\n\nimport \"example.com/testsdemo/a\"\n\nfunc Four() int { return a.Two() * 2 }\n",
+		"b/b_test.go":    "package b\n\nimport \"testing\"\n\nfunc TestFour(t *testing.T) {\n\tif Four() != 4 {\n\t\tt.Fatalf(\"four = %d\", Four())\n\t}\n}\n\nfunc TestOther(t *testing.T) {}\n",
+		"c/c.go":         "package c\n",
+		"c/c_test.go":    "package c\n\nimport \"testing\"\n\nfunc TestC(t *testing.T) {}\n",
+		"w/w.go":         "package w\n\nfunc Name() string { return \"w\" }\n",
+		"w/w_js_test.go": "//go:build wasm\n\npackage w\n\nimport (\n\t\"runtime\"\n\t\"testing\"\n)\n\nfunc TestOnWasm(t *testing.T) {\n\tif runtime.GOARCH != \"wasm\" {\n\t\tt.Fatal(runtime.GOARCH)\n\t}\n}\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestTestRunner_RunsAffectedPackagesOnSave(t *testing.T) {
+	dir := newTestModule(t)
+	exit := make(chan bool)
+	defer close(exit)
+	r := app.NewTestRunner(nil, dir, exit)
+	var logs []string
+	r.SetLog(func(msg ...any) { logs = append(logs, strings.TrimSpace(fmt.Sprintln(msg...))) })
+
+	// Breaking a fails the tests of a and of b, which imports it; c is not run
+	os.WriteFile(filepath.Join(dir, "a", "a.go"), []byte("package a\n\nfunc Two() int { return 3 }\n"), 0644)
+	r.Changed(filepath.Join(dir, "a", "a.go"))
+	var run *app.TestRun
+	if err := apptestPoll(60*time.Second, func() bool { run = r.Last(); return run != nil }); err != nil {
+		t.Fatalf("no test run\n%s", strings.Join(logs, "\n"))
+	}
+	var tested []string
+	for _, p := range run.Packages {
+		tested = append(tested, p.Package+" "+p.Status)
+	}
+	if strings.Join(tested, ", ") != "example.com/testsdemo/a fail, example.com/testsdemo/b fail" || run.Trigger != "a/a.go" {
+		t.Fatalf("tested %q, trigger %q", tested, run.Trigger)
+	}
+	if b := run.Packages[1]; len(b.Tests) != 2 || !strings.Contains(b.Tests[0].Output, "four = 6") {
+		t.Errorf("b = %+v", b)
+	}
+	all := strings.Join(logs, "\n")
+	if !strings.Contains(all, "✗ example.com/testsdemo/b: TestFour") || !strings.Contains(all, "four = 6") || r.Label() != "Watch Tests (0 ok, 2 FAIL)" {
+		t.Errorf("label %q, logs:\n%s", r.Label(), all)
+	}
+}
+
+func TestTestRunner_RunPatternAndTargets(t *testing.T) {
+	dir := newTestModule(t)
+	r := app.NewTestRunner(nil, dir, nil)
+
+	run, err := r.Run([]string{"./b"}, "TestOther", app.TestTargetServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(run.Packages) != 1 || run.Passed != 1 || len(run.Packages[0].Tests) != 1 || run.Packages[0].Tests[0].Name != "TestOther" {
+		t.Fatalf("run = %+v", run)
+	}
+
+	// w only has wasm tests: it runs on the wasm target alone
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("node not installed")
+	}
+	run, err = r.Run([]string{"./w", "./c"}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range run.Packages {
+		got = append(got, p.Package+" "+p.Target+" "+p.Status)
+	}
+	want := "example.com/testsdemo/c server pass, example.com/testsdemo/w wasm pass"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("got %q, want %q\n%+v", got, want, run.Packages)
+	}
+}
+
+func TestTestRunner_WatchToggle(t *testing.T) {
+	db := newBudgetDB(t, nil)
+	r := app.NewTestRunner(db, t.TempDir(), nil)
+	if r.Value() != "WatchTests:T" {
+		t.Fatalf("enabled by default, got %q", r.Value())
+	}
+	r.Change("WatchTests:F")
+	if v, _ := db.Get(app.StoreKeyWatchTests); v != "false" || app.NewTestRunner(db, t.TempDir(), nil).Enabled() {
+		t.Errorf("toggle not persisted: %q", v)
+	}
+}
+
+func TestPackageGraph_UpdatesChangedPackages(t *testing.T) {
+	dir := newTestModule(t)
+	g := app.NewPackageGraph(dir)
+
+	host, err := g.Packages(app.TestTargetServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wasm, _ := g.Packages(app.TestTargetWasm)
+	if w := host["example.com/testsdemo/w"]; len(w.TestGoFiles) != 0 {
+		t.Errorf("host sees the wasm-only tests: %+v", w)
+	}
+	if w := wasm["example.com/testsdemo/w"]; len(w.TestGoFiles) != 1 {
+		t.Errorf("wasm misses its tests: %+v", w)
+	}
+
+	// c starts importing b: only c is read again
+	c := filepath.Join(dir, "c", "c.go")
+	os.WriteFile(c, []byte("package c\n\nimport \"example.com/testsdemo/b\"\n\nvar X = b.Four()\n"), 0644)
+	if host, _ = g.Packages(app.TestTargetServer); len(host["example.com/testsdemo/c"].Imports) != 0 {
+		t.Fatal("the graph should only change once the file is reported")
+	}
+	g.Changed(c)
+	host, _ = g.Packages(app.TestTargetServer)
+	if imports := host["example.com/testsdemo/c"].Imports; len(imports) != 1 || imports[0] != "example.com/testsdemo/b" {
+		t.Errorf("c imports %q", imports)
+	}
+}
@@ -0,0 +1,133 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/app"
+)
+
+func TestParseVetJSON(t *testing.T) {
+	out := `# example.com/m/web
+{
+	"example.com/m/web": {
+		"printf": [
+			{
+				"posn": "/src/m/web/client.go:7:2",
+				"end": "/src/m/web/client.go:7:30",
+				"message": "fmt.Printf format %d has arg \"x\" of wrong type string"
+			}
+		]
+	}
+}
+# example.com/m/models
+vet: models/user.go:3:17: undefined: Missing
+`
+	got := app.ParseVetJSON([]byte(out), "/src/m", app.VetContextWasm)
+	if len(got) != 2 {
+		t.Fatalf("diagnostics = %+v", got)
+	}
+	if d := got[0]; d.File != "models/user.go" || d.Line != 3 || d.Analyzer != "compile" || d.Package != "example.com/m/models" || d.Message != "undefined: Missing" {
+		t.Errorf("type error = %+v", d)
+	}
+	if d := got[1]; d.String() != `web/client.go:7:2: printf: fmt.Printf format %d has arg "x" of wrong type string [wasm]` || d.Package != "example.com/m/web" {
+		t.Errorf("finding = %+v", d)
+	}
+}
+
+// newVetModule writes a module whose web package has a wasm-only printf bug
+// in client.go, a server-only self-assignment in server.go and shares
+// models with both sides.
+func newVetModule(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":          "module example.com/vetdemo\n\ngo 1.22\n",
+		"web/client.go":   "//go:build wasm\n\npackage main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/vetdemo/models\"\n)\n\nfunc main() {\n\tfmt.Printf(\"%d\\n\", models.Name())\n}\n",
+		"web/server.go":   "//go:build !wasm\n\npackage main\n\nimport \"example.com/vetdemo/models\"\n\nfunc main() {\n\tn := models.Name()\n\tn = n\n\tprintln(n)\n}\n",
+		"models/model.go": "package models\n\nfunc Name() string { return \"m\" }\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestVet_BothBuildContexts(t *testing.T) {
+	dir := newVetModule(t)
+	v := app.NewVet(nil, dir, "web", "web", nil)
+
+	diags, err := v.RunAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.File+" "+d.Analyzer+" "+strings.Join(d.Contexts, ","))
+	}
+	want := "web/client.go printf wasm, web/server.go assign server"
+	if strings.Join(got, ", ") != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if len(v.Diagnostics("web/server.go")) != 1 || v.Label() != "Go Vet (2 findings)" {
+		t.Errorf("label %q", v.Label())
+	}
+}
+
+func TestVet_RevetsSavedPackage(t *testing.T) {
+	dir := newVetModule(t)
+	exit := make(chan bool)
+	defer close(exit)
+	v := app.NewVet(nil, dir, "web", "web", exit)
+	var logs []string
+	v.SetLog(func(msg ...any) { logs = append(logs, strings.TrimSpace(fmt.Sprintln(msg...))) })
+
+	// A shared package breaks in both contexts: one finding, reported by both
+	model := filepath.Join(dir, "models", "model.go")
+	os.WriteFile(model, []byte("package models\n\nimport \"fmt\"\n\nfunc Name() string { return fmt.Sprintf(\"%s\") }\n"), 0644)
+	v.Changed(model)
+	var diags []app.Diagnostic
+	if err := apptestPoll(60*time.Second, func() bool { diags = v.Diagnostics("models/model.go"); return len(diags) > 0 }); err != nil {
+		t.Fatalf("no findings\n%s", strings.Join(logs, "\n"))
+	}
+	if d := diags[0]; d.Analyzer != "printf" || strings.Join(d.Contexts, ",") != "wasm,server" {
+		t.Errorf("finding = %+v", d)
+	}
+	if len(v.Diagnostics("web/client.go")) != 0 {
+		t.Error("only the saved package is vetted")
+	}
+
+	// Fixing it clears the finding
+	os.WriteFile(model, []byte("package models\n\nfunc Name() string { return \"m\" }\n"), 0644)
+	v.Changed(model)
+	if err := apptestPoll(60*time.Second, func() bool { return len(v.Diagnostics("")) == 0 }); err != nil {
+		t.Errorf("finding not cleared: %+v", v.Diagnostics(""))
+	}
+	if all := strings.Join(logs, "\n"); !strings.Contains(all, "models/model.go:5:") || !strings.Contains(all, "[wasm, server]") {
+		t.Errorf("logs:\n%s", all)
+	}
+}
+
+func TestVet_Toggle(t *testing.T) {
+	db := newBudgetDB(t, nil)
+	v := app.NewVet(db, t.TempDir(), "web", "web", nil)
+	if v.Value() != "Vet:T" {
+		t.Fatalf("enabled by default, got %q", v.Value())
+	}
+	v.Change("Vet:F")
+	if val, _ := db.Get(app.StoreKeyVet); val != "false" || app.NewVet(db, t.TempDir(), "web", "web", nil).Enabled() {
+		t.Errorf("toggle not persisted: %q", val)
+	}
+	db.Set(app.StoreKeyVetTools, " shadow, ,nilness")
+	if got := v.Tools(); strings.Join(got, " ") != "shadow nilness" {
+		t.Errorf("tools = %q", got)
+	}
+}
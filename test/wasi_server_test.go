@@ -0,0 +1,244 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tinywasm/app"
+	"github.com/tinywasm/server"
+)
+
+const wasiServerMain = `package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+var hits int
+
+func main() {
+	http.HandleFunc("/api/echo", func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s %s %v %d", r.Method, body, r.URL.Query().Get("q"), os.Getenv("GREETING"), os.Args[1:], hits)
+	})
+	http.HandleFunc("/", http.NotFound)
+	fmt.Fprintln(os.Stderr, "module started")
+	fd, _ := strconv.Atoi(os.Getenv("TINYWASM_LISTEN_FD"))
+	syscall.SetNonblock(fd, true)
+	l, err := net.FileListener(os.NewFile(uintptr(fd), "listener"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	http.Serve(l, nil)
+}
+`
+
+func TestWasiServer_ServesModuleAndRoutes(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "cmd", "server")
+	os.MkdirAll(src, 0755)
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module wasiapp\n\ngo 1.22\n"), 0644)
+	os.WriteFile(filepath.Join(src, "main.go"), []byte(wasiServerMain), 0644)
+
+	var logs SafeBuffer
+	exit := make(chan bool)
+	port := freePort()
+	s := app.NewWasiServer().SetExitChan(exit).
+		SetLogger(func(m ...any) { logs.Write([]byte(fmt.Sprintln(m...))) })
+	s.SetAppRootDir(dir)
+	s.SetSourceDir("cmd/server")
+	s.SetOutputDir("deploy/appserver")
+	s.SetPort(port)
+	s.SetCompileArgs(func() []string { return []string{"-p", "1", "-race"} })
+	s.SetRunArgs(func() []string { return []string{"-server_port=" + port} })
+	s.SetEnv(func() map[string]string { return map[string]string{"GREETING": "hola"} })
+	var upstreamHits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHits.Add(1)
+		http.Error(w, "upstream "+r.URL.Path, http.StatusNotFound)
+	}))
+	defer upstream.Close()
+	proxy := app.NewDevProxy(nil)
+	proxy.AddRule(app.ProxyRule{Prefix: "/api/mock", Upstream: upstream.URL})
+	var hookHits atomic.Int32
+	// Layered like the dev routes: everything under "/", the index deferred
+	s.RegisterRoutes(proxy.Routes(app.DeferCatchAll(func(mux *http.ServeMux) {
+		mux.HandleFunc("/main.js", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "js") })
+		mux.HandleFunc("GET /api/echo", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "host echo") })
+		mux.HandleFunc("POST /hook", func(w http.ResponseWriter, r *http.Request) {
+			hookHits.Add(1)
+			io.ReadAll(r.Body)
+			http.NotFound(w, r)
+		})
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "index") })
+	})))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go s.StartServer(&wg)
+	defer func() {
+		close(exit)
+		wg.Wait()
+	}()
+
+	base := "http://127.0.0.1:" + port
+	get := func(method, path, body string) (int, string) {
+		t.Helper()
+		var resp *http.Response
+		var err error
+		for i := 0; i < 1200; i++ {
+			req, _ := http.NewRequest(method, base+path, strings.NewReader(body))
+			if resp, err = http.DefaultClient.Do(req); err == nil {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	// A path the host only routes for GET goes to the module for POST,
+	// instead of the host's 405
+	want := "POST ping 1 hola [-server_port=" + port + "] "
+	if code, body := get("POST", "/api/echo?q=1", "ping"); code != 200 || body != want+"1" {
+		t.Fatalf("module: %d %q\n%s", code, body, logs.String())
+	}
+	// One instance serves every request
+	if _, body := get("POST", "/api/echo?q=1", "ping"); body != want+"2" {
+		t.Errorf("second request: %q", body)
+	}
+	if _, body := get("GET", "/api/echo", ""); body != "host echo" {
+		t.Errorf("host GET route: %q", body)
+	}
+	// A host 404 falls through to the module, whose 404 is final: the
+	// host handler runs once
+	if code, _ := get("POST", "/hook", "data"); code != 404 || hookHits.Load() != 1 {
+		t.Errorf("POST fallthrough: %d, %d host hits", code, hookHits.Load())
+	}
+	if _, body := get("GET", "/main.js", ""); body != "js" {
+		t.Errorf("host route: %q", body)
+	}
+	if code, body := get("GET", "/", ""); code != 200 || body != "index" {
+		t.Errorf("fallback: %d %q", code, body)
+	}
+	// A proxy rule answers before the module, even with a 404
+	if code, body := get("GET", "/api/mock/user", ""); code != 404 || body != "upstream /api/mock/user\n" || upstreamHits.Load() != 1 {
+		t.Errorf("proxy rule: %d %q, %d upstream hits", code, body, upstreamHits.Load())
+	}
+	if s.Value() != "running" || !strings.Contains(logs.String(), "module started") || !strings.Contains(logs.String(), "without -race") {
+		t.Errorf("value %q, logs = %s", s.Value(), logs.String())
+	}
+
+	module, err := os.ReadFile(s.ModulePath())
+	if err != nil || !bytes.HasPrefix(module, []byte("\x00asm")) {
+		t.Fatalf("no wasip1 module at %s: %v", s.ModulePath(), err)
+	}
+
+	// A new file rebuilds and restarts the module
+	extra := filepath.Join(src, "extra.go")
+	os.WriteFile(extra, []byte("package main\n\nfunc init() { hits = 10 }\n"), 0644)
+	if err := s.NewFileEvent("extra.go", ".go", extra, "create"); err != nil {
+		t.Fatal(err)
+	}
+	if _, body := get("PUT", "/api/echo", ""); !strings.HasSuffix(body, " 11") {
+		t.Errorf("after create: %q", body)
+	}
+
+	// A broken save keeps the last good module running
+	os.WriteFile(filepath.Join(src, "main.go"), []byte("package main\n\nfunc main() {"), 0644)
+	if err := s.NewFileEvent("main.go", ".go", filepath.Join(src, "main.go"), "write"); err == nil {
+		t.Error("broken build accepted")
+	}
+	if code, body := get("PUT", "/api/echo", ""); code != 200 || !strings.HasSuffix(body, " 12") {
+		t.Errorf("after failed build: %d %q", code, body)
+	}
+}
+
+func TestWasiServer_UnbuiltModule(t *testing.T) {
+	s := app.NewWasiServer()
+	if s.Value() != "stopped" {
+		t.Errorf("value = %q", s.Value())
+	}
+	var hits atomic.Int32
+	var got []string
+	s.RegisterRoutes(app.DeferCatchAll(func(mux *http.ServeMux) {
+		mux.HandleFunc("POST /api/items", func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			body, _ := io.ReadAll(r.Body)
+			got = append(got, string(body))
+			http.NotFound(w, r)
+		})
+		mux.HandleFunc("GET /api/list", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "list") })
+		mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "index") })
+	}))
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader("item")))
+		return rec
+	}
+
+	if rec := serve("GET", "/api"); rec.Code != 200 || rec.Body.String() != "index" {
+		t.Errorf("catch-all: %d %q", rec.Code, rec.Body.String())
+	}
+	// A host 404 reaches the module; the handler is not run again
+	if rec := serve("POST", "/api/items"); rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "not built") {
+		t.Errorf("unbuilt module: %d %q", rec.Code, rec.Body.String())
+	}
+	if hits.Load() != 1 || len(got) != 1 || got[0] != "item" {
+		t.Errorf("host handler ran %d times with %q", hits.Load(), got)
+	}
+	// A wrong method is tried on the module first; without one the host's
+	// 405 stands
+	if rec := serve("DELETE", "/api/list"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("405 fallthrough: %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestInitBuildHandlers_NilServerFactoryFallsBack(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module testapp\ngo 1.21\n"), 0644)
+
+	h := NewTestHandler(tmpDir)
+	h.Browser = &MockBrowser{}
+	h.Tui = newUiMockTest()
+	h.GitHandler = &MockGitClient{}
+	var logged []string
+	h.Logger = func(messages ...any) { logged = append(logged, fmt.Sprint(messages...)) }
+	h.GoModHandler = &MockGoModHandler{}
+	h.DB = &MockDB{data: map[string]string{}}
+	h.SetServerFactory(func(chan bool, app.TuiInterface, app.BrowserInterface) app.ServerInterface {
+		var wasi *app.WasiServer // typed nil, as an unavailable backend returns
+		return wasi
+	})
+
+	h.InitBuildHandlers()
+
+	if _, ok := h.Server.(*server.ServerHandler); !ok {
+		t.Fatalf("server = %T", h.Server)
+	}
+	if !strings.Contains(strings.Join(logged, "\n"), "falling back") {
+		t.Errorf("logged = %q", logged)
+	}
+}
@@ -0,0 +1,149 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/app"
+	"github.com/tinywasm/kvdb"
+)
+
+func newBudgetDB(t *testing.T, kv map[string]string) app.DB {
+	t.Helper()
+	db, err := kvdb.New(filepath.Join(t.TempDir(), ".env"), nil, app.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range kv {
+		db.Set(k, v)
+	}
+	return db
+}
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int{"512": 512, "600KB": 600 << 10, "1.5mb": 3 << 19, " 2 MB ": 2 << 20, "10B": 10} {
+		if got, err := app.ParseSize(in); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "big", "-1KB"} {
+		if _, err := app.ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) should fail", in)
+		}
+	}
+}
+
+func TestLoadWasmBudget(t *testing.T) {
+	db := newBudgetDB(t, map[string]string{
+		app.StoreKeyWasmBudget:         "2MB",
+		app.StoreKeyWasmGzipBudget:     "600KB",
+		app.StoreKeyWasmPackageBudgets: "runtime:1MB, github.com/acme/ui:80KB,broken",
+	})
+	b, err := app.LoadWasmBudget(db)
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("malformed entry should be reported, got %v", err)
+	}
+	if b.Total != 2<<20 || b.Gzip != 600<<10 || b.Packages["runtime"] != 1<<20 || b.Packages["github.com/acme/ui"] != 80<<10 {
+		t.Errorf("budget = %+v", b)
+	}
+}
+
+func TestWasmBudget_Check(t *testing.T) {
+	r := &app.WasmSizeReport{Total: 3000, Gzip: 900, Packages: []app.WasmPackageSize{
+		{Package: "runtime", Size: 2000}, {Package: "main", Size: 500},
+	}}
+	b := app.WasmBudget{Total: 2000, Gzip: 1000, Packages: map[string]int{"runtime": 1500, "main": 800}}
+	v := b.Check(r)
+	if len(v) != 2 || !strings.HasPrefix(v[0], "total ") || !strings.HasPrefix(v[1], "runtime ") {
+		t.Errorf("violations = %q", v)
+	}
+	if v := (app.WasmBudget{}).Check(r); v != nil {
+		t.Errorf("empty budget should never be exceeded: %q", v)
+	}
+}
+
+func TestWasmSizeHandler_BudgetAndHistory(t *testing.T) {
+	db := newBudgetDB(t, map[string]string{app.StoreKeyWasmBudget: "40B"})
+	builds := [][]byte{buildWasm(nil, body(1)), buildWasm(nil, body(10), body(30))}
+	h := app.NewWasmSizeHandler(func() ([]byte, string, error) {
+		b := builds[0]
+		builds = builds[1:]
+		return b, "L", nil
+	})
+	var logs []string
+	h.SetLog(func(msg ...any) { logs = append(logs, fmt.Sprint(msg...)) })
+	h.SetStore(db, false)
+
+	if _, err := h.Analyze(); err != nil {
+		t.Fatal(err)
+	}
+	h.NoteEdit("web/client.go")
+	r, err := h.Analyze()
+	if err != nil {
+		t.Fatalf("non-strict mode should only warn: %v", err)
+	}
+	if len(r.Violations) != 1 || r.Trigger != "web/client.go" {
+		t.Errorf("report = %+v", r)
+	}
+	if !strings.Contains(h.Value(), "over budget") || !strings.Contains(strings.Join(logs, "\n"), "budget exceeded") {
+		t.Errorf("value %q / logs %q should warn", h.Value(), logs)
+	}
+
+	hist := app.WasmSizeHistory(db)
+	if len(hist) != 2 {
+		t.Fatalf("history = %+v", hist)
+	}
+	if hist[0].OverBudget || hist[0].Trigger != "" || !hist[1].OverBudget || hist[1].Trigger != "web/client.go" || hist[1].Total != r.Total {
+		t.Errorf("history = %+v", hist)
+	}
+
+	// Strict (headless) mode fails the build but still returns the report
+	builds = [][]byte{buildWasm(nil, body(50))}
+	h.SetStore(db, true)
+	r, err = h.Analyze()
+	var budgetErr *app.WasmBudgetError
+	if !errors.As(err, &budgetErr) || r == nil || len(budgetErr.Violations) != 1 {
+		t.Errorf("strict mode: report %+v, err %v", r, err)
+	}
+	if len(h.History()) != 3 {
+		t.Errorf("every build is recorded, got %d", len(h.History()))
+	}
+}
+
+func TestWasmSizeHistory_KeepsNewestBuilds(t *testing.T) {
+	db := newBudgetDB(t, nil)
+	h := app.NewWasmSizeHandler(func() ([]byte, string, error) {
+		return buildWasm(nil, body(1)), "L", nil
+	})
+	h.SetStore(db, false)
+	for i := 0; i < 55; i++ {
+		h.NoteEdit(fmt.Sprintf("web/f%d.go", i))
+		if _, err := h.Analyze(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hist := h.History()
+	if len(hist) != 50 || hist[0].Trigger != "web/f5.go" || hist[49].Trigger != "web/f54.go" {
+		t.Errorf("history length %d, first %+v", len(hist), hist[0])
+	}
+}
+
+func TestWasmSizeHandler_AdmitRejectsBuildsOverBudget(t *testing.T) {
+	db := newBudgetDB(t, map[string]string{app.StoreKeyWasmBudget: "40B"})
+	h := app.NewWasmSizeHandler(nil)
+	h.SetStore(db, true)
+
+	if err := h.Admit(buildWasm(nil, body(1))); err != nil {
+		t.Errorf("build within budget rejected: %v", err)
+	}
+	var budgetErr *app.WasmBudgetError
+	if err := h.Admit(buildWasm(nil, body(50))); !errors.As(err, &budgetErr) {
+		t.Errorf("Admit() = %v, want a *WasmBudgetError", err)
+	}
+	if h.Report() != nil || len(h.History()) != 0 {
+		t.Error("Admit must not record a report or history")
+	}
+}
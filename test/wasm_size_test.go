@@ -0,0 +1,227 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tinywasm/app"
+)
+
+func uleb(n int) []byte {
+	var out []byte
+	for {
+		c := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(out, c)
+		}
+		out = append(out, c|0x80)
+	}
+}
+
+func wasmSection(id byte, payload ...byte) []byte {
+	return append(append([]byte{id}, uleb(len(payload))...), payload...)
+}
+
+func wasmName(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+// buildWasm assembles a module with one imported function followed by one
+// defined function per body, named by names (index 0 is the import).
+func buildWasm(names []string, bodies ...[]byte) []byte {
+	out := []byte("\x00asm\x01\x00\x00\x00")
+
+	imp := []byte{1}
+	imp = append(imp, wasmName("go")...)
+	imp = append(imp, wasmName("debug")...)
+	imp = append(imp, 0, 0) // func, type 0
+	out = append(out, wasmSection(2, imp...)...)
+
+	code := []byte{byte(len(bodies))}
+	for _, b := range bodies {
+		code = append(code, byte(len(b)))
+		code = append(code, b...)
+	}
+	out = append(out, wasmSection(10, code...)...)
+	out = append(out, wasmSection(11, 0, 'd', 'a', 't', 'a')...)
+
+	if names != nil {
+		fn := []byte{byte(len(names))}
+		for i, n := range names {
+			fn = append(fn, byte(i))
+			fn = append(fn, wasmName(n)...)
+		}
+		sub := append(append([]byte{1}, uleb(len(fn))...), fn...)
+		out = append(out, wasmSection(0, append(wasmName("name"), sub...)...)...)
+	}
+	return out
+}
+
+func body(n int) []byte { return make([]byte, n) }
+
+func TestAnalyzeWasm_AttributesFunctionsToPackages(t *testing.T) {
+	data := buildWasm([]string{
+		"go.debug", // import, not a body
+		"runtime.mallocgc",
+		"runtime.__mheap_.alloc",
+		"github.com_tinywasm_fmt.Sprintf",
+		"syscall_js.Value.Get",
+		"(*internal/task.Task).Resume",
+		"type_.eq.main.T",
+	}, body(20), body(10), body(15), body(8), body(6), body(4))
+
+	r, err := app.AnalyzeWasm(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Total != len(data) || r.Gzip == 0 || !r.Named || r.Functions != 6 {
+		t.Fatalf("unexpected totals: %+v", r)
+	}
+
+	want := map[string][2]int{ // package -> size (body + 1 length byte), functions
+		"runtime":                 {32, 2},
+		"github.com/tinywasm/fmt": {16, 1},
+		"syscall/js":              {9, 1},
+		"internal/task":           {7, 1},
+		"(other)":                 {5, 1},
+		"(data)":                  {7, 0},
+	}
+	if len(r.Packages) != len(want) {
+		t.Fatalf("packages = %+v", r.Packages)
+	}
+	for _, p := range r.Packages {
+		w, ok := want[p.Package]
+		if !ok || p.Size != w[0] || p.Functions != w[1] {
+			t.Errorf("package %q: size %d functions %d, want %v", p.Package, p.Size, p.Functions, w)
+		}
+	}
+	if r.Packages[0].Package != "runtime" {
+		t.Errorf("packages not sorted by size: %+v", r.Packages)
+	}
+
+	var sections []string
+	for _, s := range r.Sections {
+		sections = append(sections, s.Name)
+	}
+	if got := strings.Join(sections, ","); got != "import,code,data,custom:name" {
+		t.Errorf("sections = %s", got)
+	}
+}
+
+func TestAnalyzeWasm_StrippedBinary(t *testing.T) {
+	r, err := app.AnalyzeWasm(buildWasm(nil, body(5), body(5)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Named || r.Packages[0].Package != "(unnamed)" || r.Packages[0].Functions != 2 {
+		t.Errorf("stripped binary should report one unnamed bucket: %+v", r.Packages)
+	}
+}
+
+func TestAnalyzeWasm_RejectsNonWasm(t *testing.T) {
+	if _, err := app.AnalyzeWasm([]byte("<html>")); err == nil {
+		t.Fatal("expected an error for a non-wasm payload")
+	}
+	truncated := buildWasm(nil, body(40))
+	if _, err := app.AnalyzeWasm(truncated[:len(truncated)-10]); err == nil {
+		t.Fatal("expected an error for a truncated binary")
+	}
+}
+
+func TestAnalyzeWasm_MalformedSizes(t *testing.T) {
+	// The largest LEB128 value: as an int it wraps negative
+	huge := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}
+	header := []byte("\x00asm\x01\x00\x00\x00")
+	cases := map[string][]byte{
+		"section size": append(append(append([]byte{}, header...), 10), huge...),
+		"custom name":  append(append([]byte{}, header...), wasmSection(0, append([]byte{0xff, 0xff, 0xff, 0xff, 0x0f}, "x"...)...)...),
+	}
+	for name, data := range cases {
+		if _, err := app.AnalyzeWasm(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// Sizes inside a section stop its decoding instead of panicking
+	code := append(append([]byte{1}, huge...), 0)
+	sub := append(append([]byte{2}, huge...), 0)
+	named := append(wasmName("name"), sub...)
+	data := append(append(append([]byte{}, header...), wasmSection(10, code...)...), wasmSection(0, named...)...)
+	r, err := app.AnalyzeWasm(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Functions != 0 || r.Named {
+		t.Errorf("malformed sections decoded: %d functions, named %v", r.Functions, r.Named)
+	}
+}
+
+func TestWasmSizeHandler_ReportsDeltaVsPreviousBuild(t *testing.T) {
+	builds := [][]byte{buildWasm(nil, body(10)), buildWasm(nil, body(10), body(30))}
+	var logs []string
+	h := app.NewWasmSizeHandler(func() ([]byte, string, error) {
+		b := builds[0]
+		builds = builds[1:]
+		return b, "L", nil
+	})
+	h.SetLog(func(msg ...any) { logs = append(logs, fmt.Sprint(msg...)) })
+
+	if h.Value() != "-" {
+		t.Errorf("value before first build = %q", h.Value())
+	}
+	first, err := h.Analyze()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := h.Analyze()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Previous != first.Total || second.Delta != second.Total-first.Total || second.Mode != "L" {
+		t.Errorf("delta not computed: %+v", second)
+	}
+	if !strings.Contains(h.Value(), "(+") {
+		t.Errorf("value should show growth, got %q", h.Value())
+	}
+	if h.Report() != second || len(logs) != 2 {
+		t.Errorf("report %p / logs %q", h.Report(), logs)
+	}
+}
+
+func TestWasmSizeHandler_QueueRunsOneAnalysisAtATime(t *testing.T) {
+	h := app.NewWasmSizeHandler(nil)
+	release := make(chan struct{})
+	ran := make(chan int, 10)
+	var n int
+	analyze := func() {
+		n++
+		ran <- n
+		<-release
+	}
+
+	h.Queue(analyze)
+	if got := <-ran; got != 1 {
+		t.Fatalf("first analysis = %d", got)
+	}
+	// Builds finishing while the first analysis runs share one follow-up
+	h.Queue(analyze)
+	h.Queue(analyze)
+	release <- struct{}{}
+	if got := <-ran; got != 2 {
+		t.Fatalf("follow-up analysis = %d", got)
+	}
+	release <- struct{}{}
+
+	h.Queue(analyze) // idle again: starts a new run
+	if got := <-ran; got != 3 {
+		t.Fatalf("next analysis = %d", got)
+	}
+	release <- struct{}{}
+	select {
+	case got := <-ran:
+		t.Fatalf("unexpected extra analysis %d", got)
+	default:
+	}
+}
@@ -0,0 +1,786 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tinywasm/devwatch"
+)
+
+// StoreKeyWatchTests disables running tests on save when set to "false"
+// (toggled from the TESTS tab).
+const StoreKeyWatchTests = "TINYWASM_WATCH_TESTS"
+
+// Test targets: the host platform, or GOOS=js GOARCH=wasm run through Node.js.
+const (
+	TestTargetServer = "server"
+	TestTargetWasm   = "wasm"
+)
+
+// Test and package statuses.
+const (
+	TestPass = "pass"
+	TestFail = "fail"
+	TestSkip = "skip"
+)
+
+// testDebounce groups the files saved together into one run.
+const testDebounce = 300 * time.Millisecond
+
+// testOutputLines caps the output kept for a failing test (the tail is kept).
+const testOutputLines = 200
+
+// TestCase is the result of one test function or subtest.
+type TestCase struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration"`         // seconds
+	Output   string  `json:"output,omitempty"` // failing tests only
+}
+
+// PackageTests is the result of testing one package for one target.
+type PackageTests struct {
+	Package  string     `json:"package"`
+	Target   string     `json:"target"`
+	Status   string     `json:"status"`
+	Duration float64    `json:"duration"`         // seconds
+	Output   string     `json:"output,omitempty"` // build errors and failures outside a test
+	Tests    []TestCase `json:"tests,omitempty"`
+}
+
+// TestRun is the outcome of one go test round.
+type TestRun struct {
+	Time     time.Time      `json:"time"`
+	Trigger  string         `json:"trigger,omitempty"` // saved files or the requested patterns
+	Passed   int            `json:"passed"`            // packages
+	Failed   int            `json:"failed"`
+	Skipped  int            `json:"skipped"`
+	Packages []PackageTests `json:"packages"`
+}
+
+// TestRunner runs go test for the packages affected by each saved .go file,
+// shown in the TESTS tab. Affected packages are the ones whose
+// tests import the changed package, directly or through other packages of
+// the module, as the PackageGraph tells without running the go command.
+// A package is also tested under GOOS=js GOARCH=wasm when it has test files
+// only the wasm build sees (e.g. //go:build wasm), the rule devflow uses.
+type TestRunner struct {
+	mu      sync.Mutex
+	run     sync.Mutex // one go test round at a time
+	db      DB
+	rootDir string
+	enabled bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	last    *TestRun
+	pending []string // saved files waiting for the next round
+	timer   *time.Timer
+	cover   *Coverage
+	graph   *PackageGraph
+	log     func(message ...any)
+}
+
+// NewTestRunner reads the watch toggle from db (enabled by default). Running
+// tests are killed once exit is closed.
+func NewTestRunner(db DB, rootDir string, exit <-chan bool) *TestRunner {
+	r := &TestRunner{db: db, rootDir: rootDir, enabled: true, graph: NewPackageGraph(rootDir)}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	if exit != nil {
+		go func() {
+			<-exit
+			r.cancel()
+		}()
+	}
+	if db != nil {
+		if v, err := db.Get(StoreKeyWatchTests); err == nil && v == "false" {
+			r.enabled = false
+		}
+	}
+	return r
+}
+
+func (r *TestRunner) Name() string { return "Tests" }
+
+// Label summarizes the last run, e.g. "Watch Tests (3 ok, 1 FAIL)".
+func (r *TestRunner) Label() string {
+	last := r.Last()
+	switch {
+	case last == nil:
+		return "Watch Tests"
+	case last.Failed > 0:
+		return fmt.Sprintf("Watch Tests (%d ok, %d FAIL)", last.Passed, last.Failed)
+	}
+	return fmt.Sprintf("Watch Tests (%d ok)", last.Passed)
+}
+
+// Value implements HandlerEdit.Value, e.g. "WatchTests:T".
+func (r *TestRunner) Value() string {
+	if r.Enabled() {
+		return "WatchTests:T"
+	}
+	return "WatchTests:F"
+}
+
+// Change implements HandlerEdit.Change, accepting "WatchTests:T" or "WatchTests:F".
+func (r *TestRunner) Change(newValue string) {
+	key, val, ok := strings.Cut(newValue, ":")
+	if !ok || strings.TrimSpace(key) != "WatchTests" {
+		return
+	}
+	val = strings.ToLower(strings.TrimSpace(val))
+	r.SetEnabled(val == "t" || val == "true")
+}
+
+func (r *TestRunner) SetLog(f func(message ...any)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log = f
+}
+
+// Enabled reports whether saving a .go file runs the affected tests.
+func (r *TestRunner) Enabled() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enabled
+}
+
+// SetEnabled toggles running tests on save and persists the choice.
+func (r *TestRunner) SetEnabled(on bool) {
+	r.mu.Lock()
+	r.enabled = on
+	db := r.db
+	r.mu.Unlock()
+	if db != nil {
+		db.Set(StoreKeyWatchTests, strconv.FormatBool(on))
+	}
+	if on {
+		r.logf("Tests run for the packages affected by each saved file")
+	} else {
+		r.logf("Tests on save disabled")
+	}
+}
+
+// SetCoverage makes test rounds collect coverage into c while it is enabled.
+func (r *TestRunner) SetCoverage(c *Coverage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cover = c
+}
+
+// SetGraph shares g, kept up to date by the watcher, instead of the
+// runner's own package graph.
+func (r *TestRunner) SetGraph(g *PackageGraph) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.graph = g
+}
+
+// Coverage returns the coverage collected by the runner, nil if none.
+func (r *TestRunner) Coverage() *Coverage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cover
+}
+
+// Last returns the last completed run, nil before the first one.
+func (r *TestRunner) Last() *TestRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+// Watcher returns the handler that queues a test round for each saved .go file.
+func (r *TestRunner) Watcher() devwatch.FilesEventHandlers { return testWatcher{r} }
+
+// RunAll is the TESTS tab action that tests every package of the module.
+func (r *TestRunner) RunAll() any { return testRunAll{r} }
+
+// Changed queues a test round for the packages affected by file; files saved
+// within testDebounce of each other share one round.
+func (r *TestRunner) Changed(file string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.graph.Changed(file)
+	r.pending = append(r.pending, file)
+	if r.timer == nil {
+		r.timer = time.AfterFunc(testDebounce, r.runPending)
+	} else {
+		r.timer.Reset(testDebounce)
+	}
+}
+
+func (r *TestRunner) runPending() {
+	r.run.Lock()
+	defer r.run.Unlock()
+	r.mu.Lock()
+	files := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+	if len(files) == 0 {
+		return // taken by the round that just finished
+	}
+	plan, err := r.affected(files)
+	if err != nil {
+		r.logf("Tests:", err)
+		return
+	}
+	if plan.empty() {
+		return
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, r.rel(f))
+	}
+	r.execute(plan, "", strings.Join(dedupe(names), ", "))
+}
+
+// Run tests the packages matching patterns (relative to the project root,
+// e.g. "./models" or "./..."), only the tests matching the -run regexp run
+// when it is not empty. target is TestTargetServer, TestTargetWasm or "" for
+// every target each package has tests for.
+func (r *TestRunner) Run(patterns []string, run, target string) (*TestRun, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	r.run.Lock()
+	defer r.run.Unlock()
+	plan, err := r.listPlan(patterns, target)
+	if err != nil {
+		return nil, err
+	}
+	trigger := strings.Join(patterns, " ")
+	if run != "" {
+		trigger += " -run " + run
+	}
+	return r.execute(plan, run, trigger), nil
+}
+
+// testPlan lists the packages to test per target.
+type testPlan struct {
+	server, wasm []string
+}
+
+func (p testPlan) empty() bool { return len(p.server) == 0 && len(p.wasm) == 0 }
+
+// PackageInfo holds the package fields the runner reads, from go list or
+// the PackageGraph.
+type PackageInfo struct {
+	ImportPath   string
+	Dir          string
+	Imports      []string
+	TestImports  []string
+	XTestImports []string
+	TestGoFiles  []string
+	XTestGoFiles []string
+}
+
+func (p PackageInfo) testFiles() []string {
+	return append(append([]string{}, p.TestGoFiles...), p.XTestGoFiles...)
+}
+
+// goList lists patterns in the project root with the extra env.
+func (r *TestRunner) goList(env []string, patterns ...string) (map[string]PackageInfo, error) {
+	args := append([]string{"list", "-e", "-json=ImportPath,Dir,Imports,TestImports,XTestImports,TestGoFiles,XTestGoFiles"}, patterns...)
+	cmd := exec.CommandContext(r.ctx, "go", args...)
+	cmd.Dir = r.rootDir
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	pkgs := map[string]PackageInfo{}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var p PackageInfo
+		if err := dec.Decode(&p); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("go list: %w", err)
+		}
+		pkgs[p.ImportPath] = p
+	}
+	return pkgs, nil
+}
+
+var wasmTestEnv = []string{"GOOS=js", "GOARCH=wasm"}
+
+// listPlan plans the packages matching patterns for target ("" for both).
+func (r *TestRunner) listPlan(patterns []string, target string) (testPlan, error) {
+	native, err := r.goList(nil, patterns...)
+	if err != nil {
+		return testPlan{}, err
+	}
+	wasm, err := r.goList(wasmTestEnv, patterns...)
+	if err != nil {
+		return testPlan{}, err
+	}
+	var names []string
+	for name := range native {
+		names = append(names, name)
+	}
+	for name := range wasm {
+		if _, ok := native[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	return planTargets(names, native, wasm, target), nil
+}
+
+// affected plans the packages whose tests depend on the saved files.
+func (r *TestRunner) affected(files []string) (testPlan, error) {
+	r.mu.Lock()
+	graph := r.graph
+	r.mu.Unlock()
+	native, err := graph.Packages(TestTargetServer)
+	if err != nil {
+		return testPlan{}, err
+	}
+	wasm, err := graph.Packages(TestTargetWasm)
+	if err != nil {
+		return testPlan{}, err
+	}
+	dirs := map[string]bool{}
+	for _, f := range files {
+		if abs, err := filepath.Abs(f); err == nil {
+			f = abs
+		}
+		dirs[filepath.Dir(f)] = true
+	}
+	names := append(affectedPackages(native, dirs), affectedPackages(wasm, dirs)...)
+	return planTargets(dedupe(names), native, wasm, ""), nil
+}
+
+// affectedPackages returns the packages of pkgs (by import path) whose tests
+// depend on a package in one of dirs: the packages themselves, the packages
+// importing them transitively, and the packages whose tests import either.
+func affectedPackages(pkgs map[string]PackageInfo, dirs map[string]bool) []string {
+	changed := map[string]bool{}
+	for name, p := range pkgs {
+		if dirs[p.Dir] {
+			changed[name] = true
+		}
+	}
+	for grew := true; grew; {
+		grew = false
+		for name, p := range pkgs {
+			if changed[name] {
+				continue
+			}
+			for _, imp := range p.Imports {
+				if changed[imp] {
+					changed[name], grew = true, true
+					break
+				}
+			}
+		}
+	}
+	var out []string
+	for name, p := range pkgs {
+		hit := changed[name]
+		for _, imp := range p.TestImports {
+			hit = hit || changed[imp]
+		}
+		for _, imp := range p.XTestImports {
+			hit = hit || changed[imp]
+		}
+		if hit && len(p.testFiles()) > 0 {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// planTargets splits names into targets: the server target for packages
+// with host test files, the wasm one for packages with test files only the
+// wasm build sees. An explicit target tests every package that has test
+// files for it.
+func planTargets(names []string, native, wasm map[string]PackageInfo, target string) testPlan {
+	var plan testPlan
+	sort.Strings(names)
+	for _, name := range names {
+		n, w := native[name], wasm[name]
+		hostFiles := map[string]bool{}
+		for _, f := range n.testFiles() {
+			hostFiles[f] = true
+		}
+		wasmOnly := false
+		for _, f := range w.testFiles() {
+			wasmOnly = wasmOnly || !hostFiles[f]
+		}
+		switch target {
+		case TestTargetServer:
+			if len(hostFiles) > 0 {
+				plan.server = append(plan.server, name)
+			}
+		case TestTargetWasm:
+			if len(w.testFiles()) > 0 {
+				plan.wasm = append(plan.wasm, name)
+			}
+		default:
+			if len(hostFiles) > 0 {
+				plan.server = append(plan.server, name)
+			}
+			if wasmOnly {
+				plan.wasm = append(plan.wasm, name)
+			}
+		}
+	}
+	return plan
+}
+
+// execute runs the plan, logs the results and keeps them as the last run.
+func (r *TestRunner) execute(plan testPlan, run, trigger string) *TestRun {
+	result := &TestRun{Time: time.Now(), Trigger: trigger}
+	if len(plan.server) > 0 {
+		result.Packages = append(result.Packages, r.goTest(TestTargetServer, plan.server, run)...)
+	}
+	if len(plan.wasm) > 0 {
+		result.Packages = append(result.Packages, r.goTest(TestTargetWasm, plan.wasm, run)...)
+	}
+	for _, p := range result.Packages {
+		switch p.Status {
+		case TestPass:
+			result.Passed++
+		case TestFail:
+			result.Failed++
+		default:
+			result.Skipped++
+		}
+	}
+	if r.ctx.Err() != nil {
+		return result // shutting down: the results are partial
+	}
+	r.report(result)
+	r.mu.Lock()
+	r.last = result
+	r.mu.Unlock()
+	return result
+}
+
+// goTest runs go test -json for pkgs on target.
+func (r *TestRunner) goTest(target string, pkgs []string, run string) []PackageTests {
+	args := []string{"test", "-json"}
+	if run != "" {
+		args = append(args, "-run", run)
+	}
+	// A -run subset would understate coverage, so only full runs collect it
+	var profile string
+	if cov := r.Coverage(); cov != nil && cov.Enabled() && run == "" {
+		if f, err := os.CreateTemp("", "tinywasm-cover-*.out"); err == nil {
+			profile = f.Name()
+			f.Close()
+			defer os.Remove(profile)
+			args = append(args, "-coverprofile="+profile)
+		}
+	}
+	args = append(args, pkgs...)
+	cmd := exec.CommandContext(r.ctx, "go", args...)
+	cmd.Dir = r.rootDir
+	cmd.Env = os.Environ()
+	if target == TestTargetWasm {
+		execDir, err := wasmExecDir()
+		if err != nil {
+			return skipPackages(target, pkgs, err.Error())
+		}
+		cmd.Env = append(cmd.Env, wasmTestEnv...)
+		cmd.Env = append(cmd.Env, "PATH="+execDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	results := ParseTestJSON(out, target)
+	if profile != "" {
+		if data, readErr := os.ReadFile(profile); readErr == nil {
+			if covErr := r.Coverage().Record(target, data); covErr != nil {
+				r.logf("Coverage:", covErr)
+			}
+		}
+	}
+	if len(results) == 0 && err != nil {
+		// go test failed before running anything, e.g. a bad -run regexp
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		for _, name := range pkgs {
+			results = append(results, PackageTests{Package: name, Target: target, Status: TestFail, Output: msg})
+		}
+	}
+	return results
+}
+
+// wasmExecDir returns the directory of go_js_wasm_exec, which go test uses to
+// run js/wasm test binaries under Node.js.
+func wasmExecDir() (string, error) {
+	if _, err := exec.LookPath("node"); err != nil {
+		return "", errors.New("node not found: wasm tests run under Node.js")
+	}
+	out, err := exec.Command("go", "env", "GOROOT").Output()
+	if err != nil {
+		return "", fmt.Errorf("go env GOROOT: %w", err)
+	}
+	root := strings.TrimSpace(string(out))
+	for _, dir := range []string{filepath.Join(root, "lib", "wasm"), filepath.Join(root, "misc", "wasm")} {
+		if _, err := os.Stat(filepath.Join(dir, "go_js_wasm_exec")); err == nil {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("go_js_wasm_exec not found in %s", root)
+}
+
+func skipPackages(target string, pkgs []string, reason string) []PackageTests {
+	var out []PackageTests
+	for _, name := range pkgs {
+		out = append(out, PackageTests{Package: name, Target: target, Status: TestSkip, Output: reason})
+	}
+	return out
+}
+
+// testEvent is a go test -json (test2json) event.
+type testEvent struct {
+	Action     string
+	Package    string
+	Test       string
+	Elapsed    float64
+	Output     string
+	ImportPath string // build-output events
+}
+
+// ParseTestJSON turns go test -json output into per-package results, in the
+// order the packages finished.
+func ParseTestJSON(data []byte, target string) []PackageTests {
+	type pkgState struct {
+		result PackageTests
+		tests  map[string]*TestCase
+		order  []string
+		output map[string][]string // by test, "" for the package
+		done   bool
+	}
+	states := map[string]*pkgState{}
+	var order []string
+	build := map[string][]string{} // build output by package
+	state := func(name string) *pkgState {
+		s, ok := states[name]
+		if !ok {
+			s = &pkgState{
+				result: PackageTests{Package: name, Target: target},
+				tests:  map[string]*TestCase{},
+				output: map[string][]string{},
+			}
+			states[name] = s
+			order = append(order, name)
+		}
+		return s
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var ev testEvent
+		if json.Unmarshal(scanner.Bytes(), &ev) != nil {
+			continue
+		}
+		if ev.Action == "build-output" {
+			name, _, _ := strings.Cut(ev.ImportPath, " ")
+			build[name] = append(build[name], strings.TrimRight(ev.Output, "\n"))
+			continue
+		}
+		if ev.Package == "" {
+			continue
+		}
+		s := state(ev.Package)
+		switch ev.Action {
+		case "output":
+			s.output[ev.Test] = append(s.output[ev.Test], strings.TrimRight(ev.Output, "\n"))
+		case "pass", "fail", "skip":
+			if ev.Test == "" {
+				s.result.Status, s.result.Duration, s.done = ev.Action, ev.Elapsed, true
+				continue
+			}
+			tc, ok := s.tests[ev.Test]
+			if !ok {
+				tc = &TestCase{Name: ev.Test}
+				s.tests[ev.Test] = tc
+				s.order = append(s.order, ev.Test)
+			}
+			tc.Status, tc.Duration = ev.Action, ev.Elapsed
+		}
+	}
+
+	var out []PackageTests
+	for _, name := range order {
+		s := states[name]
+		if !s.done {
+			continue
+		}
+		for _, test := range s.order {
+			tc := *s.tests[test]
+			if tc.Status == TestFail {
+				tc.Output = tailLines(s.output[test], testOutputLines)
+			}
+			s.result.Tests = append(s.result.Tests, tc)
+		}
+		if s.result.Status == TestFail {
+			lines := build[name]
+			if len(lines) == 0 {
+				// Package output outside a test: panics in init, TestMain, timeouts
+				for _, l := range s.output[""] {
+					if !strings.HasPrefix(l, "FAIL") && l != "" {
+						lines = append(lines, l)
+					}
+				}
+			}
+			s.result.Output = tailLines(lines, testOutputLines)
+		}
+		if s.result.Status == TestSkip && len(s.result.Tests) == 0 {
+			s.result.Output = "no test files"
+		}
+		out = append(out, s.result)
+	}
+	return out
+}
+
+func tailLines(lines []string, n int) string {
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// report logs one line per package and the output of each failing test.
+func (r *TestRunner) report(run *TestRun) {
+	for _, p := range run.Packages {
+		name := p.Package
+		if p.Target == TestTargetWasm {
+			name += " [wasm]"
+		}
+		switch p.Status {
+		case TestPass:
+			r.logf("✓", name, strconv.FormatFloat(p.Duration, 'f', 2, 64)+"s")
+		case TestSkip:
+			r.logf("-", name, p.Output)
+		default:
+			var failed []string
+			for _, tc := range p.Tests {
+				if tc.Status == TestFail {
+					failed = append(failed, tc.Name)
+				}
+			}
+			if len(failed) == 0 {
+				r.logf("✗", name, "failed")
+			} else {
+				r.logf("✗", name+":", strings.Join(failed, ", "))
+			}
+			if p.Output != "" {
+				r.logLines(p.Output)
+			}
+			for _, tc := range p.Tests {
+				if tc.Status == TestFail && tc.Output != "" && !strings.Contains(tc.Name, "/") {
+					r.logLines(tc.Output) // a parent test's output includes its subtests
+				}
+			}
+		}
+	}
+	summary := fmt.Sprintf("Tests: %d passed, %d failed", run.Passed, run.Failed)
+	if run.Skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", run.Skipped)
+	}
+	if run.Trigger != "" {
+		summary += " (" + run.Trigger + ")"
+	}
+	r.logf(summary)
+}
+
+func (r *TestRunner) logLines(text string) {
+	for _, line := range strings.Split(text, "\n") {
+		if line != "" {
+			r.logf(line)
+		}
+	}
+}
+
+// rel returns file relative to the project root, slash-separated.
+func (r *TestRunner) rel(file string) string {
+	if rel, err := filepath.Rel(r.rootDir, file); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return file
+}
+
+func (r *TestRunner) logf(message ...any) {
+	r.mu.Lock()
+	log := r.log
+	r.mu.Unlock()
+	if log != nil {
+		log(message...)
+	}
+}
+
+func dedupe(list []string) []string {
+	seen := map[string]bool{}
+	out := list[:0:0]
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// errBackgroundOnly keeps devwatch from reloading the browser for a file only
+// background handlers (tests, vet) handled: devwatch reloads when any handler
+// returns nil.
+var errBackgroundOnly = errors.New("handled in the background")
+
+// testWatcher feeds saved .go files to the runner.
+type testWatcher struct{ runner *TestRunner }
+
+func (w testWatcher) MainInputFileRelativePath() string { return "" }
+func (w testWatcher) UnobservedFiles() []string         { return nil }
+func (w testWatcher) SupportedExtensions() []string     { return []string{".go"} }
+
+func (w testWatcher) NewFileEvent(fileName, extension, filePath, event string) error {
+	if event == "scan" || !w.runner.Enabled() {
+		return errBackgroundOnly
+	}
+	w.runner.Changed(filePath)
+	return errBackgroundOnly
+}
+
+// testRunAll is the TESTS tab action running every test of the module.
+type testRunAll struct{ runner *TestRunner }
+
+func (a testRunAll) Name() string  { return "RunTests" }
+func (a testRunAll) Label() string { return "Run All Tests" }
+
+func (a testRunAll) Execute() {
+	a.RunAction("", func(error) {})
+}
+
+// RunAction implements ActionReporter: done is called when the run has finished.
+func (a testRunAll) RunAction(_ string, done func(error)) {
+	go func() {
+		_, err := a.runner.Run(nil, "", "")
+		if err != nil {
+			a.runner.logf("Tests:", err)
+		}
+		done(err)
+	}()
+}
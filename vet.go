@@ -0,0 +1,496 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tinywasm/devwatch"
+)
+
+// StoreKeyVet disables go vet on save when set to "false" (toggled from the
+// BUILD tab).
+const StoreKeyVet = "TINYWASM_VET"
+
+// StoreKeyVetTools lists extra analyzers run with go vet -vettool, comma
+// separated commands or paths (e.g. "shadow,nilness").
+const StoreKeyVetTools = "TINYWASM_VET_TOOLS"
+
+// Build contexts code is vetted in: the wasm client (GOOS=js GOARCH=wasm) and
+// the server (host platform, the !wasm files).
+const (
+	VetContextWasm   = "wasm"
+	VetContextServer = "server"
+)
+
+// Diagnostic is one go vet finding, a type error that kept a package from
+// being analyzed (Analyzer "compile") or a data race of the server ("race").
+type Diagnostic struct {
+	File     string   `json:"file"` // relative to the project root
+	Line     int      `json:"line"`
+	Col      int      `json:"col"`
+	Analyzer string   `json:"analyzer"`
+	Message  string   `json:"message"`
+	Package  string   `json:"package"`
+	Contexts []string `json:"contexts"`         // build contexts reporting it
+	Detail   string   `json:"detail,omitempty"` // full report, e.g. the stacks of a data race
+}
+
+// String formats d like a compiler error, e.g.
+// "web/client.go:7:27: printf: fmt.Printf format %d has arg ... [wasm]".
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s [%s]", d.File, d.Line, d.Col, d.Analyzer, d.Message, strings.Join(d.Contexts, ", "))
+}
+
+// Vet runs go vet for the packages of each saved .go file, in the wasm
+// context when the client main package depends on them and in the server
+// context when the server one does, and logs the findings in the BUILD tab
+// like compile errors. Build-tag-specific mistakes only show up when the
+// files of that tag are analyzed, hence both passes.
+type Vet struct {
+	mu        sync.Mutex
+	run       sync.Mutex // one vet round at a time
+	db        DB
+	rootDir   string
+	clientDir string // main package of each context, relative to rootDir
+	serverDir string
+	enabled   bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	findings  map[string][]Diagnostic // by context + " " + package
+	pending   []string
+	timer     *time.Timer
+	log       func(message ...any)
+	graph     *PackageGraph
+}
+
+// NewVet reads the toggle from db (enabled by default). clientDir and
+// serverDir are the main package directories of the wasm client and the
+// server. Running analyses are killed once exit is closed.
+func NewVet(db DB, rootDir, clientDir, serverDir string, exit <-chan bool) *Vet {
+	v := &Vet{
+		db:        db,
+		rootDir:   rootDir,
+		clientDir: clientDir,
+		serverDir: serverDir,
+		enabled:   true,
+		findings:  map[string][]Diagnostic{},
+		graph:     NewPackageGraph(rootDir),
+	}
+	v.ctx, v.cancel = context.WithCancel(context.Background())
+	if exit != nil {
+		go func() {
+			<-exit
+			v.cancel()
+		}()
+	}
+	if db != nil {
+		if val, err := db.Get(StoreKeyVet); err == nil && val == "false" {
+			v.enabled = false
+		}
+	}
+	return v
+}
+
+func (v *Vet) Name() string { return "Vet" }
+
+// Label shows the number of open findings, e.g. "Go Vet (2 findings)".
+func (v *Vet) Label() string {
+	switch n := len(v.Diagnostics("")); n {
+	case 0:
+		return "Go Vet"
+	case 1:
+		return "Go Vet (1 finding)"
+	default:
+		return fmt.Sprintf("Go Vet (%d findings)", n)
+	}
+}
+
+// Value implements HandlerEdit.Value, e.g. "Vet:T".
+func (v *Vet) Value() string {
+	if v.Enabled() {
+		return "Vet:T"
+	}
+	return "Vet:F"
+}
+
+// Change implements HandlerEdit.Change, accepting "Vet:T" or "Vet:F".
+func (v *Vet) Change(newValue string) {
+	key, val, ok := strings.Cut(newValue, ":")
+	if !ok || strings.TrimSpace(key) != "Vet" {
+		return
+	}
+	val = strings.ToLower(strings.TrimSpace(val))
+	v.SetEnabled(val == "t" || val == "true")
+}
+
+func (v *Vet) SetLog(f func(message ...any)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.log = f
+}
+
+// Enabled reports whether saving a .go file vets its package.
+func (v *Vet) Enabled() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.enabled
+}
+
+// SetEnabled toggles go vet on save and persists the choice.
+func (v *Vet) SetEnabled(on bool) {
+	v.mu.Lock()
+	v.enabled = on
+	db := v.db
+	v.mu.Unlock()
+	if db != nil {
+		db.Set(StoreKeyVet, strconv.FormatBool(on))
+	}
+	if on {
+		v.logf("go vet runs on the packages of each saved file")
+	} else {
+		v.logf("go vet on save disabled")
+	}
+}
+
+// Tools returns the extra analyzers configured in StoreKeyVetTools.
+func (v *Vet) Tools() []string {
+	if v.db == nil {
+		return nil
+	}
+	val, err := v.db.Get(StoreKeyVetTools)
+	if err != nil {
+		return nil
+	}
+	var tools []string
+	for _, t := range strings.Split(val, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tools = append(tools, t)
+		}
+	}
+	return tools
+}
+
+// Diagnostics returns the open findings, of file only when not empty
+// (relative to the project root), sorted by position.
+func (v *Vet) Diagnostics(file string) []Diagnostic {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	merged := map[string]*Diagnostic{}
+	var keys []string
+	for _, list := range v.findings {
+		for _, d := range list {
+			if file != "" && d.File != filepath.ToSlash(file) {
+				continue
+			}
+			k := fmt.Sprintf("%s:%08d:%08d:%s:%s", d.File, d.Line, d.Col, d.Analyzer, d.Message)
+			if m, ok := merged[k]; ok {
+				m.Contexts = dedupe(append(m.Contexts, d.Contexts...))
+				// wasm first, whichever context was vetted last
+				sort.Slice(m.Contexts, func(i, j int) bool { return m.Contexts[i] == VetContextWasm && m.Contexts[j] != VetContextWasm })
+				continue
+			}
+			d.Contexts = append([]string{}, d.Contexts...)
+			merged[k] = &d
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	out := []Diagnostic{}
+	for _, k := range keys {
+		out = append(out, *merged[k])
+	}
+	return out
+}
+
+// SetGraph shares g, kept up to date by the watcher, instead of the vet's
+// own package graph.
+func (v *Vet) SetGraph(g *PackageGraph) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.graph = g
+}
+
+// Watcher returns the handler that vets the package of each saved .go file.
+func (v *Vet) Watcher() devwatch.FilesEventHandlers { return vetWatcher{v} }
+
+// Changed queues file's package for the next round; files saved within
+// testDebounce of each other share one round.
+func (v *Vet) Changed(file string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.graph.Changed(file)
+	v.pending = append(v.pending, file)
+	if v.timer == nil {
+		v.timer = time.AfterFunc(testDebounce, v.runPending)
+	} else {
+		v.timer.Reset(testDebounce)
+	}
+}
+
+func (v *Vet) runPending() {
+	v.mu.Lock()
+	files := v.pending
+	v.pending = nil
+	v.mu.Unlock()
+	if len(files) == 0 {
+		return
+	}
+	dirs := map[string]bool{}
+	for _, f := range files {
+		dirs[filepath.Dir(f)] = true
+	}
+	if _, err := v.vet(dirs); err != nil {
+		v.logf("go vet:", err)
+	}
+}
+
+// RunAll vets every package of the module both binaries depend on and
+// returns all open findings.
+func (v *Vet) RunAll() ([]Diagnostic, error) {
+	return v.vet(nil)
+}
+
+// vet analyzes the packages in dirs (nil: every module package of either
+// binary) and replaces their findings.
+func (v *Vet) vet(dirs map[string]bool) ([]Diagnostic, error) {
+	v.run.Lock()
+	defer v.run.Unlock()
+	plan := map[string][]string{} // context -> import paths
+	seen := map[string]bool{}
+	for _, c := range []struct{ context, dir string }{{VetContextWasm, v.clientDir}, {VetContextServer, v.serverDir}} {
+		pkgs, err := v.modulePackages(c.context, c.dir)
+		if err != nil {
+			return nil, err
+		}
+		for dir, pkg := range pkgs {
+			if dirs == nil || dirs[dir] {
+				plan[c.context] = append(plan[c.context], pkg)
+				seen[dir] = true
+			}
+		}
+	}
+	// Packages neither binary imports (tools, tests helpers) are vetted as server code
+	for dir := range dirs {
+		if !seen[dir] && strings.HasPrefix(dir, v.rootDir) {
+			if rel, err := filepath.Rel(v.rootDir, dir); err == nil {
+				plan[VetContextServer] = append(plan[VetContextServer], "./"+filepath.ToSlash(rel))
+			}
+		}
+	}
+
+	// Both contexts are vetted before the findings are replaced, so readers
+	// never see a finding of a shared package with half its contexts
+	found := map[string][]Diagnostic{} // by context + " " + package
+	for _, context := range []string{VetContextWasm, VetContextServer} {
+		sort.Strings(plan[context])
+		for _, tool := range append([]string{""}, v.Tools()...) {
+			if len(plan[context]) == 0 {
+				break
+			}
+			diags, err := v.goVet(context, tool, plan[context])
+			if err != nil {
+				if v.ctx.Err() != nil {
+					return nil, err
+				}
+				v.logf("go vet:", err)
+				continue
+			}
+			for _, d := range diags {
+				found[context+" "+d.Package] = append(found[context+" "+d.Package], d)
+			}
+		}
+	}
+	var changed []Diagnostic
+	v.mu.Lock()
+	for context, pkgs := range plan {
+		for _, pkg := range pkgs {
+			delete(v.findings, context+" "+pkg)
+		}
+	}
+	for key, diags := range found {
+		v.findings[key] = diags
+		changed = append(changed, diags...)
+	}
+	v.mu.Unlock()
+	v.report(changed)
+	return v.Diagnostics(""), nil
+}
+
+// modulePackages maps the directory of each module package the main package
+// in dir depends on, under context, to its import path.
+func (v *Vet) modulePackages(context, dir string) (map[string]string, error) {
+	v.mu.Lock()
+	g := v.graph
+	v.mu.Unlock()
+	return g.Deps(context, dir)
+}
+
+// goVet runs go vet -json for pkgs in context, with tool as -vettool when set.
+func (v *Vet) goVet(context, tool string, pkgs []string) ([]Diagnostic, error) {
+	args := []string{"vet", "-json"}
+	if tool != "" {
+		path, err := exec.LookPath(tool)
+		if err != nil {
+			return nil, fmt.Errorf("analyzer %s not found: %w", tool, err)
+		}
+		args = append(args, "-vettool="+path)
+	}
+	cmd := exec.CommandContext(v.ctx, "go", append(args, pkgs...)...)
+	cmd.Dir = v.rootDir
+	cmd.Env = os.Environ()
+	if context == VetContextWasm {
+		cmd.Env = append(cmd.Env, wasmTestEnv...)
+	}
+	out, err := cmd.CombinedOutput()
+	diags := ParseVetJSON(out, v.rootDir, context)
+	if err != nil && len(diags) == 0 {
+		if v.ctx.Err() != nil {
+			return nil, v.ctx.Err()
+		}
+		return nil, fmt.Errorf("%v %s", err, strings.TrimSpace(string(out)))
+	}
+	return diags, nil
+}
+
+// ParseVetJSON reads go vet -json output: the JSON findings by package and
+// analyzer, and the "vet: file:line:col: message" type errors printed after
+// the "# package" header of a package that did not type check.
+func ParseVetJSON(out []byte, rootDir, context string) []Diagnostic {
+	var diags []Diagnostic
+	var jsonPart bytes.Buffer
+	pkg := ""
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "# "):
+			if p := strings.Trim(strings.TrimPrefix(line, "# "), "[]"); !strings.Contains(p, " ") {
+				pkg = p
+			}
+		case strings.HasPrefix(line, "vet: "):
+			if d, ok := parsePosition(strings.TrimPrefix(line, "vet: "), rootDir); ok {
+				d.Analyzer, d.Package, d.Contexts = "compile", pkg, []string{context}
+				diags = append(diags, d)
+			}
+		default:
+			jsonPart.WriteString(line + "\n")
+		}
+	}
+
+	type finding struct {
+		Posn    string `json:"posn"`
+		Message string `json:"message"`
+	}
+	dec := json.NewDecoder(&jsonPart)
+	for dec.More() {
+		var byPkg map[string]map[string]json.RawMessage
+		if dec.Decode(&byPkg) != nil {
+			break
+		}
+		for p, analyzers := range byPkg {
+			for analyzer, raw := range analyzers {
+				var list []finding
+				if json.Unmarshal(raw, &list) != nil {
+					var failed struct{ Error struct{ Msg string } }
+					if json.Unmarshal(raw, &failed) == nil && failed.Error.Msg != "" {
+						diags = append(diags, Diagnostic{Analyzer: analyzer, Message: failed.Error.Msg, Package: p, Contexts: []string{context}})
+					}
+					continue
+				}
+				for _, f := range list {
+					d, _ := parsePosition(f.Posn+": ", rootDir)
+					d.Analyzer, d.Message, d.Package, d.Contexts = analyzer, f.Message, p, []string{context}
+					diags = append(diags, d)
+				}
+			}
+		}
+	}
+	sort.Slice(diags, func(i, j int) bool {
+		if diags[i].File != diags[j].File {
+			return diags[i].File < diags[j].File
+		}
+		return diags[i].Line < diags[j].Line
+	})
+	return diags
+}
+
+// parsePosition splits "file:line:col: message", making file relative to rootDir.
+func parsePosition(s, rootDir string) (Diagnostic, bool) {
+	var d Diagnostic
+	parts := strings.SplitN(s, ":", 4)
+	if len(parts) < 4 {
+		return d, false
+	}
+	line, err1 := strconv.Atoi(parts[1])
+	col, err2 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil {
+		return d, false
+	}
+	file := parts[0]
+	if filepath.IsAbs(file) {
+		if rel, err := filepath.Rel(rootDir, file); err == nil {
+			file = rel
+		}
+	}
+	d.File, d.Line, d.Col, d.Message = filepath.ToSlash(file), line, col, strings.TrimSpace(parts[3])
+	return d, true
+}
+
+// report logs the findings of the round, merged across contexts.
+func (v *Vet) report(found []Diagnostic) {
+	files := map[string]bool{}
+	for _, d := range found {
+		files[d.File] = true
+	}
+	shown := map[string]bool{}
+	n := 0
+	for file := range files {
+		for _, d := range v.Diagnostics(file) {
+			if s := d.String(); !shown[s] {
+				shown[s] = true
+				n++
+				v.logf(s)
+			}
+		}
+	}
+	switch total := len(v.Diagnostics("")); {
+	case n > 0:
+		v.logf(fmt.Sprintf("go vet: %d findings (%d open)", n, total))
+	case total > 0:
+		v.logf(fmt.Sprintf("go vet: no new findings (%d open)", total))
+	}
+}
+
+func (v *Vet) logf(message ...any) {
+	v.mu.Lock()
+	log := v.log
+	v.mu.Unlock()
+	if log != nil {
+		log(message...)
+	}
+}
+
+// vetWatcher feeds saved .go files to Vet.
+type vetWatcher struct{ vet *Vet }
+
+func (w vetWatcher) MainInputFileRelativePath() string { return "" }
+func (w vetWatcher) UnobservedFiles() []string         { return nil }
+func (w vetWatcher) SupportedExtensions() []string     { return []string{".go"} }
+
+func (w vetWatcher) NewFileEvent(fileName, extension, filePath, event string) error {
+	if (event == "write" || event == "create") && w.vet.Enabled() {
+		w.vet.Changed(filePath)
+	}
+	return errBackgroundOnly
+}
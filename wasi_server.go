@@ -0,0 +1,699 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/experimental/sock"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// WasiListenFDEnv is the guest variable holding the descriptor of the
+// listener the module serves on.
+const WasiListenFDEnv = "TINYWASM_LISTEN_FD"
+
+// wasiListenFD follows stdio and the preopened project directory.
+const wasiListenFD = 4
+
+const (
+	wasiRequestTimeout = 60 * time.Second      // until the module answers a request
+	wasiStartTimeout   = 10 * time.Second      // until a started module accepts connections
+	wasiMaxSleep       = 10 * time.Millisecond // longest guest sleep, see wasiNanosleep
+	wasiStopTimeout    = 2 * time.Second       // until a closed module returns
+)
+
+// errWasiNotFound is a module 404, answered by the host catch-all instead.
+var errWasiNotFound = errors.New("wasi module: not found")
+
+// WasiServer is the "wasi" server backend: the server sources are compiled
+// to GOOS=wasip1 and run in-process by wazero. One module instance lives
+// until the next build, serving HTTP on the preopened listener whose
+// descriptor is in TINYWASM_LISTEN_FD:
+//
+//	fd, _ := strconv.Atoi(os.Getenv("TINYWASM_LISTEN_FD"))
+//	syscall.SetNonblock(fd, true)
+//	l, _ := net.FileListener(os.NewFile(uintptr(fd), "listener"))
+//	http.Serve(l, mux)
+//
+// Registered routes (proxy rules, release, assets, wasm) answer first; the
+// module gets what they leave unanswered, and a module 404 falls back to the
+// host catch-all (the index).
+type WasiServer struct {
+	appRootDir    string
+	sourceDir     string
+	outputDir     string
+	mainInputFile string
+	port          string
+	compileArgs   func() []string
+	runArgs       func() []string
+	env           func() map[string]string
+	exitChan      chan bool
+	openBrowser   func(port string, https bool)
+	gitIgnoreAdd  func(entry string) error
+	ui            interface{ RefreshUI() }
+	log           func(message ...any)
+
+	mu              sync.Mutex
+	routes          []func(*http.ServeMux)
+	mux             *http.ServeMux
+	srv             *http.Server
+	module          *wasiModule
+	cache           wazero.CompilationCache
+	buildErr        error
+	openBrowserOnce sync.Once
+	buildMu         sync.Mutex // one build and module swap at a time
+}
+
+var _ ServerInterface = (*WasiServer)(nil)
+
+// wasiModule is a running module instance and the reverse proxy to its
+// listener.
+type wasiModule struct {
+	cancel context.CancelFunc
+	proxy  *httputil.ReverseProxy
+	done   chan struct{} // closed once the module returns
+	err    error         // why it returned, set before done closes
+}
+
+// NewWasiServer returns a wasi backend with the same defaults as the
+// tinywasm/server handler.
+func NewWasiServer() *WasiServer {
+	return &WasiServer{
+		appRootDir:    ".",
+		sourceDir:     "web",
+		outputDir:     "web",
+		mainInputFile: "main.go",
+		port:          "6060",
+		compileArgs:   func() []string { return nil },
+		runArgs:       func() []string { return nil },
+		env:           func() map[string]string { return nil },
+		exitChan:      make(chan bool),
+		gitIgnoreAdd:  func(string) error { return nil },
+	}
+}
+
+// SetLogger sets the logger function.
+func (s *WasiServer) SetLogger(fn func(...any)) *WasiServer {
+	s.log = fn
+	return s
+}
+
+// SetExitChan sets the channel that stops StartServer.
+func (s *WasiServer) SetExitChan(ch chan bool) *WasiServer {
+	s.exitChan = ch
+	return s
+}
+
+// SetOpenBrowser sets the function called once the server listens.
+func (s *WasiServer) SetOpenBrowser(fn func(port string, https bool)) *WasiServer {
+	s.openBrowser = fn
+	return s
+}
+
+// SetUI sets the UI refreshed after a change.
+func (s *WasiServer) SetUI(ui interface{ RefreshUI() }) *WasiServer {
+	s.ui = ui
+	return s
+}
+
+// SetGitIgnoreAdd sets the callback that ignores the compiled module.
+func (s *WasiServer) SetGitIgnoreAdd(fn func(entry string) error) *WasiServer {
+	s.gitIgnoreAdd = fn
+	return s
+}
+
+func (s *WasiServer) SetAppRootDir(dir string)          { s.appRootDir = dir }
+func (s *WasiServer) SetSourceDir(dir string)           { s.sourceDir = dir }
+func (s *WasiServer) SetOutputDir(dir string)           { s.outputDir = dir }
+func (s *WasiServer) SetMainInputFile(name string)      { s.mainInputFile = name }
+func (s *WasiServer) SetPort(port string)               { s.port = port }
+func (s *WasiServer) SetCompileArgs(fn func() []string) { s.compileArgs = fn }
+func (s *WasiServer) SetRunArgs(fn func() []string)     { s.runArgs = fn }
+
+// SetEnv sets the variables of the guest; a module sees no host environment.
+func (s *WasiServer) SetEnv(fn func() map[string]string) { s.env = fn }
+
+// SetDisableGlobalCleanup is accepted for parity: the module runs in this
+// process and leaves nothing behind.
+func (s *WasiServer) SetDisableGlobalCleanup(bool) {}
+
+// SetLog implements devtui.Loggable.
+func (s *WasiServer) SetLog(fn func(message ...any)) { s.log = fn }
+
+// RegisterRoutes appends fn to the host routes. Call before StartServer.
+func (s *WasiServer) RegisterRoutes(fn func(*http.ServeMux)) {
+	s.mu.Lock()
+	s.routes = append(s.routes, fn)
+	s.mux = nil
+	s.mu.Unlock()
+}
+
+// ModulePath is the compiled module, e.g. /app/deploy/appserver/main.wasm.
+func (s *WasiServer) ModulePath() string {
+	return filepath.Join(s.appRootDir, s.outputDir, s.outName()+".wasm")
+}
+
+func (s *WasiServer) outName() string {
+	return strings.TrimSuffix(s.mainInputFile, filepath.Ext(s.mainInputFile))
+}
+
+// StartServer builds and starts the module and serves until the exit
+// channel closes. A failed build is logged and answered with 502 until a
+// save fixes it.
+func (s *WasiServer) StartServer(wg *sync.WaitGroup) {
+	if wg != nil {
+		defer wg.Done()
+	}
+	if s.gitIgnoreAdd != nil {
+		_ = s.gitIgnoreAdd(filepath.Join(s.outputDir, s.outName()+".wasm"))
+	}
+	if err := s.RestartServer(); err != nil {
+		s.logf("WASI:", err)
+	}
+
+	ln, err := net.Listen("tcp", ":"+s.port)
+	if err != nil {
+		s.logf("WASI server listen error:", err)
+		s.stopModule()
+		return
+	}
+	srv := &http.Server{Handler: s}
+	s.mu.Lock()
+	s.srv = srv
+	s.mu.Unlock()
+	s.logf("Starting WASI Server on port:", s.port)
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.logf("WASI server error:", err)
+		}
+	}()
+	s.openBrowserOnce.Do(func() {
+		if s.openBrowser != nil {
+			s.openBrowser(s.port, false)
+		}
+	})
+
+	if s.exitChan != nil {
+		<-s.exitChan
+	}
+	s.StopServer()
+}
+
+// StopServer closes the listener, letting requests in flight finish, and
+// then the module.
+func (s *WasiServer) StopServer() error {
+	s.mu.Lock()
+	srv := s.srv
+	s.srv = nil
+	s.mu.Unlock()
+	var err error
+	if srv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), wasiStopTimeout)
+		defer cancel()
+		err = srv.Shutdown(ctx)
+	}
+	s.stopModule()
+	return err
+}
+
+// RestartServer rebuilds the module and replaces the running instance once
+// one of the new build listens. A failed build or start keeps the running
+// instance.
+func (s *WasiServer) RestartServer() error {
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+	if err := s.compile(); err != nil {
+		return err
+	}
+	m, err := s.startModule()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	old := s.module
+	s.module = m
+	s.mu.Unlock()
+	if old != nil {
+		s.closeModule(old)
+	}
+	s.RefreshUI()
+	return nil
+}
+
+// NewFileEvent rebuilds the module when a Go file is written or created.
+func (s *WasiServer) NewFileEvent(fileName, extension, filePath, event string) error {
+	if event != "write" && event != "create" {
+		return nil
+	}
+	s.logf("Go file changed, rebuilding WASI module ...")
+	return s.RestartServer()
+}
+
+// UnobservedFiles returns the module and its temporary build output.
+func (s *WasiServer) UnobservedFiles() []string {
+	return []string{s.outName() + ".wasm", s.outName() + "_temp.wasm"}
+}
+
+func (s *WasiServer) SupportedExtensions() []string { return []string{".go"} }
+
+// MainInputFileRelativePath returns the server main relative to the root.
+func (s *WasiServer) MainInputFileRelativePath() string {
+	return filepath.Join(s.sourceDir, s.mainInputFile)
+}
+
+func (s *WasiServer) Name() string  { return "SERVER" }
+func (s *WasiServer) Label() string { return "WASI Module" }
+
+// Value shows the module state: running, build failed or stopped.
+func (s *WasiServer) Value() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.module != nil:
+		select {
+		case <-s.module.done:
+			return "stopped"
+		default:
+			return "running"
+		}
+	case s.buildErr != nil:
+		return "build failed"
+	}
+	return "stopped"
+}
+
+// Change rebuilds and restarts the module, whatever the value.
+func (s *WasiServer) Change(string) {
+	if err := s.RestartServer(); err != nil {
+		s.logf("WASI:", err)
+	}
+}
+
+func (s *WasiServer) RefreshUI() {
+	if s.ui != nil {
+		s.ui.RefreshUI()
+	}
+}
+
+// compile builds the server main package with GOOS=wasip1 GOARCH=wasm into a
+// temporary file, replacing the module only when the build succeeds.
+// Callers hold buildMu.
+func (s *WasiServer) compile() error {
+	out := s.ModulePath()
+	tmp := filepath.Join(filepath.Dir(out), s.outName()+"_temp.wasm")
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+	args := []string{"build"}
+	for _, a := range s.compileArgs() {
+		if a == "-race" {
+			s.logf("WASI: the race detector is not available on wasip1, building without -race")
+			continue
+		}
+		args = append(args, a)
+	}
+	args = append(args, "-o", tmp, "./"+filepath.ToSlash(filepath.Clean(s.sourceDir))) // the package, with every file of it
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = s.appRootDir
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		err = os.Rename(tmp, out)
+	} else {
+		os.Remove(tmp)
+		err = fmt.Errorf("WASI build failed: %w\n%s", err, strings.TrimSpace(string(output)))
+	}
+
+	s.mu.Lock()
+	s.buildErr = err
+	s.mu.Unlock()
+	return err
+}
+
+// startModule instantiates the built module with a listener on a free
+// loopback port and waits until it accepts connections.
+func (s *WasiServer) startModule() (*wasiModule, error) {
+	bin, err := os.ReadFile(s.ModulePath())
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	ln.Close() // wazero opens it again in the module
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = sock.WithConfig(ctx, sock.NewConfig().WithTCPListener(addr.IP.String(), addr.Port))
+	rt := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithCompilationCache(s.compilationCache()))
+	wasi_snapshot_preview1.MustInstantiate(ctx, rt)
+	compiled, err := rt.CompileModule(ctx, bin)
+	if err != nil {
+		rt.Close(ctx)
+		cancel()
+		return nil, fmt.Errorf("WASI module: %w", err)
+	}
+
+	out := serverOutput{s.logf}
+	config := wazero.NewModuleConfig().
+		WithArgs(append([]string{s.outName()}, s.runArgs()...)...).
+		WithEnv(WasiListenFDEnv, strconv.Itoa(wasiListenFD)).
+		WithFSConfig(wazero.NewFSConfig().WithDirMount(s.appRootDir, s.appRootDir)).
+		WithStdout(out).
+		WithStderr(out).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithNanosleep(wasiNanosleep).
+		WithRandSource(rand.Reader)
+	vars := s.env()
+	for _, name := range sortedKeys(vars) {
+		config = config.WithEnv(name, vars[name])
+	}
+
+	target := &url.URL{Scheme: "http", Host: addr.String()}
+	m := &wasiModule{cancel: cancel, done: make(chan struct{})}
+	m.proxy = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.Out.Host = r.In.Host
+		},
+		Transport: &http.Transport{ResponseHeaderTimeout: wasiRequestTimeout},
+		ModifyResponse: func(resp *http.Response) error {
+			if resp.StatusCode == http.StatusNotFound {
+				return errWasiNotFound
+			}
+			return nil
+		},
+	}
+	go func() {
+		_, err := rt.InstantiateModule(ctx, compiled, config)
+		rt.Close(context.Background())
+		var exit *sys.ExitError
+		if err == nil || errors.As(err, &exit) && exit.ExitCode() == 0 {
+			err = errors.New("module exited: serve HTTP on the listener of " + WasiListenFDEnv)
+		}
+		m.err = err
+		close(m.done)
+		if ctx.Err() == nil {
+			s.logf("WASI:", err)
+			s.RefreshUI()
+		}
+	}()
+
+	deadline := time.Now().Add(wasiStartTimeout)
+	for {
+		conn, err := net.DialTimeout("tcp", addr.String(), time.Second)
+		if err == nil {
+			conn.Close()
+			return m, nil
+		}
+		select {
+		case <-m.done:
+			s.closeModule(m)
+			return nil, m.err
+		default:
+		}
+		if time.Now().After(deadline) {
+			s.closeModule(m)
+			return nil, fmt.Errorf("WASI module not listening after %v", wasiStartTimeout)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// stopModule closes the running instance, if any.
+func (s *WasiServer) stopModule() {
+	s.mu.Lock()
+	m := s.module
+	s.module = nil
+	s.mu.Unlock()
+	if m != nil {
+		s.closeModule(m)
+	}
+}
+
+// closeModule ends the instance; its goroutine closes the runtime once the
+// guest returns, as closing it meanwhile races with the guest.
+func (s *WasiServer) closeModule(m *wasiModule) {
+	m.cancel()
+	select {
+	case <-m.done:
+	case <-time.After(wasiStopTimeout):
+		s.logf("WASI: module still running after", wasiStopTimeout)
+	}
+}
+
+// compilationCache keeps compiled modules in the temp dir, so a restart
+// only compiles what changed.
+func (s *WasiServer) compilationCache() wazero.CompilationCache {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cache == nil {
+		cache, err := wazero.NewCompilationCacheWithDir(filepath.Join(os.TempDir(), "wazero"))
+		if err != nil {
+			cache = wazero.NewCompilationCache()
+		}
+		s.cache = cache
+	}
+	return s.cache
+}
+
+// wasiNanosleep caps guest sleeps: wazero's poll_oneoff reports nonblocking
+// sockets ready at once and then sleeps out the whole timeout, which would
+// hold a pending request until the next guest timer.
+func wasiNanosleep(ns int64) {
+	time.Sleep(min(time.Duration(ns), wasiMaxSleep))
+}
+
+// hostMux builds the mux of the registered routes on first use.
+func (s *WasiServer) hostMux() *http.ServeMux {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mux == nil {
+		s.mux = http.NewServeMux()
+		for _, register := range s.routes {
+			register(s.mux)
+		}
+	}
+	return s.mux
+}
+
+// ServeHTTP serves the registered routes first, with their catch-alls
+// deferred, and passes what they leave unanswered to the module: the
+// request has no host route (a wrong method included) or the route's
+// handler answered 404. A module 404 gets the host catch-alls, e.g. the
+// index, and no other handler runs twice. Only the part of the body the
+// host read is kept for the module.
+func (s *WasiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mux := s.hostMux()
+	_, pattern := mux.Handler(r)
+	body := r.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	var read bytes.Buffer
+	if pattern != "" {
+		host := &notFoundWriter{ResponseWriter: w}
+		req := r.WithContext(withRoutePhase(r.Context(), phaseDeferCatchAlls))
+		req.Body = io.NopCloser(io.TeeReader(body, &read))
+		mux.ServeHTTP(host, req)
+		if !host.notFound {
+			return
+		}
+	}
+
+	fallback := func(err error) {
+		// Only the catch-alls are left: every other handler had its turn.
+		// Without a route the mux answers itself, e.g. a 405.
+		if pattern == "" || isCatchAll(pattern) {
+			last := &notFoundWriter{ResponseWriter: w}
+			req := r.Clone(withRoutePhase(r.Context(), phaseCatchAllsOnly))
+			req.Body = http.NoBody
+			mux.ServeHTTP(last, req)
+			if !last.notFound {
+				return
+			}
+		}
+		if errors.Is(err, errWasiNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "wasi: "+err.Error(), http.StatusBadGateway)
+	}
+	s.mu.Lock()
+	m, buildErr := s.module, s.buildErr
+	s.mu.Unlock()
+	if m == nil {
+		if buildErr == nil {
+			buildErr = errors.New("module not built yet")
+		}
+		fallback(buildErr)
+		return
+	}
+	select {
+	case <-m.done:
+		fallback(m.err)
+		return
+	default:
+	}
+	proxy := *m.proxy
+	proxy.ErrorHandler = func(w http.ResponseWriter, _ *http.Request, err error) { fallback(err) }
+	req := r.Clone(r.Context())
+	req.Body = io.NopCloser(io.MultiReader(&read, body))
+	proxy.ServeHTTP(w, req)
+}
+
+// notFoundWriter passes a response through unless it is a 404, which it
+// drops so another handler can answer. A handler that owns the request
+// keeps its 404 with keepNotFound.
+type notFoundWriter struct {
+	http.ResponseWriter
+	wrote    bool
+	notFound bool
+	keep     bool
+}
+
+func (w *notFoundWriter) WriteHeader(code int) {
+	if w.wrote {
+		return
+	}
+	w.wrote = true
+	if code == http.StatusNotFound && !w.keep {
+		w.notFound = true
+		for k := range w.Header() {
+			delete(w.Header(), k) // left for the next handler to set
+		}
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *notFoundWriter) Write(p []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.notFound {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController flush streamed responses.
+func (w *notFoundWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// keepNotFound makes the response written to w final, 404 included, so the
+// request does not go on to the server backend, e.g. for a proxy rule.
+func keepNotFound(w http.ResponseWriter) {
+	for {
+		if nf, ok := w.(*notFoundWriter); ok {
+			nf.keep = true
+			return
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = u.Unwrap()
+	}
+}
+
+// routePhaseKey marks the passes of a request over the host routes when a
+// server backend shares them, see WasiServer.ServeHTTP.
+type routePhaseKey struct{}
+
+type routePhase int
+
+const (
+	// phaseDeferCatchAlls is the first pass: the catch-alls answer 404 so
+	// the backend serves their requests first
+	phaseDeferCatchAlls routePhase = iota + 1
+	// phaseCatchAllsOnly follows a backend 404: only the catch-alls run,
+	// every other handler already had the request
+	phaseCatchAllsOnly
+)
+
+func withRoutePhase(ctx context.Context, phase routePhase) context.Context {
+	return context.WithValue(ctx, routePhaseKey{}, phase)
+}
+
+func routePhaseOf(r *http.Request) routePhase {
+	phase, _ := r.Context().Value(routePhaseKey{}).(routePhase)
+	return phase
+}
+
+// catchAllsDeferred reports whether r must skip the host catch-alls (the
+// index, the release app shell) and answer 404 instead.
+func catchAllsDeferred(r *http.Request) bool {
+	return routePhaseOf(r) == phaseDeferCatchAlls
+}
+
+// isCatchAll reports whether a mux pattern matches every path, "/" with or
+// without a method.
+func isCatchAll(pattern string) bool {
+	return pattern == "/" || strings.HasSuffix(pattern, " /")
+}
+
+// DeferCatchAll registers fn on a private mux mounted at "/". While
+// catchAllsDeferred, requests only its catch-all "/" matches, or no route
+// of the method, answer 404, so the backend serves them first. After the
+// backend's 404 only the catch-all runs.
+func DeferCatchAll(fn func(*http.ServeMux)) func(*http.ServeMux) {
+	return func(mux *http.ServeMux) {
+		inner := http.NewServeMux()
+		fn(inner)
+		mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, pattern := inner.Handler(r)
+			switch routePhaseOf(r) {
+			case phaseDeferCatchAlls:
+				if pattern == "" || isCatchAll(pattern) {
+					http.NotFound(w, r)
+					return
+				}
+			case phaseCatchAllsOnly:
+				if pattern != "" && !isCatchAll(pattern) {
+					http.NotFound(w, r)
+					return
+				}
+			}
+			inner.ServeHTTP(w, r)
+		}))
+	}
+}
+
+func (s *WasiServer) logf(message ...any) {
+	if s.log != nil {
+		s.log(message...)
+	}
+}
+
+// serverOutput forwards what the module prints to the log as it arrives,
+// like tinywasm/server does, so ServerProfile.Scan sees the raw chunks.
+type serverOutput struct{ log func(message ...any) }
+
+func (o serverOutput) Write(p []byte) (int, error) {
+	o.log(string(p))
+	return len(p), nil
+}
@@ -0,0 +1,198 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Project store keys for WASM size budgets, e.g. in .env:
+//
+//	TINYWASM_WASM_BUDGET=2MB
+//	TINYWASM_WASM_GZIP_BUDGET=600KB
+//	TINYWASM_WASM_PACKAGE_BUDGETS=runtime:1MB,github.com/acme/ui:80KB
+//
+// Package budgets use "pkg:size" pairs because the store forbids '=' in values.
+const (
+	StoreKeyWasmBudget         = "TINYWASM_WASM_BUDGET"
+	StoreKeyWasmGzipBudget     = "TINYWASM_WASM_GZIP_BUDGET"
+	StoreKeyWasmPackageBudgets = "TINYWASM_WASM_PACKAGE_BUDGETS"
+	StoreKeyWasmSizeHistory    = "wasm_size_history"
+)
+
+// wasmSizeHistoryMax bounds how many builds are kept in the store.
+const wasmSizeHistoryMax = 50
+
+// WasmBudget holds size limits in bytes; zero means no limit.
+type WasmBudget struct {
+	Total    int
+	Gzip     int
+	Packages map[string]int
+}
+
+// LoadWasmBudget reads the budget keys from db. Malformed values are
+// reported in the error; the remaining limits are still returned.
+func LoadWasmBudget(db DB) (WasmBudget, error) {
+	var b WasmBudget
+	if db == nil {
+		return b, nil
+	}
+	var errs []string
+	if v, _ := db.Get(StoreKeyWasmBudget); v != "" {
+		n, err := ParseSize(v)
+		if err != nil {
+			errs = append(errs, StoreKeyWasmBudget+": "+err.Error())
+		}
+		b.Total = n
+	}
+	if v, _ := db.Get(StoreKeyWasmGzipBudget); v != "" {
+		n, err := ParseSize(v)
+		if err != nil {
+			errs = append(errs, StoreKeyWasmGzipBudget+": "+err.Error())
+		}
+		b.Gzip = n
+	}
+	if v, _ := db.Get(StoreKeyWasmPackageBudgets); v != "" {
+		for _, pair := range strings.Split(v, ",") {
+			pkg, size, ok := strings.Cut(strings.TrimSpace(pair), ":")
+			n, err := ParseSize(size)
+			if !ok || pkg == "" || err != nil {
+				errs = append(errs, StoreKeyWasmPackageBudgets+": bad entry "+strconv.Quote(pair))
+				continue
+			}
+			if b.Packages == nil {
+				b.Packages = make(map[string]int)
+			}
+			b.Packages[pkg] = n
+		}
+	}
+	if len(errs) > 0 {
+		return b, fmt.Errorf("invalid wasm budget: %s", strings.Join(errs, "; "))
+	}
+	return b, nil
+}
+
+// ParseSize parses "512", "600KB", "1.5MB" (base 1024, case-insensitive).
+func ParseSize(s string) (int, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	mult := 1.0
+	for _, u := range []struct {
+		suffix string
+		mult   float64
+	}{{"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int(f * mult), nil
+}
+
+// Check lists every limit r exceeds, largest packages first.
+func (b WasmBudget) Check(r *WasmSizeReport) []string {
+	var out []string
+	if b.Total > 0 && r.Total > b.Total {
+		out = append(out, "total "+formatBytes(r.Total)+" exceeds budget "+formatBytes(b.Total))
+	}
+	if b.Gzip > 0 && r.Gzip > b.Gzip {
+		out = append(out, "gzip "+formatBytes(r.Gzip)+" exceeds budget "+formatBytes(b.Gzip))
+	}
+	for _, p := range r.Packages { // already sorted by size
+		if limit, ok := b.Packages[p.Package]; ok && p.Size > limit {
+			out = append(out, p.Package+" "+formatBytes(p.Size)+" exceeds budget "+formatBytes(limit))
+		}
+	}
+	return out
+}
+
+// WasmBudgetError is returned by WasmSizeHandler.Admit, and by Analyze in
+// strict mode, when the build exceeds its budget.
+type WasmBudgetError struct {
+	Violations []string
+}
+
+func (e *WasmBudgetError) Error() string {
+	return "wasm size budget exceeded: " + strings.Join(e.Violations, "; ")
+}
+
+// WasmSizeRecord is one build in the size history.
+type WasmSizeRecord struct {
+	Time       time.Time `json:"time"`
+	Mode       string    `json:"mode"`
+	Total      int       `json:"total"`
+	Gzip       int       `json:"gzip"`
+	Trigger    string    `json:"trigger,omitempty"` // file whose edit caused the build
+	OverBudget bool      `json:"over_budget,omitempty"`
+}
+
+// The history is a single store value: records separated by ';', fields by '|'.
+func encodeWasmSizeHistory(records []WasmSizeRecord) string {
+	clean := strings.NewReplacer(";", "_", "|", "_", "=", "_", "\n", " ")
+	parts := make([]string, len(records))
+	for i, r := range records {
+		over := "0"
+		if r.OverBudget {
+			over = "1"
+		}
+		parts[i] = strings.Join([]string{
+			strconv.FormatInt(r.Time.Unix(), 10),
+			clean.Replace(r.Mode),
+			strconv.Itoa(r.Total),
+			strconv.Itoa(r.Gzip),
+			clean.Replace(r.Trigger),
+			over,
+		}, "|")
+	}
+	return strings.Join(parts, ";")
+}
+
+func decodeWasmSizeHistory(s string) []WasmSizeRecord {
+	var out []WasmSizeRecord
+	for _, entry := range strings.Split(s, ";") {
+		f := strings.Split(entry, "|")
+		if len(f) != 6 {
+			continue // skip corrupt entries rather than losing the whole history
+		}
+		sec, err1 := strconv.ParseInt(f[0], 10, 64)
+		total, err2 := strconv.Atoi(f[2])
+		gz, err3 := strconv.Atoi(f[3])
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		out = append(out, WasmSizeRecord{
+			Time:       time.Unix(sec, 0),
+			Mode:       f[1],
+			Total:      total,
+			Gzip:       gz,
+			Trigger:    f[4],
+			OverBudget: f[5] == "1",
+		})
+	}
+	return out
+}
+
+// WasmSizeHistory returns the recorded builds, oldest first.
+func WasmSizeHistory(db DB) []WasmSizeRecord {
+	if db == nil {
+		return nil
+	}
+	v, err := db.Get(StoreKeyWasmSizeHistory)
+	if err != nil || v == "" {
+		return nil
+	}
+	return decodeWasmSizeHistory(v)
+}
+
+// appendWasmSizeHistory stores rec, keeping the newest wasmSizeHistoryMax builds.
+func appendWasmSizeHistory(db DB, rec WasmSizeRecord) error {
+	records := append(WasmSizeHistory(db), rec)
+	if len(records) > wasmSizeHistoryMax {
+		records = records[len(records)-wasmSizeHistoryMax:]
+	}
+	return db.Set(StoreKeyWasmSizeHistory, encodeWasmSizeHistory(records))
+}
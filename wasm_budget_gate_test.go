@@ -0,0 +1,52 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/tinywasm/client"
+)
+
+func TestGateWasm_RejectedBuildIsRolledBack(t *testing.T) {
+	dir := t.TempDir()
+	wasm := client.New(&client.Config{
+		SourceDir: func() string { return "web" },
+		OutputDir: func() string { return "public" },
+	})
+	wasm.SetAppRootDir(dir)
+	if err := os.MkdirAll(dir+"/public", 0755); err != nil {
+		t.Fatal(err)
+	}
+	out := wasm.MainOutputFileAbsolutePath()
+	if err := os.WriteFile(out, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{WasmClient: wasm}
+	h.wasmOnDisk.Store(true)
+
+	next := []byte("big")
+	build := func() error { return os.WriteFile(out, next, 0644) }
+	budgetErr := &WasmBudgetError{Violations: []string{"total over"}}
+	admit := func(data []byte) error {
+		if string(data) == "big" {
+			return budgetErr
+		}
+		return nil
+	}
+
+	if err := h.gateWasm(build, admit); !errors.Is(err, budgetErr) {
+		t.Fatalf("gateWasm() = %v, want the budget error", err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "old" {
+		t.Errorf("served build = %q, want the previous one", data)
+	}
+
+	next = []byte("small")
+	if err := h.gateWasm(build, admit); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "small" {
+		t.Errorf("served build = %q", data)
+	}
+}
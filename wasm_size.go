@@ -0,0 +1,380 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WasmSizeReport describes where the bytes of a compiled .wasm go.
+// It is the JSON returned by app_wasm_size_report and `tinywasm -wasm-size`.
+type WasmSizeReport struct {
+	File      string            `json:"file,omitempty"`
+	Mode      string            `json:"mode,omitempty"` // WasmClient size mode (L/M/S)
+	Total     int               `json:"total"`
+	Gzip      int               `json:"gzip"`
+	Previous  int               `json:"previous,omitempty"` // Total of the previous build
+	Delta     int               `json:"delta"`              // Total - Previous
+	Functions int               `json:"functions"`
+	Named     bool              `json:"named"` // false when the name section was stripped
+	Sections  []WasmSectionSize `json:"sections"`
+	Packages  []WasmPackageSize `json:"packages"` // largest first
+	Time      string            `json:"time"`
+
+	Trigger    string   `json:"trigger,omitempty"`    // edited file that caused the build
+	Violations []string `json:"violations,omitempty"` // exceeded budgets, see WasmBudget
+}
+
+// WasmSectionSize is the size of one wasm section, payload included.
+type WasmSectionSize struct {
+	Name string `json:"name"` // "code", "data", ... or "custom:<name>"
+	Size int    `json:"size"`
+}
+
+// WasmPackageSize is the code attributed to one Go package via the name section.
+type WasmPackageSize struct {
+	Package   string `json:"package"`
+	Size      int    `json:"size"`
+	Functions int    `json:"functions"`
+}
+
+// wasmSectionNames indexes standard section ids.
+var wasmSectionNames = [...]string{
+	"custom", "type", "import", "function", "table", "memory", "global",
+	"export", "start", "element", "code", "data", "datacount",
+}
+
+// Package buckets for functions that don't map to a Go package.
+const (
+	wasmPkgUnnamed = "(unnamed)" // binary has no name section
+	wasmPkgOther   = "(other)"   // assembly stubs, C runtime and linker helpers
+	wasmPkgData    = "(data)"    // data section, not attributable per package
+)
+
+// AnalyzeWasmFile reads and analyzes the .wasm at path.
+func AnalyzeWasmFile(path string) (*WasmSizeReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := AnalyzeWasm(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r.File = path
+	return r, nil
+}
+
+// AnalyzeWasm breaks a wasm binary down by section and, when the name section
+// is present, attributes each function body to the Go package it belongs to.
+func AnalyzeWasm(data []byte) (*WasmSizeReport, error) {
+	if len(data) < 8 || string(data[:4]) != "\x00asm" {
+		return nil, errors.New("not a wasm binary")
+	}
+	r := &WasmSizeReport{
+		Total: len(data),
+		Gzip:  gzipSize(data),
+		Time:  time.Now().Format(time.RFC3339),
+	}
+
+	var (
+		imported int   // imported functions come first in the function index space
+		bodies   []int // code section body sizes, by defined function
+		names    map[int]string
+		dataSize int
+		p        = wasmReader{b: data, off: 8}
+	)
+	for p.off < len(data) {
+		start := p.off
+		id, err := p.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := p.uleb()
+		if err != nil {
+			return nil, err
+		}
+		end, err := p.span(size)
+		if err != nil {
+			return nil, fmt.Errorf("section %d overruns the binary", id)
+		}
+		sec := wasmReader{b: data[:end], off: p.off}
+
+		name := fmt.Sprintf("unknown:%d", id)
+		if int(id) < len(wasmSectionNames) {
+			name = wasmSectionNames[id]
+		}
+		switch id {
+		case 0:
+			custom, err := sec.name()
+			if err != nil {
+				return nil, err
+			}
+			name = "custom:" + custom
+			if custom == "name" {
+				names = sec.functionNames()
+			}
+		case 2:
+			imported = sec.importedFunctions()
+		case 10:
+			bodies = sec.bodySizes()
+		case 11:
+			dataSize = end - start
+		}
+		r.Sections = append(r.Sections, WasmSectionSize{Name: name, Size: end - start})
+		p.off = end
+	}
+
+	r.Functions = len(bodies)
+	r.Named = len(names) > 0
+	pkgs := map[string]*WasmPackageSize{}
+	for i, size := range bodies {
+		pkg := wasmPkgUnnamed
+		if r.Named {
+			pkg = goPackageOf(names[imported+i])
+		}
+		ps := pkgs[pkg]
+		if ps == nil {
+			ps = &WasmPackageSize{Package: pkg}
+			pkgs[pkg] = ps
+		}
+		ps.Size += size
+		ps.Functions++
+	}
+	if dataSize > 0 {
+		pkgs[wasmPkgData] = &WasmPackageSize{Package: wasmPkgData, Size: dataSize}
+	}
+	for _, ps := range pkgs {
+		r.Packages = append(r.Packages, *ps)
+	}
+	sort.Slice(r.Packages, func(i, j int) bool {
+		if r.Packages[i].Size != r.Packages[j].Size {
+			return r.Packages[i].Size > r.Packages[j].Size
+		}
+		return r.Packages[i].Package < r.Packages[j].Package
+	})
+	return r, nil
+}
+
+// goPackageOf returns the import path of a function name from the name section.
+// TinyGo keeps real paths ("(*internal/task.Task).Resume"); the Go linker
+// replaces '/' and other punctuation with '_' ("syscall_js.Value.Get",
+// "github.com_a_b.__T_.M"), which is reversed here.
+func goPackageOf(sym string) string {
+	s := strings.TrimPrefix(strings.TrimPrefix(sym, "("), "*")
+	if i := strings.IndexByte(s, '['); i >= 0 { // generic instantiation
+		s = s[:i]
+	}
+	if strings.HasPrefix(s, "type:") || strings.HasPrefix(s, "type_.") || strings.HasPrefix(s, "go:") {
+		return wasmPkgOther
+	}
+	if slash := strings.LastIndexByte(s, '/'); slash >= 0 {
+		if dot := strings.IndexByte(s[slash+1:], '.'); dot > 0 {
+			return s[:slash+1+dot]
+		}
+		return wasmPkgOther
+	}
+
+	dot := strings.IndexByte(s, '.')
+	if dot <= 0 {
+		return wasmPkgOther
+	}
+	// A leading domain ("github.com_...") holds the only dots of the path
+	if under := strings.IndexByte(s, '_'); under > dot && isDomain(s[:under]) {
+		next := strings.IndexByte(s[under:], '.')
+		if next < 0 {
+			return wasmPkgOther
+		}
+		dot = under + next
+	}
+	return strings.ReplaceAll(s[:dot], "_", "/")
+}
+
+// isDomain reports whether s looks like the host part of an import path.
+func isDomain(s string) bool {
+	switch s[strings.LastIndexByte(s, '.')+1:] {
+	case "com", "org", "net", "io", "in", "dev", "me", "co", "cc", "app", "sh", "xyz":
+		return true
+	}
+	return false
+}
+
+// gzipSize returns the size of data gzipped at the level the dev server uses.
+func gzipSize(data []byte) int {
+	return len(gzipBytes(data))
+}
+
+// wasmReader decodes the few wasm constructs the size report needs.
+type wasmReader struct {
+	b   []byte
+	off int
+}
+
+var errWasmTruncated = errors.New("truncated wasm binary")
+
+func (r *wasmReader) byte() (byte, error) {
+	if r.off >= len(r.b) {
+		return 0, errWasmTruncated
+	}
+	r.off++
+	return r.b[r.off-1], nil
+}
+
+func (r *wasmReader) uleb() (uint64, error) {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		c, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("malformed LEB128")
+}
+
+func (r *wasmReader) name() (string, error) {
+	n, err := r.uleb()
+	if err != nil {
+		return "", err
+	}
+	end, err := r.span(n)
+	if err != nil {
+		return "", err
+	}
+	s := string(r.b[r.off:end])
+	r.off = end
+	return s, nil
+}
+
+// span returns the offset n bytes ahead, or errWasmTruncated past the end
+// of the reader. n comes from the binary, so it is checked before any
+// conversion to int can overflow.
+func (r *wasmReader) span(n uint64) (int, error) {
+	if n > uint64(len(r.b)-r.off) {
+		return 0, errWasmTruncated
+	}
+	return r.off + int(n), nil
+}
+
+// skip advances n bytes.
+func (r *wasmReader) skip(n uint64) error {
+	end, err := r.span(n)
+	if err != nil {
+		return err
+	}
+	r.off = end
+	return nil
+}
+
+// bodySizes returns the size of every function body in a code section.
+func (r *wasmReader) bodySizes() []int {
+	count, err := r.uleb()
+	if err != nil {
+		return nil
+	}
+	sizes := make([]int, 0, min(count, uint64(len(r.b))))
+	for i := uint64(0); i < count; i++ {
+		start := r.off
+		n, err := r.uleb()
+		if err != nil {
+			break
+		}
+		if r.skip(n) != nil {
+			break
+		}
+		sizes = append(sizes, r.off-start)
+	}
+	return sizes
+}
+
+// importedFunctions counts function imports in an import section.
+func (r *wasmReader) importedFunctions() int {
+	count, err := r.uleb()
+	if err != nil {
+		return 0
+	}
+	funcs := 0
+	for i := uint64(0); i < count; i++ {
+		if _, err := r.name(); err != nil { // module
+			break
+		}
+		if _, err := r.name(); err != nil { // field
+			break
+		}
+		kind, err := r.byte()
+		if err != nil {
+			break
+		}
+		switch kind {
+		case 0: // func: type index
+			funcs++
+			r.uleb()
+		case 1: // table: reftype + limits
+			r.byte()
+			r.limits()
+		case 2: // memory: limits
+			r.limits()
+		case 3: // global: valtype + mutability
+			r.byte()
+			r.byte()
+		case 4: // tag: attribute + type index
+			r.byte()
+			r.uleb()
+		default:
+			return funcs
+		}
+	}
+	return funcs
+}
+
+func (r *wasmReader) limits() {
+	flags, _ := r.byte()
+	r.uleb()
+	if flags&1 != 0 {
+		r.uleb()
+	}
+}
+
+// functionNames decodes the function-names subsection of a "name" section.
+func (r *wasmReader) functionNames() map[int]string {
+	names := map[int]string{}
+	for r.off < len(r.b) {
+		id, err := r.byte()
+		if err != nil {
+			break
+		}
+		size, err := r.uleb()
+		if err != nil {
+			break
+		}
+		if id != 1 {
+			if r.skip(size) != nil {
+				break
+			}
+			continue
+		}
+		count, err := r.uleb()
+		if err != nil {
+			break
+		}
+		for i := uint64(0); i < count; i++ {
+			idx, err := r.uleb()
+			if err != nil {
+				return names
+			}
+			name, err := r.name()
+			if err != nil {
+				return names
+			}
+			names[int(idx)] = name
+		}
+		break
+	}
+	return names
+}
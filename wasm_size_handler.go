@@ -0,0 +1,310 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WasmSizeHandler shows the size of the latest WASM build in the BUILD tab
+// and keeps its report for the app_wasm_size_report tool. With a store set it
+// also checks the project's size budgets and records every build in the history.
+type WasmSizeHandler struct {
+	run     sync.Mutex // one analysis at a time so deltas compare consecutive builds
+	mu      sync.Mutex
+	queued  bool // an analysis goroutine is running
+	pending bool // a build finished while it ran
+	last    *WasmSizeReport
+	log     func(message ...any)
+	source  func() ([]byte, string, error) // wasm bytes and size mode of the latest build
+	db      DB
+	strict  bool   // budget violations fail the build instead of warning
+	trigger string // last edited file, consumed by the next analysis
+}
+
+// NewWasmSizeHandler creates a handler that analyzes the bytes returned by source.
+func NewWasmSizeHandler(source func() ([]byte, string, error)) *WasmSizeHandler {
+	return &WasmSizeHandler{source: source}
+}
+
+func (w *WasmSizeHandler) Name() string  { return "WasmSize" }
+func (w *WasmSizeHandler) Label() string { return "Wasm Size" }
+
+// Value summarizes the latest report, e.g. "1.7 MB · gz 517 KB (+2.1 KB)".
+func (w *WasmSizeHandler) Value() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.last == nil {
+		return "-"
+	}
+	if len(w.last.Violations) > 0 {
+		return w.last.Summary() + " ⚠ over budget"
+	}
+	return w.last.Summary()
+}
+
+func (w *WasmSizeHandler) SetLog(f func(message ...any)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.log = f
+}
+
+// SetStore enables budgets and size history, both kept in db.
+// In strict mode (headless builds) Analyze fails when a budget is exceeded.
+func (w *WasmSizeHandler) SetStore(db DB, strict bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.db, w.strict = db, strict
+}
+
+// NoteEdit records the file whose change triggers the next build.
+func (w *WasmSizeHandler) NoteEdit(file string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.trigger = file
+}
+
+// History returns the recorded builds, oldest first.
+func (w *WasmSizeHandler) History() []WasmSizeRecord {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return WasmSizeHistory(w.db)
+}
+
+// Report returns the latest report, or nil before the first analysis.
+func (w *WasmSizeHandler) Report() *WasmSizeReport {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.last
+}
+
+// Analyze reports on the current build and compares it with the previous one.
+// Called after every successful WasmClient compile. In strict mode a build over
+// budget returns the report together with a *WasmBudgetError.
+func (w *WasmSizeHandler) Analyze() (*WasmSizeReport, error) {
+	w.run.Lock()
+	defer w.run.Unlock()
+
+	// Take the trigger with the bytes: an edit made while this build is
+	// being analyzed belongs to the next one.
+	w.mu.Lock()
+	db, strict, trigger := w.db, w.strict, w.trigger
+	w.trigger = ""
+	w.mu.Unlock()
+
+	data, mode, err := w.source()
+	if err != nil {
+		return nil, err
+	}
+	r, err := AnalyzeWasm(data)
+	if err != nil {
+		return nil, err
+	}
+	r.Mode, r.Trigger = mode, trigger
+
+	budget, budgetErr := LoadWasmBudget(db)
+	r.Violations = budget.Check(r)
+
+	w.mu.Lock()
+	if w.last != nil {
+		r.Previous = w.last.Total
+		r.Delta = r.Total - r.Previous
+	}
+	w.last = r
+	log := w.log
+	w.mu.Unlock()
+
+	var histErr error
+	if db != nil {
+		histErr = appendWasmSizeHistory(db, WasmSizeRecord{
+			Time:       time.Now(),
+			Mode:       r.Mode,
+			Total:      r.Total,
+			Gzip:       r.Gzip,
+			Trigger:    r.Trigger,
+			OverBudget: len(r.Violations) > 0,
+		})
+	}
+
+	if log != nil {
+		log(r.Summary() + " — top: " + r.topPackages(3))
+		if budgetErr != nil {
+			log("Warning:", budgetErr)
+		}
+		if histErr != nil {
+			log("Warning: size history not saved:", histErr)
+		}
+		if len(r.Violations) > 0 && !strict {
+			log("Warning: wasm size budget exceeded: " + strings.Join(r.Violations, "; "))
+		}
+	}
+	if len(r.Violations) > 0 && strict {
+		return r, &WasmBudgetError{Violations: r.Violations}
+	}
+	return r, nil
+}
+
+// Admit checks a freshly compiled build against the budgets before it is
+// served and returns a *WasmBudgetError when it exceeds them. Headless
+// builds are gated on it; a module it cannot measure or unreadable budgets
+// are left to Analyze to report.
+func (w *WasmSizeHandler) Admit(data []byte) error {
+	w.mu.Lock()
+	db := w.db
+	w.mu.Unlock()
+
+	r, err := AnalyzeWasm(data)
+	if err != nil {
+		return nil
+	}
+	budget, err := LoadWasmBudget(db)
+	if err != nil {
+		return nil
+	}
+	if v := budget.Check(r); len(v) > 0 {
+		return &WasmBudgetError{Violations: v}
+	}
+	return nil
+}
+
+// Queue runs analyze in the background after a build. Queued analyses run
+// one after another in build order; builds finished while one runs are
+// covered by a single follow-up, so each delta compares the build analyzed
+// before it rather than whichever goroutine happened to win.
+func (w *WasmSizeHandler) Queue(analyze func()) {
+	w.mu.Lock()
+	if w.queued {
+		w.pending = true
+		w.mu.Unlock()
+		return
+	}
+	w.queued = true
+	w.mu.Unlock()
+
+	go func() {
+		for {
+			analyze()
+			w.mu.Lock()
+			if !w.pending {
+				w.queued = false
+				w.mu.Unlock()
+				return
+			}
+			w.pending = false
+			w.mu.Unlock()
+		}
+	}()
+}
+
+// Summary is the one-line form shown in the BUILD tab.
+func (r *WasmSizeReport) Summary() string {
+	s := formatBytes(r.Total) + " · gz " + formatBytes(r.Gzip)
+	if r.Previous > 0 {
+		sign := "+"
+		if r.Delta < 0 {
+			sign = "-"
+		}
+		s += " (" + sign + formatBytes(abs(r.Delta)) + ")"
+	}
+	return s
+}
+
+// topPackages lists the n largest packages as "pkg size" pairs.
+func (r *WasmSizeReport) topPackages(n int) string {
+	var parts []string
+	for i, p := range r.Packages {
+		if i == n {
+			break
+		}
+		parts = append(parts, p.Package+" "+formatBytes(p.Size))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatBytes renders n in B, KB or MB (base 1024).
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// errNoWasmBuild is returned by wasmOutput before the first build exists,
+// e.g. while external mode has not written the output file yet.
+var errNoWasmBuild = errors.New("no wasm build yet")
+
+// wasmOutput returns the latest WASM build from whichever storage the client
+// uses, along with its size mode.
+func (h *Handler) wasmOutput() ([]byte, string, error) {
+	mode := h.WasmClient.Value()
+	if data, ok := h.wasmRestored.get(); ok && !h.wasmOnDisk.Load() {
+		if len(data) == 0 {
+			return nil, mode, errNoWasmBuild
+		}
+		return data, mode, nil
+	}
+	if ms := h.wasmMemory; ms != nil && !h.wasmOnDisk.Load() {
+		ms.Mu.RLock()
+		defer ms.Mu.RUnlock()
+		if len(ms.WasmContent) == 0 {
+			return nil, mode, errNoWasmBuild
+		}
+		return ms.WasmContent, mode, nil // replaced on each compile, never mutated
+	}
+	data, err := os.ReadFile(h.WasmClient.MainOutputFileAbsolutePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, mode, errNoWasmBuild
+	}
+	return data, mode, err
+}
+
+// analyzeWasmSize queues a refresh of the size report and the client import
+// audit after a successful compile. It returns at once: gzipping the binary
+// must not delay reloads.
+func (h *Handler) analyzeWasmSize() {
+	if h.WasmSize == nil {
+		return
+	}
+	h.WasmSize.Queue(h.runWasmSizeAnalysis)
+}
+
+// admitWasm gates a new build on the size budgets (headless mode).
+func (h *Handler) admitWasm(data []byte) error {
+	if h.WasmSize == nil {
+		return nil
+	}
+	return h.WasmSize.Admit(data)
+}
+
+func (h *Handler) runWasmSizeAnalysis() {
+	report, err := h.WasmSize.Analyze()
+	var budgetErr *WasmBudgetError
+	switch {
+	case errors.Is(err, errNoWasmBuild):
+		return // nothing built yet; the first compile queues another analysis
+	case errors.As(err, &budgetErr):
+		// Headless builds over budget are rejected by admitWasm before they
+		// are served; this only sees a budget tightened since the build.
+		h.WasmClient.Logger("Warning:", err)
+	case err != nil:
+		h.WasmClient.Logger("Wasm size analysis failed:", err)
+	}
+	if h.Imports != nil {
+		if _, err := h.Imports.Audit(report); err != nil {
+			h.WasmClient.Logger("Client import audit failed:", err)
+		}
+	}
+}